@@ -0,0 +1,907 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/pkg/errors"
+)
+
+// Binlog event types swoof reads. The rest are skipped.
+const (
+	binlogQuery          = 2
+	binlogRotate         = 4
+	binlogFormat         = 15
+	binlogXID            = 16
+	binlogTableMap       = 19
+	binlogWriteRowsV1    = 23
+	binlogUpdateRowsV1   = 24
+	binlogDeleteRowsV1   = 25
+	binlogHeartbeat      = 27
+	binlogWriteRows      = 30
+	binlogUpdateRows     = 31
+	binlogDeleteRows     = 32
+	binlogPartialUpdate  = 39
+	binlogHeartbeatV2    = 41
+	mariadbWriteRowsZip  = 169
+	mariadbUpdateRowsZip = 170
+	mariadbDeleteRowsZip = 171
+)
+
+// Column types as a table map gives them.
+const (
+	typeTiny       = 1
+	typeShort      = 2
+	typeLong       = 3
+	typeFloat      = 4
+	typeDouble     = 5
+	typeTimestamp  = 7
+	typeLongLong   = 8
+	typeInt24      = 9
+	typeDate       = 10
+	typeTime       = 11
+	typeDatetime   = 12
+	typeYear       = 13
+	typeVarchar    = 15
+	typeBit        = 16
+	typeTimestamp2 = 17
+	typeDatetime2  = 18
+	typeTime2      = 19
+	typeJSON       = 245
+	typeNewDecimal = 246
+	typeEnum       = 247
+	typeSet        = 248
+	typeBlob       = 252
+	typeVarString  = 253
+	typeString     = 254
+	typeGeometry   = 255
+)
+
+// How often the source sends a heartbeat when it has nothing else to, so
+// a quiet stream still shows it's caught up, and a dead one is noticed.
+const binlogHeartbeatPeriod = time.Second
+
+var binlogDialSeq atomic.Int64
+
+// binlogReader streams a source's binary log the way a replica does. It
+// connects through go-sql-driver, so every DSN and auth option works the
+// same as for the copy, then takes over the connection underneath it to
+// ask for the binlog, which the driver has no command for.
+type binlogReader struct {
+	db   *sql.DB
+	conn *sql.Conn
+	raw  net.Conn
+	r    *bufio.Reader
+
+	// Where the next event starts.
+	file string
+	pos  uint64
+
+	// Whether events end in a CRC32, as the current file's format says.
+	checksum  bool
+	sawFormat bool
+}
+
+type binlogEvent struct {
+	timestamp uint32
+	typ       byte
+	logPos    uint32
+	body      []byte
+}
+
+// openBinlogReader starts reading the binlog at file and pos, as a replica
+// with serverID, which has to differ from every other replica's.
+func openBinlogReader(ctx context.Context, dsn string, serverID uint32, file string, pos uint64) (*binlogReader, error) {
+	cfg, err := mysqldriver.ParseDSN(dsn)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse source DSN")
+	}
+	if cfg.TLS != nil {
+		return nil, errors.New("reading the binlog isn't supported over TLS")
+	}
+	if strings.Contains(cfg.FormatDSN(), "compress=") {
+		return nil, errors.New("reading the binlog isn't supported with compression")
+	}
+	if pos > math.MaxUint32 {
+		return nil, errors.Errorf("binlog position %d is past what a replica can ask for", pos)
+	}
+
+	r := &binlogReader{file: file, pos: pos}
+	network := cfg.Net
+	cfg.Net = "swoof-binlog-" + strconv.FormatInt(binlogDialSeq.Add(1), 10)
+	mysqldriver.RegisterDialContext(cfg.Net, func(ctx context.Context, addr string) (net.Conn, error) {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, network, addr)
+		r.raw = conn
+		return conn, err
+	})
+	connector, err := mysqldriver.NewConnector(cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "create binlog connector")
+	}
+	r.db = sql.OpenDB(connector)
+	r.db.SetMaxOpenConns(1)
+	if r.conn, err = r.db.Conn(ctx); err != nil {
+		r.db.Close()
+		return nil, errors.Wrap(err, "connect for binlog")
+	}
+
+	for _, q := range []string{
+		// MySQL 8.0.26 renamed these for replicas; older servers and
+		// MariaDB read the first.
+		"set@master_binlog_checksum=@@global.binlog_checksum",
+		"set@source_binlog_checksum=@@global.binlog_checksum",
+		"set@master_heartbeat_period=" + strconv.FormatInt(binlogHeartbeatPeriod.Nanoseconds(), 10),
+		"set@source_heartbeat_period=" + strconv.FormatInt(binlogHeartbeatPeriod.Nanoseconds(), 10),
+		// Lets MariaDB send its GTID events rather than dummies.
+		"set@mariadb_slave_capability=4",
+	} {
+		if _, err := r.conn.ExecContext(ctx, q); err != nil {
+			r.Close()
+			return nil, errors.Wrap(err, "set up binlog connection")
+		}
+	}
+
+	// COM_BINLOG_DUMP, as the first packet of a new command.
+	dump := make([]byte, 11, 11+len(file))
+	dump[0] = 0x12
+	binary.LittleEndian.PutUint32(dump[1:], uint32(pos))
+	binary.LittleEndian.PutUint32(dump[7:], serverID)
+	dump = append(dump, file...)
+	r.raw.SetDeadline(time.Time{})
+	if err := writePacket(r.raw, dump); err != nil {
+		r.Close()
+		return nil, errors.Wrap(err, "ask for binlog")
+	}
+	r.r = bufio.NewReaderSize(r.raw, 64<<10)
+	return r, nil
+}
+
+// Close ends the stream. The driver's connection is closed after its
+// socket, so it doesn't write a quit into the middle of the binlog.
+func (r *binlogReader) Close() error {
+	if r.raw != nil {
+		r.raw.Close()
+	}
+	if r.conn != nil {
+		r.conn.Close()
+	}
+	return r.db.Close()
+}
+
+func writePacket(w io.Writer, payload []byte) error {
+	header := []byte{byte(len(payload)), byte(len(payload) >> 8), byte(len(payload) >> 16), 0}
+	_, err := w.Write(append(header, payload...))
+	return err
+}
+
+// readPacket reads a whole packet, joining the pieces of one over 16MB.
+func (r *binlogReader) readPacket() ([]byte, error) {
+	var payload []byte
+	for {
+		var header [4]byte
+		if _, err := io.ReadFull(r.r, header[:]); err != nil {
+			return nil, err
+		}
+		n := int(header[0]) | int(header[1])<<8 | int(header[2])<<16
+		start := len(payload)
+		payload = append(payload, make([]byte, n)...)
+		if _, err := io.ReadFull(r.r, payload[start:]); err != nil {
+			return nil, err
+		}
+		if n < 0xffffff {
+			return payload, nil
+		}
+	}
+}
+
+// next reads the next event, keeping track of the file and position, and
+// of whether events carry checksums. A quiet source still sends heartbeats,
+// so a read that waits past a few of them means the connection is gone.
+func (r *binlogReader) next() (binlogEvent, error) {
+	for {
+		r.raw.SetReadDeadline(time.Now().Add(10 * binlogHeartbeatPeriod))
+		p, err := r.readPacket()
+		if err != nil {
+			return binlogEvent{}, errors.Wrap(err, "read binlog")
+		}
+		switch {
+		case len(p) == 0:
+			return binlogEvent{}, errors.New("read binlog: empty packet")
+		case p[0] == 0xff:
+			return binlogEvent{}, errors.Wrap(parseErrorPacket(p), "read binlog")
+		case p[0] == 0xfe && len(p) < 9:
+			return binlogEvent{}, errors.Wrap(io.EOF, "source ended the binlog stream")
+		}
+		p = p[1:]
+		if len(p) < 19 {
+			return binlogEvent{}, errors.New("read binlog: short event header")
+		}
+		ev := binlogEvent{
+			timestamp: binary.LittleEndian.Uint32(p),
+			typ:       p[4],
+			logPos:    binary.LittleEndian.Uint32(p[13:]),
+			body:      p[19:],
+		}
+		artificial := binary.LittleEndian.Uint16(p[17:])&0x20 != 0
+
+		if ev.typ == binlogFormat {
+			// The algorithm is the fifth to last byte, then the checksum's
+			// room, whether or not it's used.
+			if len(ev.body) < 5 {
+				return binlogEvent{}, errors.New("read binlog: short format description")
+			}
+			r.checksum = ev.body[len(ev.body)-5] == 1
+			r.sawFormat = true
+			continue
+		}
+		if !r.sawFormat && ev.typ == binlogRotate && len(ev.body) >= 12 {
+			// The rotate sent ahead of the first format description names
+			// the file asked for, with or without a checksum after it.
+			r.checksum = string(ev.body[8:]) != r.file && string(ev.body[8:len(ev.body)-4]) == r.file
+		}
+		if r.checksum {
+			if len(ev.body) < 4 {
+				return binlogEvent{}, errors.New("read binlog: short event")
+			}
+			ev.body = ev.body[:len(ev.body)-4]
+		}
+		if ev.typ == binlogRotate {
+			if len(ev.body) < 8 {
+				return binlogEvent{}, errors.New("read binlog: short rotate")
+			}
+			r.file = string(ev.body[8:])
+			r.pos = binary.LittleEndian.Uint64(ev.body)
+			continue
+		}
+		if !artificial && ev.logPos != 0 {
+			r.pos = uint64(ev.logPos)
+		}
+		return ev, nil
+	}
+}
+
+func parseErrorPacket(p []byte) error {
+	if len(p) < 3 {
+		return errors.New("malformed error packet")
+	}
+	err := &mysqldriver.MySQLError{Number: binary.LittleEndian.Uint16(p[1:])}
+	msg := p[3:]
+	if len(msg) >= 6 && msg[0] == '#' {
+		copy(err.SQLState[:], msg[1:6])
+		msg = msg[6:]
+	}
+	err.Message = string(msg)
+	return err
+}
+
+// binlogTable is a TABLE_MAP event: the table a following rows event
+// changes, and how its columns are stored.
+type binlogTable struct {
+	id     uint64
+	schema string
+	name   string
+	types  []byte
+	meta   []uint16
+}
+
+func parseTableMap(b []byte) (binlogTable, error) {
+	var t binlogTable
+	d := binlogDecoder{b: b}
+	t.id = d.uint(6)
+	d.skip(2)
+	t.schema = string(d.bytes(int(d.uint(1))))
+	d.skip(1)
+	t.name = string(d.bytes(int(d.uint(1))))
+	d.skip(1)
+	n := int(d.lenenc())
+	t.types = d.bytes(n)
+	metaLen := int(d.lenenc())
+	meta := binlogDecoder{b: d.bytes(metaLen)}
+	if d.err != nil {
+		return t, errors.Wrap(d.err, "parse table map")
+	}
+	t.meta = make([]uint16, n)
+	for i, typ := range t.types {
+		switch typ {
+		case typeFloat, typeDouble, typeBlob, typeGeometry, typeJSON,
+			typeTimestamp2, typeDatetime2, typeTime2:
+			t.meta[i] = uint16(meta.uint(1))
+		case typeVarchar, typeVarString:
+			t.meta[i] = uint16(meta.uint(2))
+		case typeBit, typeNewDecimal, typeString, typeEnum, typeSet:
+			// Two single bytes: bits and bytes, precision and scale, or the
+			// real type and length.
+			hi := meta.uint(1)
+			t.meta[i] = uint16(hi<<8 | meta.uint(1))
+		}
+	}
+	return t, errors.Wrapf(meta.err, "parse table map of %q", t.name)
+}
+
+// binlogRows is a rows event: the images of every row it changes. Updates
+// come as before and after pairs.
+type binlogRows struct {
+	tableID uint64
+	present []bool
+	after   []bool
+	data    []byte
+}
+
+func parseRows(typ byte, b []byte) (binlogRows, error) {
+	var r binlogRows
+	d := binlogDecoder{b: b}
+	r.tableID = d.uint(6)
+	d.skip(2)
+	if typ == binlogWriteRows || typ == binlogUpdateRows || typ == binlogDeleteRows {
+		// Extra data, its length counting itself.
+		d.skip(int(d.uint(2)) - 2)
+	}
+	n := int(d.lenenc())
+	r.present = bitmap(d.bytes((n+7)/8), n)
+	if typ == binlogUpdateRows || typ == binlogUpdateRowsV1 {
+		r.after = bitmap(d.bytes((n+7)/8), n)
+	}
+	r.data = d.b[d.off:]
+	return r, errors.Wrap(d.err, "parse rows event")
+}
+
+func bitmap(b []byte, n int) []bool {
+	bits := make([]bool, n)
+	for i := range bits {
+		if i/8 < len(b) {
+			bits[i] = b[i/8]&(1<<(i%8)) != 0
+		}
+	}
+	return bits
+}
+
+// binlogDecoder reads little endian values off a buffer, remembering the
+// first overrun rather than checking at every read.
+type binlogDecoder struct {
+	b   []byte
+	off int
+	err error
+}
+
+func (d *binlogDecoder) bytes(n int) []byte {
+	if d.err != nil || n < 0 || d.off+n > len(d.b) {
+		if d.err == nil {
+			d.err = io.ErrUnexpectedEOF
+		}
+		return nil
+	}
+	b := d.b[d.off : d.off+n]
+	d.off += n
+	return b
+}
+
+func (d *binlogDecoder) skip(n int) {
+	d.bytes(n)
+}
+
+func (d *binlogDecoder) uint(n int) uint64 {
+	var v uint64
+	for i, c := range d.bytes(n) {
+		v |= uint64(c) << (8 * i)
+	}
+	return v
+}
+
+// bigEndian reads the unsigned big endian integers temporal and decimal
+// values are packed in.
+func (d *binlogDecoder) bigEndian(n int) uint64 {
+	var v uint64
+	for _, c := range d.bytes(n) {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
+
+func (d *binlogDecoder) lenenc() uint64 {
+	switch c := d.uint(1); c {
+	case 0xfc:
+		return d.uint(2)
+	case 0xfd:
+		return d.uint(3)
+	case 0xfe:
+		return d.uint(8)
+	default:
+		return c
+	}
+}
+
+// binlogColumn is what decoding a column's value needs beyond the table map.
+type binlogColumn struct {
+	unsigned bool
+
+	// The character set of a text column, empty for binary ones.
+	charset string
+}
+
+// decodeRow reads one row image off d, as SQL literals for the columns
+// present in it. Absent columns are left empty.
+func decodeRow(d *binlogDecoder, t binlogTable, columns []binlogColumn, present []bool) ([]string, error) {
+	n := 0
+	for _, p := range present {
+		if p {
+			n++
+		}
+	}
+	nulls := bitmap(d.bytes((n+7)/8), n)
+	values := make([]string, len(present))
+	j := 0
+	for i, p := range present {
+		if !p {
+			continue
+		}
+		if nulls[j] {
+			values[i] = "null"
+		} else {
+			v, err := decodeValue(d, t.types[i], t.meta[i], columns[i])
+			if err != nil {
+				return nil, errors.Wrapf(err, "column %d of %q", i+1, t.name)
+			}
+			values[i] = v
+		}
+		j++
+	}
+	return values, errors.Wrapf(d.err, "decode row of %q", t.name)
+}
+
+// decodeValue reads a value in the binlog's row format as a SQL literal
+// that gives the column the same value. Enums and sets stay numbers, which
+// MySQL takes as their index and bits.
+func decodeValue(d *binlogDecoder, typ byte, meta uint16, c binlogColumn) (string, error) {
+	integer := func(n int) string {
+		v := d.uint(n)
+		if c.unsigned {
+			return strconv.FormatUint(v, 10)
+		}
+		shift := 64 - 8*n
+		return strconv.FormatInt(int64(v<<shift)>>shift, 10)
+	}
+
+	switch typ {
+	case typeTiny:
+		return integer(1), nil
+	case typeShort:
+		return integer(2), nil
+	case typeInt24:
+		return integer(3), nil
+	case typeLong:
+		return integer(4), nil
+	case typeLongLong:
+		return integer(8), nil
+	case typeFloat:
+		// Written as the double it compares equal to, not the shortest
+		// decimal that rounds to it.
+		return strconv.FormatFloat(float64(math.Float32frombits(uint32(d.uint(4)))), 'g', -1, 64), nil
+	case typeDouble:
+		return strconv.FormatFloat(math.Float64frombits(d.uint(8)), 'g', -1, 64), nil
+	case typeYear:
+		if y := d.uint(1); y != 0 {
+			return strconv.FormatUint(1900+y, 10), nil
+		}
+		return "0", nil
+	case typeBit:
+		n := int(meta&0xff) + (int(meta>>8)+7)/8
+		return strconv.FormatUint(d.bigEndian(n), 10), nil
+	case typeNewDecimal:
+		return decodeDecimal(d, int(meta>>8), int(meta&0xff)), nil
+
+	case typeDate:
+		v := d.uint(3)
+		return fmt.Sprintf("'%04d-%02d-%02d'", v>>9, v>>5&15, v&31), nil
+	case typeDatetime:
+		v := d.uint(8)
+		date, clock := v/1000000, v%1000000
+		return fmt.Sprintf("'%04d-%02d-%02d %02d:%02d:%02d'", date/10000, date/100%100, date%100, clock/10000, clock/100%100, clock%100), nil
+	case typeTimestamp:
+		return formatTimestamp(int64(d.uint(4)), 0, 0), nil
+	case typeTime:
+		v := d.uint(3)
+		return fmt.Sprintf("'%02d:%02d:%02d'", v/10000, v/100%100, v%100), nil
+	case typeDatetime2:
+		v := d.bigEndian(5) - 0x8000000000
+		frac := decodeFraction(d, int(meta))
+		ymd, hms := v>>17, v&(1<<17-1)
+		ym := ymd >> 5
+		return fmt.Sprintf("'%04d-%02d-%02d %02d:%02d:%02d%s'", ym/13, ym%13, ymd&31, hms>>12, hms>>6&63, hms&63, formatFraction(frac, int(meta))), nil
+	case typeTimestamp2:
+		return formatTimestamp(int64(d.bigEndian(4)), decodeFraction(d, int(meta)), int(meta)), nil
+	case typeTime2:
+		return decodeTime2(d, int(meta)), nil
+
+	case typeVarchar, typeVarString:
+		n := 1
+		if meta >= 256 {
+			n = 2
+		}
+		return stringLiteral(d.bytes(int(d.uint(n))), c.charset), nil
+	case typeString:
+		realType, length := byte(meta>>8), int(meta&0xff)
+		if realType&0x30 != 0x30 {
+			// Lengths over 255 borrow two bits of the type.
+			length |= int(realType&0x30^0x30) << 4
+			realType |= 0x30
+		}
+		switch realType {
+		case typeEnum:
+			return strconv.FormatUint(d.uint(length), 10), nil
+		case typeSet:
+			return strconv.FormatUint(d.uint(length), 10), nil
+		}
+		n := 1
+		if length >= 256 {
+			n = 2
+		}
+		return stringLiteral(d.bytes(int(d.uint(n))), c.charset), nil
+	case typeBlob, typeGeometry:
+		return stringLiteral(d.bytes(int(d.uint(int(meta)))), c.charset), nil
+	case typeJSON:
+		b := d.bytes(int(d.uint(int(meta))))
+		if d.err != nil {
+			return "", d.err
+		}
+		if len(b) == 0 {
+			// How MySQL logs a JSON null set by some older statements.
+			return "'null'", nil
+		}
+		var out strings.Builder
+		if err := decodeJSON(&out, b[0], b[1:]); err != nil {
+			return "", errors.Wrap(err, "decode json")
+		}
+		return stringLiteral([]byte(out.String()), "utf8mb4"), nil
+	}
+	return "", errors.Errorf("unsupported binlog column type %d", typ)
+}
+
+// stringLiteral writes bytes in hex, so nothing in them needs escaping,
+// introduced by their character set.
+func stringLiteral(b []byte, charset string) string {
+	if len(b) == 0 {
+		return "''"
+	}
+	lit := "0x" + fmt.Sprintf("%x", b)
+	if charset != "" {
+		lit = "_" + charset + " " + lit
+	}
+	return lit
+}
+
+func decodeFraction(d *binlogDecoder, fsp int) uint64 {
+	switch fsp {
+	case 1, 2:
+		return d.bigEndian(1) * 10000
+	case 3, 4:
+		return d.bigEndian(2) * 100
+	case 5, 6:
+		return d.bigEndian(3)
+	}
+	return 0
+}
+
+func formatFraction(micros uint64, fsp int) string {
+	if fsp == 0 {
+		return ""
+	}
+	return "." + fmt.Sprintf("%06d", micros)[:fsp]
+}
+
+// formatTimestamp renders a timestamp in UTC, which is the session time
+// zone swoof gives every destination.
+func formatTimestamp(sec int64, micros uint64, fsp int) string {
+	if sec == 0 && micros == 0 {
+		return "'0000-00-00 00:00:00" + formatFraction(0, fsp) + "'"
+	}
+	return "'" + time.Unix(sec, 0).UTC().Format(time.DateTime) + formatFraction(micros, fsp) + "'"
+}
+
+// decodeTime2 reads a TIME, whose negative values keep their fraction as
+// a borrow from the seconds.
+func decodeTime2(d *binlogDecoder, fsp int) string {
+	var packed int64
+	switch fsp {
+	case 1, 2:
+		intPart := int64(d.bigEndian(3)) - 0x800000
+		frac := int64(d.bigEndian(1))
+		if intPart < 0 && frac != 0 {
+			intPart++
+			frac -= 0x100
+		}
+		packed = intPart<<24 + frac*10000
+	case 3, 4:
+		intPart := int64(d.bigEndian(3)) - 0x800000
+		frac := int64(d.bigEndian(2))
+		if intPart < 0 && frac != 0 {
+			intPart++
+			frac -= 0x10000
+		}
+		packed = intPart<<24 + frac*100
+	case 5, 6:
+		packed = int64(d.bigEndian(6)) - 0x800000000000
+	default:
+		packed = (int64(d.bigEndian(3)) - 0x800000) << 24
+	}
+	sign := ""
+	if packed < 0 {
+		sign, packed = "-", -packed
+	}
+	hms := packed >> 24
+	return fmt.Sprintf("'%s%02d:%02d:%02d%s'", sign, hms>>12&1023, hms>>6&63, hms&63, formatFraction(uint64(packed&(1<<24-1)), fsp))
+}
+
+// Bytes taken by 0 to 9 leftover decimal digits.
+var decimalDigitBytes = [10]int{0, 1, 1, 2, 2, 3, 3, 4, 4, 4}
+
+// decodeDecimal reads MySQL's binary decimal: groups of nine digits in four
+// big endian bytes, the leftover digits in fewer, with the sign bit flipped
+// and every bit flipped again for negatives.
+func decodeDecimal(d *binlogDecoder, precision, scale int) string {
+	intDigits := precision - scale
+	size := intDigits/9*4 + decimalDigitBytes[intDigits%9] + scale/9*4 + decimalDigitBytes[scale%9]
+	b := append([]byte(nil), d.bytes(size)...)
+	if len(b) == 0 {
+		return "0"
+	}
+	var out strings.Builder
+	var mask byte
+	if b[0]&0x80 == 0 {
+		mask = 0xff
+		out.WriteByte('-')
+	}
+	b[0] ^= 0x80
+	off := 0
+	group := func(n, width int) {
+		var v uint64
+		for _, c := range b[off : off+n] {
+			v = v<<8 | uint64(c^mask)
+		}
+		off += n
+		fmt.Fprintf(&out, "%0*d", width, v)
+	}
+
+	start := out.Len()
+	if n := decimalDigitBytes[intDigits%9]; n > 0 {
+		group(n, 1)
+	}
+	for range intDigits / 9 {
+		group(4, 9)
+	}
+	// Drop the leading zeros of the integer part, keeping one.
+	digits := strings.TrimLeft(out.String()[start:], "0")
+	if digits == "" {
+		digits = "0"
+	}
+	sign := out.String()[:start]
+	out.Reset()
+	out.WriteString(sign + digits)
+
+	if scale > 0 {
+		out.WriteByte('.')
+		for range scale / 9 {
+			group(4, 9)
+		}
+		if n := decimalDigitBytes[scale%9]; n > 0 {
+			group(n, scale%9)
+		}
+	}
+	return out.String()
+}
+
+// decodeJSON writes MySQL's binary JSON as JSON text.
+func decodeJSON(out *strings.Builder, typ byte, b []byte) error {
+	switch typ {
+	case 0x00, 0x01, 0x02, 0x03:
+		return decodeJSONContainer(out, typ, b)
+	case 0x04:
+		if len(b) < 1 {
+			return io.ErrUnexpectedEOF
+		}
+		switch b[0] {
+		case 0:
+			out.WriteString("null")
+		case 1:
+			out.WriteString("true")
+		case 2:
+			out.WriteString("false")
+		default:
+			return errors.Errorf("unknown json literal %d", b[0])
+		}
+		return nil
+	case 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b:
+		size := map[byte]int{0x05: 2, 0x06: 2, 0x07: 4, 0x08: 4, 0x09: 8, 0x0a: 8, 0x0b: 8}[typ]
+		if len(b) < size {
+			return io.ErrUnexpectedEOF
+		}
+		var v uint64
+		for i := range size {
+			v |= uint64(b[i]) << (8 * i)
+		}
+		shift := 64 - 8*size
+		switch typ {
+		case 0x05, 0x07, 0x09:
+			out.WriteString(strconv.FormatInt(int64(v<<shift)>>shift, 10))
+		case 0x0b:
+			out.WriteString(strconv.FormatFloat(math.Float64frombits(v), 'g', -1, 64))
+		default:
+			out.WriteString(strconv.FormatUint(v, 10))
+		}
+		return nil
+	case 0x0c:
+		n, w := jsonVarLen(b)
+		if w == 0 || w+n > len(b) {
+			return io.ErrUnexpectedEOF
+		}
+		s, _ := json.Marshal(string(b[w : w+n]))
+		out.Write(s)
+		return nil
+	case 0x0f:
+		return decodeJSONOpaque(out, b)
+	}
+	return errors.Errorf("unknown json type %d", typ)
+}
+
+func decodeJSONContainer(out *strings.Builder, typ byte, b []byte) error {
+	large := typ == 0x01 || typ == 0x03
+	object := typ == 0x00 || typ == 0x01
+	size := 2
+	if large {
+		size = 4
+	}
+	read := func(off, n int) (int, bool) {
+		if off < 0 || off+n > len(b) {
+			return 0, false
+		}
+		v := 0
+		for i := range n {
+			v |= int(b[off+i]) << (8 * i)
+		}
+		return v, true
+	}
+	count, ok := read(0, size)
+	if !ok {
+		return io.ErrUnexpectedEOF
+	}
+
+	keyEntry := 0
+	if object {
+		keyEntry = size + 2
+	}
+	valueEntry := 1 + size
+	valuesAt := 2*size + count*keyEntry
+
+	open, close := "[", "]"
+	if object {
+		open, close = "{", "}"
+	}
+	out.WriteString(open)
+	for i := range count {
+		if i > 0 {
+			out.WriteByte(',')
+		}
+		if object {
+			at := 2*size + i*keyEntry
+			keyOff, ok1 := read(at, size)
+			keyLen, ok2 := read(at+size, 2)
+			if !ok1 || !ok2 || keyOff+keyLen > len(b) {
+				return io.ErrUnexpectedEOF
+			}
+			k, _ := json.Marshal(string(b[keyOff : keyOff+keyLen]))
+			out.Write(k)
+			out.WriteByte(':')
+		}
+		at := valuesAt + i*valueEntry
+		if at+valueEntry > len(b) {
+			return io.ErrUnexpectedEOF
+		}
+		vt := b[at]
+		inline := vt == 0x04 || vt == 0x05 || vt == 0x06 || (large && (vt == 0x07 || vt == 0x08))
+		if inline {
+			if err := decodeJSON(out, vt, b[at+1:at+valueEntry]); err != nil {
+				return err
+			}
+			continue
+		}
+		off, _ := read(at+1, size)
+		if off > len(b) {
+			return io.ErrUnexpectedEOF
+		}
+		if err := decodeJSON(out, vt, b[off:]); err != nil {
+			return err
+		}
+	}
+	out.WriteString(close)
+	return nil
+}
+
+// decodeJSONOpaque writes the MySQL values JSON has no type for: decimals
+// and temporals as MySQL prints them, anything else the way MySQL does.
+func decodeJSONOpaque(out *strings.Builder, b []byte) error {
+	if len(b) < 1 {
+		return io.ErrUnexpectedEOF
+	}
+	mysqlType := b[0]
+	n, w := jsonVarLen(b[1:])
+	if w == 0 || 1+w+n > len(b) {
+		return io.ErrUnexpectedEOF
+	}
+	data := b[1+w : 1+w+n]
+
+	switch mysqlType {
+	case typeNewDecimal:
+		if len(data) < 2 {
+			return io.ErrUnexpectedEOF
+		}
+		d := binlogDecoder{b: data[2:]}
+		s := decodeDecimal(&d, int(data[0]), int(data[1]))
+		if d.err != nil {
+			return d.err
+		}
+		out.WriteString(s)
+		return nil
+	case typeDate, typeDatetime, typeTimestamp, typeTime:
+		if len(data) < 8 {
+			return io.ErrUnexpectedEOF
+		}
+		s, _ := json.Marshal(formatPackedTemporal(mysqlType, int64(binary.LittleEndian.Uint64(data))))
+		out.Write(s)
+		return nil
+	}
+	s, _ := json.Marshal("base64:type" + strconv.Itoa(int(mysqlType)) + ":" + base64.StdEncoding.EncodeToString(data))
+	out.Write(s)
+	return nil
+}
+
+// formatPackedTemporal formats the packed integers JSON stores temporals
+// in: the date and time packed like DATETIME2 in the high bits, above 24
+// bits of microseconds.
+func formatPackedTemporal(typ byte, v int64) string {
+	sign := ""
+	if v < 0 {
+		sign, v = "-", -v
+	}
+	micros := v & (1<<24 - 1)
+	v >>= 24
+	frac := ""
+	if micros != 0 {
+		frac = fmt.Sprintf(".%06d", micros)
+	}
+	if typ == typeTime {
+		return fmt.Sprintf("%s%02d:%02d:%02d%s", sign, v>>12, v>>6&63, v&63, frac)
+	}
+	ymd, hms := v>>17, v&(1<<17-1)
+	ym := ymd >> 5
+	date := fmt.Sprintf("%04d-%02d-%02d", ym/13, ym%13, ymd&31)
+	if typ == typeDate {
+		return date
+	}
+	return fmt.Sprintf("%s %02d:%02d:%02d%s", date, hms>>12, hms>>6&63, hms&63, frac)
+}
+
+// jsonVarLen reads the variable length integer binary JSON gives string
+// lengths in, seven bits a byte, returning it and the bytes it took.
+func jsonVarLen(b []byte) (int, int) {
+	n := 0
+	for i := 0; i < len(b) && i < 5; i++ {
+		n |= int(b[i]&0x7f) << (7 * i)
+		if b[i]&0x80 == 0 {
+			return n, i + 1
+		}
+	}
+	return 0, 0
+}
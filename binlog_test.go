@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/hex"
+	"slices"
+	"testing"
+)
+
+// be packs v big endian into n bytes, the way temporal values are stored.
+func be(v uint64, n int) []byte {
+	b := make([]byte, n)
+	for i := n - 1; i >= 0; i-- {
+		b[i] = byte(v)
+		v >>= 8
+	}
+	return b
+}
+
+func TestDecodeValue(t *testing.T) {
+	datetime := func(y, mo, d, h, mi, s uint64) uint64 {
+		ymd := (y*13+mo)<<5 | d
+		return ymd<<17 | h<<12 | mi<<6 | s
+	}
+	jsonObject := []byte{0x00, 0x01, 0x00, 0x0c, 0x00, 0x0b, 0x00, 0x01, 0x00, 0x05, 0x01, 0x00, 'a'}
+	jsonArray := []byte{0x02, 0x02, 0x00, 0x0c, 0x00, 0x0c, 0x0a, 0x00, 0x04, 0x01, 0x00, 0x01, 'x'}
+
+	for _, tt := range []struct {
+		name   string
+		typ    byte
+		meta   uint16
+		column binlogColumn
+		data   []byte
+		want   string
+	}{
+		{name: "tinyint", typ: typeTiny, data: []byte{0xff}, want: "-1"},
+		{name: "tinyint unsigned", typ: typeTiny, column: binlogColumn{unsigned: true}, data: []byte{0xff}, want: "255"},
+		{name: "mediumint", typ: typeInt24, data: []byte{0xfe, 0xff, 0xff}, want: "-2"},
+		{name: "int", typ: typeLong, data: []byte{0x2a, 0, 0, 0}, want: "42"},
+		{name: "bigint unsigned", typ: typeLongLong, column: binlogColumn{unsigned: true}, data: []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, want: "18446744073709551615"},
+		{name: "double", typ: typeDouble, data: []byte{0, 0, 0, 0, 0, 0, 0xf8, 0x3f}, want: "1.5"},
+		{name: "year", typ: typeYear, data: []byte{124}, want: "2024"},
+		{name: "bit(10)", typ: typeBit, meta: 2<<8 | 1, data: []byte{0x02, 0x01}, want: "513"},
+
+		{name: "decimal(5,2)", typ: typeNewDecimal, meta: 5<<8 | 2, data: []byte{0x80, 0x7b, 0x2d}, want: "123.45"},
+		{name: "negative decimal(5,2)", typ: typeNewDecimal, meta: 5<<8 | 2, data: []byte{0x7f, 0x84, 0xd2}, want: "-123.45"},
+		{name: "decimal(10,4) under one", typ: typeNewDecimal, meta: 10<<8 | 4, data: []byte{0x80, 0, 0, 0x01, 0xf4}, want: "0.0500"},
+
+		{name: "date", typ: typeDate, data: []byte{0x65, 0xd0, 0x0f}, want: "'2024-03-05'"},
+		{name: "datetime(0)", typ: typeDatetime2, data: be(0x8000000000+datetime(2024, 3, 5, 14, 30, 15), 5), want: "'2024-03-05 14:30:15'"},
+		{name: "datetime(3)", typ: typeDatetime2, meta: 3, data: append(be(0x8000000000+datetime(1999, 12, 31, 23, 59, 59), 5), be(1230, 2)...), want: "'1999-12-31 23:59:59.123'"},
+		{name: "timestamp", typ: typeTimestamp2, data: be(1700000000, 4), want: "'2023-11-14 22:13:20'"},
+		{name: "zero timestamp(2)", typ: typeTimestamp2, meta: 2, data: []byte{0, 0, 0, 0, 0}, want: "'0000-00-00 00:00:00.00'"},
+		{name: "time", typ: typeTime2, data: be(0x800000+12<<12|34<<6|56, 3), want: "'12:34:56'"},
+		{name: "negative time", typ: typeTime2, data: be(0x800000-1<<12, 3), want: "'-01:00:00'"},
+		{name: "time(3)", typ: typeTime2, meta: 3, data: append(be(0x800000+12<<12|34<<6|56, 3), be(7890, 2)...), want: "'12:34:56.789'"},
+
+		{name: "varchar", typ: typeVarchar, meta: 255, column: binlogColumn{charset: "utf8mb4"}, data: []byte{2, 'h', 'i'}, want: "_utf8mb4 0x6869"},
+		{name: "long varchar", typ: typeVarchar, meta: 1024, column: binlogColumn{charset: "latin1"}, data: []byte{1, 0, '\''}, want: "_latin1 0x27"},
+		{name: "empty varchar", typ: typeVarchar, meta: 255, column: binlogColumn{charset: "utf8mb4"}, data: []byte{0}, want: "''"},
+		{name: "varbinary", typ: typeVarchar, meta: 16, data: []byte{2, 0x00, 0xff}, want: "0x00ff"},
+		{name: "char", typ: typeString, meta: typeString<<8 | 40, column: binlogColumn{charset: "ascii"}, data: []byte{1, 'z'}, want: "_ascii 0x7a"},
+		{name: "enum", typ: typeString, meta: typeEnum<<8 | 1, data: []byte{2}, want: "2"},
+		{name: "set", typ: typeString, meta: typeSet<<8 | 2, data: []byte{0x05, 0x00}, want: "5"},
+		{name: "blob", typ: typeBlob, meta: 2, data: []byte{3, 0, 'a', 'b', 'c'}, want: "0x616263"},
+
+		{name: "json object", typ: typeJSON, meta: 4, data: append([]byte{byte(len(jsonObject)), 0, 0, 0}, jsonObject...), want: "_utf8mb4 0x" + hex.EncodeToString([]byte(`{"a":1}`))},
+		{name: "json array", typ: typeJSON, meta: 4, data: append([]byte{byte(len(jsonArray)), 0, 0, 0}, jsonArray...), want: "_utf8mb4 0x" + hex.EncodeToString([]byte(`["x",true]`))},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			d := binlogDecoder{b: tt.data}
+			got, err := decodeValue(&d, tt.typ, tt.meta, tt.column)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d.err != nil {
+				t.Fatal(d.err)
+			}
+			if got != tt.want {
+				t.Errorf("decodeValue = %s, want %s", got, tt.want)
+			}
+			if d.off != len(tt.data) {
+				t.Errorf("read %d bytes of %d", d.off, len(tt.data))
+			}
+		})
+	}
+}
+
+func TestDecodeValueTruncated(t *testing.T) {
+	d := binlogDecoder{b: []byte{0x00, 0x01, 0x02}}
+	if _, err := decodeRow(&d, binlogTable{name: "t", types: []byte{typeLong}, meta: []uint16{0}}, []binlogColumn{{}}, []bool{true}); err == nil {
+		t.Error("decodeRow of a short row image = nil error")
+	}
+}
+
+func TestParseRowsEvent(t *testing.T) {
+	tm, err := parseTableMap([]byte{
+		7, 0, 0, 0, 0, 0, // table id
+		1, 0, // flags
+		2, 'd', 'b', 0,
+		1, 't', 0,
+		3, typeLong, typeVarchar, typeNewDecimal,
+		4, 0xff, 0x00, 5, 2, // metadata
+		0x02, // nullable columns
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tm.id != 7 || tm.schema != "db" || tm.name != "t" {
+		t.Errorf("table map = %d %s.%s", tm.id, tm.schema, tm.name)
+	}
+	if want := []uint16{0, 255, 5<<8 | 2}; !slices.Equal(tm.meta, want) {
+		t.Errorf("meta = %v, want %v", tm.meta, want)
+	}
+
+	rows, err := parseRows(binlogUpdateRows, []byte{
+		7, 0, 0, 0, 0, 0, // table id
+		1, 0, // flags
+		2, 0, // extra data
+		3,
+		0x07, // before image columns
+		0x05, // after image columns
+		// Before: the varchar is null.
+		0x02, 0x2a, 0, 0, 0, 0x80, 0x7b, 0x2d,
+		// After: only the id and decimal.
+		0x00, 0x2a, 0, 0, 0, 0x7f, 0x84, 0xd2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows.tableID != 7 {
+		t.Errorf("tableID = %d, want 7", rows.tableID)
+	}
+
+	columns := make([]binlogColumn, 3)
+	d := binlogDecoder{b: rows.data}
+	before, err := decodeRow(&d, tm, columns, rows.present)
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, err := decodeRow(&d, tm, columns, rows.after)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"42", "null", "123.45"}; !slices.Equal(before, want) {
+		t.Errorf("before = %q, want %q", before, want)
+	}
+	if want := []string{"42", "", "-123.45"}; !slices.Equal(after, want) {
+		t.Errorf("after = %q, want %q", after, want)
+	}
+	if d.off != len(d.b) {
+		t.Errorf("read %d bytes of %d", d.off, len(d.b))
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	event := []byte{
+		1, 0, 0, 0, // thread id
+		0, 0, 0, 0, // execution time
+		2,    // schema length
+		0, 0, // error code
+		3, 0, // status variables length
+		0x03, 0x01, 0x02, // status variables
+		'd', 'b', 0,
+	}
+	event = append(event, "BEGIN"...)
+	if got := parseQuery(event); got != "BEGIN" {
+		t.Errorf("parseQuery = %q, want BEGIN", got)
+	}
+	if got := parseQuery(event[:10]); got != "" {
+		t.Errorf("parseQuery of a short event = %q, want empty", got)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	mysql "github.com/StirlingMarketingGroup/cool-mysql"
+	"github.com/fatih/color"
+)
+
+// cancelOnInterrupt cancels a run's context on SIGINT or SIGTERM, or once
+// the TUI stops, with the reason as its cause: errInterrupted, or the error
+// a failing table stopped the TUI with. A second signal gets the default
+// behavior back, so it kills a run that's slow to unwind.
+func cancelOnInterrupt(ctx context.Context, cancel context.CancelCauseFunc, u *ui) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	var done <-chan struct{}
+	if u != nil {
+		done = u.Done()
+	}
+	go func() {
+		defer signal.Stop(sigs)
+		select {
+		case <-sigs:
+			cancel(errInterrupted)
+		case <-done:
+			if err := u.FirstError(); err != nil {
+				cancel(err)
+			} else {
+				cancel(errInterrupted)
+			}
+		case <-ctx.Done():
+		}
+	}()
+}
+
+// dropTempTables drops the temp tables of tables that didn't finish, on
+// every database destination, logging rather than stopping on the ones it
+// can't.
+func dropTempTables(dbs []*mysql.Database, tempTables []string) {
+	for _, db := range dbs {
+		for _, t := range tempTables {
+			if err := db.Exec("drop table if exists`" + t + "`"); err != nil {
+				slog.Warn("failed to drop temp table", "error", err, "tempTable", t)
+			}
+		}
+	}
+}
+
+// unfinishedTables describes each table of a stopped run that didn't
+// finish, and counts the ones that did.
+func unfinishedTables(snaps []tableSnapshot) (int, []string) {
+	finished := 0
+	var unfinished []string
+	for _, s := range snaps {
+		var why string
+		switch s.status {
+		case statusFinalized, statusFollowing:
+			finished++
+			continue
+		case statusPending:
+			why = "not started"
+		case statusDone:
+			why = "copied, not swapped in"
+		case statusFailed:
+			why = s.cause
+		default:
+			why = "interrupted"
+		}
+		if s.current > 0 && s.status != statusDone {
+			why += fmt.Sprintf(" after %d rows", s.current)
+		}
+		unfinished = append(unfinished, s.name+" ("+why+")")
+	}
+	return finished, unfinished
+}
+
+// printPartialSummary tells what a stopped run got done, and what it left
+// for -resume.
+func printPartialSummary(snaps []tableSnapshot, kept []string) {
+	labelCyan := color.New(color.FgHiCyan).SprintFunc()
+	value := color.New(color.FgHiWhite).SprintFunc()
+	yellow := color.New(color.FgHiYellow).SprintFunc()
+
+	finished, unfinished := unfinishedTables(snaps)
+	fmt.Fprintf(os.Stderr, "%s %s\n", labelCyan("finished:     "), value(fmt.Sprintf("%d of %d tables", finished, len(snaps))))
+	for i, t := range unfinished {
+		label := "              "
+		if i == 0 {
+			label = "unfinished:   "
+		}
+		fmt.Fprintf(os.Stderr, "%s %s\n", labelCyan(label), yellow(t))
+	}
+	if len(kept) != 0 {
+		fmt.Fprintf(os.Stderr, "%s %s\n", labelCyan("kept:         "), value("temp tables of "+strings.Join(kept, ", ")+" for -resume"))
+	}
+}
+
+// printInterrupted tells that a run was stopped after its tables were
+// swapped in, and where the TUI's log went when there was one.
+func printInterrupted(w io.Writer, u *ui) {
+	fmt.Fprintln(w, "\nswoof: interrupted")
+	if u != nil {
+		if path := u.LogPath(); path != "" {
+			fmt.Fprintf(w, "log: %s\n", path)
+		}
+	}
+}
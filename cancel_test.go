@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestUnfinishedTables(t *testing.T) {
+	finished, unfinished := unfinishedTables([]tableSnapshot{
+		{name: "users", status: statusFinalized, current: 10},
+		{name: "orders", status: statusDone, current: 500},
+		{name: "order_items", status: statusFailed, current: 1200, cause: "interrupted"},
+		{name: "audit", status: statusFailed, cause: "Error 1146: Table 'db.audit' doesn't exist"},
+		{name: "logs", status: statusRunning},
+		{name: "sessions", status: statusPending},
+	})
+	if finished != 1 {
+		t.Errorf("finished = %d, want 1", finished)
+	}
+	want := []string{
+		"orders (copied, not swapped in)",
+		"order_items (interrupted after 1200 rows)",
+		"audit (Error 1146: Table 'db.audit' doesn't exist)",
+		"logs (interrupted)",
+		"sessions (not started)",
+	}
+	if !slices.Equal(unfinished, want) {
+		t.Errorf("unfinished = %q\nwant %q", unfinished, want)
+	}
+}
+
+func TestPrintInterrupted(t *testing.T) {
+	// Without the TUI there's no ui, and no log file to point at.
+	var b strings.Builder
+	printInterrupted(&b, nil)
+	if got := b.String(); got != "\nswoof: interrupted\n" {
+		t.Errorf("printInterrupted without a ui = %q", got)
+	}
+
+	f, err := os.Create(filepath.Join(t.TempDir(), "swoof.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	b.Reset()
+	printInterrupted(&b, &ui{logFile: f})
+	if got := b.String(); !strings.HasSuffix(got, "log: "+f.Name()+"\n") {
+		t.Errorf("printInterrupted = %q, want it to end with the log's path", got)
+	}
+}
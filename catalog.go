@@ -0,0 +1,82 @@
+package main
+
+import (
+	mysql "github.com/StirlingMarketingGroup/cool-mysql"
+)
+
+// tableCatalog is everything table resolution needs from a source: exact
+// lookups, glob expansion, the inverse list for -all, and the size ordering
+// the workers are scheduled by. A live connection and a `file:` backup both
+// satisfy it, so aliases and globs resolve the same way against either.
+type tableCatalog interface {
+	tableExists(name string) (bool, error)
+
+	// matchTables expands a glob (`*` and `?`) into the matching base tables,
+	// sorted by name.
+	matchTables(pattern string) ([]string, error)
+
+	// tablesExcept returns every base table not in names.
+	tablesExcept(names []string) ([]string, error)
+
+	// tablesBySize returns names ordered largest first, de-duplicated.
+	tablesBySize(names []string) ([]string, error)
+}
+
+type mysqlCatalog struct {
+	db *mysql.Database
+}
+
+func (c mysqlCatalog) tableExists(name string) (bool, error) {
+	return c.db.Exists("show tables like'"+name+"'", 0)
+}
+
+func (c mysqlCatalog) matchTables(pattern string) ([]string, error) {
+	var matched []string
+	err := c.db.Select(&matched, "select`table_name`"+
+		"from`information_schema`.`TABLES`"+
+		"where`table_schema`=database()"+
+		"and`table_type`='BASE TABLE'"+
+		"and`table_name`like @@Pattern"+
+		" order by`table_name`", 0, mysql.Params{
+		"Pattern": globToLike(pattern),
+	})
+	return matched, err
+}
+
+func (c mysqlCatalog) tablesExcept(names []string) ([]string, error) {
+	var tables []string
+	err := c.db.Select(&tables, "select`table_name`"+
+		"from`information_schema`.`TABLES`"+
+		"where`table_schema`=database()"+
+		"and`table_type`='BASE TABLE'{{ if .Tables }}"+
+		"and`table_name`not in(@@Tables){{ end }}", 0, mysql.Params{
+		"Tables": names,
+	})
+	return tables, err
+}
+
+// Ordered by data+index length so the longest table doesn't start last and
+// draw out the total run. The query also de-duplicates the list for free.
+func (c mysqlCatalog) tablesBySize(names []string) ([]string, error) {
+	var ordered []string
+	if len(names) == 0 {
+		return ordered, nil
+	}
+	tablesCh := make(chan string, len(names))
+	var err error
+	go func() {
+		defer close(tablesCh)
+		err = c.db.Select(tablesCh, "select`table_name`"+
+			"from`information_schema`.`TABLES`"+
+			"where`table_schema`=database()"+
+			"and`table_name`in({{ range $i, $table := .Tables }}{{ if $i }},{{ end }}{{ $table | printf `'%s'` }}{{ end }})"+
+			"and`table_type`='BASE TABLE'"+
+			"order by`data_length`+`index_length`desc", 0, mysql.Params{
+			"Tables": names,
+		})
+	}()
+	for t := range tablesCh {
+		ordered = append(ordered, t)
+	}
+	return ordered, err
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// How often in-flight progress is written to disk. A crash can lose at most
+// this much, and resume trims the destination back to the recorded key, so
+// the only cost of a stale checkpoint is re-copying a few seconds of rows.
+const checkpointInterval = 5 * time.Second
+
+// Rows handed to an inserter per statement stream while checkpointing. A
+// segment only counts as committed once its stream has been inserted, so
+// this is also how far the checkpoint can trail the destination.
+const checkpointSegmentRows = 10_000
+
+// checkpoint records how far each destination's temp table got, so a retry
+// or a `-resume` run can continue with `where pk > last` instead of starting
+// the table over.
+type checkpoint struct {
+	Source    string `json:"source"`
+	Table     string `json:"table"`
+	TempTable string `json:"temp_table"`
+	Column    string `json:"column"`
+
+	// The filter the rows were selected with. A resume under a different
+	// -w would splice two different row sets together.
+	Where string `json:"where,omitempty"`
+
+	// The key ranges the table was read in, a single unbounded one unless
+	// -chunks split it. A resume keeps these bounds even if -chunks changed,
+	// since progress is only meaningful within the range it was made in.
+	Ranges    []rangeCheckpoint `json:"ranges"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+type rangeCheckpoint struct {
+	keyRange
+	Destinations map[string]destCheckpoint `json:"destinations"`
+}
+
+type destCheckpoint struct {
+	// Highest primary key committed into the temp table, as a decimal string
+	// so unsigned bigints survive the JSON round trip.
+	Last string `json:"last"`
+	Rows int64  `json:"rows"`
+}
+
+func checkpointDir() string {
+	return filepath.Join(confDir, "swoof", "checkpoints")
+}
+
+func checkpointPath(source, table string) string {
+	return stateFilePath(checkpointDir(), table, source+"\x00"+table)
+}
+
+// stateFilePath names a file in dir after the table plus a hash of what it's
+// scoped to, since sources and columns can contain characters that don't
+// belong in a file name.
+func stateFilePath(dir, table, scope string) string {
+	sum := sha1.Sum([]byte(scope))
+	return filepath.Join(dir, table+"-"+hex.EncodeToString(sum[:6])+".json")
+}
+
+// loadCheckpoint returns nil without an error when there's nothing to resume.
+func loadCheckpoint(path string) (*checkpoint, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "read checkpoint %q", path)
+	}
+	var c checkpoint
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, errors.Wrapf(err, "parse checkpoint %q", path)
+	}
+	return &c, nil
+}
+
+func (c *checkpoint) save(path string) error {
+	c.UpdatedAt = time.Now()
+	return saveStateFile(path, c)
+}
+
+// saveStateFile writes through a temp file and rename so a crash mid-write
+// leaves the previous state intact rather than a truncated file.
+func saveStateFile(path string, v any) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "marshal state")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return errors.Wrap(err, "create state dir")
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return errors.Wrapf(err, "write %q", tmp)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return errors.Wrapf(err, "rename %q", tmp)
+	}
+	return nil
+}
+
+func removeCheckpoint(path string) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return errors.Wrapf(err, "remove checkpoint %q", path)
+	}
+	return nil
+}
+
+// rangeResume is one key range to read, with the key every destination has
+// committed through ("" when the range hasn't started) and the rows that
+// represents.
+type rangeResume struct {
+	keyRange
+	last string
+	rows int64
+}
+
+// remaining narrows the range to the keys still to be copied.
+func (r rangeResume) remaining() keyRange {
+	if r.last == "" {
+		return r.keyRange
+	}
+	return keyRange{Low: r.last, High: r.High}
+}
+
+// resumePoint returns each range's progress. ok is false when any
+// destination is missing from the checkpoint or it was taken under a
+// different key column or filter, in which case the table starts over.
+func (c *checkpoint) resumePoint(destKeys []string, column, where string, unsigned bool) (ranges []rangeResume, ok bool) {
+	if c == nil || c.Column != column || c.Where != where || len(destKeys) == 0 || len(c.Ranges) == 0 {
+		return nil, false
+	}
+	for _, rc := range c.Ranges {
+		r := rangeResume{keyRange: rc.keyRange}
+		var lowest keyValue
+		for i, k := range destKeys {
+			d, found := rc.Destinations[k]
+			if !found {
+				return nil, false
+			}
+			if d.Last == "" {
+				// This destination hasn't committed anything in the range,
+				// so neither has the slowest one.
+				r.last, r.rows = "", 0
+				break
+			}
+			v, err := parseKey(d.Last, unsigned)
+			if err != nil {
+				return nil, false
+			}
+			if i == 0 || v.less(lowest) {
+				lowest = v
+				r.last, r.rows = v.String(), d.Rows
+			}
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges, true
+}
+
+// keyValue is an integer primary key that may be signed or unsigned. Bits
+// holds the raw value; the comparison and formatting honor the signedness.
+type keyValue struct {
+	bits     uint64
+	unsigned bool
+}
+
+func parseKey(s string, unsigned bool) (keyValue, error) {
+	if unsigned {
+		u, err := strconv.ParseUint(s, 10, 64)
+		return keyValue{u, true}, err
+	}
+	i, err := strconv.ParseInt(s, 10, 64)
+	return keyValue{uint64(i), false}, err
+}
+
+func (k keyValue) less(o keyValue) bool {
+	if k.unsigned {
+		return k.bits < o.bits
+	}
+	return int64(k.bits) < int64(o.bits)
+}
+
+func (k keyValue) String() string {
+	if k.unsigned {
+		return strconv.FormatUint(k.bits, 10)
+	}
+	return strconv.FormatInt(int64(k.bits), 10)
+}
+
+// rowKey reads the integer primary key out of a dynamic row struct. Every
+// field is a pointer, so a nil one (impossible for a real PK) reports !ok.
+func rowKey(row reflect.Value, field int) (uint64, bool) {
+	f := row.Field(field)
+	if f.IsNil() {
+		return 0, false
+	}
+	e := f.Elem()
+	switch e.Kind() {
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return uint64(e.Int()), true
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return e.Uint(), true
+	}
+	return 0, false
+}
+
+// keyTracker maps the rows each destination has committed back to primary
+// keys for one key range. Rows reach every destination in stream order, so
+// a destination's n-th committed row is the n-th key pushed here.
+type keyTracker struct {
+	mu       sync.Mutex
+	unsigned bool
+
+	// keys[0] is the key of row number offset in this attempt's stream.
+	keys   []uint64
+	offset int64
+
+	committed []int64
+	baseRows  int64
+	baseLast  string
+}
+
+func newKeyTracker(dests int, unsigned bool, baseLast string, baseRows int64) *keyTracker {
+	return &keyTracker{
+		unsigned:  unsigned,
+		committed: make([]int64, dests),
+		baseRows:  baseRows,
+		baseLast:  baseLast,
+	}
+}
+
+func (t *keyTracker) push(key uint64) {
+	t.mu.Lock()
+	t.keys = append(t.keys, key)
+	t.mu.Unlock()
+}
+
+func (t *keyTracker) commit(dest int, rows int64) {
+	t.mu.Lock()
+	t.committed[dest] += rows
+	t.mu.Unlock()
+}
+
+// insertSegments hands rows to insert in segments of at most size rows,
+// reporting each segment to inserted once insert has returned for it. An
+// inserter's after-row callback can fire while a row is only buffered, so
+// it can't say what the destination has; a finished insert can.
+func insertSegments(ctx context.Context, rows reflect.Value, size int64, insert func(segment reflect.Value) error, inserted func(rows int64)) error {
+	for {
+		segment := reflect.MakeChan(rows.Type(), 0)
+		stop := make(chan struct{})
+		fed := make(chan struct{})
+		var n int64
+		var drained bool
+		go func() {
+			defer close(fed)
+			defer segment.Close()
+			recvCases := []reflect.SelectCase{
+				{Dir: reflect.SelectRecv, Chan: rows},
+				{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())},
+				{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(stop)},
+			}
+			sendCases := []reflect.SelectCase{
+				{Dir: reflect.SelectSend, Chan: segment},
+				{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(stop)},
+			}
+			for n < size {
+				chosen, row, ok := reflect.Select(recvCases)
+				if chosen != 0 {
+					return
+				}
+				if !ok {
+					drained = true
+					return
+				}
+				sendCases[0].Send = row
+				if chosen, _, _ := reflect.Select(sendCases); chosen == 1 {
+					return
+				}
+				n++
+			}
+		}()
+		err := insert(segment)
+		close(stop)
+		<-fed
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			inserted(n)
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if drained {
+			return nil
+		}
+	}
+}
+
+// snapshot records every destination's progress into c and drops keys all
+// destinations have moved past, so the log stays about as long as the row
+// buffers rather than the table.
+func (t *keyTracker) snapshot(c *rangeCheckpoint, destKeys []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if c.Destinations == nil {
+		c.Destinations = make(map[string]destCheckpoint, len(destKeys))
+	}
+	slowest := t.committed[0]
+	for i, k := range destKeys {
+		n := t.committed[i]
+		slowest = min(slowest, n)
+		d := destCheckpoint{Last: t.baseLast, Rows: t.baseRows + n}
+		if n > 0 {
+			d.Last = keyValue{t.keys[n-1-t.offset], t.unsigned}.String()
+		}
+		c.Destinations[k] = d
+	}
+
+	// Keep the slowest destination's last key so it can still report it.
+	if drop := slowest - 1 - t.offset; drop > 0 {
+		t.keys = append(t.keys[:0], t.keys[drop:]...)
+		t.offset += drop
+	}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func TestKeyValueOrdering(t *testing.T) {
+	neg, err := parseKey("-5", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pos, err := parseKey("3", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !neg.less(pos) || pos.less(neg) {
+		t.Errorf("signed: want -5 < 3")
+	}
+
+	big, err := parseKey("18446744073709551615", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	small, err := parseKey("1", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !small.less(big) {
+		t.Errorf("unsigned: want 1 < max uint64")
+	}
+	if got := big.String(); got != "18446744073709551615" {
+		t.Errorf("String() = %q, want max uint64", got)
+	}
+	if _, err := parseKey("-1", true); err == nil {
+		t.Error("parseKey(-1, unsigned) should fail")
+	}
+}
+
+func TestResumePoint(t *testing.T) {
+	c := &checkpoint{
+		Column: "id",
+		Where:  "x > 1",
+		Ranges: []rangeCheckpoint{
+			{
+				keyRange: keyRange{High: "0"},
+				Destinations: map[string]destCheckpoint{
+					"a": {Last: "-10", Rows: 100},
+					"b": {Last: "-20", Rows: 40},
+				},
+			},
+			{
+				keyRange: keyRange{Low: "0"},
+				Destinations: map[string]destCheckpoint{
+					"a": {Last: "5", Rows: 5},
+					"b": {},
+				},
+			},
+		},
+	}
+
+	ranges, ok := c.resumePoint([]string{"a", "b"}, "id", "x > 1", false)
+	if !ok || len(ranges) != 2 {
+		t.Fatalf("resumePoint = %+v, %v, want 2 ranges", ranges, ok)
+	}
+	if r := ranges[0]; r.last != "-20" || r.rows != 40 {
+		t.Errorf("first range = %+v, want the slowest destination's -20/40", r)
+	}
+	if got, want := ranges[0].remaining(), (keyRange{Low: "-20", High: "0"}); got != want {
+		t.Errorf("first range remaining = %+v, want %+v", got, want)
+	}
+	if r := ranges[1]; r.last != "" || r.rows != 0 {
+		t.Errorf("second range = %+v, want it unstarted", r)
+	}
+	if got, want := ranges[1].remaining(), (keyRange{Low: "0"}); got != want {
+		t.Errorf("second range remaining = %+v, want %+v", got, want)
+	}
+
+	tests := []struct {
+		name   string
+		c      *checkpoint
+		dests  []string
+		column string
+		where  string
+	}{
+		{"nil checkpoint", nil, []string{"a"}, "id", "x > 1"},
+		{"no ranges", &checkpoint{Column: "id"}, []string{"a"}, "id", ""},
+		{"missing destination", c, []string{"a", "c"}, "id", "x > 1"},
+		{"different column", c, []string{"a"}, "other", "x > 1"},
+		{"different where", c, []string{"a"}, "id", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := tt.c.resumePoint(tt.dests, tt.column, tt.where, false); ok {
+				t.Error("resumePoint should not resume")
+			}
+		})
+	}
+}
+
+func TestKeyTrackerSnapshot(t *testing.T) {
+	tr := newKeyTracker(2, false, "7", 7)
+	for _, k := range []uint64{8, 9, 10, 11} {
+		tr.push(k)
+	}
+	c := &rangeCheckpoint{}
+	keys := []string{"fast", "slow"}
+
+	tr.snapshot(c, keys)
+	if d := c.Destinations["slow"]; d.Last != "7" || d.Rows != 7 {
+		t.Errorf("before any commits = %+v, want the base key", d)
+	}
+
+	tr.commit(0, 3)
+	tr.commit(1, 1)
+	tr.snapshot(c, keys)
+	if d := c.Destinations["fast"]; d.Last != "10" || d.Rows != 10 {
+		t.Errorf("fast = %+v, want 10/10", d)
+	}
+	if d := c.Destinations["slow"]; d.Last != "8" || d.Rows != 8 {
+		t.Errorf("slow = %+v, want 8/8", d)
+	}
+
+	// Snapshotting drops keys both destinations are past, and the trimmed
+	// log must still resolve each one's last key.
+	tr.commit(0, 1)
+	tr.commit(1, 1)
+	tr.snapshot(c, keys)
+	tr.commit(1, 1)
+	tr.snapshot(c, keys)
+	if d := c.Destinations["fast"]; d.Last != "11" || d.Rows != 11 {
+		t.Errorf("fast after trim = %+v, want 11/11", d)
+	}
+	if d := c.Destinations["slow"]; d.Last != "10" || d.Rows != 10 {
+		t.Errorf("slow after trim = %+v, want 10/10", d)
+	}
+	if tr.offset == 0 {
+		t.Error("snapshot never trimmed the key log")
+	}
+}
+
+func TestInsertSegmentsResume(t *testing.T) {
+	const total = 23
+	var dest []uint64
+	errKilled := errors.New("killed")
+
+	// copyFrom streams the keys after last into dest the way an inserter
+	// does, a chunk of 4 rows per statement, calling back for each row as
+	// it's buffered, and is killed once it has received killAt rows.
+	copyFrom := func(last uint64, killAt int) (string, int) {
+		tr := newKeyTracker(1, true, strconv.FormatUint(last, 10), int64(last))
+		rows := make(chan uint64)
+		go func() {
+			defer close(rows)
+			for k := last + 1; k <= total; k++ {
+				tr.push(k)
+				rows <- k
+			}
+		}()
+		received := 0
+		err := insertSegments(t.Context(), reflect.ValueOf(rows), 5, func(segment reflect.Value) error {
+			var chunk []uint64
+			for {
+				v, ok := segment.Recv()
+				if !ok {
+					break
+				}
+				received++
+				if received == killAt {
+					return errKilled
+				}
+				if chunk = append(chunk, v.Uint()); len(chunk) == 4 {
+					dest = append(dest, chunk...)
+					chunk = nil
+				}
+			}
+			dest = append(dest, chunk...)
+			return nil
+		}, func(n int64) {
+			tr.commit(0, n)
+		})
+		if killAt > 0 && !errors.Is(err, errKilled) {
+			t.Fatalf("insertSegments = %v, want it killed", err)
+		}
+		if killAt == 0 && err != nil {
+			t.Fatal(err)
+		}
+		for range rows {
+		}
+		c := &rangeCheckpoint{}
+		tr.snapshot(c, []string{"dest"})
+		return c.Destinations["dest"].Last, received
+	}
+
+	last, received := copyFrom(0, 13)
+	n, _ := strconv.ParseUint(last, 10, 64)
+	if int(n) >= received {
+		t.Fatalf("checkpoint at %d after receiving %d rows, want it behind the rows only buffered", n, received)
+	}
+	for k := uint64(1); k <= n; k++ {
+		if !slices.Contains(dest, k) {
+			t.Fatalf("checkpoint at %d, but row %d never reached the destination", n, k)
+		}
+	}
+
+	// Resuming trims the destination back to the checkpoint and copies the
+	// rest.
+	dest = slices.DeleteFunc(dest, func(k uint64) bool { return k > n })
+	copyFrom(n, 0)
+	want := make([]uint64, total)
+	for i := range want {
+		want[i] = uint64(i + 1)
+	}
+	if !slices.Equal(dest, want) {
+		t.Errorf("destination after resume = %v, want every row once", dest)
+	}
+}
+
+func TestCheckpointSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "orders.json")
+
+	got, err := loadCheckpoint(path)
+	if err != nil || got != nil {
+		t.Fatalf("loadCheckpoint on a missing file = %v, %v, want nil, nil", got, err)
+	}
+
+	c := &checkpoint{
+		Source:    "root@127.0.0.1:3306/prod",
+		Table:     "orders",
+		TempTable: "_swoof_orders",
+		Column:    "OrderID",
+		Ranges: []rangeCheckpoint{{
+			keyRange:     keyRange{Low: "10", High: "99"},
+			Destinations: map[string]destCheckpoint{"root@localhost:3306/dev": {Last: "42", Rows: 32}},
+		}},
+	}
+	if err := c.save(path); err != nil {
+		t.Fatal(err)
+	}
+	got, err = loadCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.UpdatedAt.Equal(c.UpdatedAt) {
+		t.Errorf("UpdatedAt = %v, want %v", got.UpdatedAt, c.UpdatedAt)
+	}
+	got.UpdatedAt = c.UpdatedAt
+	if !reflect.DeepEqual(got, c) {
+		t.Errorf("round trip = %+v, want %+v", got, c)
+	}
+
+	if err := removeCheckpoint(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := removeCheckpoint(path); err != nil {
+		t.Errorf("removing a missing checkpoint should be a no-op, got %v", err)
+	}
+}
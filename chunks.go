@@ -0,0 +1,67 @@
+package main
+
+import "github.com/pkg/errors"
+
+// keyRange selects primary keys in (Low, High]. An empty bound is unbounded,
+// so the first and last chunk also pick up rows inserted outside the
+// min/max the table was split on.
+type keyRange struct {
+	Low  string `json:"low,omitempty"`
+	High string `json:"high,omitempty"`
+}
+
+// conds returns the range as where-clause conditions on column, none for an
+// unbounded range.
+func (r keyRange) conds(column string) []string {
+	var conds []string
+	if r.Low != "" {
+		conds = append(conds, "`"+column+"`>"+r.Low)
+	}
+	if r.High != "" {
+		conds = append(conds, "`"+column+"`<="+r.High)
+	}
+	return conds
+}
+
+// splitKeyRange cuts [lo, hi] into at most n ranges of about the same width.
+// Tables with fewer distinct keys than n get fewer ranges, and gaps in the
+// key space mean equal widths aren't always equal row counts.
+func splitKeyRange(lo, hi keyValue, n int) []keyRange {
+	if n <= 1 || !lo.less(hi) {
+		return []keyRange{{}}
+	}
+
+	// Two's complement subtraction gives the width for signed keys too.
+	span := hi.bits - lo.bits
+	if span < uint64(n) {
+		n = int(span) + 1
+	}
+	// span*i/n without overflowing span*i.
+	step, rem := span/uint64(n), span%uint64(n)
+
+	ranges := make([]keyRange, n)
+	for i := 1; i < n; i++ {
+		offset := step*uint64(i) + rem*uint64(i)/uint64(n)
+		cut := keyValue{lo.bits + offset, lo.unsigned}.String()
+		ranges[i-1].High = cut
+		ranges[i].Low = cut
+	}
+	return ranges
+}
+
+// parseKeyBounds parses the min and max key a source reported. Either being
+// nil means the table (under its filter) is empty.
+func parseKeyBounds(lo, hi *string, unsigned bool) (keyValue, keyValue, bool, error) {
+	if lo == nil || hi == nil {
+		return keyValue{}, keyValue{}, false, nil
+	}
+	l, err := parseKey(*lo, unsigned)
+	if err != nil {
+		return keyValue{}, keyValue{}, false, errors.Wrapf(err, "parse min key %q", *lo)
+	}
+	h, err := parseKey(*hi, unsigned)
+	if err != nil {
+		return keyValue{}, keyValue{}, false, errors.Wrapf(err, "parse max key %q", *hi)
+	}
+	return l, h, true, nil
+}
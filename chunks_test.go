@@ -0,0 +1,82 @@
+package main
+
+import (
+	"math"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func TestSplitKeyRange(t *testing.T) {
+	key := func(s string, unsigned bool) keyValue {
+		t.Helper()
+		k, err := parseKey(s, unsigned)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return k
+	}
+
+	tests := []struct {
+		name     string
+		lo, hi   string
+		unsigned bool
+		n        int
+		want     []keyRange
+	}{
+		{"one chunk", "1", "100", false, 1, []keyRange{{}}},
+		{"single key", "7", "7", false, 4, []keyRange{{}}},
+		{"even split", "1", "100", false, 4, []keyRange{
+			{High: "25"}, {Low: "25", High: "50"}, {Low: "50", High: "75"}, {Low: "75"},
+		}},
+		{"fewer keys than chunks", "1", "3", false, 8, []keyRange{
+			{High: "1"}, {Low: "1", High: "2"}, {Low: "2"},
+		}},
+		{"spans zero", "-100", "100", false, 2, []keyRange{{High: "0"}, {Low: "0"}}},
+		{"full signed range", strconv.FormatInt(math.MinInt64, 10), strconv.FormatInt(math.MaxInt64, 10), false, 2, []keyRange{
+			{High: "-1"}, {Low: "-1"},
+		}},
+		{"full unsigned range", "0", strconv.FormatUint(math.MaxUint64, 10), true, 2, []keyRange{
+			{High: "9223372036854775807"}, {Low: "9223372036854775807"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitKeyRange(key(tt.lo, tt.unsigned), key(tt.hi, tt.unsigned), tt.n)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("splitKeyRange(%s, %s, %d) = %+v, want %+v", tt.lo, tt.hi, tt.n, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeyRangeConds(t *testing.T) {
+	tests := []struct {
+		r    keyRange
+		want []string
+	}{
+		{keyRange{}, nil},
+		{keyRange{High: "10"}, []string{"`id`<=10"}},
+		{keyRange{Low: "10"}, []string{"`id`>10"}},
+		{keyRange{Low: "-5", High: "10"}, []string{"`id`>-5", "`id`<=10"}},
+	}
+	for _, tt := range tests {
+		if got := tt.r.conds("id"); !slices.Equal(got, tt.want) {
+			t.Errorf("%+v.conds = %q, want %q", tt.r, got, tt.want)
+		}
+	}
+}
+
+func TestParseKeyBounds(t *testing.T) {
+	if _, _, ok, err := parseKeyBounds(nil, nil, false); ok || err != nil {
+		t.Errorf("empty table = %v, %v, want not ok and no error", ok, err)
+	}
+	lo, hi := "-3", "9"
+	l, h, ok, err := parseKeyBounds(&lo, &hi, false)
+	if err != nil || !ok || l.String() != "-3" || h.String() != "9" {
+		t.Errorf("parseKeyBounds = %v, %v, %v, %v", l, h, ok, err)
+	}
+	if _, _, _, err := parseKeyBounds(&lo, &hi, true); err == nil {
+		t.Error("negative key for an unsigned column should fail")
+	}
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/pkg/errors"
+	"github.com/posener/cmd"
+	"golang.org/x/term"
+)
+
+// runCleanup implements `swoof cleanup`, which finds what crashed runs left
+// on the given destinations, temp tables and the .incomplete and .old
+// directories beside file: targets, and removes them once confirmed.
+// Anything a running swoof holds a lease on is listed but left alone.
+func runCleanup(argv []string) {
+	c := cmd.New(cmd.OptName("swoof cleanup"))
+	connectionsFile := c.String("c", confDir+"/swoof/connections.yaml", "your connections file")
+	prefix := c.String("p", "_swoof_", "prefix of the temp tables to look for")
+	yes := c.Bool("yes", false, "removes what's found without asking")
+	args := c.Args("destinations", "destinations, ex:\n"+
+		"swoof cleanup [flags] localhost file:backups/production\n\n"+
+		"Destinations are given the same way as an import's.")
+	c.ParseArgs(append([]string{"swoof cleanup"}, argv...)...)
+
+	if len(*args) == 0 {
+		c.Usage()
+		os.Exit(2)
+	}
+
+	fatal := func(msg string, args ...any) {
+		slog.Error(msg, args...)
+		os.Exit(2)
+	}
+	if *prefix == "" {
+		fatal("-p can't be empty, or every table would be a temp table")
+	}
+
+	ctx := context.Background()
+	connections, _ := getConnections(*connectionsFile)
+
+	var found []leftover
+	for _, arg := range *args {
+		for _, name := range strings.Split(arg, ",") {
+			name = strings.TrimSpace(name)
+			if dir, ok := strings.CutPrefix(name, "file:"); ok {
+				l, err := findLeftoverDirs(name, dir)
+				if err != nil {
+					fatal("failed to look for leftover directories", "error", err, "destination", name)
+				}
+				found = append(found, l...)
+				continue
+			}
+			if _, ok, _ := openRowDest(name, rowDestOptions{}); ok || name == "clipboard" || isStdoutDest(name) {
+				fatal("cleanup only looks at database and file: destinations", "destination", name)
+			}
+			dsn, err := ensureUTCSession(resolveDSN(connections, name))
+			if err != nil {
+				fatal("failed to apply UTC session tz", "error", err, "destination", name)
+			}
+			l, err := findLeftoverTables(ctx, name, dsn, *prefix)
+			if err != nil {
+				fatal("failed to look for leftover temp tables", "error", err, "destination", name)
+			}
+			found = append(found, l...)
+		}
+	}
+
+	if len(found) == 0 {
+		fmt.Println("nothing to clean up")
+		return
+	}
+
+	bold := color.New(color.FgHiWhite).SprintFunc()
+	dim := color.New(color.FgHiBlack).SprintFunc()
+	yellow := color.New(color.FgHiYellow).SprintFunc()
+	removable := 0
+	for _, l := range found {
+		status := ""
+		if l.heldBy != "" {
+			status = "  " + yellow("in use by "+l.heldBy)
+		} else {
+			removable++
+		}
+		fmt.Printf("%s %s %s%s\n", bold(l.name), dim("on "+l.dest+","), formatLeftover(l.size, time.Since(l.modified)), status)
+	}
+	if removable == 0 {
+		fmt.Println("\neverything found is in use by a running swoof")
+		return
+	}
+
+	if !*yes {
+		if !term.IsTerminal(int(os.Stdin.Fd())) {
+			fatal("pass -yes to remove without being asked")
+		}
+		fmt.Printf("\nremove %d of these? [y/N] ", removable)
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+			return
+		}
+	}
+
+	failed := false
+	for _, l := range found {
+		if l.heldBy != "" {
+			continue
+		}
+		if err := l.remove(ctx); err != nil {
+			slog.Error("failed to remove", "error", err, "name", l.name, "destination", l.dest)
+			failed = true
+			continue
+		}
+		fmt.Printf("removed %s\n", l.name)
+	}
+	for _, l := range found {
+		if l.close != nil {
+			l.close()
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// leftover is a temp table or directory a run left behind.
+type leftover struct {
+	dest     string
+	name     string
+	size     int64
+	modified time.Time
+
+	// Who holds a lease on it, empty when nobody running does.
+	heldBy string
+
+	remove func(context.Context) error
+	close  func()
+}
+
+func formatLeftover(size int64, age time.Duration) string {
+	return formatBytes(size) + ", " + age.Round(time.Second).String() + " old"
+}
+
+// formatBytes renders a size in the powers of 1024 parseSize reads.
+func formatBytes(n int64) string {
+	const units = "KMGT"
+	if n < 1024 {
+		return strconv.FormatInt(n, 10) + "B"
+	}
+	v := float64(n)
+	i := -1
+	for v >= 1024 && i < len(units)-1 {
+		v /= 1024
+		i++
+	}
+	return strconv.FormatFloat(v, 'f', 1, 64) + string(units[i]) + "B"
+}
+
+// findLeftoverTables lists the temp tables on a database destination. Each
+// is dropped holding its lock, so a run can't start writing it meanwhile.
+func findLeftoverTables(ctx context.Context, dest, dsn, prefix string) ([]leftover, error) {
+	db, conn, schema, err := openLockConn(ctx, dsn)
+	if err != nil {
+		return nil, err
+	}
+	closeConn := func() {
+		conn.Close()
+		db.Close()
+	}
+
+	// Previous tables -keep-previous kept share the prefix, but they're
+	// there for swoof rollback, not left behind.
+	escape := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace
+	rows, err := conn.QueryContext(ctx, "select`TABLE_NAME`,"+
+		"coalesce(`DATA_LENGTH`,0)+coalesce(`INDEX_LENGTH`,0),"+
+		"cast(coalesce(`UPDATE_TIME`,`CREATE_TIME`)as char)"+
+		"from`INFORMATION_SCHEMA`.`TABLES`"+
+		"where`TABLE_SCHEMA`=database()"+
+		"and`TABLE_TYPE`='BASE TABLE'"+
+		"and`TABLE_NAME`like ?"+
+		"and`TABLE_NAME`not like ?"+
+		"order by`TABLE_NAME`", escape(prefix)+"%", escape(previousTable(prefix, ""))+"%")
+	if err != nil {
+		closeConn()
+		return nil, errors.Wrap(err, "select temp tables")
+	}
+	var found []leftover
+	for rows.Next() {
+		var name string
+		var size int64
+		var modified sql.NullString
+		if err := rows.Scan(&name, &size, &modified); err != nil {
+			rows.Close()
+			closeConn()
+			return nil, errors.Wrap(err, "select temp tables")
+		}
+		l := leftover{dest: dest, name: name, size: size}
+		l.modified, _ = time.ParseInLocation(time.DateTime, modified.String, time.UTC)
+		lock := tempTableLock(schema, name)
+		l.remove = func(ctx context.Context) error {
+			var got sql.NullInt64
+			if err := conn.QueryRowContext(ctx, "select get_lock(?,0)", lock).Scan(&got); err != nil {
+				return errors.Wrapf(err, "lock temp table %q", name)
+			}
+			if got.Int64 != 1 {
+				return errors.Errorf("a swoof started writing %q since it was listed", name)
+			}
+			defer conn.ExecContext(ctx, "do release_lock(?)", lock)
+			if _, err := conn.ExecContext(ctx, "drop table if exists`"+name+"`"); err != nil {
+				return errors.Wrapf(err, "drop temp table %q", name)
+			}
+			return nil
+		}
+		found = append(found, l)
+	}
+	if err := rows.Close(); err != nil {
+		closeConn()
+		return nil, errors.Wrap(err, "select temp tables")
+	}
+
+	for i := range found {
+		var holder sql.NullInt64
+		if err := conn.QueryRowContext(ctx, "select is_used_lock(?)", tempTableLock(schema, found[i].name)).Scan(&holder); err != nil {
+			closeConn()
+			return nil, errors.Wrapf(err, "check lock on temp table %q", found[i].name)
+		}
+		if holder.Valid {
+			found[i].heldBy = "connection " + strconv.FormatInt(holder.Int64, 10)
+		}
+	}
+	if len(found) == 0 {
+		closeConn()
+		return nil, nil
+	}
+	found[0].close = closeConn
+	return found, nil
+}
+
+// findLeftoverDirs lists the .incomplete and .old directories beside a
+// file: target. An .old one belongs to the run whose .incomplete it is
+// being swapped with.
+func findLeftoverDirs(dest, dir string) ([]leftover, error) {
+	incomplete, old := dir+".incomplete", dir+".old"
+	holder, leased := dirLeaseHolder(incomplete)
+	var heldBy string
+	if leased {
+		heldBy = "pid " + strconv.Itoa(holder.PID)
+		if holder.Host != "" {
+			heldBy += " on " + holder.Host
+		}
+	}
+
+	var found []leftover
+	for _, path := range []string{incomplete, old} {
+		fi, err := os.Stat(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !fi.IsDir() {
+			continue
+		}
+		l := leftover{dest: dest, name: path, modified: fi.ModTime(), heldBy: heldBy}
+		err = filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() {
+				l.size += info.Size()
+			}
+			if info.ModTime().After(l.modified) {
+				l.modified = info.ModTime()
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "read directory %q", path)
+		}
+		l.remove = func(context.Context) error {
+			if _, leased := dirLeaseHolder(incomplete); leased {
+				return errors.Errorf("a swoof started writing %q since it was listed", incomplete)
+			}
+			return os.RemoveAll(path)
+		}
+		found = append(found, l)
+	}
+	return found, nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTempTableLock(t *testing.T) {
+	if got := tempTableLock("shop", "_swoof_orders"); got != "swoof:shop._swoof_orders" {
+		t.Errorf("tempTableLock = %q", got)
+	}
+	long := tempTableLock("warehouse_reporting", "_swoof_"+strings.Repeat("x", 60))
+	if len(long) > 64 {
+		t.Errorf("tempTableLock = %q, longer than MySQL allows", long)
+	}
+	if long != tempTableLock("warehouse_reporting", "_swoof_"+strings.Repeat("x", 60)) {
+		t.Error("tempTableLock isn't stable")
+	}
+	if long == tempTableLock("warehouse_reporting", "_swoof_"+strings.Repeat("y", 60)) {
+		t.Error("tempTableLock gave two tables the same lock")
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	for _, tt := range []struct {
+		n    int64
+		want string
+	}{
+		{0, "0B"},
+		{1023, "1023B"},
+		{1024, "1.0KB"},
+		{1536, "1.5KB"},
+		{5 << 20, "5.0MB"},
+		{3 << 40, "3.0TB"},
+	} {
+		if got := formatBytes(tt.n); got != tt.want {
+			t.Errorf("formatBytes(%d) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestFindLeftoverDirs(t *testing.T) {
+	target := filepath.Join(t.TempDir(), "backup")
+
+	found, err := findLeftoverDirs("file:"+target, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 0 {
+		t.Fatalf("found %d leftovers beside a target without any", len(found))
+	}
+
+	// A run writing beside the last backup, halfway through the swap.
+	incomplete := target + ".incomplete"
+	if err := os.MkdirAll(filepath.Join(incomplete, "tables", "users"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(incomplete, "tables", "users", "data.sql"), make([]byte, 100), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(target+".old", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	lease, err := leaseDir(incomplete)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found, err = findLeftoverDirs("file:"+target, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 2 {
+		t.Fatalf("found %d leftovers, want 2", len(found))
+	}
+	for _, l := range found {
+		if !strings.HasPrefix(l.heldBy, "pid ") {
+			t.Errorf("%s heldBy = %q, want the running swoof", l.name, l.heldBy)
+		}
+	}
+	if found[0].size < 100 {
+		t.Errorf("size = %d, want at least the table's 100 bytes", found[0].size)
+	}
+
+	// A lease that's stopped being renewed is a crashed run's.
+	stale := time.Now().Add(-2 * dirLeaseTTL)
+	if err := os.Chtimes(filepath.Join(incomplete, dirLeaseFile), stale, stale); err != nil {
+		t.Fatal(err)
+	}
+	found, err = findLeftoverDirs("file:"+target, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, l := range found {
+		if l.heldBy != "" {
+			t.Errorf("%s heldBy = %q under a stale lease", l.name, l.heldBy)
+		}
+		if err := l.remove(t.Context()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lease.release()
+	for _, path := range []string{incomplete, target + ".old"} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s still exists after removal", path)
+		}
+	}
+}
+
+func TestDirLeaseRelease(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "backup.incomplete")
+	lease, err := leaseDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := dirLeaseHolder(dir); !ok {
+		t.Error("a fresh lease isn't held")
+	}
+	lease.release()
+	if _, ok := dirLeaseHolder(dir); ok {
+		t.Error("a released lease is still held")
+	}
+	if _, err := os.Stat(filepath.Join(dir, dirLeaseFile)); !os.IsNotExist(err) {
+		t.Error("release left the lease file behind")
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"net/url"
 	"os"
 
-	mysql "github.com/StirlingMarketingGroup/cool-mysql"
 	mysqldriver "github.com/go-sql-driver/mysql"
 	"github.com/pkg/errors"
 	"gopkg.in/yaml.v2"
@@ -63,11 +62,32 @@ func connectionToDSN(c connection) string {
 	return dsn
 }
 
+// dsnTarget reduces a DSN to the user@host/schema it points at, so two
+// spellings of the same server compare equal. Unparseable DSNs are returned
+// as-is.
+func dsnTarget(dsn string) string {
+	cfg, err := mysqldriver.ParseDSN(dsn)
+	if err != nil {
+		return dsn
+	}
+	return cfg.User + "@" + cfg.Addr + "/" + cfg.DBName
+}
+
+// resolveDSN returns the DSN for a named connection, or name itself when
+// it isn't one, for commands that only read and don't need the import's
+// source/dest-only checks.
+func resolveDSN(connections map[string]connection, name string) string {
+	if c, ok := connections[name]; ok {
+		return connectionToDSN(c)
+	}
+	return name
+}
+
 // checkIfInSource is a wrapper function that checks if the
 // the table for a given connection exists and panics if
 // if there is no table in that connection
-func checkIfInSource(s *mysql.Database, t string) {
-	if ok, err := s.Exists("show tables like'"+t+"'", 0); err != nil {
+func checkIfInSource(s tableCatalog, t string) {
+	if ok, err := s.tableExists(t); err != nil {
 		panic(err)
 	} else if !ok {
 		panic(errors.Errorf("table %q does not exist on the source connection", t))
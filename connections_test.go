@@ -58,3 +58,22 @@ func TestConnectionToDSN(t *testing.T) {
 		})
 	}
 }
+
+func TestDSNTarget(t *testing.T) {
+	tests := []struct {
+		name string
+		dsn  string
+		want string
+	}{
+		{"ignores password and params", "root:secret@tcp(localhost:3306)/mydb?parseTime=true", "root@localhost:3306/mydb"},
+		{"same target different password", "root:other@tcp(localhost:3306)/mydb", "root@localhost:3306/mydb"},
+		{"unparseable falls back to input", "::not a dsn::", "::not a dsn::"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := dsnTarget(tt.dsn); got != tt.want {
+				t.Errorf("dsnTarget(%q) = %q, want %q", tt.dsn, got, tt.want)
+			}
+		})
+	}
+}
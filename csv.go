@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
+// csvDest writes each table to <dir>/<table>.csv, with a header row and
+// RFC 4180 quoting, or with a tab delimiter to .tsv for a tsv: destination.
+// With a split size, a table is written to numbered parts instead, each
+// with its own header: <table>-000001.csv and on.
+type csvDest struct {
+	dir   string
+	comma rune
+	ext   string
+	opts  rowDestOptions
+}
+
+func newCSVDest(dir string, comma rune, opts rowDestOptions) (*csvDest, error) {
+	ext := "csv"
+	if comma == '\t' {
+		ext = "tsv"
+	}
+	if dir == "" {
+		return nil, errors.Errorf("%s: destination needs a directory", ext)
+	}
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, errors.Wrapf(err, "create %s directory %q", ext, dir)
+	}
+	return &csvDest{dir: dir, comma: comma, ext: ext, opts: opts}, nil
+}
+
+func (d *csvDest) key() string {
+	if abs, err := filepath.Abs(d.dir); err == nil {
+		return d.ext + ":" + abs
+	}
+	return d.ext + ":" + d.dir
+}
+
+func (d *csvDest) openTable(rt rowTable) (tableWriter, error) {
+	t := &csvTable{
+		dest:    d,
+		files:   &tableFiles{dir: d.dir, table: rt.name, ext: d.ext, splitSize: d.opts.splitSize},
+		columns: rt.columns,
+		header:  make([]string, len(rt.columns)),
+		record:  make([]string, len(rt.columns)),
+	}
+	for i, c := range rt.columns {
+		t.header[i] = c.name
+	}
+	if err := t.startPart(); err != nil {
+		t.abort()
+		return nil, err
+	}
+	return t, nil
+}
+
+// csvTable writes a table's parts through a csv writer each.
+type csvTable struct {
+	dest    *csvDest
+	files   *tableFiles
+	columns []rowColumn
+	header  []string
+	record  []string
+	w       *csv.Writer
+}
+
+func (t *csvTable) startPart() error {
+	f, err := t.files.startPart()
+	if err != nil {
+		return err
+	}
+	t.w = csv.NewWriter(f)
+	t.w.Comma = t.dest.comma
+	return t.w.Write(t.header)
+}
+
+func (t *csvTable) finishPart() error {
+	t.w.Flush()
+	err := t.w.Error()
+	if cerr := t.files.finishPart(); err == nil {
+		err = cerr
+	}
+	return errors.Wrapf(err, "write %s file for %q", t.dest.ext, t.files.table)
+}
+
+func (t *csvTable) write(row reflect.Value) error {
+	if !t.files.open() {
+		// The last row filled the previous part.
+		if err := t.startPart(); err != nil {
+			return err
+		}
+	}
+	for i, c := range t.columns {
+		s, ok := fieldText(c, row.Field(i), t.dest.opts.binaryEncoding)
+		if !ok {
+			s = t.dest.opts.null
+		}
+		t.record[i] = s
+	}
+	if err := t.w.Write(t.record); err != nil {
+		return errors.Wrapf(err, "write %s row for %q", t.dest.ext, t.files.table)
+	}
+	if t.files.full() {
+		return t.finishPart()
+	}
+	return nil
+}
+
+func (t *csvTable) commit() error {
+	if t.files.open() {
+		if err := t.finishPart(); err != nil {
+			return err
+		}
+	}
+	return t.files.commit()
+}
+
+func (t *csvTable) abort() error {
+	return t.files.abort()
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	dynamicstruct "github.com/Ompluscator/dynamic-struct"
+	mysql "github.com/StirlingMarketingGroup/cool-mysql"
+)
+
+var testRowColumns = []rowColumn{
+	{"ID", "int", "int unsigned", false},
+	{"Name", "varchar", "varchar(50)", true},
+	{"Price", "decimal", "decimal(10,2)", true},
+	{"Photo", "blob", "blob", true},
+	{"Flags", "bit", "bit(10)", true},
+	{"Ratio", "float", "float", true},
+}
+
+// testRows builds rows of a struct like the one main builds for columns,
+// each given as the values the driver would scan, nil for NULL.
+func testRows(t *testing.T, columns []rowColumn, rows ...[]any) []reflect.Value {
+	t.Helper()
+	s := dynamicstruct.NewStruct()
+	for i, c := range columns {
+		v, ok := rowField(c.dataType, strings.HasSuffix(c.columnType, " unsigned"), false)
+		if !ok {
+			t.Fatalf("no field for %q", c.dataType)
+		}
+		s.AddField("F"+string(rune('A'+i)), v, `mysql:"`+c.name+`"`)
+	}
+	structType := reflect.TypeOf(s.Build().New()).Elem()
+
+	var out []reflect.Value
+	for _, values := range rows {
+		row := reflect.New(structType).Elem()
+		for i, v := range values {
+			if v == nil {
+				continue
+			}
+			p := reflect.New(structType.Field(i).Type.Elem())
+			p.Elem().Set(reflect.ValueOf(v).Convert(p.Elem().Type()))
+			row.Field(i).Set(p)
+		}
+		out = append(out, row)
+	}
+	return out
+}
+
+func writeTable(t *testing.T, d rowDest, table string, columns []rowColumn, rows []reflect.Value) {
+	t.Helper()
+	w, err := d.openTable(rowTable{name: table, columns: columns})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range rows {
+		if err := w.write(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.commit(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func dirFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names
+}
+
+func TestCSVDest(t *testing.T) {
+	dir := t.TempDir()
+	d, ok, err := openRowDest("csv:"+dir, rowDestOptions{null: `\N`, binaryEncoding: "hex"})
+	if !ok || err != nil {
+		t.Fatalf("openRowDest = %v, %v", ok, err)
+	}
+
+	writeTable(t, d, "products", testRowColumns, testRows(t, testRowColumns,
+		[]any{uint32(1), "Widget, large", mysql.Raw("9.99"), []byte{0xde, 0xad}, []byte{0x02, 0x01}, 0.1},
+		[]any{uint32(2), "say \"hi\"\nagain", nil, nil, nil, nil},
+		[]any{uint32(3), "", mysql.Raw("0.00"), []byte{}, []byte{0}, 3.5},
+	))
+
+	got, err := os.ReadFile(filepath.Join(dir, "products.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "ID,Name,Price,Photo,Flags,Ratio\n" +
+		"1,\"Widget, large\",9.99,dead,513,0.1\n" +
+		"2,\"say \"\"hi\"\"\nagain\",\\N,\\N,\\N,\\N\n" +
+		"3,,0.00,,0,3.5\n"
+	if string(got) != want {
+		t.Errorf("products.csv =\n%s\nwant\n%s", got, want)
+	}
+	if files := dirFiles(t, dir); !slices.Equal(files, []string{"products.csv"}) {
+		t.Errorf("files = %v, want only products.csv", files)
+	}
+}
+
+func TestCSVDestTSVBase64(t *testing.T) {
+	dir := t.TempDir()
+	d, _, err := openRowDest("tsv:"+dir, rowDestOptions{binaryEncoding: "base64"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTable(t, d, "products", testRowColumns, testRows(t, testRowColumns,
+		[]any{uint32(1), "tab\there", nil, []byte{0xde, 0xad}, nil, nil},
+	))
+	got, err := os.ReadFile(filepath.Join(dir, "products.tsv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "ID\tName\tPrice\tPhoto\tFlags\tRatio\n1\t\"tab\there\"\t\t3q0=\t\t\n"; string(got) != want {
+		t.Errorf("products.tsv = %q, want %q", got, want)
+	}
+}
+
+func TestCSVDestSplitAndReplace(t *testing.T) {
+	dir := t.TempDir()
+
+	// A previous unsplit copy, and more parts than this run will write.
+	for _, name := range []string{"orders.csv", "orders-000001.csv", "orders-000009.csv", "orders_archive.csv"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("old"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Every flush of the csv writer's buffer passes the size, so each part
+	// holds one buffer's worth.
+	d, _, err := openRowDest("csv:"+dir, rowDestOptions{binaryEncoding: "hex", splitSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	big := make([]byte, 3000)
+	var rows [][]any
+	for i := range 4 {
+		rows = append(rows, []any{uint32(i), "row", nil, big, nil, nil})
+	}
+	writeTable(t, d, "orders", testRowColumns, testRows(t, testRowColumns, rows...))
+
+	files := dirFiles(t, dir)
+	if want := []string{"orders-000001.csv", "orders-000002.csv", "orders-000003.csv", "orders-000004.csv", "orders_archive.csv"}; !slices.Equal(files, want) {
+		t.Fatalf("files = %v, want %v", files, want)
+	}
+	for _, name := range files[:4] {
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(b[:len("ID,Name")], []byte("ID,Name")) {
+			t.Errorf("%s doesn't start with the header", name)
+		}
+	}
+}
+
+func TestCSVDestAbort(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "orders.csv"), []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	d, _, err := openRowDest("csv:"+dir, rowDestOptions{binaryEncoding: "hex"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := d.openTable(rowTable{name: "orders", columns: testRowColumns})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.write(testRows(t, testRowColumns, []any{uint32(1), nil, nil, nil, nil, nil})[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.abort(); err != nil {
+		t.Fatal(err)
+	}
+	if files := dirFiles(t, dir); !slices.Equal(files, []string{"orders.csv"}) {
+		t.Errorf("files = %v, want the old orders.csv left alone", files)
+	}
+	if b, _ := os.ReadFile(filepath.Join(dir, "orders.csv")); string(b) != "old" {
+		t.Errorf("orders.csv = %q, want the old copy", b)
+	}
+
+	if _, _, err := openRowDest("csv:"+dir, rowDestOptions{binaryEncoding: "base32"}); err == nil {
+		t.Error("an unknown binary encoding should fail")
+	}
+	if _, ok, _ := openRowDest("user:pass@tcp(localhost)/db", rowDestOptions{}); ok {
+		t.Error("a DSN isn't a row destination")
+	}
+}
@@ -0,0 +1,609 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// csvSource is a directory of CSV files used as a source, each file a table
+// named after it, or a tsv: directory of tab-delimited ones. The numbered
+// parts a split csv: destination writes are read back as one table. Each
+// table's file is scanned when it starts, then loaded through a temp table
+// with generated inserts and swapped in at finalization, like a dump.
+type csvSource struct {
+	dir   string
+	comma rune
+	ext   string
+
+	// A field equal to this is loaded as NULL.
+	null string
+
+	// hex or base64, how binary columns' values are written.
+	binaryEncoding string
+
+	// Set to guess column types for tables without a <table>.sql.
+	infer bool
+
+	tempPrefix string
+
+	// Each table's files, parts in order.
+	tables map[string][]string
+}
+
+// Bytes of CSV per generated insert, which the hex literals roughly double.
+const csvInsertSize = 1 << 20
+
+func openCSVSource(dir string, comma rune, null, binaryEncoding string, infer bool, tempPrefix string) (*csvSource, error) {
+	ext := "csv"
+	if comma == '\t' {
+		ext = "tsv"
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "list %s directory %q", ext, dir)
+	}
+	s := &csvSource{dir: dir, comma: comma, ext: ext, null: null, binaryEncoding: binaryEncoding, infer: infer, tempPrefix: tempPrefix, tables: make(map[string][]string)}
+
+	partRegexp := regexp.MustCompile(`^(.+)-[0-9]{6}\.` + ext + `$`)
+	whole := make(map[string]bool)
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || strings.HasPrefix(name, ".") || !strings.HasSuffix(name, "."+ext) {
+			continue
+		}
+		table := strings.TrimSuffix(name, "."+ext)
+		if m := partRegexp.FindStringSubmatch(name); m != nil {
+			table = m[1]
+		} else {
+			whole[table] = true
+		}
+		s.tables[table] = append(s.tables[table], filepath.Join(dir, name))
+	}
+	if len(s.tables) == 0 {
+		return nil, errors.Errorf("%q has no .%s files", dir, ext)
+	}
+	for table, files := range s.tables {
+		if whole[table] && len(files) > 1 {
+			return nil, errors.Errorf("%q has both %s.%s and numbered parts of it", dir, table, ext)
+		}
+		slices.Sort(files)
+	}
+	return s, nil
+}
+
+func (s *csvSource) names() []string {
+	names := make([]string, 0, len(s.tables))
+	for name := range s.tables {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func (s *csvSource) tableExists(name string) (bool, error) {
+	_, ok := s.tables[name]
+	return ok, nil
+}
+
+func (s *csvSource) matchTables(pattern string) ([]string, error) {
+	var matched []string
+	for _, n := range s.names() {
+		ok, err := path.Match(pattern, n)
+		if err != nil {
+			return nil, errors.Wrapf(err, "match pattern %q", pattern)
+		}
+		if ok {
+			matched = append(matched, n)
+		}
+	}
+	return matched, nil
+}
+
+func (s *csvSource) tablesExcept(exclude []string) ([]string, error) {
+	return slices.DeleteFunc(s.names(), func(n string) bool {
+		return slices.Contains(exclude, n)
+	}), nil
+}
+
+// File sizes stand in for data_length+index_length.
+func (s *csvSource) tablesBySize(names []string) ([]string, error) {
+	sizes := make(map[string]int64, len(names))
+	var ordered []string
+	for _, n := range names {
+		if _, ok := s.tables[n]; !ok || slices.Contains(ordered, n) {
+			continue
+		}
+		for _, f := range s.tables[n] {
+			info, err := os.Stat(f)
+			if err != nil {
+				return nil, errors.Wrapf(err, "stat %q", f)
+			}
+			sizes[n] += info.Size()
+		}
+		ordered = append(ordered, n)
+	}
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return sizes[ordered[i]] > sizes[ordered[j]]
+	})
+	return ordered, nil
+}
+
+// A CSV directory has no views, triggers or routines.
+func (s *csvSource) routineFiles(kind string) ([]string, error) {
+	return nil, nil
+}
+
+// csvBatch is a run of records in one file that becomes one insert.
+type csvBatch struct {
+	file       string
+	start, end int64
+	rows       int64
+}
+
+// planTable scans the table's files for the batches to insert and, without
+// a <table>.sql beside them, the column types, then builds the statements a
+// live import would run: create the temp table, insert into it, and at
+// finalization swap it in and add any foreign keys from the .sql back.
+func (s *csvSource) planTable(table string) (tableReplay, error) {
+	files, ok := s.tables[table]
+	if !ok {
+		return tableReplay{}, errors.Errorf("%s directory %q has no table %q", s.ext, s.dir, table)
+	}
+
+	create, constraints, err := s.companionDDL(table)
+	if err != nil {
+		return tableReplay{}, err
+	}
+	if create == "" && !s.infer {
+		return tableReplay{}, errors.Errorf("%s has no %s.sql with its CREATE TABLE, add one or use -csv-schema infer", filepath.Join(s.dir, table+"."+s.ext), table)
+	}
+
+	var header []string
+	var inferred []*inferredColumn
+	var batches []csvBatch
+	for _, file := range files {
+		fileBatches, err := s.scan(file, func(h []string) error {
+			if header == nil {
+				header = h
+				for range h {
+					inferred = append(inferred, newInferredColumn())
+				}
+				return nil
+			}
+			if !slices.Equal(h, header) {
+				return errors.Errorf("%q has a different header than %q", file, files[0])
+			}
+			return nil
+		}, func(record []string) {
+			if create != "" {
+				return
+			}
+			for i, v := range record {
+				inferred[i].add(v, v == s.null)
+			}
+		})
+		if err != nil {
+			return tableReplay{}, err
+		}
+		batches = append(batches, fileBatches...)
+	}
+
+	columns := make([]string, len(header))
+	for i, name := range header {
+		columns[i] = "`" + strings.ReplaceAll(name, "`", "``") + "`"
+	}
+
+	// How each column's values are written, from the types in the .sql or
+	// the ones inferred.
+	kinds := make([]csvValueKind, len(header))
+	tempTable := s.tempPrefix + table
+	if create != "" {
+		types := createColumnTypes(create)
+		for i, name := range header {
+			kinds[i] = csvKindOf(types[strings.ToLower(name)])
+		}
+	} else {
+		defs := make([]string, len(header))
+		for i, c := range inferred {
+			colType := c.columnType()
+			if c.numeric() {
+				kinds[i] = csvNumber
+			}
+			defs[i] = columns[i] + colType
+			if c.nulls {
+				defs[i] += " null"
+			} else {
+				defs[i] += " not null"
+			}
+		}
+		create = "(" + strings.Join(defs, ",") + ")"
+	}
+
+	plan := tableReplay{
+		load: []replayStatement{
+			fixedStatement("drop table if exists`" + tempTable + "`"),
+			fixedStatement("create table`" + tempTable + "`" + create),
+		},
+		finalize: []replayStatement{
+			fixedStatement("drop table if exists`" + table + "`"),
+			fixedStatement("alter table`" + tempTable + "`rename`" + table + "`"),
+		},
+		inserts:   len(batches),
+		retryable: true,
+	}
+	prefix := "insert into`" + tempTable + "`(" + strings.Join(columns, ",") + ")values"
+	for _, b := range batches {
+		plan.load = append(plan.load, replayStatement{
+			name:   fmt.Sprintf("%s at byte %d", b.file, b.start),
+			insert: true,
+			rows:   b.rows,
+			read: func() (string, error) {
+				return s.insert(b, prefix, header, kinds)
+			},
+		})
+	}
+	if constraints != "" {
+		plan.finalize = append(plan.finalize, fixedStatement(addConstraints(table, constraints)))
+	}
+	return plan, nil
+}
+
+// companionDDL reads the CREATE TABLE in <table>.sql, if there is one,
+// returning what follows the table's name without its foreign keys, and the
+// foreign keys.
+func (s *csvSource) companionDDL(table string) (string, string, error) {
+	file := filepath.Join(s.dir, table+".sql")
+	f, err := os.Open(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", "", nil
+	}
+	if err != nil {
+		return "", "", errors.Wrapf(err, "open %q", file)
+	}
+	defer f.Close()
+
+	var suffix string
+	err = scanStatements(bufio.NewReader(f), func(stmt string, start int64) error {
+		body, _ := statementBody(stmt)
+		if suffix != "" || !strings.HasPrefix(strings.ToLower(body[:min(len(body), 32)]), "create table") {
+			return nil
+		}
+		_, rest, ok := cutCreateTable(body)
+		if !ok {
+			return errors.Errorf("unreadable table name in CREATE TABLE at byte %d", start)
+		}
+		suffix = rest
+		return nil
+	})
+	if err != nil {
+		return "", "", errors.Wrapf(err, "read %q", file)
+	}
+	if suffix == "" {
+		return "", "", errors.Errorf("%q has no CREATE TABLE statement", file)
+	}
+	create, constraints := splitConstraints(suffix)
+	return create, constraints, nil
+}
+
+func (s *csvSource) reader(r io.Reader) *csv.Reader {
+	cr := csv.NewReader(r)
+	cr.Comma = s.comma
+	return cr
+}
+
+// scan reads a file through once, checking its header with onHeader and
+// passing every record to onRecord, and cuts it into batches of about
+// csvInsertSize bytes.
+func (s *csvSource) scan(file string, onHeader func([]string) error, onRecord func([]string)) ([]csvBatch, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, errors.Wrapf(err, "open %q", file)
+	}
+	defer f.Close()
+
+	cr := s.reader(bufio.NewReader(f))
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, errors.Errorf("%q is empty, it needs at least a header row", file)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "read %q", file)
+	}
+	header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	seen := make(map[string]bool, len(header))
+	for _, name := range header {
+		if name == "" {
+			return nil, errors.Errorf("%q has an empty column name in its header", file)
+		}
+		if seen[strings.ToLower(name)] {
+			return nil, errors.Errorf("%q has column %q twice in its header", file, name)
+		}
+		seen[strings.ToLower(name)] = true
+	}
+	if err := onHeader(header); err != nil {
+		return nil, err
+	}
+
+	var batches []csvBatch
+	batch := csvBatch{file: file, start: cr.InputOffset()}
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "read %q", file)
+		}
+		onRecord(record)
+		batch.rows++
+		batch.end = cr.InputOffset()
+		if batch.end-batch.start >= csvInsertSize {
+			batches = append(batches, batch)
+			batch = csvBatch{file: file, start: batch.end}
+		}
+	}
+	if batch.rows > 0 {
+		batches = append(batches, batch)
+	}
+	return batches, nil
+}
+
+// csvValueKind is how a column's values are written into an insert.
+type csvValueKind int
+
+const (
+	// Text, for the server to convert to the column's type.
+	csvText csvValueKind = iota
+
+	// Numbers, written as is, which bit columns need too: a csv:
+	// destination writes their value, not their bytes.
+	csvNumber
+
+	// Binary, decoded from -binary-encoding, as a csv: destination writes
+	// it.
+	csvBinary
+)
+
+// csvKindOf is the kind of a column's values by its data type.
+func csvKindOf(dataType string) csvValueKind {
+	if isBinaryType(dataType) || isSpatialType(dataType) || dataType == "vector" {
+		return csvBinary
+	}
+	switch dataType {
+	case "tinyint", "smallint", "mediumint", "int", "integer", "bigint",
+		"decimal", "numeric", "dec", "fixed", "float", "double", "real", "bit", "bool", "boolean":
+		return csvNumber
+	}
+	return csvText
+}
+
+// createColumnTypes reads the data type of each column of a CREATE TABLE,
+// keyed by its lowercased name, since column names aren't case sensitive.
+func createColumnTypes(create string) map[string]string {
+	types := make(map[string]string)
+	for _, line := range strings.Split(create, "\n") {
+		def := strings.TrimSpace(line)
+		if !strings.HasPrefix(def, "`") {
+			continue
+		}
+		name, n, ok := parseIdentifier(def)
+		if !ok {
+			continue
+		}
+		rest := strings.TrimSpace(def[n:])
+		end := strings.IndexAny(rest, " (,")
+		if end < 0 {
+			end = len(rest)
+		}
+		types[strings.ToLower(name)] = strings.ToLower(rest[:end])
+	}
+	return types
+}
+
+// csvNumberRegexp matches the numbers written as is, which anything else in
+// a number column isn't, so it can't end up in the statement unquoted.
+var csvNumberRegexp = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?([eE][-+]?[0-9]+)?$`)
+
+// insert reads a batch's records back and writes them as one insert.
+func (s *csvSource) insert(b csvBatch, prefix string, header []string, kinds []csvValueKind) (string, error) {
+	f, err := os.Open(b.file)
+	if err != nil {
+		return "", errors.Wrapf(err, "open %q", b.file)
+	}
+	defer f.Close()
+
+	cr := s.reader(io.NewSectionReader(f, b.start, b.end-b.start))
+	cr.FieldsPerRecord = len(header)
+	cr.ReuseRecord = true
+
+	var sb strings.Builder
+	sb.Grow(len(prefix) + int(b.end-b.start)*2)
+	sb.WriteString(prefix)
+	for i := int64(0); ; i++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", errors.Wrapf(err, "read %q at byte %d", b.file, b.start)
+		}
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteByte('(')
+		for j, v := range record {
+			if j > 0 {
+				sb.WriteByte(',')
+			}
+			switch {
+			case v == s.null:
+				sb.WriteString("null")
+			case kinds[j] == csvBinary:
+				var data []byte
+				var err error
+				if s.binaryEncoding == "base64" {
+					data, err = base64.StdEncoding.DecodeString(v)
+				} else {
+					data, err = hex.DecodeString(v)
+				}
+				if err != nil {
+					return "", errors.Wrapf(err, "column %q of %q near byte %d isn't %s", header[j], b.file, b.start, s.binaryEncoding)
+				}
+				sb.WriteString("x'")
+				sb.WriteString(hex.EncodeToString(data))
+				sb.WriteByte('\'')
+			case kinds[j] == csvNumber && csvNumberRegexp.MatchString(v):
+				sb.WriteString(v)
+			case v == "":
+				sb.WriteString("''")
+			default:
+				sb.WriteString("convert(0x")
+				sb.WriteString(hex.EncodeToString([]byte(v)))
+				sb.WriteString(" using utf8mb4)")
+			}
+		}
+		sb.WriteByte(')')
+	}
+	return sb.String(), nil
+}
+
+var (
+	csvIntRegexp      = regexp.MustCompile(`^-?(0|[1-9][0-9]*)$`)
+	csvDecimalRegexp  = regexp.MustCompile(`^-?(0|[1-9][0-9]*)\.([0-9]+)$`)
+	csvDoubleRegexp   = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?[eE][-+]?[0-9]+$`)
+	csvDatetimeRegexp = regexp.MustCompile(`^([0-9]{4}-[0-9]{2}-[0-9]{2})([ T][0-9]{2}:[0-9]{2}:[0-9]{2}(\.([0-9]{1,6}))?)?$`)
+)
+
+// inferredColumn narrows a column's type down as its values are seen. Each
+// value rules out the kinds it doesn't fit, and the narrowest kind left
+// standing at the end is the column's type. Numbers with leading zeros,
+// like zip codes, stay text so the zeros aren't lost.
+type inferredColumn struct {
+	values int64
+	nulls  bool
+
+	maxRunes, maxBytes int
+
+	integer, decimal, double bool
+	date, datetime           bool
+
+	// Digits before and after the point, for a decimal's precision.
+	intDigits, scale int
+
+	// The range of integers that fit an int64, and whether any needed a
+	// uint64 or more.
+	min, max              int64
+	haveRange             bool
+	bigUnsigned, tooLarge bool
+
+	// Fractional second digits, for datetime(fsp).
+	fsp int
+}
+
+func newInferredColumn() *inferredColumn {
+	return &inferredColumn{integer: true, decimal: true, double: true, date: true, datetime: true}
+}
+
+func (c *inferredColumn) add(v string, null bool) {
+	if null {
+		c.nulls = true
+		return
+	}
+	c.values++
+	c.maxBytes = max(c.maxBytes, len(v))
+	c.maxRunes = max(c.maxRunes, utf8.RuneCountInString(v))
+
+	if m := csvDatetimeRegexp.FindStringSubmatch(v); m != nil {
+		c.integer, c.decimal, c.double = false, false, false
+		if _, err := time.Parse(time.DateOnly, m[1]); err != nil {
+			c.date, c.datetime = false, false
+			return
+		}
+		if m[2] != "" {
+			c.date = false
+			c.fsp = max(c.fsp, len(m[4]))
+			if _, err := time.Parse("15:04:05", m[2][1:9]); err != nil {
+				c.datetime = false
+			}
+		}
+		return
+	}
+	c.date, c.datetime = false, false
+
+	switch {
+	case csvIntRegexp.MatchString(v):
+		c.intDigits = max(c.intDigits, len(strings.TrimPrefix(v, "-")))
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			if !c.haveRange {
+				c.min, c.max, c.haveRange = n, n, true
+			}
+			c.min, c.max = min(c.min, n), max(c.max, n)
+		} else if _, err := strconv.ParseUint(v, 10, 64); err == nil {
+			c.bigUnsigned = true
+		} else {
+			c.tooLarge = true
+		}
+	case csvDecimalRegexp.MatchString(v):
+		m := csvDecimalRegexp.FindStringSubmatch(v)
+		c.integer = false
+		c.intDigits = max(c.intDigits, len(m[1]))
+		c.scale = max(c.scale, len(m[2]))
+	case csvDoubleRegexp.MatchString(v):
+		c.integer, c.decimal = false, false
+	default:
+		c.integer, c.decimal, c.double = false, false, false
+	}
+}
+
+func (c *inferredColumn) numeric() bool {
+	t := c.columnType()
+	return t == "int" || t == "bigint" || t == "bigint unsigned" || t == "double" || strings.HasPrefix(t, "decimal")
+}
+
+func (c *inferredColumn) columnType() string {
+	switch {
+	case c.values == 0:
+		return "varchar(255)"
+	case c.integer && !c.bigUnsigned && !c.tooLarge:
+		if c.min >= math.MinInt32 && c.max <= math.MaxInt32 {
+			return "int"
+		}
+		return "bigint"
+	case c.integer && c.bigUnsigned && !c.tooLarge && c.min >= 0:
+		return "bigint unsigned"
+	case (c.integer || c.decimal) && c.intDigits+c.scale <= 65 && c.scale <= 30:
+		return fmt.Sprintf("decimal(%d,%d)", c.intDigits+c.scale, c.scale)
+	case c.double && !c.integer && !c.decimal:
+		return "double"
+	case c.date:
+		return "date"
+	case c.datetime && c.fsp > 0:
+		return fmt.Sprintf("datetime(%d)", c.fsp)
+	case c.datetime:
+		return "datetime"
+	case c.maxRunes <= 255:
+		return "varchar(255)"
+	case c.maxBytes <= math.MaxUint16:
+		return "text"
+	case c.maxBytes <= 1<<24-1:
+		return "mediumtext"
+	}
+	return "longtext"
+}
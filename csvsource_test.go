@@ -0,0 +1,241 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func textLiteral(s string) string {
+	return "convert(0x" + hex.EncodeToString([]byte(s)) + " using utf8mb4)"
+}
+
+func TestCSVSource(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"customers.csv":     "\ufeffID,Name\n1,\"Smith, Jo\"\n2,\n",
+		"customers.sql":     "-- exported by hand\nCREATE TABLE `customers` (\n  `ID` int NOT NULL,\n  `Name` varchar(50),\n  PRIMARY KEY (`ID`),\n  CONSTRAINT `customers_ibfk_1` FOREIGN KEY (`ID`) REFERENCES `accounts` (`ID`)\n);\n",
+		"orders-000001.csv": "ID,Total,Placed,Zip\n1,9.99,2026-01-02 03:04:05,02134\n",
+		"orders-000002.csv": "ID,Total,Placed,Zip\n3000000000,10,2026-01-03 00:00:00.25,\n",
+		"notes.txt":         "not a table",
+		".orders-1.csv.tmp": "ID\n",
+	})
+
+	s, err := openCSVSource(dir, ',', "", "hex", false, "_swoof_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := s.names(); !slices.Equal(names, []string{"customers", "orders"}) {
+		t.Errorf("tables = %v, want customers and orders", names)
+	}
+	ordered, err := s.tablesBySize([]string{"customers", "orders", "customers"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"orders", "customers"}; !slices.Equal(ordered, want) {
+		t.Errorf("tablesBySize = %v, want %v", ordered, want)
+	}
+
+	plan, err := s.planTable("customers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"drop table if exists`_swoof_customers`",
+		"create table`_swoof_customers` (\n  `ID` int NOT NULL,\n  `Name` varchar(50),\n  PRIMARY KEY (`ID`)\n)",
+		"insert into`_swoof_customers`(`ID`,`Name`)values(1," + textLiteral("Smith, Jo") + "),(2,null)",
+	}
+	if got := readAll(t, plan.load); !slices.Equal(got, want) {
+		t.Errorf("customers load =\n%q\nwant\n%q", got, want)
+	}
+	finalize := readAll(t, plan.finalize)
+	if len(finalize) != 3 || !addConstraintRegexp.MatchString(finalize[2]) {
+		t.Errorf("customers finalize = %q, want the swap and its foreign key", finalize)
+	}
+	if rows, ok := plan.countRows(); !ok || rows != 2 {
+		t.Errorf("countRows = %d, %v, want 2", rows, ok)
+	}
+
+	if _, err := s.planTable("orders"); err == nil || !strings.Contains(err.Error(), "-csv-schema infer") {
+		t.Errorf("planTable without a .sql or inference = %v, want an error pointing at -csv-schema", err)
+	}
+
+	s.infer = true
+	plan, err = s.planTable("orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []string{
+		"drop table if exists`_swoof_orders`",
+		"create table`_swoof_orders`(`ID`bigint not null,`Total`decimal(4,2) not null,`Placed`datetime(2) not null,`Zip`varchar(255) null)",
+		"insert into`_swoof_orders`(`ID`,`Total`,`Placed`,`Zip`)values(1,9.99," + textLiteral("2026-01-02 03:04:05") + "," + textLiteral("02134") + ")",
+		"insert into`_swoof_orders`(`ID`,`Total`,`Placed`,`Zip`)values(3000000000,10," + textLiteral("2026-01-03 00:00:00.25") + ",null)",
+	}
+	if got := readAll(t, plan.load); !slices.Equal(got, want) {
+		t.Errorf("orders load =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestCSVSourceColumnTypes(t *testing.T) {
+	create := "CREATE TABLE `files` (\n  `ID` int unsigned NOT NULL,\n  `Data` blob,\n  `Flags` bit(3),\n  `Name` varchar(50)\n);\n"
+	for _, tt := range []struct {
+		encoding, data string
+	}{
+		{"hex", "00ff10"},
+		{"base64", "AP8Q"},
+	} {
+		dir := t.TempDir()
+		// What a csv: destination writes: bit columns as their value, and
+		// binary ones encoded.
+		writeFiles(t, dir, map[string]string{
+			"files.csv": "id,Data,Flags,Name\n1," + tt.data + ",5,7\n2,,0,\n1 or 1,,,x\n",
+			"files.sql": create,
+		})
+		s, err := openCSVSource(dir, ',', "", tt.encoding, false, "_swoof_")
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.null = "\\N"
+		plan, err := s.planTable("files")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := "insert into`_swoof_files`(`id`,`Data`,`Flags`,`Name`)values" +
+			"(1,x'00ff10',5," + textLiteral("7") + ")," +
+			"(2,x'',0,'')," +
+			"(" + textLiteral("1 or 1") + ",x'',''," + textLiteral("x") + ")"
+		if got := readAll(t, plan.load[2:]); len(got) != 1 || got[0] != want {
+			t.Errorf("%s load =\n%q\nwant\n%q", tt.encoding, got, want)
+		}
+	}
+
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"files.csv": "ID,Data\n1,not hex\n", "files.sql": create})
+	s, err := openCSVSource(dir, ',', "", "hex", false, "_swoof_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := s.planTable("files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := plan.load[2].read(); err == nil || !strings.Contains(err.Error(), `"Data"`) {
+		t.Errorf("reading a binary column that isn't hex = %v, want an error naming it", err)
+	}
+}
+
+func TestCSVSourceBatches(t *testing.T) {
+	dir := t.TempDir()
+	var b strings.Builder
+	b.WriteString("ID\tNote\n")
+	for i := range 40000 {
+		fmt.Fprintf(&b, "%d\t\"line one\nline two, with\ttabs\"\n", i)
+	}
+	writeFiles(t, dir, map[string]string{"notes.tsv": b.String()})
+
+	s, err := openCSVSource(dir, '\t', `\N`, "hex", true, "_swoof_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := s.planTable("notes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.inserts < 2 {
+		t.Fatalf("a %d byte file made %d inserts, want it split", b.Len(), plan.inserts)
+	}
+	var total int64
+	for _, st := range plan.load[2:] {
+		stmt, err := st.read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := countInsertRows(stmt); n != st.rows {
+			t.Errorf("%s has %d rows, planned %d", st.name, n, st.rows)
+		}
+		total += st.rows
+	}
+	if total != 40000 {
+		t.Errorf("inserts hold %d rows, want 40000", total)
+	}
+}
+
+func TestCSVSourceInvalid(t *testing.T) {
+	tests := map[string]map[string]string{
+		"no files":        {"readme.txt": "hi"},
+		"parts and whole": {"t.csv": "ID\n1\n", "t-000001.csv": "ID\n2\n"},
+	}
+	for name, files := range tests {
+		dir := t.TempDir()
+		writeFiles(t, dir, files)
+		if _, err := openCSVSource(dir, ',', "", "hex", true, "_swoof_"); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	tables := map[string]map[string]string{
+		"header mismatch":  {"t-000001.csv": "ID\n1\n", "t-000002.csv": "Id\n2\n"},
+		"duplicate column": {"t.csv": "ID,id\n1,2\n"},
+		"empty file":       {"t.csv": ""},
+		"ragged row":       {"t.csv": "ID,Name\n1\n"},
+		"no create table":  {"t.csv": "ID\n1\n", "t.sql": "-- nothing\n"},
+	}
+	for name, files := range tables {
+		dir := t.TempDir()
+		writeFiles(t, dir, files)
+		s, err := openCSVSource(dir, ',', "", "hex", true, "_swoof_")
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if _, err := s.planTable("t"); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestInferredColumn(t *testing.T) {
+	tests := []struct {
+		values []string
+		want   string
+	}{
+		{nil, "varchar(255)"},
+		{[]string{"1", "-2", "2147483647"}, "int"},
+		{[]string{"1", "2147483648"}, "bigint"},
+		{[]string{"1", "18446744073709551615"}, "bigint unsigned"},
+		{[]string{"-1", "18446744073709551615"}, "decimal(20,0)"},
+		{[]string{"1", "12.345", "-0.5"}, "decimal(5,3)"},
+		{[]string{"1.5", "2e10"}, "double"},
+		{[]string{"007"}, "varchar(255)"},
+		{[]string{"1", "x"}, "varchar(255)"},
+		{[]string{"2026-02-28"}, "date"},
+		{[]string{"2026-02-30"}, "varchar(255)"},
+		{[]string{"2026-02-28", "2026-03-01T12:00:00"}, "datetime"},
+		{[]string{"2026-02-28 25:00:00"}, "varchar(255)"},
+		{[]string{"2026-02-28 12:00:00.123"}, "datetime(3)"},
+		{[]string{strings.Repeat("é", 256)}, "text"},
+		{[]string{strings.Repeat("x", 70000)}, "mediumtext"},
+		{[]string{"1" + strings.Repeat("0", 70)}, "varchar(255)"},
+	}
+	for _, tt := range tests {
+		c := newInferredColumn()
+		for _, v := range tt.values {
+			c.add(v, false)
+		}
+		if got := c.columnType(); got != tt.want {
+			t.Errorf("%.40q = %s, want %s", tt.values, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,510 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	mysql "github.com/StirlingMarketingGroup/cool-mysql"
+	"github.com/fatih/color"
+	"github.com/pkg/errors"
+	"github.com/posener/cmd"
+)
+
+// runDiff implements `swoof diff`, which compares tables between two
+// databases by primary key without writing to either, and can write a patch
+// that brings the destination in line with the source. Exits 1 when any
+// table differs, like diff(1).
+func runDiff(argv []string) {
+	c := cmd.New(cmd.OptName("swoof diff"))
+	aliasesFile := c.String("a", confDir+"/swoof/aliases.yaml", "your aliases file")
+	connectionsFile := c.String("c", confDir+"/swoof/connections.yaml", "your connections file")
+	all := c.Bool("all", false, "compares all tables, specified tables are ignored")
+	where := c.String("w", "", "optional WHERE clause to limit the compared rows on both sides")
+	patchFile := c.String("o", "", "writes a .sql patch to this file that would bring the destination in line with the source")
+	verbose := c.Bool("v", false, "prints the primary key of every differing row")
+	args := c.Args("source, dest, tables", "source, dest, tables, ex:\n"+
+		"swoof diff [flags] production localhost table1 table2 table3\n\n"+
+		"Tables resolve the same way as an import: aliases, globs, and -all.")
+	c.ParseArgs(append([]string{"swoof diff"}, argv...)...)
+
+	if len(*args) < 2 {
+		c.Usage()
+		os.Exit(2)
+	}
+
+	fatal := func(msg string, args ...any) {
+		slog.Error(msg, args...)
+		os.Exit(2)
+	}
+
+	connections, _ := getConnections(*connectionsFile)
+	open := func(name string) *mysql.Database {
+		dsn, err := ensureUTCSession(resolveDSN(connections, name))
+		if err != nil {
+			fatal("failed to apply UTC session tz", "error", err, "connection", name)
+		}
+		db, err := mysql.NewFromDSN(dsn, dsn)
+		if err != nil {
+			fatal("failed to connect", "error", err, "connection", name)
+		}
+		db.DisableUnusedColumnWarnings = true
+		return db
+	}
+	src := open((*args)[0])
+	dst := open((*args)[1])
+
+	tableNames, err := getTables(*aliasesFile, *all, args, mysqlCatalog{src})
+	if err != nil {
+		fatal("failed to get tables", "error", err)
+	}
+	tables := *tableNames
+	if len(tables) == 0 {
+		fatal("no tables to compare")
+	}
+
+	var patch *bufio.Writer
+	if *patchFile != "" {
+		f, err := os.Create(*patchFile)
+		if err != nil {
+			fatal("failed to create patch file", "error", err, "file", *patchFile)
+		}
+		defer f.Close()
+		patch = bufio.NewWriter(f)
+		patch.WriteString("set foreign_key_checks=0;\n")
+	}
+
+	ctx := context.Background()
+	bold := color.New(color.FgHiWhite).SprintFunc()
+	green := color.New(color.FgHiGreen).SprintFunc()
+	yellow := color.New(color.FgHiYellow).SprintFunc()
+
+	differs := false
+	for _, table := range tables {
+		var emit func(diffOp) error
+		if patch != nil || *verbose {
+			emit = func(op diffOp) error {
+				if *verbose {
+					fmt.Printf("  %s %s\n", op.kind, op.keyString())
+				}
+				if patch != nil {
+					patch.WriteString(op.sql(table))
+					patch.WriteString(";\n")
+				}
+				return nil
+			}
+		}
+
+		counts, err := diffTable(ctx, src, dst, table, *where, emit)
+		var skip *diffSkip
+		if errors.As(err, &skip) {
+			differs = true
+			fmt.Printf("%s %s\n", bold(table), yellow("skipped: "+skip.reason))
+			continue
+		}
+		if err != nil {
+			fatal("failed to diff table", "error", err, "tableName", table)
+		}
+
+		if counts.total() == 0 {
+			fmt.Printf("%s %s\n", bold(table), green("identical"))
+			continue
+		}
+		differs = true
+		fmt.Printf("%s %d inserted, %d deleted, %d changed\n",
+			bold(table), counts.inserted, counts.deleted, counts.changed)
+	}
+
+	if patch != nil {
+		patch.WriteString("set foreign_key_checks=1;\n")
+		if err := patch.Flush(); err != nil {
+			fatal("failed to write patch file", "error", err, "file", *patchFile)
+		}
+	}
+
+	if differs {
+		os.Exit(1)
+	}
+}
+
+// diffSkip is returned for tables that can't be compared row by row, which
+// counts as a difference but doesn't stop the other tables.
+type diffSkip struct {
+	reason string
+}
+
+func (e *diffSkip) Error() string { return e.reason }
+
+type diffCounts struct {
+	inserted, deleted, changed int64
+}
+
+func (c diffCounts) total() int64 { return c.inserted + c.deleted + c.changed }
+
+type diffKind string
+
+const (
+	diffInsert diffKind = "insert"
+	diffDelete diffKind = "delete"
+	diffUpdate diffKind = "update"
+)
+
+// diffColumn is one compared column. Values travel as the text protocol
+// renders them, which is identical on both servers for identical data.
+type diffColumn struct {
+	name     string
+	dataType string
+}
+
+// diffOp is one row the destination needs changed to match the source.
+type diffOp struct {
+	kind    diffKind
+	columns []diffColumn
+	keys    []int
+
+	// The source row for inserts and updates, the destination row for
+	// deletes.
+	row []sql.NullString
+
+	// Columns an update changes.
+	changed []int
+}
+
+func (op diffOp) keyString() string {
+	parts := make([]string, len(op.keys))
+	for i, k := range op.keys {
+		v := "NULL"
+		if op.row[k].Valid {
+			v = op.row[k].String
+		}
+		parts[i] = op.columns[k].name + "=" + v
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (op diffOp) keyWhere() string {
+	parts := make([]string, len(op.keys))
+	for i, k := range op.keys {
+		parts[i] = "`" + op.columns[k].name + "`=" + sqlLiteral(op.columns[k].dataType, op.row[k])
+	}
+	return strings.Join(parts, " and ")
+}
+
+// sql renders the op as a statement without its trailing semicolon.
+func (op diffOp) sql(table string) string {
+	switch op.kind {
+	case diffInsert:
+		names := make([]string, len(op.columns))
+		values := make([]string, len(op.columns))
+		for i, c := range op.columns {
+			names[i] = "`" + c.name + "`"
+			values[i] = sqlLiteral(c.dataType, op.row[i])
+		}
+		return "insert into`" + table + "`(" + strings.Join(names, ",") + ")values(" + strings.Join(values, ",") + ")"
+	case diffDelete:
+		return "delete from`" + table + "`where " + op.keyWhere()
+	}
+	sets := make([]string, len(op.changed))
+	for i, c := range op.changed {
+		sets[i] = "`" + op.columns[c].name + "`=" + sqlLiteral(op.columns[c].dataType, op.row[c])
+	}
+	// Spaced, since a value like 12 or NULL would run into the keyword.
+	return "update`" + table + "`set" + strings.Join(sets, ",") + " where " + op.keyWhere()
+}
+
+// sqlLiteral renders a text-protocol value back into SQL for its column type.
+// Everything that isn't a number goes through a hex literal so no byte needs
+// escaping; text-like types are converted back to a character set so JSON,
+// dates and enums accept them.
+func sqlLiteral(dataType string, v sql.NullString) string {
+	if !v.Valid {
+		return "NULL"
+	}
+	switch dataType {
+	case "tinyint", "smallint", "mediumint", "int", "bigint", "decimal", "float", "double", "year":
+		return v.String
+	case "binary", "varbinary", "blob", "tinyblob", "mediumblob", "longblob", "bit", "vector":
+		if v.String == "" {
+			return "''"
+		}
+		return "0x" + hex.EncodeToString([]byte(v.String))
+	}
+	if isSpatialType(dataType) {
+		return "0x" + hex.EncodeToString([]byte(v.String))
+	}
+	if v.String == "" {
+		return "''"
+	}
+	return "convert(0x" + hex.EncodeToString([]byte(v.String)) + " using utf8mb4)"
+}
+
+// diffKeyKind says how a primary key column is ordered, so both sides can be
+// streamed in an order Go can follow for the merge.
+type diffKeyKind int
+
+const (
+	diffKeyNumber diffKeyKind = iota
+	diffKeyBytes
+)
+
+func diffKeyKindOf(dataType string) (diffKeyKind, bool) {
+	switch dataType {
+	case "tinyint", "smallint", "mediumint", "int", "bigint", "decimal", "year":
+		return diffKeyNumber, true
+	case "char", "varchar", "binary", "varbinary", "date", "datetime", "timestamp":
+		// Dates are fixed width, so their text sorts like their value.
+		return diffKeyBytes, true
+	}
+	return 0, false
+}
+
+func diffKeyOrder(c diffColumn, kind diffKeyKind) string {
+	if kind == diffKeyBytes && c.dataType != "date" && c.dataType != "datetime" && c.dataType != "timestamp" {
+		// Collations don't sort the way Go compares bytes; binary does.
+		return "cast(`" + c.name + "`as binary)"
+	}
+	return "`" + c.name + "`"
+}
+
+func compareDiffKeys(a, b []sql.NullString, keys []int, kinds []diffKeyKind) int {
+	for i, k := range keys {
+		var c int
+		if kinds[i] == diffKeyNumber {
+			c = compareNumbers(a[k].String, b[k].String)
+		} else {
+			c = strings.Compare(a[k].String, b[k].String)
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func compareNumbers(a, b string) int {
+	ai, aErr := strconv.ParseInt(a, 10, 64)
+	bi, bErr := strconv.ParseInt(b, 10, 64)
+	if aErr == nil && bErr == nil {
+		switch {
+		case ai < bi:
+			return -1
+		case ai > bi:
+			return 1
+		}
+		return 0
+	}
+	ar, aOk := new(big.Rat).SetString(a)
+	br, bOk := new(big.Rat).SetString(b)
+	if aOk && bOk {
+		return ar.Cmp(br)
+	}
+	return strings.Compare(a, b)
+}
+
+// diffRows yields rows in primary key order; ok is false once it's drained.
+type diffRows interface {
+	next() (row []sql.NullString, ok bool, err error)
+}
+
+type sqlDiffRows struct {
+	rows *sql.Rows
+	cols int
+}
+
+func (r *sqlDiffRows) next() ([]sql.NullString, bool, error) {
+	if !r.rows.Next() {
+		return nil, false, r.rows.Err()
+	}
+	row := make([]sql.NullString, r.cols)
+	dest := make([]any, r.cols)
+	for i := range row {
+		dest[i] = &row[i]
+	}
+	if err := r.rows.Scan(dest...); err != nil {
+		return nil, false, err
+	}
+	return row, true, nil
+}
+
+// diffStreams merge-joins two key-ordered streams, calling emit for every
+// row the destination is missing, has extra, or has different.
+func diffStreams(src, dst diffRows, columns []diffColumn, keys []int, kinds []diffKeyKind, emit func(diffOp) error) (diffCounts, error) {
+	var counts diffCounts
+	send := func(op diffOp) error {
+		op.columns, op.keys = columns, keys
+		switch op.kind {
+		case diffInsert:
+			counts.inserted++
+		case diffDelete:
+			counts.deleted++
+		case diffUpdate:
+			counts.changed++
+		}
+		if emit == nil {
+			return nil
+		}
+		return emit(op)
+	}
+
+	s, sOk, err := src.next()
+	if err != nil {
+		return counts, errors.Wrap(err, "read source row")
+	}
+	d, dOk, err := dst.next()
+	if err != nil {
+		return counts, errors.Wrap(err, "read destination row")
+	}
+	for sOk || dOk {
+		c := 0
+		switch {
+		case !dOk:
+			c = -1
+		case !sOk:
+			c = 1
+		default:
+			c = compareDiffKeys(s, d, keys, kinds)
+		}
+
+		if c <= 0 {
+			if c < 0 {
+				if err := send(diffOp{kind: diffInsert, row: s}); err != nil {
+					return counts, err
+				}
+			} else {
+				var changed []int
+				for i := range columns {
+					if s[i] != d[i] {
+						changed = append(changed, i)
+					}
+				}
+				if len(changed) != 0 {
+					if err := send(diffOp{kind: diffUpdate, row: s, changed: changed}); err != nil {
+						return counts, err
+					}
+				}
+			}
+			if s, sOk, err = src.next(); err != nil {
+				return counts, errors.Wrap(err, "read source row")
+			}
+		}
+		if c >= 0 {
+			if c > 0 {
+				if err := send(diffOp{kind: diffDelete, row: d}); err != nil {
+					return counts, err
+				}
+			}
+			if d, dOk, err = dst.next(); err != nil {
+				return counts, errors.Wrap(err, "read destination row")
+			}
+		}
+	}
+	return counts, nil
+}
+
+type diffColumnInfo struct {
+	ColumnName           string `mysql:"COLUMN_NAME"`
+	DataType             string `mysql:"DATA_TYPE"`
+	ColumnKey            string `mysql:"COLUMN_KEY"`
+	GenerationExpression string `mysql:"GENERATION_EXPRESSION"`
+}
+
+func selectDiffColumns(ctx context.Context, db *mysql.Database, table string) ([]diffColumnInfo, error) {
+	var columns []diffColumnInfo
+	err := db.SelectContext(ctx, &columns, "select*"+
+		"from`INFORMATION_SCHEMA`.`columns`"+
+		"where`TABLE_SCHEMA`=database()"+
+		"and`table_name`='"+table+"'"+
+		"order by`ORDINAL_POSITION`", 0)
+	return columns, err
+}
+
+func diffTable(ctx context.Context, src, dst *mysql.Database, table, where string, emit func(diffOp) error) (diffCounts, error) {
+	srcCols, err := selectDiffColumns(ctx, src, table)
+	if err != nil {
+		return diffCounts{}, errors.Wrap(err, "select source columns")
+	}
+	dstCols, err := selectDiffColumns(ctx, dst, table)
+	if err != nil {
+		return diffCounts{}, errors.Wrap(err, "select destination columns")
+	}
+	if len(dstCols) == 0 {
+		return diffCounts{}, &diffSkip{"missing on destination"}
+	}
+
+	var columns []diffColumn
+	var keys []int
+	var kinds []diffKeyKind
+	var order []string
+	for _, c := range srcCols {
+		// Generated columns follow from the rest; the patch couldn't set them.
+		if len(c.GenerationExpression) != 0 {
+			continue
+		}
+		col := diffColumn{c.ColumnName, c.DataType}
+		if c.ColumnKey == "PRI" {
+			kind, ok := diffKeyKindOf(c.DataType)
+			if !ok {
+				return diffCounts{}, &diffSkip{fmt.Sprintf("primary key column %q is a %s, which can't be ordered for comparison", c.ColumnName, c.DataType)}
+			}
+			keys = append(keys, len(columns))
+			kinds = append(kinds, kind)
+			order = append(order, diffKeyOrder(col, kind))
+		}
+		columns = append(columns, col)
+	}
+	if len(keys) == 0 {
+		return diffCounts{}, &diffSkip{"no primary key"}
+	}
+
+	srcNames := make([]string, 0, len(columns))
+	for _, c := range columns {
+		srcNames = append(srcNames, c.name)
+	}
+	var dstNames []string
+	for _, c := range dstCols {
+		if len(c.GenerationExpression) == 0 {
+			dstNames = append(dstNames, c.ColumnName)
+		}
+	}
+	if !slices.Equal(srcNames, dstNames) {
+		return diffCounts{}, &diffSkip{"columns differ between source and destination"}
+	}
+
+	quoted := make([]string, len(columns))
+	for i, c := range columns {
+		quoted[i] = "`" + c.name + "`"
+	}
+	q := "select " + strings.Join(quoted, ",") + "from`" + table + "`"
+	if where != "" {
+		q += " where " + where + " "
+	}
+	q += "order by " + strings.Join(order, ",")
+
+	stream := func(db *mysql.Database) (*sqlDiffRows, error) {
+		rows, err := db.Reads.QueryContext(ctx, q)
+		if err != nil {
+			return nil, err
+		}
+		return &sqlDiffRows{rows, len(columns)}, nil
+	}
+	srcRows, err := stream(src)
+	if err != nil {
+		return diffCounts{}, errors.Wrap(err, "select source rows")
+	}
+	defer srcRows.rows.Close()
+	dstRows, err := stream(dst)
+	if err != nil {
+		return diffCounts{}, errors.Wrap(err, "select destination rows")
+	}
+	defer dstRows.rows.Close()
+
+	return diffStreams(srcRows, dstRows, columns, keys, kinds, emit)
+}
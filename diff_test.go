@@ -0,0 +1,119 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func ns(s string) sql.NullString { return sql.NullString{String: s, Valid: true} }
+
+type sliceDiffRows [][]sql.NullString
+
+func (r *sliceDiffRows) next() ([]sql.NullString, bool, error) {
+	if len(*r) == 0 {
+		return nil, false, nil
+	}
+	row := (*r)[0]
+	*r = (*r)[1:]
+	return row, true, nil
+}
+
+func TestSQLLiteral(t *testing.T) {
+	tests := []struct {
+		dataType string
+		v        sql.NullString
+		want     string
+	}{
+		{"int", sql.NullString{}, "NULL"},
+		{"bigint", ns("-42"), "-42"},
+		{"decimal", ns("10.50"), "10.50"},
+		{"varchar", ns("it's"), "convert(0x69742773 using utf8mb4)"},
+		{"varchar", ns(""), "''"},
+		{"json", ns(`{"a":1}`), "convert(0x7b2261223a317d using utf8mb4)"},
+		{"varbinary", ns("\x00\xff"), "0x00ff"},
+		{"datetime", ns("2025-01-02 03:04:05"), "convert(0x323032352d30312d30322030333a30343a3035 using utf8mb4)"},
+	}
+	for _, tt := range tests {
+		if got := sqlLiteral(tt.dataType, tt.v); got != tt.want {
+			t.Errorf("sqlLiteral(%s, %q) = %s, want %s", tt.dataType, tt.v.String, got, tt.want)
+		}
+	}
+}
+
+func TestCompareNumbers(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"9", "10", -1},
+		{"-1", "-2", 1},
+		{"18446744073709551615", "9223372036854775807", 1},
+		{"1.50", "1.5", 0},
+		{"2.25", "10", -1},
+	}
+	for _, tt := range tests {
+		if got := compareNumbers(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareNumbers(%s, %s) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestDiffStreams(t *testing.T) {
+	columns := []diffColumn{{"id", "int"}, {"name", "varchar"}}
+	keys := []int{0}
+	kinds := []diffKeyKind{diffKeyNumber}
+
+	src := sliceDiffRows{
+		{ns("1"), ns("a")},
+		{ns("2"), ns("b")},
+		{ns("4"), sql.NullString{}},
+		{ns("10"), ns("j")},
+	}
+	dst := sliceDiffRows{
+		{ns("2"), ns("b")},
+		{ns("3"), ns("c")},
+		{ns("4"), ns("")},
+		{ns("11"), ns("k")},
+	}
+
+	var got []string
+	counts, err := diffStreams(&src, &dst, columns, keys, kinds, func(op diffOp) error {
+		got = append(got, op.sql("t"))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"insert into`t`(`id`,`name`)values(1,convert(0x61 using utf8mb4))",
+		"delete from`t`where `id`=3",
+		"update`t`set`name`=NULL where `id`=4",
+		"insert into`t`(`id`,`name`)values(10,convert(0x6a using utf8mb4))",
+		"delete from`t`where `id`=11",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d ops, want %d: %q", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("op %d = %s, want %s", i, got[i], want[i])
+		}
+	}
+	if counts != (diffCounts{inserted: 2, deleted: 2, changed: 1}) {
+		t.Errorf("counts = %+v", counts)
+	}
+}
+
+func TestDiffCompositeKeyWhere(t *testing.T) {
+	op := diffOp{
+		kind:    diffDelete,
+		columns: []diffColumn{{"a", "int"}, {"b", "char"}, {"c", "text"}},
+		keys:    []int{0, 1},
+		row:     []sql.NullString{ns("1"), ns("x"), ns("ignored")},
+	}
+	want := "delete from`t`where `a`=1 and `b`=convert(0x78 using utf8mb4)"
+	if got := op.sql("t"); got != want {
+		t.Errorf("sql = %s, want %s", got, want)
+	}
+}
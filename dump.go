@@ -0,0 +1,497 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// dump is a mysqldump file, plain or gzipped, used as a source. It's read
+// once up front to find every table's CREATE TABLE and extended inserts,
+// and each table is then replayed through a temp table and swapped in at
+// finalization, the same way a live source's tables are.
+type dump struct {
+	path string
+
+	// The dump itself, or for a gzipped dump a decompressed temp copy, so
+	// each table's inserts can be read back by offset. temp is set when the
+	// copy couldn't be unlinked while open and Close has to remove it.
+	file *os.File
+	temp bool
+
+	tempPrefix string
+	tables     map[string]*dumpTable
+
+	// The sql_mode the dump sets before its inserts, NO_AUTO_VALUE_ON_ZERO
+	// from mysqldump, or nil if it sets none.
+	sqlMode *string
+}
+
+type dumpTable struct {
+	// The CREATE TABLE statement from after the table's name.
+	createSuffix string
+
+	inserts []dumpInsert
+	size    int64
+}
+
+// dumpInsert is where an insert's text after its table name lies in the
+// file, so it's only read when it runs.
+type dumpInsert struct {
+	// insert, insert ignore, replace, and so on, as written.
+	verb string
+
+	start, end int64
+	rows       int64
+}
+
+func openDump(file, tempPrefix string) (*dump, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, errors.Wrapf(err, "open dump %q", file)
+	}
+	d := &dump{path: file, file: f, tempPrefix: tempPrefix, tables: make(map[string]*dumpTable)}
+
+	br := bufio.NewReader(f)
+	if magic, _ := br.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		if err := d.decompress(br); err != nil {
+			d.Close()
+			return nil, err
+		}
+		br.Reset(d.file)
+	}
+
+	if err := scanStatements(br, d.add); err != nil {
+		d.Close()
+		return nil, errors.Wrapf(err, "read dump %q", file)
+	}
+	if len(d.tables) == 0 {
+		d.Close()
+		return nil, errors.Errorf("%q has no CREATE TABLE statements", file)
+	}
+	return d, nil
+}
+
+// decompress swaps the gzipped dump for a decompressed temp copy.
+func (d *dump) decompress(r io.Reader) error {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return errors.Wrapf(err, "decompress %q", d.path)
+	}
+	tmp, err := os.CreateTemp("", "swoof-dump-*.sql")
+	if err != nil {
+		return errors.Wrap(err, "create temp file for dump")
+	}
+	orig := d.file
+	d.file = tmp
+	// It's only ever read through the open file, so it's unlinked right
+	// away and goes with the process however swoof exits. Windows won't
+	// remove an open file, so there it's left for Close.
+	d.temp = os.Remove(tmp.Name()) != nil
+	_, err = io.Copy(tmp, zr)
+	orig.Close()
+	if err != nil {
+		return errors.Wrapf(err, "decompress %q", d.path)
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return errors.Wrapf(err, "rewind %q", tmp.Name())
+	}
+	return nil
+}
+
+func (d *dump) Close() error {
+	err := d.file.Close()
+	if d.temp {
+		os.Remove(d.file.Name())
+	}
+	return err
+}
+
+// dumpSQLModeRegexp finds the sql_mode a dump's session setup sets, but not
+// the @OLD_SQL_MODE it saves or restores.
+var dumpSQLModeRegexp = regexp.MustCompile(`(?i)(?:^|[^@\w])SQL_MODE\s*=\s*'([^']*)'`)
+
+// add records one statement of the dump, starting at offset start. Only
+// table creates and inserts matter, and the sql_mode the inserts expect;
+// everything else mysqldump writes is session setup, locking, or wrapped in
+// /*! */ comments.
+func (d *dump) add(stmt string, start int64) error {
+	body, skipped := statementBody(stmt)
+	lower := strings.ToLower(body[:min(len(body), 32)])
+
+	if d.sqlMode == nil && len(d.tables) == 0 {
+		if m := dumpSQLModeRegexp.FindStringSubmatch(stmt); m != nil {
+			d.sqlMode = &m[1]
+		}
+	}
+
+	switch {
+	case strings.HasPrefix(lower, "create table"):
+		name, suffix, ok := cutCreateTable(body)
+		if !ok {
+			return errors.Errorf("unreadable table name in CREATE TABLE at byte %d", start)
+		}
+		if _, ok := d.tables[name]; ok {
+			return errors.Errorf("table %q is created more than once, dumps of several databases aren't supported", name)
+		}
+		d.tables[name] = &dumpTable{createSuffix: suffix}
+
+	case strings.HasPrefix(lower, "insert"), strings.HasPrefix(lower, "replace"):
+		verb, rest, ok := cutInto(body)
+		if !ok {
+			return errors.Errorf("unsupported insert at byte %d", start)
+		}
+		name, n, ok := parseTableName(rest)
+		if !ok {
+			return errors.Errorf("unreadable table name in insert at byte %d", start)
+		}
+		t, ok := d.tables[name]
+		if !ok {
+			return errors.Errorf("insert into %q at byte %d comes before its CREATE TABLE, dumps without table structure aren't supported", name, start)
+		}
+		restStart := start + int64(skipped+len(body)-len(rest)+n)
+		end := start + int64(len(stmt))
+		t.inserts = append(t.inserts, dumpInsert{
+			verb:  strings.ToLower(verb),
+			start: restStart,
+			end:   end,
+			rows:  countInsertRows(body),
+		})
+		t.size += end - restStart
+	}
+	return nil
+}
+
+// cutCreateTable splits a CREATE TABLE statement into the table's name and
+// everything after it.
+func cutCreateTable(stmt string) (string, string, bool) {
+	rest := strings.TrimLeft(stmt[len("create table"):], " \t\r\n")
+	if strings.HasPrefix(strings.ToLower(rest), "if not exists") {
+		rest = strings.TrimLeft(rest[len("if not exists"):], " \t\r\n")
+	}
+	name, n, ok := parseTableName(rest)
+	if !ok {
+		return "", "", false
+	}
+	return name, rest[n:], true
+}
+
+// cutInto splits an insert at its INTO, returning the verb and modifiers
+// before it and the text after it, which starts with the table name.
+func cutInto(stmt string) (string, string, bool) {
+	i := 0
+	for range 5 {
+		for i < len(stmt) && stmt[i] <= ' ' {
+			i++
+		}
+		wordStart := i
+		for i < len(stmt) && isIdentByte(stmt[i]) {
+			i++
+		}
+		if i == wordStart {
+			return "", "", false
+		}
+		if strings.EqualFold(stmt[wordStart:i], "into") {
+			return strings.TrimSpace(stmt[:wordStart]), strings.TrimLeft(stmt[i:], " \t\r\n"), true
+		}
+	}
+	return "", "", false
+}
+
+func (d *dump) names() []string {
+	names := make([]string, 0, len(d.tables))
+	for name := range d.tables {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func (d *dump) tableExists(name string) (bool, error) {
+	_, ok := d.tables[name]
+	return ok, nil
+}
+
+func (d *dump) matchTables(pattern string) ([]string, error) {
+	var matched []string
+	for _, n := range d.names() {
+		ok, err := path.Match(pattern, n)
+		if err != nil {
+			return nil, errors.Wrapf(err, "match pattern %q", pattern)
+		}
+		if ok {
+			matched = append(matched, n)
+		}
+	}
+	return matched, nil
+}
+
+func (d *dump) tablesExcept(exclude []string) ([]string, error) {
+	return slices.DeleteFunc(d.names(), func(n string) bool {
+		return slices.Contains(exclude, n)
+	}), nil
+}
+
+// The bytes of each table's inserts stand in for data_length+index_length.
+func (d *dump) tablesBySize(names []string) ([]string, error) {
+	var ordered []string
+	for _, n := range names {
+		if _, ok := d.tables[n]; ok && !slices.Contains(ordered, n) {
+			ordered = append(ordered, n)
+		}
+	}
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return d.tables[ordered[i]].size > d.tables[ordered[j]].size
+	})
+	return ordered, nil
+}
+
+// A dump's views, triggers and routines aren't replayed.
+func (d *dump) routineFiles(kind string) ([]string, error) {
+	return nil, nil
+}
+
+// planTable builds the statements a live import of the table would run:
+// create the temp table without its foreign keys, insert into it, then at
+// finalization swap it in and add the foreign keys back.
+func (d *dump) planTable(table string) (tableReplay, error) {
+	t, ok := d.tables[table]
+	if !ok {
+		return tableReplay{}, errors.Errorf("dump %q has no table %q", d.path, table)
+	}
+	tempTable := d.tempPrefix + table
+	create, constraints := splitConstraints(t.createSuffix)
+
+	plan := tableReplay{
+		load: []replayStatement{
+			fixedStatement("drop table if exists`" + tempTable + "`"),
+			fixedStatement("CREATE TABLE `" + tempTable + "`" + create),
+		},
+		finalize: []replayStatement{
+			fixedStatement("drop table if exists`" + table + "`"),
+			fixedStatement("alter table`" + tempTable + "`rename`" + table + "`"),
+		},
+		inserts:   len(t.inserts),
+		retryable: true,
+	}
+	for _, in := range t.inserts {
+		plan.load = append(plan.load, replayStatement{
+			name:   fmt.Sprintf("%s at byte %d", d.path, in.start),
+			insert: true,
+			rows:   in.rows,
+			read: func() (string, error) {
+				b := make([]byte, in.end-in.start)
+				if _, err := d.file.ReadAt(b, in.start); err != nil {
+					return "", errors.Wrapf(err, "read %q at byte %d", d.path, in.start)
+				}
+				return in.verb + " into`" + tempTable + "`" + string(b), nil
+			},
+		})
+	}
+	if constraints != "" {
+		plan.finalize = append(plan.finalize, fixedStatement(addConstraints(table, constraints)))
+	}
+	return plan, nil
+}
+
+func fixedStatement(stmt string) replayStatement {
+	return replayStatement{name: stmt, read: func() (string, error) {
+		return stmt, nil
+	}}
+}
+
+// scanStatements splits SQL the way the mysql client does, calling fn with
+// each statement, without its delimiter, and the offset it starts at.
+// Delimiters inside quotes and comments don't split, and DELIMITER lines
+// change the delimiter, as dumps with triggers and routines use.
+func scanStatements(r *bufio.Reader, fn func(stmt string, start int64) error) error {
+	delimiter := ";"
+	var buf []byte
+	var offset, start int64
+
+	// The quote we're inside, and for comments, '-' for one running to the
+	// end of the line or '*' for a block, with where its text starts.
+	var quote, comment byte
+	var commentStart int
+
+	for {
+		c, err := r.ReadByte()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		offset++
+		buf = append(buf, c)
+
+		switch {
+		case comment == '-':
+			if c == '\n' {
+				comment = 0
+			}
+			continue
+		case comment == '*':
+			if c == '/' && len(buf)-2 >= commentStart && buf[len(buf)-2] == '*' {
+				comment = 0
+			}
+			continue
+		case quote != 0:
+			if c == '\\' && quote != '`' {
+				next, err := r.ReadByte()
+				if err == io.EOF {
+					continue
+				}
+				if err != nil {
+					return err
+				}
+				offset++
+				buf = append(buf, next)
+			} else if c == quote {
+				quote = 0
+			}
+			continue
+		}
+
+		switch c {
+		case '\'', '"', '`':
+			quote = c
+			continue
+		case '#':
+			comment = '-'
+			continue
+		case '-':
+			if len(buf) >= 2 && buf[len(buf)-2] == '-' {
+				if next, err := r.Peek(1); err != nil || next[0] <= ' ' {
+					comment = '-'
+				}
+			}
+			continue
+		case '*':
+			if len(buf) >= 2 && buf[len(buf)-2] == '/' {
+				comment, commentStart = '*', len(buf)
+			}
+			continue
+		case '\n':
+			if d, ok := delimiterCommand(buf); ok {
+				delimiter = d
+				buf, start = buf[:0], offset
+				continue
+			}
+		}
+
+		if bytes.HasSuffix(buf, []byte(delimiter)) {
+			if _, ok := delimiterCommand(buf); ok {
+				continue
+			}
+			stmt := buf[:len(buf)-len(delimiter)]
+			if len(bytes.TrimSpace(stmt)) != 0 {
+				if err := fn(string(stmt), start); err != nil {
+					return err
+				}
+			}
+			buf, start = buf[:0], offset
+		}
+	}
+
+	if _, ok := delimiterCommand(buf); !ok && len(bytes.TrimSpace(buf)) != 0 {
+		return fn(string(buf), start)
+	}
+	return nil
+}
+
+// delimiterCommand reports whether buf holds a client DELIMITER line, and
+// the delimiter it sets once the line is complete.
+func delimiterCommand(buf []byte) (string, bool) {
+	line := bytes.TrimLeft(buf, " \t\r\n")
+	const cmd = "delimiter "
+	if len(line) < len(cmd) || !strings.EqualFold(string(line[:len(cmd)]), cmd) {
+		return "", false
+	}
+	return strings.TrimSpace(string(line[len(cmd):])), true
+}
+
+// statementBody skips the whitespace and comments ahead of a statement,
+// returning the rest and how many bytes were skipped. /*! */ comments are
+// skipped too: in a dump they wrap session setup and version-gated
+// statements swoof doesn't replay.
+func statementBody(stmt string) (string, int) {
+	i := 0
+	for i < len(stmt) {
+		switch {
+		case stmt[i] <= ' ':
+			i++
+		case strings.HasPrefix(stmt[i:], "/*"):
+			end := strings.Index(stmt[i+2:], "*/")
+			if end == -1 {
+				return "", len(stmt)
+			}
+			i += 2 + end + 2
+		case stmt[i] == '#' || strings.HasPrefix(stmt[i:], "-- ") || strings.HasPrefix(stmt[i:], "--\t") || strings.HasPrefix(stmt[i:], "--\n"):
+			end := strings.IndexByte(stmt[i:], '\n')
+			if end == -1 {
+				return "", len(stmt)
+			}
+			i += end + 1
+		default:
+			return stmt[i:], i
+		}
+	}
+	return "", len(stmt)
+}
+
+// parseTableName reads a table name, quoted or not and maybe qualified by
+// its schema, from the start of s, returning the table's part and how many
+// bytes it took.
+func parseTableName(s string) (string, int, bool) {
+	var name string
+	i := 0
+	for {
+		part, n, ok := parseIdentifier(s[i:])
+		if !ok {
+			return "", 0, false
+		}
+		name = part
+		i += n
+		if i < len(s) && s[i] == '.' {
+			i++
+			continue
+		}
+		return name, i, true
+	}
+}
+
+func parseIdentifier(s string) (string, int, bool) {
+	if strings.HasPrefix(s, "`") {
+		var b strings.Builder
+		for i := 1; i < len(s); i++ {
+			if s[i] != '`' {
+				b.WriteByte(s[i])
+				continue
+			}
+			// A doubled backtick is one inside the name.
+			if i+1 < len(s) && s[i+1] == '`' {
+				b.WriteByte('`')
+				i++
+				continue
+			}
+			return b.String(), i + 1, b.Len() != 0
+		}
+		return "", 0, false
+	}
+	i := 0
+	for i < len(s) && isIdentByte(s[i]) {
+		i++
+	}
+	return s[:i], i, i != 0
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const testDump = "-- MySQL dump 10.13  Distrib 8.0.36, for Linux (x86_64)\n" +
+	"--\n" +
+	"-- Host: localhost    Database: shop\n" +
+	"-- ------------------------------------------------------\n" +
+	"/*!40101 SET @OLD_CHARACTER_SET_CLIENT=@@CHARACTER_SET_CLIENT */;\n" +
+	"/*!50503 SET NAMES utf8mb4 */;\n" +
+	"/*!40101 SET @OLD_SQL_MODE=@@SQL_MODE, SQL_MODE='NO_AUTO_VALUE_ON_ZERO' */;\n" +
+	"\n" +
+	"--\n" +
+	"-- Table structure for table `customers`\n" +
+	"--\n" +
+	"\n" +
+	"DROP TABLE IF EXISTS `customers`;\n" +
+	"/*!40101 SET @saved_cs_client     = @@character_set_client */;\n" +
+	"CREATE TABLE `customers` (\n" +
+	"  `ID` int NOT NULL,\n" +
+	"  `Name` varchar(50) NOT NULL,\n" +
+	"  PRIMARY KEY (`ID`)\n" +
+	") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;\n" +
+	"\n" +
+	"LOCK TABLES `customers` WRITE;\n" +
+	"/*!40000 ALTER TABLE `customers` DISABLE KEYS */;\n" +
+	"INSERT INTO `customers` VALUES (1,'semi; colon'),(2,'it\\'s -- not a comment'),(3,'back`tick');\n" +
+	"INSERT INTO `customers` VALUES (4,'/* nor this */');\n" +
+	"/*!40000 ALTER TABLE `customers` ENABLE KEYS */;\n" +
+	"UNLOCK TABLES;\n" +
+	"\n" +
+	"DROP TABLE IF EXISTS `orders`;\n" +
+	"CREATE TABLE `orders` (\n" +
+	"  `ID` int NOT NULL,\n" +
+	"  `CustomerID` int NOT NULL,\n" +
+	"  PRIMARY KEY (`ID`),\n" +
+	"  KEY `CustomerID` (`CustomerID`),\n" +
+	"  CONSTRAINT `orders_ibfk_1` FOREIGN KEY (`CustomerID`) REFERENCES `customers` (`ID`)\n" +
+	") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;\n" +
+	"INSERT IGNORE INTO `shop`.`orders` (`ID`, `CustomerID`) VALUES (10,1);\n" +
+	"DELIMITER ;;\n" +
+	"/*!50003 CREATE*/ /*!50003 TRIGGER `orders_bi` BEFORE INSERT ON `orders` FOR EACH ROW BEGIN\n" +
+	"  SET NEW.ID = NEW.ID + 1;\n" +
+	"END */;;\n" +
+	"DELIMITER ;\n" +
+	"\n" +
+	"DROP TABLE IF EXISTS `empty_log`;\n" +
+	"CREATE TABLE `empty_log` (\n" +
+	"  `ID` int NOT NULL\n" +
+	") ENGINE=InnoDB;\n" +
+	"/*!40101 SET SQL_MODE=@OLD_SQL_MODE */;\n" +
+	"-- Dump completed on 2026-10-17 12:00:00\n"
+
+func writeTestDump(t *testing.T, gz bool) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "shop.sql")
+	f, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if !gz {
+		if _, err := f.WriteString(testDump); err != nil {
+			t.Fatal(err)
+		}
+		return file
+	}
+	zw := gzip.NewWriter(f)
+	if _, err := zw.Write([]byte(testDump)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestScanStatements(t *testing.T) {
+	var stmts []string
+	err := scanStatements(bufio.NewReader(strings.NewReader(testDump)), func(stmt string, start int64) error {
+		if testDump[start:start+int64(len(stmt))] != stmt {
+			t.Errorf("statement at %d doesn't match the input there", start)
+		}
+		stmts = append(stmts, stmt)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var inserts, triggers int
+	for _, s := range stmts {
+		body, _ := statementBody(s)
+		switch {
+		case strings.HasPrefix(strings.ToUpper(body), "DELIMITER"):
+			t.Errorf("DELIMITER line came through as a statement: %q", s)
+		case strings.HasPrefix(body, "INSERT"):
+			inserts++
+		case strings.Contains(s, "TRIGGER"):
+			triggers++
+			if !strings.HasSuffix(s, "END */") {
+				t.Errorf("trigger split inside its body: %q", s)
+			}
+			if body != "" {
+				t.Errorf("trigger wrapped in /*! */ should have no body, got %q", body)
+			}
+		}
+	}
+	if inserts != 3 || triggers != 1 {
+		t.Errorf("got %d inserts and %d triggers, want 3 and 1, in %q", inserts, triggers, stmts)
+	}
+}
+
+func TestDump(t *testing.T) {
+	for _, gz := range []bool{false, true} {
+		d, err := openDump(writeTestDump(t, gz), "_swoof_")
+		if err != nil {
+			t.Fatalf("gz %v: %v", gz, err)
+		}
+		defer d.Close()
+
+		if d.sqlMode == nil || *d.sqlMode != "NO_AUTO_VALUE_ON_ZERO" {
+			t.Errorf("gz %v: sqlMode = %v, want the dump's NO_AUTO_VALUE_ON_ZERO", gz, d.sqlMode)
+		}
+
+		matched, err := d.matchTables("*o*")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"customers", "empty_log", "orders"}; !slices.Equal(matched, want) {
+			t.Errorf("matchTables = %v, want %v", matched, want)
+		}
+		ordered, err := d.tablesBySize([]string{"empty_log", "orders", "customers", "orders"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"customers", "orders", "empty_log"}; !slices.Equal(ordered, want) {
+			t.Errorf("tablesBySize = %v, want %v", ordered, want)
+		}
+
+		plan, err := d.planTable("customers")
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := readAll(t, plan.load)
+		want := []string{
+			"drop table if exists`_swoof_customers`",
+			"CREATE TABLE `_swoof_customers` (\n  `ID` int NOT NULL,\n  `Name` varchar(50) NOT NULL,\n  PRIMARY KEY (`ID`)\n) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4",
+			"insert into`_swoof_customers` VALUES (1,'semi; colon'),(2,'it\\'s -- not a comment'),(3,'back`tick')",
+			"insert into`_swoof_customers` VALUES (4,'/* nor this */')",
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("gz %v: customers load =\n%q\nwant\n%q", gz, got, want)
+		}
+		if rows, ok := plan.countRows(); !ok || rows != 4 {
+			t.Errorf("countRows = %d, %v, want 4", rows, ok)
+		}
+		if !plan.retryable {
+			t.Error("a dump table's plan starts by dropping the temp table, so should be retryable")
+		}
+
+		plan, err = d.planTable("orders")
+		if err != nil {
+			t.Fatal(err)
+		}
+		load := readAll(t, plan.load)
+		if strings.Contains(load[1], "CONSTRAINT") {
+			t.Errorf("temp table created with its foreign keys: %q", load[1])
+		}
+		if want := "insert ignore into`_swoof_orders` (`ID`, `CustomerID`) VALUES (10,1)"; load[2] != want {
+			t.Errorf("orders insert = %q, want %q", load[2], want)
+		}
+		finalize := readAll(t, plan.finalize)
+		if want := []string{
+			"drop table if exists`orders`",
+			"alter table`_swoof_orders`rename`orders`",
+			"alter table`orders`\nadd  CONSTRAINT `orders_ibfk_1` FOREIGN KEY (`CustomerID`) REFERENCES `customers` (`ID`)",
+		}; !slices.Equal(finalize, want) {
+			t.Errorf("orders finalize = %q, want %q", finalize, want)
+		}
+		if !addConstraintRegexp.MatchString(finalize[2]) {
+			t.Error("the constraint statement should get the constraint pass's leniency")
+		}
+
+		if _, err := d.planTable("missing"); err == nil {
+			t.Error("planTable of a table not in the dump should fail")
+		}
+	}
+}
+
+func TestDumpTempFile(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("windows won't unlink an open file")
+	}
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	leftover := func(when string) {
+		t.Helper()
+		if entries, _ := os.ReadDir(tmp); len(entries) != 0 {
+			t.Errorf("%s: temp dir holds %s", when, entries[0].Name())
+		}
+	}
+
+	// Exiting without Close mustn't leave the decompressed copy behind.
+	d, err := openDump(writeTestDump(t, true), "_swoof_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	leftover("open")
+	plan, err := d.planTable("customers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows, ok := plan.countRows(); !ok || rows != 4 {
+		t.Errorf("countRows = %d, %v, want 4", rows, ok)
+	}
+	d.Close()
+
+	// Nor should a dump that fails partway through decompressing.
+	file := writeTestDump(t, true)
+	b, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, b[:len(b)/2], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if d, err := openDump(file, "_swoof_"); err == nil {
+		d.Close()
+		t.Error("a truncated gzip should fail to open")
+	}
+	leftover("truncated")
+}
+
+func TestOpenDumpInvalid(t *testing.T) {
+	tests := map[string]string{
+		"no tables":            "-- nothing here\nSET NAMES utf8mb4;\n",
+		"insert without table": "INSERT INTO `t` VALUES (1);\n",
+		"table twice":          "CREATE TABLE `t` (`ID` int);\nCREATE TABLE `t` (`ID` int);\n",
+	}
+	for name, sql := range tests {
+		file := filepath.Join(t.TempDir(), "dump.sql")
+		if err := os.WriteFile(file, []byte(sql), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if d, err := openDump(file, "_swoof_"); err == nil {
+			d.Close()
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func readAll(t *testing.T, stmts []replayStatement) []string {
+	t.Helper()
+	var out []string
+	for _, st := range stmts {
+		s, err := st.read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, s)
+	}
+	return out
+}
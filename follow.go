@@ -0,0 +1,487 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/binary"
+	stderrors "errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	mysql "github.com/StirlingMarketingGroup/cool-mysql"
+	"github.com/cenkalti/backoff/v5"
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+)
+
+// How long a dropped binlog stream waits before connecting again.
+const followReconnectDelay = 5 * time.Second
+
+// How often -follow logs where it is.
+const followLogInterval = 30 * time.Second
+
+// followTable is a copied table as -follow applies its changes.
+type followTable struct {
+	name    string
+	dest    string
+	columns []followColumn
+
+	// The primary key's columns, which updates and deletes find rows by.
+	key []int
+
+	state *tableState
+}
+
+type followColumn struct {
+	name string
+	binlogColumn
+
+	// Generated or excluded columns aren't written.
+	skip bool
+
+	// Columns that can't be compared to a literal, so aren't used to find
+	// rows in a table without a primary key.
+	noCompare bool
+}
+
+// loadFollowTables reads the columns of the tables to follow, in the order
+// the binlog gives them.
+func loadFollowTables(src *mysql.Database, tables []string, destTables map[string]string, specs tableSpecs) (map[string]*followTable, error) {
+	out := make(map[string]*followTable, len(tables))
+	for _, name := range tables {
+		var columns []struct {
+			Name       string  `mysql:"COLUMN_NAME"`
+			DataType   string  `mysql:"DATA_TYPE"`
+			ColumnType string  `mysql:"COLUMN_TYPE"`
+			ColumnKey  string  `mysql:"COLUMN_KEY"`
+			Charset    *string `mysql:"CHARACTER_SET_NAME"`
+			Extra      string  `mysql:"EXTRA"`
+		}
+		if err := src.Select(&columns, "select`COLUMN_NAME`,`DATA_TYPE`,`COLUMN_TYPE`,`COLUMN_KEY`,`CHARACTER_SET_NAME`,`EXTRA`"+
+			"from`INFORMATION_SCHEMA`.`columns`"+
+			"where`TABLE_SCHEMA`=database()"+
+			"and`table_name`='"+name+"'"+
+			"order by`ORDINAL_POSITION`", 0); err != nil {
+			return nil, errors.Wrapf(err, "select columns of %q", name)
+		}
+
+		spec := specs.lookup(name)
+		t := &followTable{name: name, dest: destTables[name]}
+		for i, c := range columns {
+			fc := followColumn{
+				name: c.Name,
+				binlogColumn: binlogColumn{
+					unsigned: strings.HasSuffix(c.ColumnType, " unsigned"),
+				},
+				skip:      strings.Contains(c.Extra, "GENERATED") || spec.excludes(c.Name),
+				noCompare: c.DataType == "json" || c.DataType == "geometry",
+			}
+			if c.Charset != nil {
+				fc.charset = *c.Charset
+			}
+			if c.ColumnKey == "PRI" {
+				t.key = append(t.key, i)
+			}
+			t.columns = append(t.columns, fc)
+		}
+		out[name] = t
+	}
+	return out, nil
+}
+
+func (t *followTable) binlogColumns() []binlogColumn {
+	columns := make([]binlogColumn, len(t.columns))
+	for i, c := range t.columns {
+		columns[i] = c.binlogColumn
+	}
+	return columns
+}
+
+// insert is an insert of a row image, updating the row if it's already
+// there, so changes the copy already has apply the same.
+func (t *followTable) insert(row []string) string {
+	var names, values, updates []string
+	for i, c := range t.columns {
+		if c.skip || row[i] == "" {
+			continue
+		}
+		names = append(names, "`"+c.name+"`")
+		values = append(values, row[i])
+		updates = append(updates, "`"+c.name+"`=values(`"+c.name+"`)")
+	}
+	return "insert into`" + t.dest + "`(" + strings.Join(names, ",") + ")values(" + strings.Join(values, ",") + ")" +
+		"on duplicate key update" + strings.Join(updates, ",")
+}
+
+// update sets the columns of the after image on the row the before image
+// finds. It's empty when nothing written changed.
+func (t *followTable) update(before, after []string) (string, error) {
+	var set []string
+	for i, c := range t.columns {
+		if c.skip || after[i] == "" {
+			continue
+		}
+		set = append(set, "`"+c.name+"`="+after[i])
+	}
+	if len(set) == 0 {
+		return "", nil
+	}
+	where, err := t.where(before)
+	if err != nil {
+		return "", err
+	}
+	return "update`" + t.dest + "`set" + strings.Join(set, ",") + where, nil
+}
+
+func (t *followTable) delete(row []string) (string, error) {
+	where, err := t.where(row)
+	if err != nil {
+		return "", err
+	}
+	return "delete from`" + t.dest + "`" + where, nil
+}
+
+// where finds the row an image is of: by primary key, or in a table
+// without one, by every column that can be compared, one row of any that
+// are the same.
+func (t *followTable) where(row []string) (string, error) {
+	var conds []string
+	byKey := len(t.key) != 0
+	for _, i := range t.key {
+		if row[i] == "" {
+			byKey = false
+		}
+	}
+	if byKey {
+		for _, i := range t.key {
+			conds = append(conds, "`"+t.columns[i].name+"`="+row[i])
+		}
+		return "where" + strings.Join(conds, " and "), nil
+	}
+	for i, c := range t.columns {
+		if c.skip || c.noCompare || row[i] == "" {
+			continue
+		}
+		conds = append(conds, "`"+c.name+"`<=>"+row[i])
+	}
+	if len(conds) == 0 {
+		return "", errors.Errorf("a change to %q doesn't say which row it's of", t.name)
+	}
+	return "where" + strings.Join(conds, " and ") + " limit 1", nil
+}
+
+// followDest is a destination changes are applied to, through a
+// connection of its own so each source transaction can be applied as one.
+type followDest struct {
+	name string
+	db   *sql.DB
+}
+
+func openFollowDest(name, dsn string) (followDest, error) {
+	cfg, err := mysqldriver.ParseDSN(dsn)
+	if err != nil {
+		return followDest{}, errors.Wrap(err, "parse destination DSN")
+	}
+	connector, err := mysqldriver.NewConnector(cfg)
+	if err != nil {
+		return followDest{}, errors.Wrap(err, "create destination connector")
+	}
+	db := sql.OpenDB(connector)
+	db.SetMaxOpenConns(1)
+	return followDest{name, db}, nil
+}
+
+// apply runs a transaction's changes on the destination in one transaction
+// of its own, so a failure partway through leaves none of them applied.
+func (d followDest) apply(ctx context.Context, changes []followChange) error {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "begin transaction")
+	}
+	for _, c := range changes {
+		if _, err := tx.ExecContext(ctx, c.stmt); err != nil {
+			tx.Rollback()
+			return errors.Wrapf(err, "apply change to %q", c.table.dest)
+		}
+	}
+	return errors.Wrap(tx.Commit(), "commit transaction")
+}
+
+// followChange is a statement that applies one row's change.
+type followChange struct {
+	table *followTable
+	stmt  string
+	at    time.Time
+}
+
+// follower applies a source's row changes to the copied tables on every
+// destination, a transaction at a time, reading the binlog from where the
+// copy's snapshot was taken.
+type follower struct {
+	dsn      string
+	schema   string
+	serverID uint32
+	tables   map[string]*followTable
+	dests    []followDest
+	u        *ui
+
+	// The position after the last applied transaction, which a dropped
+	// stream picks up from.
+	file string
+	pos  uint64
+
+	// Table maps by id for the stream being read. A nil table isn't
+	// followed.
+	maps map[uint64]followMap
+
+	// The changes of the transaction being read.
+	pending []followChange
+
+	applied  int64
+	lag      time.Duration
+	loggedAt time.Time
+}
+
+type followMap struct {
+	table *followTable
+	tm    binlogTable
+}
+
+func newFollower(dsn string, serverID uint32, pos binlogPosition, tables map[string]*followTable, dests []followDest, u *ui) (*follower, error) {
+	cfg, err := mysqldriver.ParseDSN(dsn)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse source DSN")
+	}
+	for _, t := range tables {
+		t.state = u.State(t.name)
+	}
+	return &follower{
+		dsn:      dsn,
+		schema:   cfg.DBName,
+		serverID: serverID,
+		tables:   tables,
+		dests:    dests,
+		u:        u,
+		file:     pos.File,
+		pos:      pos.Pos,
+	}, nil
+}
+
+// run follows the binlog until ctx is done, connecting again whenever the
+// stream drops. A transaction that was half read is read again in full.
+func (f *follower) run(ctx context.Context) error {
+	for _, t := range f.tables {
+		t.state.Follow()
+	}
+	f.u.SetFollowing()
+	f.loggedAt = time.Now()
+
+	for {
+		err := f.stream(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		var perm *backoff.PermanentError
+		if stderrors.As(err, &perm) || !isTransientError(err) {
+			return err
+		}
+		slog.Warn("binlog stream dropped, reconnecting", "cause", rootErrorMsg(err), "file", f.file, "pos", f.pos)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(followReconnectDelay):
+		}
+	}
+}
+
+func (f *follower) stream(ctx context.Context) error {
+	r, err := openBinlogReader(ctx, f.dsn, f.serverID, f.file, f.pos)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	// A read blocked on a quiet source only returns once its socket is
+	// closed.
+	defer context.AfterFunc(ctx, func() { r.raw.Close() })()
+
+	f.maps = make(map[uint64]followMap)
+	f.pending = f.pending[:0]
+	for {
+		ev, err := r.next()
+		if err != nil {
+			return err
+		}
+		at := time.Unix(int64(ev.timestamp), 0)
+		if ev.timestamp != 0 {
+			f.setLag(time.Since(at))
+		}
+		// Heartbeats keep this ticking while the source is quiet.
+		if time.Since(f.loggedAt) >= followLogInterval {
+			slog.Info("following binlog", "file", f.file, "pos", f.pos, "lag", f.lag.Round(time.Second), "applied", f.applied)
+			f.loggedAt = time.Now()
+		}
+
+		switch ev.typ {
+		case binlogHeartbeat, binlogHeartbeatV2:
+			// Sent only when there's nothing left to send.
+			f.setLag(0)
+
+		case binlogTableMap:
+			tm, err := parseTableMap(ev.body)
+			if err != nil {
+				return backoff.Permanent(err)
+			}
+			var t *followTable
+			if tm.schema == f.schema {
+				t = f.tables[tm.name]
+			}
+			if t != nil && len(tm.types) != len(t.columns) {
+				return backoff.Permanent(errors.Errorf("table %q went from %d columns to %d on the source, so its changes can't be followed", t.name, len(t.columns), len(tm.types)))
+			}
+			f.maps[tm.id] = followMap{t, tm}
+
+		case binlogWriteRows, binlogUpdateRows, binlogDeleteRows,
+			binlogWriteRowsV1, binlogUpdateRowsV1, binlogDeleteRowsV1:
+			if err := f.readRows(ev.typ, ev.body, at); err != nil {
+				return backoff.Permanent(err)
+			}
+
+		case binlogPartialUpdate, mariadbWriteRowsZip, mariadbUpdateRowsZip, mariadbDeleteRowsZip:
+			if len(ev.body) >= 6 {
+				if m := f.maps[(&binlogDecoder{b: ev.body}).uint(6)]; m.table != nil {
+					return backoff.Permanent(errors.Errorf("changes to %q are logged partially or compressed, which -follow can't read, turn off binlog_row_value_options or log_bin_compress", m.table.name))
+				}
+			}
+
+		case binlogXID:
+			if err := f.commit(ctx, r); err != nil {
+				return err
+			}
+
+		case binlogQuery:
+			q := parseQuery(ev.body)
+			switch strings.ToUpper(q) {
+			case "BEGIN":
+			case "COMMIT":
+				// How transactions on tables without XA, like MyISAM, end.
+				if err := f.commit(ctx, r); err != nil {
+					return err
+				}
+			default:
+				f.warnStatement(q)
+				if len(f.pending) == 0 {
+					f.file, f.pos = r.file, r.pos
+				}
+			}
+		}
+	}
+}
+
+// readRows turns a rows event on a followed table into statements.
+func (f *follower) readRows(typ byte, body []byte, at time.Time) error {
+	rows, err := parseRows(typ, body)
+	if err != nil {
+		return err
+	}
+	m, ok := f.maps[rows.tableID]
+	if !ok || m.table == nil {
+		return nil
+	}
+	t := m.table
+	columns := t.binlogColumns()
+	d := binlogDecoder{b: rows.data}
+	for d.off < len(d.b) {
+		row, err := decodeRow(&d, m.tm, columns, rows.present)
+		if err != nil {
+			return err
+		}
+		var stmt string
+		switch typ {
+		case binlogWriteRows, binlogWriteRowsV1:
+			stmt = t.insert(row)
+		case binlogUpdateRows, binlogUpdateRowsV1:
+			var after []string
+			if after, err = decodeRow(&d, m.tm, columns, rows.after); err == nil {
+				stmt, err = t.update(row, after)
+			}
+		default:
+			stmt, err = t.delete(row)
+		}
+		if err != nil {
+			return err
+		}
+		if stmt != "" {
+			f.pending = append(f.pending, followChange{t, stmt, at})
+		}
+	}
+	return nil
+}
+
+// commit applies a transaction's changes to every destination, each in
+// the source's order and as one transaction, retried whole, and moves past
+// it.
+func (f *follower) commit(ctx context.Context, r *binlogReader) error {
+	if len(f.pending) != 0 {
+		g, gctx := errgroup.WithContext(ctx)
+		for _, d := range f.dests {
+			g.Go(func() error {
+				op := func() (struct{}, error) {
+					err := d.apply(gctx, f.pending)
+					if err != nil && !isTransientError(err) {
+						return struct{}{}, backoff.Permanent(err)
+					}
+					return struct{}{}, err
+				}
+				if _, err := backoff.Retry(gctx, op, backoff.WithMaxTries(5)); err != nil {
+					return backoff.Permanent(errors.Wrapf(err, "apply transaction on %s", d.name))
+				}
+				return nil
+			})
+		}
+		if err := g.Wait(); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		for _, c := range f.pending {
+			c.table.state.Applied(1, now.Sub(c.at))
+		}
+		f.applied += int64(len(f.pending))
+		f.pending = f.pending[:0]
+	}
+	f.file, f.pos = r.file, r.pos
+	return nil
+}
+
+func (f *follower) setLag(d time.Duration) {
+	f.lag = max(d, 0)
+	f.u.SetLag(f.lag)
+}
+
+// warnStatement warns about a statement, like an ALTER or TRUNCATE, that
+// looks like it's on a followed table, since only row changes are applied.
+func (f *follower) warnStatement(q string) {
+	lower := strings.ToLower(q)
+	for _, t := range f.tables {
+		if strings.Contains(lower, strings.ToLower(t.name)) {
+			slog.Warn("statement on the source isn't applied to followed tables", "tableName", t.name, "statement", truncateRight(q, 200))
+			return
+		}
+	}
+}
+
+// parseQuery reads the statement of a QUERY event.
+func parseQuery(b []byte) string {
+	if len(b) < 13 {
+		return ""
+	}
+	schemaLen := int(b[8])
+	statusLen := int(binary.LittleEndian.Uint16(b[11:]))
+	start := 13 + statusLen + schemaLen + 1
+	if start > len(b) {
+		return ""
+	}
+	return string(b[start:])
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"slices"
+	"sync"
+	"testing"
+)
+
+func TestFollowStatements(t *testing.T) {
+	keyed := &followTable{
+		name: "users",
+		dest: "users_copy",
+		columns: []followColumn{
+			{name: "id"},
+			{name: "email"},
+			{name: "email_domain", skip: true},
+			{name: "prefs", noCompare: true},
+		},
+		key: []int{0},
+	}
+	keyless := &followTable{
+		name: "log",
+		dest: "log",
+		columns: []followColumn{
+			{name: "at"},
+			{name: "msg"},
+			{name: "data", noCompare: true},
+		},
+	}
+
+	for _, tt := range []struct {
+		name string
+		stmt func() (string, error)
+		want string
+	}{
+		{
+			name: "insert",
+			stmt: func() (string, error) { return keyed.insert([]string{"1", "'a@b.c'", "'b.c'", "null"}), nil },
+			want: "insert into`users_copy`(`id`,`email`,`prefs`)values(1,'a@b.c',null)on duplicate key update`id`=values(`id`),`email`=values(`email`),`prefs`=values(`prefs`)",
+		},
+		{
+			name: "update by primary key",
+			stmt: func() (string, error) {
+				return keyed.update([]string{"1", "'a@b.c'", "'b.c'", "null"}, []string{"1", "'x@y.z'", "'y.z'", ""})
+			},
+			want: "update`users_copy`set`id`=1,`email`='x@y.z'where`id`=1",
+		},
+		{
+			name: "update of only skipped columns",
+			stmt: func() (string, error) {
+				return keyed.update([]string{"1", "", "'b.c'", ""}, []string{"", "", "'y.z'", ""})
+			},
+			want: "",
+		},
+		{
+			name: "delete by primary key",
+			stmt: func() (string, error) { return keyed.delete([]string{"1", "'a@b.c'", "'b.c'", "null"}) },
+			want: "delete from`users_copy`where`id`=1",
+		},
+		{
+			name: "delete without a primary key",
+			stmt: func() (string, error) { return keyless.delete([]string{"'2024-01-01'", "null", "'{}'"}) },
+			want: "delete from`log`where`at`<=>'2024-01-01' and `msg`<=>null limit 1",
+		},
+		{
+			name: "update without a primary key",
+			stmt: func() (string, error) {
+				return keyless.update([]string{"'2024-01-01'", "'hi'", "'{}'"}, []string{"'2024-01-01'", "'bye'", "'{}'"})
+			},
+			want: "update`log`set`at`='2024-01-01',`msg`='bye',`data`='{}'where`at`<=>'2024-01-01' and `msg`<=>'hi' limit 1",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.stmt()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+
+	// Without a key in the image or anything to compare, there's no saying
+	// which row to change.
+	if _, err := keyless.delete([]string{"", "", "'{}'"}); err == nil {
+		t.Error("delete of an image without comparable columns = nil error")
+	}
+}
+
+// followRecorder is a destination that keeps what its transactions
+// committed, and drops its connection at one statement.
+type followRecorder struct {
+	mu        sync.Mutex
+	failAt    int
+	execs     int
+	rollbacks int
+	tx        []string
+	committed []string
+}
+
+func (r *followRecorder) Connect(context.Context) (driver.Conn, error) { return followConn{r}, nil }
+func (r *followRecorder) Driver() driver.Driver                        { return nil }
+
+type followConn struct{ r *followRecorder }
+
+func (c followConn) Prepare(string) (driver.Stmt, error) { return nil, driver.ErrSkip }
+func (c followConn) Close() error                        { return nil }
+func (c followConn) Begin() (driver.Tx, error) {
+	c.r.mu.Lock()
+	defer c.r.mu.Unlock()
+	c.r.tx = nil
+	return c, nil
+}
+
+func (c followConn) ExecContext(_ context.Context, q string, _ []driver.NamedValue) (driver.Result, error) {
+	c.r.mu.Lock()
+	defer c.r.mu.Unlock()
+	c.r.execs++
+	if c.r.execs == c.r.failAt {
+		return nil, driver.ErrBadConn
+	}
+	c.r.tx = append(c.r.tx, q)
+	return driver.RowsAffected(1), nil
+}
+
+func (c followConn) Commit() error {
+	c.r.mu.Lock()
+	defer c.r.mu.Unlock()
+	c.r.committed = append(c.r.committed, c.r.tx...)
+	return nil
+}
+
+func (c followConn) Rollback() error {
+	c.r.mu.Lock()
+	defer c.r.mu.Unlock()
+	c.r.rollbacks++
+	c.r.tx = nil
+	return nil
+}
+
+func TestFollowCommit(t *testing.T) {
+	rec := &followRecorder{failAt: 2}
+	db := sql.OpenDB(rec)
+	defer db.Close()
+
+	table := &followTable{name: "log", dest: "log"}
+	want := []string{
+		"insert into`log`values(1)",
+		"update`log`set`n`=2 where`n`=1 limit 1",
+		"delete from`log`where`n`=2 limit 1",
+	}
+	f := &follower{dests: []followDest{{"dest", db}}}
+	for _, stmt := range want {
+		f.pending = append(f.pending, followChange{table: table, stmt: stmt})
+	}
+	if err := f.commit(context.Background(), &binlogReader{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The connection dropped at the update, so the insert before it was
+	// rolled back and the whole transaction applied again, once.
+	if rec.rollbacks != 1 {
+		t.Errorf("rolled back %d times, want 1", rec.rollbacks)
+	}
+	if !slices.Equal(rec.committed, want) {
+		t.Errorf("committed %q, want %q", rec.committed, want)
+	}
+	if f.applied != 3 || len(f.pending) != 0 {
+		t.Errorf("applied %d with %d pending, want 3 and none", f.applied, len(f.pending))
+	}
+}
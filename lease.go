@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"crypto/sha1"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/pkg/errors"
+)
+
+// A running swoof leases what it writes that a crash would leave behind, so
+// `swoof cleanup` can tell its leftovers from a run still in progress. On a
+// database destination the lease on a temp table is a named lock, which the
+// server releases the moment the run's connection goes away. A file:
+// directory's lease is a file in it that the run keeps touching, and that
+// counts only while it's fresh.
+const (
+	dirLeaseFile  = ".swoof-lease"
+	dirLeaseRenew = 15 * time.Second
+	dirLeaseTTL   = time.Minute
+
+	// How often a temp table lease's connection is pinged, well inside
+	// any wait_timeout a server would be configured with.
+	tableLeasePing = 30 * time.Second
+)
+
+// tempTableLock names the lock held on a temp table, within MySQL's 64
+// character limit.
+func tempTableLock(schema, table string) string {
+	name := "swoof:" + schema + "." + table
+	if len(name) > 64 {
+		sum := sha1.Sum([]byte(name))
+		name = "swoof:" + hex.EncodeToString(sum[:])
+	}
+	return name
+}
+
+// openLockConn opens a single connection to a destination, which named
+// locks belong to, and reads which schema it's in.
+func openLockConn(ctx context.Context, dsn string) (*sql.DB, *sql.Conn, string, error) {
+	cfg, err := mysqldriver.ParseDSN(dsn)
+	if err != nil {
+		return nil, nil, "", errors.Wrap(err, "parse destination DSN")
+	}
+	connector, err := mysqldriver.NewConnector(cfg)
+	if err != nil {
+		return nil, nil, "", errors.Wrap(err, "create destination connector")
+	}
+	db := sql.OpenDB(connector)
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		db.Close()
+		return nil, nil, "", errors.Wrap(err, "connect to destination")
+	}
+	var schema sql.NullString
+	if err := conn.QueryRowContext(ctx, "select database()").Scan(&schema); err != nil {
+		conn.Close()
+		db.Close()
+		return nil, nil, "", errors.Wrap(err, "select destination schema")
+	}
+	return db, conn, schema.String, nil
+}
+
+// tableLease holds the locks on a run's temp tables on one destination.
+type tableLease struct {
+	db   *sql.DB
+	conn *sql.Conn
+
+	ping  func(context.Context) error
+	every time.Duration
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// leaseTables locks the temp tables a run is about to write. Tables another
+// running swoof already holds are returned, so the run can warn that the
+// two will collide. The locks last only as long as their connection, so
+// it's kept busy until Close, and lost is called if it goes away anyway.
+func leaseTables(ctx context.Context, dsn string, tables []string, lost func(error)) (*tableLease, []string, error) {
+	db, conn, schema, err := openLockConn(ctx, dsn)
+	if err != nil {
+		return nil, nil, err
+	}
+	l := &tableLease{
+		db:    db,
+		conn:  conn,
+		ping:  conn.PingContext,
+		every: tableLeasePing,
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	var held []string
+	for _, t := range tables {
+		var got sql.NullInt64
+		if err := conn.QueryRowContext(ctx, "select get_lock(?,0)", tempTableLock(schema, t)).Scan(&got); err != nil {
+			conn.Close()
+			db.Close()
+			return nil, nil, errors.Wrapf(err, "lock temp table %q", t)
+		}
+		if got.Int64 != 1 {
+			held = append(held, t)
+		}
+	}
+	go l.keepAlive(lost)
+	return l, held, nil
+}
+
+// keepAlive pings the lease's connection so the server doesn't close it
+// as idle, which would release the locks with it, until the lease is
+// closed or a ping fails.
+func (l *tableLease) keepAlive(lost func(error)) {
+	defer close(l.done)
+	ticker := time.NewTicker(l.every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), l.every)
+			err := l.ping(ctx)
+			cancel()
+			if err != nil {
+				lost(errors.Wrap(err, "ping temp table lease"))
+				return
+			}
+		}
+	}
+}
+
+// Close releases the locks with the connection that holds them.
+func (l *tableLease) Close() error {
+	close(l.stop)
+	<-l.done
+	l.conn.Close()
+	return l.db.Close()
+}
+
+// dirLease is a run's lease on a directory it's writing.
+type dirLease struct {
+	path string
+	stop chan struct{}
+	done chan struct{}
+}
+
+type dirLeaseInfo struct {
+	PID     int       `json:"pid"`
+	Host    string    `json:"host"`
+	Started time.Time `json:"started"`
+}
+
+// leaseDir creates dir if needed and leases it until release.
+func leaseDir(dir string) (*dirLease, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, errors.Wrapf(err, "create directory %q", dir)
+	}
+	host, _ := os.Hostname()
+	b, err := json.Marshal(dirLeaseInfo{os.Getpid(), host, time.Now().UTC()})
+	if err != nil {
+		return nil, errors.Wrap(err, "encode lease")
+	}
+	l := &dirLease{filepath.Join(dir, dirLeaseFile), make(chan struct{}), make(chan struct{})}
+	if err := os.WriteFile(l.path, b, 0o644); err != nil {
+		return nil, errors.Wrapf(err, "write lease %q", l.path)
+	}
+	go func() {
+		defer close(l.done)
+		ticker := time.NewTicker(dirLeaseRenew)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-l.stop:
+				return
+			case <-ticker.C:
+				now := time.Now()
+				_ = os.Chtimes(l.path, now, now)
+			}
+		}
+	}()
+	return l, nil
+}
+
+// release ends the lease, removing its file so it doesn't end up in the
+// finished directory.
+func (l *dirLease) release() {
+	close(l.stop)
+	<-l.done
+	_ = os.Remove(l.path)
+}
+
+// dirLeaseHolder reports which running swoof holds dir, if any does.
+func dirLeaseHolder(dir string) (dirLeaseInfo, bool) {
+	var info dirLeaseInfo
+	path := filepath.Join(dir, dirLeaseFile)
+	fi, err := os.Stat(path)
+	if err != nil || time.Since(fi.ModTime()) >= dirLeaseTTL {
+		return info, false
+	}
+	// A lease being written or renewed still counts, whoever holds it.
+	if b, err := os.ReadFile(path); err == nil {
+		_ = json.Unmarshal(b, &info)
+	}
+	return info, true
+}
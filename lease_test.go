@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTableLeaseKeepAlive(t *testing.T) {
+	var pings atomic.Int32
+	dropped := errors.New("connection dropped")
+	l := &tableLease{
+		ping: func(context.Context) error {
+			if pings.Add(1) == 3 {
+				return dropped
+			}
+			return nil
+		},
+		every: time.Millisecond,
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	lost := make(chan error, 1)
+	go l.keepAlive(func(err error) { lost <- err })
+
+	select {
+	case err := <-lost:
+		if !errors.Is(err, dropped) {
+			t.Errorf("lost with %v, want %v", err, dropped)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("a failed ping should report the lease lost")
+	}
+	<-l.done
+	if n := pings.Load(); n != 3 {
+		t.Errorf("pinged %d times, want it to stop at the failure, 3", n)
+	}
+
+	// Closed before anything fails, it stops without reporting a loss.
+	l = &tableLease{
+		ping:  func(context.Context) error { return nil },
+		every: time.Millisecond,
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	go l.keepAlive(func(err error) { t.Errorf("lost with %v after a clean stop", err) })
+	time.Sleep(10 * time.Millisecond)
+	close(l.stop)
+	<-l.done
+}
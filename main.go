@@ -9,15 +9,18 @@ import (
 	"io"
 	"log"
 	"log/slog"
+	"math/rand/v2"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"reflect"
 	"regexp"
 	"runtime/debug"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	dynamicstruct "github.com/Ompluscator/dynamic-struct"
@@ -25,7 +28,6 @@ import (
 	"github.com/cenkalti/backoff/v5"
 	"github.com/fatih/color"
 	"github.com/gen2brain/beeep"
-	mysqldriver "github.com/go-sql-driver/mysql"
 	"github.com/pkg/errors"
 	"github.com/posener/cmd"
 	"golang.design/x/clipboard"
@@ -46,6 +48,10 @@ var (
 
 	aliasesFiles = root.String("a", confDir+"/swoof/aliases.yaml", "your aliases file")
 
+	tablesFile = root.String("tables-file", "", "optional YAML file of tables to copy, each with its own where, exclude_columns, order_by, limit and destination name")
+
+	masksFile = root.String("mask", confDir+"/swoof/masks.yaml", "your masking rules file, rewriting the listed columns before they reach any destination")
+
 	connectionsFile = root.String("c", confDir+"/swoof/connections.yaml", "your connections file")
 
 	skipData = root.Bool("n", false, "drop/create tables and triggers only, without importing data")
@@ -55,9 +61,15 @@ var (
 	all = root.Bool("all", false, "grabs all tables, specified tables are ignored")
 
 	insertIgnoreInto = root.Bool("insert-ignore", false, "inserts into the existing table without overwriting the existing rows")
+	upsertInto       = root.Bool("upsert", false, "inserts into the existing table, updating existing rows that share a unique key")
+	replaceInto      = root.Bool("replace", false, "replaces into the existing table, deleting existing rows that share a unique key first")
 
 	dryRun = root.Bool("dry-run", false, "doesn't actually execute any queries that have an effect")
 
+	verify = root.Bool("verify", false, "after finalizing, compares row counts and per key range checksums between the source and every database destination")
+
+	lossless = root.Bool("lossless", false, "copies float, double and temporal values exactly as the source prints them, and runs destinations under the source's sql_mode so values like zero dates are accepted")
+
 	verbose = root.Bool("v", false, "writes all queries to stdout")
 
 	funcs = root.Bool("funcs", false, "imports all functions after tables")
@@ -79,19 +91,57 @@ var (
 
 	whereClause = root.String("w", "", "optional WHERE clause to filter rows from the source table (e.g. \"ID > 1000\")")
 
+	subset = root.Bool("subset", false, "treats the given tables as roots filtered by -w, and also copies exactly the rows they reference through foreign keys")
+
+	subsetChildren = root.Bool("subset-children", false, "with -subset, also copies the rows that reference the root rows through foreign keys")
+
 	tempTablePrefix = root.String("p", "_swoof_", "prefix of the temp table used for initial creation before the swap and drop")
 
+	resume = root.Bool("resume", false, "continues interrupted table imports from their last checkpoint instead of starting them over")
+
+	keepPreviousFlag = root.Bool("keep-previous", false, "renames the table a swap replaces to <prefix>prev_<name> instead of dropping it, so swoof rollback can restore it")
+
+	keepPreviousFor = root.String("keep-previous-for", "", "drops previous tables kept with -keep-previous once they're this old, like 72h or 7d, when a run finishes")
+
+	chunks = root.Int("chunks", 1, "splits each table with an integer primary key into this many key ranges that are read and inserted concurrently")
+
+	follow = root.Bool("follow", false, "after the copy, applies the source's row changes to the copied tables on every destination from its binlog until interrupted")
+
+	consistent = root.Bool("consistent", false, "reads every table from one consistent snapshot of the source, taken under a brief global read lock where allowed, and logs its binlog position")
+
+	csvNull = root.String("csv-null", "", "how NULL is written to csv: and tsv: destinations and read from those sources, an empty field by default")
+
+	csvSchema = root.String("csv-schema", "", "infer to guess the column types of csv: and tsv: source files that have no <table>.sql beside them")
+
+	binaryEncoding = root.String("binary-encoding", "hex", "how binary columns are written to text destinations like csv:, and read from csv: and tsv: sources, hex or base64")
+
+	splitSize = root.String("split-size", "", "starts a new file once a table's file reaches this size, like 512MB, for csv:, tsv: and ndjson: destinations, or a parquet: row group does")
+
+	incremental = root.String("incremental", "", "column whose highest copied value is remembered per destination, so later runs upsert only rows at or above it instead of rebuilding the table")
+
 	args = root.Args("source, dest, tables", "source, dest, tables, ex:\n"+
 		"swoof [flags] 'user:pass@(host)/dbname' 'user:pass@(host)/dbname' table1 table2 table3\n\n"+
 		"see: https://github.com/go-sql-driver/mysql#dsn-data-source-name\n\n"+
 		"Or, optionally, you can use your connections in your connections file like so:\n\n"+
 		"swoof [flags] production localhost table1 table2 table3\n\n"+
 		"Multiple destinations can be comma-separated:\n\n"+
-		"swoof [flags] production localhost,staging table1 table2 table3")
+		"swoof [flags] production localhost,staging table1 table2 table3\n\n"+
+		"A backup written by a file: destination can be restored by using it as the source:\n\n"+
+		"swoof [flags] file:../dump localhost table1 table2 table3\n\n"+
+		"A mysqldump file, plain or gzipped, can be loaded the same way:\n\n"+
+		"swoof [flags] dump:fixtures.sql.gz localhost table1 table2 table3\n\n"+
+		"And a directory of CSV files, one per table:\n\n"+
+		"swoof [flags] csv:./drop localhost table1 table2 table3\n\n"+
+		"To compare tables row by row instead of copying them, see:\n\n"+
+		"swoof diff -h")
 )
 
 var definerRegexp = regexp.MustCompile(`\sDEFINER\s*=\s*[^ ]+`)
 
+// Matches the constraint statements addConstraints writes, whose failures
+// are only warned about.
+var addConstraintRegexp = regexp.MustCompile(`(?i)\badd\s+constraint\b`)
+
 func maybeReportNewVersion() {
 	module, current := moduleVersion()
 	if module == "" || current == "" {
@@ -223,6 +273,24 @@ func printRunSummaryLabels(source string, destinations []string, tables []string
 	fmt.Printf("%s %s\n", labelCyan("tables:       "), value(fmt.Sprintf("%d total", len(tables))))
 }
 
+func printVerifySummary(mismatches []verifyMismatch) {
+	labelCyan := color.New(color.FgHiCyan).SprintFunc()
+	if len(mismatches) == 0 {
+		fmt.Printf("%s %s\n", labelCyan("verified:     "), color.New(color.FgHiGreen).Sprint("all tables match"))
+		return
+	}
+
+	red := color.New(color.FgHiRed).SprintFunc()
+	fmt.Printf("%s %s\n", labelCyan("verified:     "), red(fmt.Sprintf("%d mismatched ranges", len(mismatches))))
+	for _, m := range mismatches {
+		detail := fmt.Sprintf("%d rows on source, %d on destination", m.srcRows, m.dstRows)
+		if m.srcRows == m.dstRows {
+			detail = fmt.Sprintf("checksums differ across %d rows", m.srcRows)
+		}
+		fmt.Printf("  %s %s on %s: %s\n", red(m.table), m.rangeString(), m.dest, detail)
+	}
+}
+
 func printTableColumns(tables []string) {
 	const indent = 2
 	const gutter = 2
@@ -297,6 +365,22 @@ func ensureSemverPrefix(v string) string {
 func main() {
 	start := time.Now()
 
+	// Commands are dispatched ahead of the root flags, since giving root
+	// subcommands would make every import have to name one.
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "diff":
+			runDiff(os.Args[2:])
+			return
+		case "cleanup":
+			runCleanup(os.Args[2:])
+			return
+		case "rollback":
+			runRollback(os.Args[2:])
+			return
+		}
+	}
+
 	// parse our command line arguments and make sure we
 	// were given something that makes sense
 	root.ParseArgs(os.Args...)
@@ -310,6 +394,13 @@ func main() {
 		os.Exit(0)
 	}
 
+	// A destination writing rows to stdout gets it to itself, so everything
+	// swoof prints for people goes to stderr instead, without the TUI.
+	if len(*args) >= 2 && writesToStdout((*args)[1]) {
+		os.Stdout = os.Stderr
+		*noProgressBars = true
+	}
+
 	printTitle()
 	maybeReportNewVersion()
 
@@ -361,6 +452,12 @@ func main() {
 		go u.Run()
 	}
 
+	// Cancelled, with why as its cause, by Ctrl+C or q, SIGTERM, or a table
+	// that fails for good, so every worker unwinds and the run cleans up the
+	// temp tables and directories it would otherwise leave behind.
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+
 	setupStatus := func(msg string) {
 		if useTUI {
 			setupStatuses = append(setupStatuses, msg)
@@ -381,6 +478,13 @@ func main() {
 		os.Exit(1)
 	}
 
+	// -insert-ignore, -upsert and -replace all write straight into the real
+	// table, skipping the temp table and the delayed swap.
+	directWrite := directWriteFlag()
+	if countTrue(*insertIgnoreInto, *upsertInto, *replaceInto) > 1 {
+		fatalSetup("only one of -insert-ignore, -upsert and -replace can be used at a time")
+	}
+
 	blue := color.New(color.FgBlue).SprintFunc()
 	red := color.New(color.FgRed).SprintFunc()
 
@@ -388,54 +492,158 @@ func main() {
 	// for much easier and shorter (and probably safer) command usage
 	connections, _ := getConnections(*connectionsFile)
 
-	// resolve source connection name
-	if connections != nil {
-		if c, ok := connections[sourceDSN]; ok {
-			if c.DestOnly {
-				fatalSetup("source use is not allowed by config", "source", sourceDSN)
+	// A `file:` source replays a backup written by a `file:` destination
+	// instead of reading a live database, a `dump:` source replays a
+	// mysqldump file, and a `csv:` source loads a directory of CSV files.
+	// Everything from table resolution on runs the same pipeline either way.
+	var src *mysql.Database
+	var bk replaySource
+	var catalog tableCatalog
+	var err error
+	if isReplaySource(sourceDSN) {
+		if directWrite != "" {
+			fatalSetup(directWrite + " is not supported with a file:, dump: or csv: source, which is loaded by replaying statements")
+		}
+		if *incremental != "" {
+			fatalSetup("-incremental is not supported with a file:, dump: or csv: source, which is loaded by replaying statements")
+		}
+		if *subset {
+			fatalSetup("-subset needs a live source to follow foreign keys on")
+		}
+		if *follow {
+			fatalSetup("-follow needs a live source to read the binlog of")
+		}
+		if *consistent {
+			fatalSetup("-consistent needs a live source to take a snapshot of")
+		}
+		if *keepPreviousFlag {
+			fatalSetup("-keep-previous is not supported with a file:, dump: or csv: source, which is loaded by replaying statements")
+		}
+		if *tablesFile != "" {
+			fatalSetup("-tables-file is not supported with a file:, dump: or csv: source, which is loaded by replaying statements")
+		}
+
+		if *csvSchema != "" && *csvSchema != "infer" {
+			fatalSetup("-csv-schema must be empty or infer", "csvSchema", *csvSchema)
+		}
+		if err := (rowDestOptions{binaryEncoding: *binaryEncoding}).validate(); err != nil {
+			fatalSetup("invalid -binary-encoding", "error", err)
+		}
+
+		if dir, ok := strings.CutPrefix(sourceDSN, "csv:"); ok {
+			setupStatus(fmt.Sprintf("listing %q...", dir))
+			c, err := openCSVSource(dir, ',', *csvNull, *binaryEncoding, *csvSchema == "infer", *tempTablePrefix)
+			if err != nil {
+				fatalSetup("failed to open csv source", "error", err, "source", sourceFriendly)
+			}
+			bk = c
+		} else if dir, ok := strings.CutPrefix(sourceDSN, "tsv:"); ok {
+			setupStatus(fmt.Sprintf("listing %q...", dir))
+			c, err := openCSVSource(dir, '\t', *csvNull, *binaryEncoding, *csvSchema == "infer", *tempTablePrefix)
+			if err != nil {
+				fatalSetup("failed to open tsv source", "error", err, "source", sourceFriendly)
+			}
+			bk = c
+		} else if name, ok := strings.CutPrefix(sourceDSN, "dump:"); ok {
+			setupStatus(fmt.Sprintf("reading dump %q...", name))
+			d, err := openDump(name, *tempTablePrefix)
+			if err != nil {
+				fatalSetup("failed to read dump", "error", err, "source", sourceFriendly)
+			}
+			defer d.Close()
+			bk = d
+		} else {
+			setupStatus(fmt.Sprintf("opening backup %q...", sourceFriendly))
+			b, err := openBackup(strings.TrimPrefix(sourceDSN, "file:"))
+			if err != nil {
+				fatalSetup("failed to open backup", "error", err, "source", sourceFriendly)
 			}
+			bk = b
+		}
+		catalog = bk
+	} else {
+		// resolve source connection name
+		if connections != nil {
+			if c, ok := connections[sourceDSN]; ok {
+				if c.DestOnly {
+					fatalSetup("source use is not allowed by config", "source", sourceDSN)
+				}
 
-			sourceDSN = connectionToDSN(c)
+				sourceDSN = connectionToDSN(c)
+			}
 		}
-	}
 
-	// Anchor the source session to UTC so SHOW CREATE TABLE emits timestamp
-	// defaults (e.g. TIMESTAMP's 2038-01-19 03:14:07.999999 max) in UTC rather
-	// than rendered into whatever tz the server defaulted to.
-	sourceDSN, err := ensureUTCSession(sourceDSN)
-	if err != nil {
-		fatalSetup("failed to apply UTC session tz to source DSN", "error", err)
-	}
+		// Anchor the source session to UTC so SHOW CREATE TABLE emits timestamp
+		// defaults (e.g. TIMESTAMP's 2038-01-19 03:14:07.999999 max) in UTC rather
+		// than rendered into whatever tz the server defaulted to.
+		sourceDSN, err = ensureUTCSession(sourceDSN)
+		if err != nil {
+			fatalSetup("failed to apply UTC session tz to source DSN", "error", err)
+		}
 
-	// Stop the source server from killing a streaming read conn when dest
-	// backpressure stalls our TCP read side.
-	sourceDSN, err = ensureLongSourceStream(sourceDSN)
-	if err != nil {
-		fatalSetup("failed to apply net_write_timeout to source DSN", "error", err)
-	}
+		// Stop the source server from killing a streaming read conn when dest
+		// backpressure stalls our TCP read side.
+		sourceDSN, err = ensureLongSourceStream(sourceDSN)
+		if err != nil {
+			fatalSetup("failed to apply net_write_timeout to source DSN", "error", err)
+		}
 
-	// source connection is the first argument
-	// this is where our rows are coming from
-	setupStatus(fmt.Sprintf("connecting to source %q...", sourceFriendly))
-	src, err := mysql.NewFromDSN(sourceDSN, sourceDSN)
-	if err != nil {
-		fatalSetup("failed to create source connection", "error", err, "sourceDSN", sourceDSN)
-	}
+		if *lossless {
+			sourceDSN, err = textTemporals(sourceDSN)
+			if err != nil {
+				fatalSetup("failed to turn off parseTime on source DSN", "error", err)
+			}
+		}
+
+		// source connection is the first argument
+		// this is where our rows are coming from
+		setupStatus(fmt.Sprintf("connecting to source %q...", sourceFriendly))
+		src, err = mysql.NewFromDSN(sourceDSN, sourceDSN)
+		if err != nil {
+			fatalSetup("failed to create source connection", "error", err, "sourceDSN", sourceDSN)
+		}
 
-	src.DisableUnusedColumnWarnings = true
+		src.DisableUnusedColumnWarnings = true
 
-	if *verbose {
+		if *verbose {
+			src.Log = func(detail mysql.LogDetail) {
+				slog.Info(fmt.Sprintf("%s %s", blue("src:"), detail.Query))
+			}
+		}
+
+		logFnSrc := src.Log
 		src.Log = func(detail mysql.LogDetail) {
-			slog.Info(fmt.Sprintf("%s %s", blue("src:"), detail.Query))
+			if logFnSrc != nil {
+				logFnSrc(detail)
+			}
 		}
+
+		catalog = mysqlCatalog{src}
 	}
 
-	logFnSrc := src.Log
-	src.Log = func(detail mysql.LogDetail) {
-		if logFnSrc != nil {
-			logFnSrc(detail)
+	// -lossless runs every destination under the mode the source's values
+	// were accepted under, so strict modes on the destination don't reject
+	// or round them.
+	var sqlMode *string
+	if *lossless {
+		if src == nil {
+			slog.Warn("-lossless is ignored with a file:, dump: or csv: source, which is loaded by replaying statements")
+		} else {
+			var mode struct {
+				Mode string `mysql:"Mode"`
+			}
+			if err := src.Select(&mode, "select@@session.sql_mode`Mode`", 0); err != nil {
+				fatalSetup("failed to read source sql_mode", "error", err)
+			}
+			sqlMode = &mode.Mode
 		}
 	}
+	// mysqldump sets NO_AUTO_VALUE_ON_ZERO in a /*! */ comment the replay
+	// skips, and without it a 0 in an auto increment column would load as
+	// the next id, so destinations take the dump's sql_mode instead.
+	if d, ok := bk.(*dump); ok && d.sqlMode != nil {
+		sqlMode = d.sqlMode
+	}
 
 	// resolve and create all destination connections upfront so that
 	// each table's data is read from the source only once and fanned
@@ -445,21 +653,67 @@ func main() {
 		isPath      bool
 		isClipboard bool
 		clipboard   *bytes.Buffer
+
+		// The - destination's script, which each table spools into.
+		stream *sqlStream
+
+		// Identifies the physical target (user@host/schema for databases),
+		// used to spot duplicates and to key per-destination checkpoints.
+		key string
+
+		// As given on the command line, for logs.
+		name string
+
+		// The DSN of a database destination, empty for the rest.
+		dsn string
+	}
+
+	// Destinations that take rows rather than SQL, like csv: directories.
+	type rowDestInfo struct {
+		dest rowDest
+		name string
+	}
+
+	rowOpts := rowDestOptions{null: *csvNull, binaryEncoding: *binaryEncoding, tempPrefix: *tempTablePrefix}
+	if *splitSize != "" {
+		if rowOpts.splitSize, err = parseSize(*splitSize); err != nil {
+			fatalSetup("invalid -split-size", "error", err)
+		}
 	}
 
 	var dsts []destInfo
+	var rowDsts []rowDestInfo
+	// file: directories being written beside an existing one, removed if
+	// the run stops before they can be moved into its place.
+	var incompleteDirs []string
 	seenDestKeys := make(map[string]string)
 	for _, rawDSN := range destDSNs {
 		destDSN := strings.TrimSpace(rawDSN)
 		friendlyName := destDSN
 
+		if rd, ok, err := openRowDest(destDSN, rowOpts); ok {
+			if err != nil {
+				fatalSetup("failed to open destination", "error", err, "destination", friendlyName)
+			}
+			if bk != nil {
+				fatalSetup("a file:, dump: or csv: source replays statements, which only database, file:, clipboard and stdout destinations take", "destination", friendlyName)
+			}
+			if prev, ok := seenDestKeys[rd.key()]; ok {
+				fatalSetup(fmt.Sprintf("%q resolves to the same target as %q", friendlyName, prev))
+			}
+			seenDestKeys[rd.key()] = friendlyName
+			rowDsts = append(rowDsts, rowDestInfo{rd, friendlyName})
+			continue
+		}
+
 		destIsPath := strings.HasPrefix(destDSN, "file:")
 		destIsClipboard := strings.EqualFold(destDSN, "clipboard")
+		destIsStdout := isStdoutDest(destDSN)
 
 		setupStatus(fmt.Sprintf("opening destination %q...", friendlyName))
 
 		// resolve destination connection name
-		if connections != nil && !destIsPath && !destIsClipboard {
+		if connections != nil && !destIsPath && !destIsClipboard && !destIsStdout {
 			if c, ok := connections[destDSN]; ok {
 				if c.SourceOnly {
 					fatalSetup("destination use is not allowed by config", "destination", destDSN)
@@ -488,12 +742,13 @@ func main() {
 			dedupeKey = "file:" + strings.TrimPrefix(destDSN, "file:")
 		case destIsClipboard:
 			dedupeKey = "clipboard"
-		default:
-			if cfg, parseErr := mysqldriver.ParseDSN(destDSN); parseErr == nil {
-				dedupeKey = cfg.User + "@" + cfg.Addr + "/" + cfg.DBName
-			} else {
-				dedupeKey = destDSN
+		case destIsStdout:
+			dedupeKey = "stdout"
+			if prev, ok := seenDestKeys[dedupeKey]; ok {
+				fatalSetup(fmt.Sprintf("%q resolves to the same target as %q", friendlyName, prev))
 			}
+		default:
+			dedupeKey = dsnTarget(destDSN)
 		}
 		if prev, ok := seenDestKeys[dedupeKey]; ok {
 			label := color.New(color.FgHiYellow).Sprint("⚠ duplicate destination")
@@ -504,6 +759,7 @@ func main() {
 
 		var db *mysql.Database
 		var clipboardBuf *bytes.Buffer
+		var stream *sqlStream
 		if destIsPath {
 			name := strings.TrimPrefix(destDSN, "file:")
 
@@ -512,7 +768,15 @@ func main() {
 				oldName := name + ".old"
 				finalName := name
 				name = incompleteName
+				incompleteDirs = append(incompleteDirs, incompleteName)
+				// Leased while it's written, so `swoof cleanup` leaves it be.
+				lease, err := leaseDir(incompleteName)
+				if err != nil {
+					fatalSetup("failed to lease directory", "error", err, "directory", incompleteName)
+				}
 				defer func() {
+					lease.release()
+
 					// if the "old" directory exists, we can remove it
 					if _, err := os.Stat(oldName); err == nil {
 						slog.Info("removing old directory", "directory", oldName)
@@ -550,12 +814,24 @@ func main() {
 			}
 		} else if destIsClipboard {
 			clipboardBuf = new(bytes.Buffer)
-			clipboardBuf.WriteString("set foreign_key_checks=0;\n\n")
+			clipboardBuf.WriteString("set foreign_key_checks=0;\n")
+			if sqlMode != nil {
+				clipboardBuf.WriteString("set sql_mode='" + *sqlMode + "';\n")
+			}
+			clipboardBuf.WriteString("\n")
 
 			db, err = mysql.NewWriter(clipboardBuf)
 			if err != nil {
 				fatalSetup("failed to create writer", "error", err)
 			}
+		} else if destIsStdout {
+			if stream, err = newSQLStream(stdout, sqlMode); err != nil {
+				fatalSetup("failed to start stdout script", "error", err)
+			}
+			db, err = mysql.NewWriter(stream)
+			if err != nil {
+				fatalSetup("failed to create writer", "error", err)
+			}
 		} else {
 			// Anchor every dest pool conn to UTC, matching the source. Without
 			// this a non-UTC dest session reinterprets the SHOW CREATE TABLE
@@ -565,6 +841,12 @@ func main() {
 			if err != nil {
 				fatalSetup("failed to apply UTC session tz to destination DSN", "error", err, "destinationDSN", friendlyName)
 			}
+			if sqlMode != nil {
+				destDSN, err = ensureSQLMode(destDSN, *sqlMode)
+				if err != nil {
+					fatalSetup("failed to apply source sql_mode to destination DSN", "error", err, "destinationDSN", friendlyName)
+				}
+			}
 			db, err = mysql.NewFromDSN(destDSN, destDSN)
 			if err != nil {
 				fatalSetup("failed to create destination connection", "error", err, "destinationDSN", destDSN)
@@ -586,15 +868,73 @@ func main() {
 			}
 		}
 
-		dsts = append(dsts, destInfo{db, destIsPath, destIsClipboard, clipboardBuf})
+		var dbDSN string
+		if !destIsPath && !destIsClipboard && !destIsStdout {
+			dbDSN = destDSN
+		}
+		dsts = append(dsts, destInfo{db, destIsPath, destIsClipboard, clipboardBuf, stream, dedupeKey, friendlyName, dbDSN})
+	}
+
+	// execDst runs a statement through one of d's writers, db, which for
+	// the stdout script is table's spool, or the script itself for "".
+	execDst := func(d destInfo, db *mysql.Database, table, stmt string) error {
+		if d.stream != nil {
+			return d.stream.exec(table, db, stmt)
+		}
+		return db.Exec(stmt)
+	}
+
+	// The tables file's tables are copied along with any named ones. -all
+	// treats named tables as exclusions, so there they only carry options.
+	var specs tableSpecs
+	if *tablesFile != "" {
+		if specs, err = getTableSpecs(*tablesFile); err != nil {
+			fatalSetup("failed to read tables file", "error", err)
+		}
+		if !*all {
+			*args = append(*args, specs.names()...)
+		}
 	}
 
 	setupStatus("resolving tables...")
-	tableNames, err := getTables(*aliasesFiles, *all, args, src)
+	tableNames, err := getTables(*aliasesFiles, *all, args, catalog)
 	if err != nil {
 		fatalSetup("failed to get tables", "error", err, "aliasesFile", *aliasesFiles, "all", *all, "args", *args)
 	}
 
+	// -subset swaps the given tables for the whole plan, each table with its
+	// own filter. Printed before anything runs, since it decides what's copied.
+	var plan *subsetPlan
+	if *subsetChildren && !*subset {
+		fatalSetup("-subset-children only applies with -subset")
+	}
+	if *subset {
+		setupStatus("following foreign keys...")
+		fks, err := loadForeignKeys(ctx, src)
+		if err != nil {
+			fatalSetup("failed to read foreign keys", "error", err)
+		}
+		rootWheres := make(map[string]string, len(*tableNames))
+		for _, t := range *tableNames {
+			rootWheres[t] = *whereClause
+			if w := specs.lookup(t).Where; w != "" {
+				rootWheres[t] = w
+			}
+		}
+		plan = planSubset(fks, *tableNames, rootWheres, *subsetChildren)
+		setupStatus("subset plan:")
+		for _, line := range plan.describe() {
+			setupStatus("  " + line)
+		}
+		for _, fk := range plan.cycles {
+			slog.Warn("foreign key closes a loop between tables and is only followed once, rows it references may be missing",
+				"constraint", fk.name,
+				"tableName", fk.table,
+				"references", fk.refTable)
+		}
+		tableNames = &plan.tables
+	}
+
 	// get our tables ordered by the largest physical tables first
 	// this *should* help performance, so that the longest table doesn't start last
 	// and draw out the total process time
@@ -603,28 +943,36 @@ func main() {
 	var orderedTables []string
 	if len(*tableNames) > 0 {
 		setupStatus(fmt.Sprintf("ordering %d tables by size...", len(*tableNames)))
-		tablesCh := make(chan string, len(*tableNames))
-		go func() {
-			defer close(tablesCh)
-			err := src.Select(tablesCh, "select`table_name`"+
-				"from`information_schema`.`TABLES`"+
-				"where`table_schema`=database()"+
-				"and`table_name`in({{ range $i, $table := .Tables }}{{ if $i }},{{ end }}{{ $table | printf `'%s'` }}{{ end }})"+
-				"and`table_type`='BASE TABLE'"+
-				"order by`data_length`+`index_length`desc", 0, mysql.Params{
-				"Tables": *tableNames,
-			})
-			if err != nil {
-				fatalSetup("failed to select tables", "error", err)
-			}
-		}()
-		for t := range tablesCh {
-			orderedTables = append(orderedTables, t)
+		orderedTables, err = catalog.tablesBySize(*tableNames)
+		if err != nil {
+			fatalSetup("failed to select tables", "error", err)
 		}
 	}
 
 	u.SetTables(orderedTables)
 
+	// Every table reads with -w, unless it has its own where in the tables
+	// file or -subset worked out its filter.
+	tableWheres := make(map[string]string, len(orderedTables))
+	destTables := make(map[string]string, len(orderedTables))
+	for _, t := range orderedTables {
+		tableWheres[t] = *whereClause
+		if w := specs.lookup(t).Where; w != "" {
+			tableWheres[t] = w
+		}
+		if plan != nil {
+			tableWheres[t] = plan.wheres[t]
+		}
+
+		dest := specs.lookup(t).destName(t)
+		for other, d := range destTables {
+			if d == dest {
+				fatalSetup("two tables would be copied to the same destination table", "tables", []string{other, t}, "destTable", dest)
+			}
+		}
+		destTables[t] = dest
+	}
+
 	// TUI mode replays the run header post-dismiss; non-TUI prints it now.
 	if !useTUI {
 		printRunHeader(sourceFriendly, destFriendlyNames, orderedTables)
@@ -638,9 +986,185 @@ func main() {
 		"tables", len(orderedTables),
 		"threads", *threads)
 
+	// -consistent reads every table through connections that share one
+	// snapshot, enough of them for every table and chunk read at once.
+	// -follow needs one too, for where to start reading the binlog.
+	var snap *snapshot
+	var snapDB *mysql.Database
+	if *consistent || *follow {
+		if *resume {
+			name := "-consistent"
+			if !*consistent {
+				name = "-follow"
+			}
+			fatalSetup(name + " can't be combined with -resume, which would mix rows read at different times")
+		}
+		setupStatus("opening consistent snapshot...")
+		snap, err = openSnapshot(ctx, sourceDSN, *threads*max(*chunks, 1))
+		if err != nil {
+			fatalSetup("failed to open consistent snapshot", "error", err)
+		}
+		defer snap.Close()
+		snapDB = snap.db
+		snapDB.DisableUnusedColumnWarnings = true
+		snapDB.Log = src.Log
+		slog.Info("opened consistent snapshot",
+			"connections", *threads*max(*chunks, 1),
+			"locked", snap.locked,
+			"binlogFile", snap.pos.File,
+			"binlogPos", snap.pos.Pos,
+			"gtid", snap.pos.GTID)
+	}
+
 	// FK constraints applied post-import so cross-references resolve.
 	delayedFuncs := make(chan func() error, len(orderedTables))
 
+	// Checkpoints need every destination to be a database we can trim back
+	// and append to. File, clipboard and stdout writers always start a
+	// table over, and the direct-write modes have no temp table to resume
+	// into.
+	allDatabases := len(rowDsts) == 0
+	destKeys := make([]string, len(dsts))
+	for i, d := range dsts {
+		destKeys[i] = d.key
+		if d.isPath || d.isClipboard || d.stream != nil {
+			allDatabases = false
+		}
+		if d.stream != nil {
+			for _, t := range orderedTables {
+				if _, err := d.stream.addTable(t, d.db); err != nil {
+					fatalSetup("failed to set up stdout script", "error", err)
+				}
+			}
+		}
+	}
+	checkpointing := allDatabases && bk == nil && !*skipData && !*dryRun && directWrite == ""
+	if *resume && !checkpointing {
+		slog.Warn("-resume only applies to database destinations with data imports, tables will start over")
+	}
+	sourceKey := dsnTarget(sourceDSN)
+
+	masks, err := getMasks(*masksFile)
+	if err != nil {
+		fatalSetup("failed to read masks", "error", err, "masksFile", *masksFile)
+	}
+	if bk != nil && len(masks) != 0 {
+		slog.Warn("masks don't apply to a file:, dump: or csv: source, which is loaded by replaying statements")
+		masks = nil
+	}
+
+	// Incremental runs upsert into the real table, which only a database
+	// destination has; the direct-write modes already write straight into it.
+	if *incremental != "" && !allDatabases {
+		fatalSetup("-incremental only supports database destinations")
+	}
+	if *incremental != "" && directWrite != "" {
+		fatalSetup("-incremental can't be combined with " + directWrite)
+	}
+
+	// Chunks share one temp table, so their inserts must be safe to run
+	// concurrently, which file, clipboard and stdout writers aren't.
+	chunking := *chunks > 1 && bk == nil
+	if chunking && !allDatabases {
+		slog.Warn("-chunks only applies when every destination is a database, tables will be read in a single stream")
+		chunking = false
+	}
+
+	// -follow keeps the copied tables up to date from the binlog once the
+	// copy is done, starting where the snapshot was taken, so it needs every
+	// change to a table to apply as is.
+	var followTables map[string]*followTable
+	if *follow {
+		switch {
+		case !allDatabases:
+			fatalSetup("-follow only supports database destinations")
+		case *dryRun:
+			fatalSetup("-follow can't be combined with -dry-run")
+		case *whereClause != "" || plan != nil:
+			fatalSetup("-follow applies every change to a table, so it can't be combined with -w or -subset")
+		}
+		for _, t := range orderedTables {
+			if spec := specs.lookup(t); spec.Where != "" || spec.Limit > 0 {
+				fatalSetup("-follow applies every change to a table, so it can't copy one with a where or limit", "tableName", t)
+			}
+			if len(masks[t]) != 0 {
+				fatalSetup("-follow doesn't mask the changes it applies, so it can't copy a table with masked columns", "tableName", t)
+			}
+		}
+		if snap.pos.File == "" {
+			fatalSetup("-follow needs the source's binlog position, which needs binary logging on and the REPLICATION CLIENT privilege")
+		}
+		var format struct {
+			Format string `mysql:"Format"`
+		}
+		if err := src.Select(&format, "select@@global.binlog_format`Format`", 0); err != nil {
+			fatalSetup("failed to read source binlog_format", "error", err)
+		}
+		if !strings.EqualFold(format.Format, "ROW") {
+			fatalSetup("-follow needs the source's binlog_format to be ROW", "binlogFormat", format.Format)
+		}
+		if followTables, err = loadFollowTables(src, orderedTables, destTables, specs); err != nil {
+			fatalSetup("failed to read columns of followed tables", "error", err)
+		}
+	}
+
+	// -keep-previous moves each replaced table aside as <prefix>prev_<name>,
+	// which a table already named prev_<name> would have for its temp table.
+	var retention time.Duration
+	if *keepPreviousFlag {
+		if directWrite != "" {
+			fatalSetup("-keep-previous can't be combined with " + directWrite + ", which writes straight into the table")
+		}
+		for _, t := range orderedTables {
+			if strings.HasPrefix(destTables[t], "prev_") {
+				fatalSetup("-keep-previous can't copy a table named prev_*, its temp table would be another's previous table", "tableName", destTables[t])
+			}
+		}
+	}
+	if *keepPreviousFor != "" {
+		if retention, err = parseRetention(*keepPreviousFor); err != nil {
+			fatalSetup("invalid -keep-previous-for", "error", err)
+		}
+	}
+
+	// Every temp table this run writes is leased until it exits, so `swoof
+	// cleanup` can tell them from a crashed run's. Losing a lease stops the
+	// run while its temp tables are still being written, since cleanup could
+	// drop them; once every table is written, there's nothing left to stop.
+	var finalizing atomic.Bool
+	if directWrite == "" && !*dryRun {
+		tempTables := make([]string, len(orderedTables))
+		for i, t := range orderedTables {
+			tempTables[i] = *tempTablePrefix + destTables[t]
+		}
+		for _, d := range dsts {
+			if d.dsn == "" {
+				continue
+			}
+			lease, held, err := leaseTables(ctx, d.dsn, tempTables, func(err error) {
+				if finalizing.Load() {
+					slog.Warn("lost the temp table leases", "error", err, "destination", d.name)
+					return
+				}
+				cancel(errors.Wrapf(err, "lost the temp table leases on %s", d.name))
+			})
+			if err != nil {
+				fatalSetup("failed to lease temp tables", "error", err, "destination", d.name)
+			}
+			defer lease.Close()
+			if len(held) != 0 {
+				slog.Warn("another swoof is writing some of the same temp tables, the two will collide", "destination", d.name, "tempTables", held)
+			}
+		}
+	}
+
+	// Only now, so an interrupt during setup still just ends the process.
+	cancelOnInterrupt(ctx, cancel, u)
+
+	// Every table's state, TUI or not, for the summary of a run that stops
+	// early.
+	states := make([]*tableState, 0, len(orderedTables))
+
 	tableCount := 0
 	for _, table := range orderedTables {
 		tableCount++
@@ -652,10 +1176,11 @@ func main() {
 
 		wg.Add(1)
 
-		var state *tableState
-		if u != nil {
-			state = u.State(tableName)
+		state := u.State(tableName)
+		if state == nil {
+			state = newTableState(tableName)
 		}
+		states = append(states, state)
 
 		go func() {
 			defer wg.Done()
@@ -663,20 +1188,52 @@ func main() {
 			// Throttle after the bar is registered so progress rendering
 			// reflects all tables from the start; the semaphore just paces
 			// how many goroutines actually do work concurrently.
-			guard <- struct{}{}
+			select {
+			case guard <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
 			defer func() { <-guard }()
+			if ctx.Err() != nil {
+				return
+			}
+
+			// The table's own options from -tables-file, if any. Its rows
+			// land in destTable, which is tableName unless renamed there.
+			spec := specs.lookup(tableName)
+			destTable := destTables[tableName]
 
 			// compute the per-table destination, applying WriterWithSubdir for file dests
 			tableDsts := make([]*mysql.Database, len(dsts))
 			for i, d := range dsts {
 				tableDsts[i] = d.db
 				if d.isPath {
-					tableDsts[i] = d.db.WriterWithSubdir(filepath.Join("tables", tableName))
+					tableDsts[i] = d.db.WriterWithSubdir(filepath.Join("tables", destTable))
+				}
+				if d.stream != nil {
+					tableDsts[i] = d.stream.table(tableName)
 				}
 			}
 
-			tempTableName := *tempTablePrefix + tableName
+			tempTableName := *tempTablePrefix + destTable
 			tableStart := time.Now()
+			tableWhere := tableWheres[tableName]
+
+			// Carried across attempts so a retry picks up where the last one
+			// committed rather than re-reading the checkpoint file.
+			var ckpt *checkpoint
+			var ckptPath string
+			if checkpointing {
+				ckptPath = checkpointPath(sourceKey, tableName)
+			}
+
+			// Set once an attempt has upserted straight into the real table,
+			// leaving no delayed swap to finalize.
+			var upserted bool
+
+			// Set when a direct write can safely be retried after a partial
+			// attempt because a unique key stops rows from doubling up.
+			var retrySafe bool
 
 			// Safe to retry because the real table is only swapped in by the
 			// delayed finalization pass, which runs after the attempt succeeds.
@@ -692,21 +1249,41 @@ func main() {
 				// Fresh *sql.DB pool per attempt so NewFromDSN / Ping failures
 				// also go through the retry loop, and each table goroutine's
 				// cursors and metadata queries don't contend on a shared pool.
-				srcTable, err := mysql.NewFromDSN(sourceDSN, sourceDSN)
-				if err != nil {
-					return struct{}{}, errors.Wrapf(err, "open source connection for %q", tableName)
+				// -consistent shares the snapshot's connections instead, since
+				// a fresh one wouldn't see the same view.
+				srcTable := snapDB
+				if srcTable == nil {
+					var err error
+					srcTable, err = mysql.NewFromDSN(sourceDSN, sourceDSN)
+					if err != nil {
+						return struct{}{}, errors.Wrapf(err, "open source connection for %q", tableName)
+					}
+					defer func() {
+						if err := srcTable.Close(); err != nil {
+							slog.Warn("failed to close per-attempt source pool", "error", err, "tableName", tableName)
+						}
+					}()
+					// Don't recycle connections mid-stream — cool-mysql's 27s default
+					// is Lambda-oriented and wrong for multi-hour table imports.
+					srcTable.SetMaxConnectionTime(0)
+					srcTable.DisableUnusedColumnWarnings = true
+					if src.Log != nil {
+						srcTable.Log = src.Log
+					}
 				}
-				defer func() {
-					if err := srcTable.Close(); err != nil {
-						slog.Warn("failed to close per-attempt source pool", "error", err, "tableName", tableName)
+
+				// Masked key columns have to stay distinct. COLUMN_KEY only marks
+				// the first column of a composite unique key, so every column of
+				// one comes from STATISTICS instead.
+				var uniqueColumns []string
+				if len(masks[tableName]) != 0 {
+					if err := srcTable.SelectContext(ctx, &uniqueColumns, "select distinct`COLUMN_NAME`"+
+						"from`INFORMATION_SCHEMA`.`STATISTICS`"+
+						"where`TABLE_SCHEMA`=database()"+
+						"and`TABLE_NAME`='"+tableName+"'"+
+						"and`NON_UNIQUE`=0", 0); err != nil {
+						return struct{}{}, errors.Wrapf(err, "get unique key columns for %q", tableName)
 					}
-				}()
-				// Don't recycle connections mid-stream — cool-mysql's 27s default
-				// is Lambda-oriented and wrong for multi-hour table imports.
-				srcTable.SetMaxConnectionTime(0)
-				srcTable.DisableUnusedColumnWarnings = true
-				if src.Log != nil {
-					srcTable.Log = src.Log
 				}
 
 				columns := make(chan struct {
@@ -714,6 +1291,9 @@ func main() {
 					Position             int    `mysql:"ORDINAL_POSITION"`
 					DataType             string `mysql:"DATA_TYPE"`
 					ColumnType           string `mysql:"COLUMN_TYPE"`
+					ColumnKey            string `mysql:"COLUMN_KEY"`
+					IsNullable           string `mysql:"IS_NULLABLE"`
+					MaxLength            *int64 `mysql:"CHARACTER_MAXIMUM_LENGTH"`
 					GenerationExpression string `mysql:"GENERATION_EXPRESSION"`
 				})
 
@@ -729,7 +1309,7 @@ func main() {
 				columnsErrCh := make(chan error, 1)
 				go func() {
 					defer close(columns)
-					columnsErrCh <- srcTable.SelectContext(context.Background(), columns, "select*"+
+					columnsErrCh <- srcTable.SelectContext(ctx, columns, "select*"+
 						"from`INFORMATION_SCHEMA`.`columns`"+
 						"where`TABLE_SCHEMA`=database()"+
 						"and`table_name`='"+tableName+"'"+
@@ -740,6 +1320,26 @@ func main() {
 				columnsQuotedBld := new(strings.Builder)
 				i := 0
 
+				// The resume key: a single-column integer primary key, which
+				// both sides can order and compare the same way.
+				pkColumns := 0
+				pkField := -1
+				var pkName string
+				var pkUnsigned bool
+
+				// Upserts match rows on the primary key and overwrite the rest.
+				var columnNames, pkNames, updateNames []string
+				var watermarkColumn string
+
+				// What row destinations are told about each field.
+				var rowColumns []rowColumn
+
+				// Masked columns are rewritten between the select and every
+				// inserter. A masked primary key no longer matches the source's,
+				// so the table can't be resumed by key.
+				var masked []maskedColumn
+				var pkMasked bool
+
 				// Drain columns into the dynamic row struct. Cool mysql channel
 				// selecting keeps only one row in memory at a time.
 				for c := range columns {
@@ -748,6 +1348,15 @@ func main() {
 						// throw errors if you try. Skip them entirely.
 						continue
 					}
+					if spec.excludes(c.ColumnName) {
+						if c.ColumnKey == "PRI" {
+							for range columns {
+							}
+							<-columnsErrCh
+							return struct{}{}, backoff.Permanent(errors.Errorf("can't exclude primary key column %q of table %q", c.ColumnName, tableName))
+						}
+						continue
+					}
 
 					if i != 0 {
 						columnsQuotedBld.WriteByte(',')
@@ -761,53 +1370,8 @@ func main() {
 					f := "F" + strconv.Itoa(c.Position)
 					tag := `mysql:"` + strings.ReplaceAll(c.ColumnName, `,`, `0x2C`) + `"`
 
-					var v any
-
-					// All field types are pointers so mysql scanning handles NULL gracefully.
-					switch c.DataType {
-					case "tinyint":
-						if unsigned {
-							v = new(uint8)
-						} else {
-							v = new(int8)
-						}
-					case "smallint":
-						if unsigned {
-							v = new(uint16)
-						} else {
-							v = new(int16)
-						}
-					case "int", "mediumint":
-						if unsigned {
-							v = new(uint32)
-						} else {
-							v = new(int32)
-						}
-					case "bigint":
-						if unsigned {
-							v = new(uint64)
-						} else {
-							v = new(int64)
-						}
-					case "float", "double":
-						v = new(float64)
-					case "decimal":
-						// mysql.Raw is passed directly into the query with no escaping;
-						// safe here because a decimal from mysql can't contain breaking characters.
-						v = new(mysql.Raw)
-					case "timestamp", "date", "datetime":
-						v = new(string)
-					case "binary", "varbinary", "blob", "tinyblob", "mediumblob", "longblob":
-						v = new([]byte)
-					case "char", "varchar", "text", "tinytext", "mediumtext", "longtext", "enum":
-						v = new(string)
-					case "json":
-						// json.RawMessage lets cool mysql surround the value with charset info,
-						// since mysql needs utf8 charset info for json columns.
-						v = new(json.RawMessage)
-					case "set":
-						v = new(any)
-					default:
+					v, ok := rowField(c.DataType, unsigned, *lossless)
+					if !ok {
 						// Unknown column types are not transient — fail permanently so we
 						// don't spin through retries on a schema shape we can't handle.
 						// Drain remaining columns so the streaming goroutine can finish and
@@ -818,6 +1382,38 @@ func main() {
 						return struct{}{}, backoff.Permanent(errors.Errorf("unknown mysql column type %q for column %q on table %q", c.ColumnType, c.ColumnName, tableName))
 					}
 
+					if rule, ok := masks.rule(tableName, c.ColumnName); ok {
+						mc, err := newMaskedColumn(rule, maskColumn{i, c.ColumnName, c.DataType, c.MaxLength, c.IsNullable == "YES", slices.ContainsFunc(uniqueColumns, func(u string) bool {
+							return strings.EqualFold(u, c.ColumnName)
+						})})
+						if err != nil {
+							for range columns {
+							}
+							<-columnsErrCh
+							return struct{}{}, backoff.Permanent(errors.Wrapf(err, "mask table %q", tableName))
+						}
+						masked = append(masked, mc)
+						if c.ColumnKey == "PRI" {
+							pkMasked = true
+						}
+					}
+
+					if c.ColumnKey == "PRI" {
+						pkColumns++
+						switch c.DataType {
+						case "tinyint", "smallint", "mediumint", "int", "bigint":
+							pkField, pkName, pkUnsigned = i, c.ColumnName, unsigned
+						}
+						pkNames = append(pkNames, c.ColumnName)
+					} else {
+						updateNames = append(updateNames, c.ColumnName)
+					}
+					columnNames = append(columnNames, c.ColumnName)
+					rowColumns = append(rowColumns, rowColumn{c.ColumnName, c.DataType, c.ColumnType, c.IsNullable == "YES"})
+					if *incremental != "" && strings.EqualFold(c.ColumnName, *incremental) {
+						watermarkColumn = c.ColumnName
+					}
+
 					rowStruct.AddField(f, v, tag)
 					i++
 				}
@@ -831,55 +1427,322 @@ func main() {
 				structType := reflect.Indirect(reflect.ValueOf(rowStruct.Build().New())).Type()
 				columnsQuoted := columnsQuotedBld.String()
 
-				// errgroup scopes the row-stream, fan-out, and per-dest insert
-				// goroutines for this attempt. First error cancels ctx so everyone
-				// unwinds; g.Wait() returns the first error.
-				g, ctx := errgroup.WithContext(context.Background())
-
-				var count int64
-				if !*skipData && !*skipCount {
-					countQ := "select count(*)`Count`from`" + tableName + "`"
-					if *whereClause != "" {
-						countQ += " where " + *whereClause + " "
+				var masker *rowMasker
+				if len(masked) != 0 {
+					masker = &rowMasker{masked}
+					// An all-NULL row still runs every fixed value's conversion,
+					// so a bad one fails here instead of on the first row.
+					if _, err := masker.mask(reflect.New(structType).Elem()); err != nil {
+						return struct{}{}, backoff.Permanent(errors.Wrapf(err, "mask table %q", tableName))
 					}
-					if err := srcTable.SelectContext(ctx, &count, countQ, 0); err != nil {
-						return struct{}{}, errors.Wrapf(err, "count rows for %q", tableName)
+				}
+
+				// Conditions every read of the table's rows shares: -w, plus
+				// the watermark window on an incremental run.
+				var filter []string
+				if tableWhere != "" {
+					filter = append(filter, "("+tableWhere+")")
+				}
+				filterParams := mysql.Params{}
+				filterWhere := func() string {
+					if len(filter) == 0 {
+						return ""
 					}
-					state.SetTotal(count)
+					return " where " + strings.Join(filter, " and ") + " "
 				}
 
-				// Build the finalization closure during the attempt but do NOT push it
-				// to delayedFuncs until the attempt actually succeeds — otherwise a
-				// failed+retried table would have two entries.
-				var onSuccess func()
+				var wmPath string
+				if *incremental != "" && !*skipData {
+					switch {
+					case watermarkColumn == "":
+						if attempt == 1 {
+							slog.Warn("table has no -incremental column, it will be copied in full",
+								"tableName", tableName,
+								"column", *incremental)
+						}
+					case len(pkNames) == 0:
+						if attempt == 1 {
+							slog.Warn("table has no primary key to upsert on, it will be copied in full",
+								"tableName", tableName)
+						}
+					case spec.Limit > 0:
+						if attempt == 1 {
+							slog.Warn("table has a limit, which would skip rows past the watermark, it will be copied in full",
+								"tableName", tableName)
+						}
+					default:
+						wmPath = watermarkPath(sourceKey, tableName, watermarkColumn)
+					}
+				}
 
-				if !*insertIgnoreInto {
-					var tableInfo struct {
-						CreateMySQL string `mysql:"Create Table"`
+				// An incremental run upserts straight into the real table; the
+				// first run for a table, or one whose destinations changed,
+				// rebuilds it as usual and records where it got to.
+				var incrementalRun bool
+				var recordWatermark func()
+				if wmPath != "" {
+					wm, err := loadWatermarks(wmPath)
+					if err != nil {
+						return struct{}{}, backoff.Permanent(err)
 					}
+					since, ok := wm.since(destKeys, tableWhere)
+					if ok {
+						for _, dst := range tableDsts {
+							exists, err := dst.Exists("show tables like'"+destTable+"'", 0)
+							if err != nil {
+								return struct{}{}, errors.Wrapf(err, "check table %q", destTable)
+							}
+							if !exists {
+								ok = false
+								break
+							}
+						}
+					}
+
+					// Captured before any rows are read, so rows written during
+					// the copy are left for the next run rather than skipped.
+					var upper struct {
+						Max *string `mysql:"Max"`
+					}
+					if err := srcTable.Select(&upper, "select cast(max(`"+watermarkColumn+"`)as char)`Max`from`"+tableName+"`"+filterWhere(), 0); err != nil {
+						return struct{}{}, errors.Wrapf(err, "select watermark for %q", tableName)
+					}
+
+					if ok {
+						// Inclusive, so rows that shared the last run's highest
+						// value but landed after it read are still copied.
+						incrementalRun = true
+						filter = append(filter, "`"+watermarkColumn+"`>=@@WatermarkSince")
+						filterParams["WatermarkSince"] = since
+						if upper.Max != nil {
+							filter = append(filter, "`"+watermarkColumn+"`<=@@WatermarkUpper")
+							filterParams["WatermarkUpper"] = *upper.Max
+						}
+						if attempt == 1 {
+							slog.Info("upserting rows since watermark",
+								"tableName", tableName,
+								"column", watermarkColumn,
+								"since", since)
+						}
+					}
+
+					recordWatermark = func() {
+						if upper.Max == nil || *dryRun {
+							return
+						}
+						if wm == nil || wm.Where != tableWhere {
+							wm = &watermarks{
+								Source: sourceKey,
+								Table:  tableName,
+								Column: watermarkColumn,
+								Where:  tableWhere,
+							}
+						}
+						wm.set(destKeys, *upper.Max)
+						if err := wm.save(wmPath); err != nil {
+							slog.Warn("failed to save watermark", "error", err, "tableName", tableName)
+						}
+					}
+				}
+
+				// Tables are read in one unbounded range unless -chunks splits
+				// them or a checkpoint resumes them in the ranges it recorded.
+				ranges := []rangeResume{{}}
+				var trackers []*keyTracker
+				var resumed bool
+				// A table read in its own order, or only partly, can't be
+				// split or resumed by key.
+				usableKey := pkColumns == 1 && pkField >= 0 && !spec.ordered()
+				if spec.ordered() && attempt == 1 {
+					if ckptPath != "" {
+						slog.Warn("table has an order_by or limit, an interrupted import will start over",
+							"tableName", tableName)
+					}
+					if chunking {
+						slog.Warn("table has an order_by or limit, it will be read in a single stream",
+							"tableName", tableName)
+					}
+				} else if !usableKey && attempt == 1 {
+					if ckptPath != "" {
+						slog.Warn("table has no single-column integer primary key, an interrupted import will start over",
+							"tableName", tableName)
+					}
+					if chunking {
+						slog.Warn("table has no single-column integer primary key, it will be read in a single stream",
+							"tableName", tableName)
+					}
+				}
+				resumable := ckptPath != "" && usableKey && !incrementalRun && !pkMasked
+				if ckptPath != "" && usableKey && pkMasked && attempt == 1 {
+					slog.Warn("table's primary key is masked, an interrupted import will start over",
+						"tableName", tableName)
+				}
+
+				if resumable {
+					if attempt == 1 {
+						ckpt = nil
+						if *resume {
+							loaded, err := loadCheckpoint(ckptPath)
+							if err != nil {
+								slog.Warn("ignoring unreadable checkpoint", "error", err, "tableName", tableName)
+							}
+							ckpt = loaded
+						} else if err := removeCheckpoint(ckptPath); err != nil {
+							return struct{}{}, backoff.Permanent(err)
+						}
+					}
+
+					var ok bool
+					var resumeRanges []rangeResume
+					if resumeRanges, ok = ckpt.resumePoint(destKeys, pkName, tableWhere, pkUnsigned); ok {
+						// The temp table is the only thing worth resuming
+						// into; if any destination lost it, start over.
+						for _, dst := range tableDsts {
+							exists, err := dst.Exists("show tables like'"+tempTableName+"'", 0)
+							if err != nil {
+								return struct{}{}, errors.Wrapf(err, "check temp table %q", tempTableName)
+							}
+							if !exists {
+								ok = false
+								break
+							}
+						}
+					}
+					if ok {
+						// Checkpoints are flushed on an interval and the
+						// slowest destination sets the resume key, so trim
+						// anything committed past it before appending.
+						var rows int64
+						for _, r := range resumeRanges {
+							q := "delete from`" + tempTableName + "`"
+							if conds := r.remaining().conds(pkName); len(conds) != 0 {
+								q += "where " + strings.Join(conds, " and ")
+							}
+							for _, dst := range tableDsts {
+								if err := dst.Exec(q); err != nil {
+									return struct{}{}, errors.Wrapf(err, "trim temp table %q to checkpoint", tempTableName)
+								}
+							}
+							rows += r.rows
+						}
+						ranges, resumed = resumeRanges, true
+						state.Add(rows)
+						slog.Info("resuming table from checkpoint",
+							"tableName", tableName,
+							"column", pkName,
+							"ranges", len(ranges),
+							"rows", rows)
+					}
+				}
+
+				if !resumed && chunking && usableKey && !*skipData && !*dryRun {
+					var bounds struct {
+						Min *string `mysql:"Min"`
+						Max *string `mysql:"Max"`
+					}
+					q := "select min(`" + pkName + "`)`Min`,max(`" + pkName + "`)`Max`from`" + tableName + "`" + filterWhere()
+					if err := srcTable.Select(&bounds, q, 0, filterParams); err != nil {
+						return struct{}{}, errors.Wrapf(err, "select key bounds for %q", tableName)
+					}
+					lo, hi, ok, err := parseKeyBounds(bounds.Min, bounds.Max, pkUnsigned)
+					if err != nil {
+						return struct{}{}, backoff.Permanent(err)
+					}
+					if ok {
+						ranges = ranges[:0]
+						for _, r := range splitKeyRange(lo, hi, *chunks) {
+							ranges = append(ranges, rangeResume{keyRange: r})
+						}
+					}
+				}
+
+				if resumable {
+					ckpt = &checkpoint{
+						Source:    sourceKey,
+						Table:     tableName,
+						TempTable: tempTableName,
+						Column:    pkName,
+						Where:     tableWhere,
+						Ranges:    make([]rangeCheckpoint, len(ranges)),
+					}
+					trackers = make([]*keyTracker, len(ranges))
+					for ri, r := range ranges {
+						ckpt.Ranges[ri].keyRange = r.keyRange
+						trackers[ri] = newKeyTracker(len(tableDsts), pkUnsigned, r.last, r.rows)
+					}
+				}
+
+				// errgroup scopes the row-stream, fan-out, and per-dest insert
+				// goroutines for this attempt. First error cancels ctx so everyone
+				// unwinds; g.Wait() returns the first error.
+				g, ctx := errgroup.WithContext(ctx)
+
+				var count int64
+				if !*skipData && !*skipCount {
+					countQ := "select count(*)`Count`from`" + tableName + "`" + filterWhere()
+					if err := srcTable.SelectContext(ctx, &count, countQ, 0, filterParams); err != nil {
+						return struct{}{}, errors.Wrapf(err, "count rows for %q", tableName)
+					}
+					if spec.Limit > 0 {
+						count = min(count, spec.Limit)
+					}
+					state.SetTotal(count)
+				}
+
+				// Build the finalization closure during the attempt but do NOT push it
+				// to delayedFuncs until the attempt actually succeeds — otherwise a
+				// failed+retried table would have two entries.
+				var onSuccess func()
+
+				if directWrite != "" {
+					// It's the destination's keys that decide whether a retried
+					// write replaces rows or appends them, and it takes every
+					// database destination having one for a retry to be safe.
+					// File, clipboard and stdout writers start the table over.
+					retrySafe = true
+					for j, dst := range tableDsts {
+						if d := dsts[j]; d.isPath || d.isClipboard || d.stream != nil {
+							continue
+						}
+						hasUnique, err := dst.Exists("select 1 "+
+							"from`INFORMATION_SCHEMA`.`STATISTICS`"+
+							"where`TABLE_SCHEMA`=database()"+
+							"and`TABLE_NAME`='"+destTable+"'"+
+							"and`NON_UNIQUE`=0", 0)
+						if err != nil {
+							return struct{}{}, errors.Wrapf(err, "check unique keys for %q", destTable)
+						}
+						if !hasUnique {
+							retrySafe = false
+							if !*insertIgnoreInto && attempt == 1 {
+								slog.Warn("table has no unique key, "+directWrite+" will only append rows",
+									"tableName", destTable, "destination", dsts[j].name)
+							}
+						}
+					}
+				}
+
+				var tableInfo struct {
+					CreateMySQL string `mysql:"Create Table"`
+				}
+				if directWrite == "" && !incrementalRun || len(rowDsts) != 0 {
 					if err := srcTable.SelectContext(ctx, &tableInfo, "show create table`"+tableName+"`", 0); err != nil {
 						return struct{}{}, errors.Wrapf(err, "show create table %q", tableName)
 					}
+				}
+				rowTable := rowTable{name: destTable, columns: rowColumns, create: tableInfo.CreateMySQL}
 
+				if directWrite == "" && !incrementalRun {
 					// FK constraints have globally unique names, so creating the temp table
 					// with them inline would collide with the already-existing real table.
 					// Strip them out here and re-apply after the rename.
 					var constraints string
-
-					constraintsStart := strings.Index(tableInfo.CreateMySQL, ",\n  CONSTRAINT ")
-					if constraintsStart != -1 {
-						// MySQL always gives constraints as a contiguous block, so locate
-						// the last one and treat everything between as the constraint block.
-						constraintsEnd := strings.LastIndex(tableInfo.CreateMySQL, ",\n  CONSTRAINT ")
-						constraintsEnd = constraintsEnd + strings.IndexByte(tableInfo.CreateMySQL[constraintsEnd+2:], '\n') + 2
-						constraints = tableInfo.CreateMySQL[constraintsStart:constraintsEnd]
-						tableInfo.CreateMySQL = tableInfo.CreateMySQL[:constraintsStart] + tableInfo.CreateMySQL[constraintsEnd:]
-					}
+					tableInfo.CreateMySQL, constraints = splitConstraints(tableInfo.CreateMySQL)
 
 					createSuffix := strings.TrimPrefix(tableInfo.CreateMySQL, "CREATE TABLE `"+tableName+"`")
 
 					for _, dst := range tableDsts {
-						if !*dryRun {
+						if !*dryRun && !resumed {
 							if err := dst.Exec("drop table if exists`" + tempTableName + "`"); err != nil {
 								return struct{}{}, errors.Wrapf(err, "drop temp table %q", tempTableName)
 							}
@@ -895,20 +1758,42 @@ func main() {
 						delayedFuncs <- func() error {
 							finalizeStart := time.Now()
 							if !*dryRun {
-								for _, dst := range tableDsts {
-									if err := dst.Exec("drop table if exists`" + tableName + "`"); err != nil {
-										return errors.Wrapf(err, "drop table %q", tempTableName)
+								for i, dst := range tableDsts {
+									// Only a database destination has a table to keep.
+									keep := *keepPreviousFlag && dsts[i].dsn != ""
+									prev := previousTable(*tempTablePrefix, destTable)
+									kept := false
+									if keep {
+										var err error
+										if kept, err = keepPrevious(dst, destTable, prev); err != nil {
+											return err
+										}
+									} else if err := dst.Exec("drop table if exists`" + destTable + "`"); err != nil {
+										return errors.Wrapf(err, "drop table %q", destTable)
 									}
 
 									// Non-atomic rename on purpose — atomic would also rename
 									// other tables' FK references to point at the old name.
 									// Small downtime on live dest is the accepted tradeoff.
-									if err := dst.Exec("alter table`" + tempTableName + "`rename`" + tableName + "`"); err != nil {
-										return errors.Wrapf(err, "rename table %q to %q", tempTableName, tableName)
+									if err := dst.Exec("alter table`" + tempTableName + "`rename`" + destTable + "`"); err != nil {
+										return errors.Wrapf(err, "rename table %q to %q", tempTableName, destTable)
+									}
+
+									// The keys other tables had on the replaced table went
+									// with it.
+									if kept {
+										if err := repointForeignKeys(dst, prev, destTable); err != nil {
+											slog.Warn("failed to move foreign keys to table", "error", err, "tableName", destTable)
+										}
+									}
+									if keep {
+										if err := recordPrevious(dsts[i].key, destTable, kept); err != nil {
+											slog.Warn("failed to record previous table", "error", err, "tableName", destTable)
+										}
 									}
 
 									if len(constraints) != 0 {
-										if err := dst.Exec("alter table`" + tableName + "`" + strings.ReplaceAll(strings.TrimLeft(constraints, ","), "\n", "\nadd")); err != nil {
+										if err := dst.Exec(addConstraints(destTable, constraints)); err != nil {
 											slog.Warn("failed to add constraints to table", "error", err, "tableName", tableName)
 										}
 									}
@@ -928,6 +1813,15 @@ func main() {
 								}
 							}()
 							for r := range triggers {
+								// Their statements name the source table.
+								if destTable != tableName {
+									slog.Warn("skipping trigger on renamed table",
+										"trigger", r.Trigger,
+										"tableName", tableName,
+										"destTable", destTable)
+									continue
+								}
+
 								var trigger struct {
 									CreateMySQL string `mysql:"SQL Original Statement"`
 								}
@@ -939,8 +1833,8 @@ func main() {
 								trigger.CreateMySQL = definerRegexp.ReplaceAllString(trigger.CreateMySQL, "")
 
 								if !*dryRun {
-									for _, dst := range tableDsts {
-										if err := dst.Exec(trigger.CreateMySQL); err != nil {
+									for i, dst := range tableDsts {
+										if err := execDst(dsts[i], dst, tableName, trigger.CreateMySQL); err != nil {
 											return errors.Wrapf(err, "execute trigger creation SQL for %q on table %q", r.Trigger, tableName)
 										}
 									}
@@ -949,6 +1843,14 @@ func main() {
 							if triggerSelectErr != nil {
 								return errors.Wrapf(triggerSelectErr, "select triggers for table %q", tableName)
 							}
+							if ckptPath != "" {
+								if err := removeCheckpoint(ckptPath); err != nil {
+									slog.Warn("failed to remove checkpoint", "error", err, "tableName", tableName)
+								}
+							}
+							if recordWatermark != nil {
+								recordWatermark()
+							}
 							state.Finalize()
 							slog.Info("finalized table",
 								"tableName", tableName,
@@ -966,50 +1868,193 @@ func main() {
 					}
 				}
 
+				// Each attempt writes row destinations afresh; what a failed one
+				// wrote is discarded, and nothing shows until the table succeeds.
+				var tableWriters []tableWriter
+				defer func() {
+					for _, w := range tableWriters {
+						if err := w.abort(); err != nil {
+							slog.Warn("failed to discard partial table output", "error", err, "tableName", tableName)
+						}
+					}
+				}()
+
 				if !*skipData && !*dryRun {
+					for _, d := range rowDsts {
+						w, err := d.dest.openTable(rowTable)
+						if err != nil {
+							return struct{}{}, errors.Wrapf(err, "open %s for %q", d.name, tableName)
+						}
+						tableWriters = append(tableWriters, w)
+					}
+
 					insertPrefix := "insert into`" + tempTableName + "`"
-					if *insertIgnoreInto {
-						insertPrefix = "insert ignore into`" + tableName + "`"
+					switch {
+					case *insertIgnoreInto:
+						insertPrefix = "insert ignore into`" + destTable + "`"
+					case *replaceInto:
+						insertPrefix = "replace into`" + destTable + "`"
+					}
+					insertRows := func(inserter *mysql.Inserter, rows any) error {
+						switch {
+						case incrementalRun:
+							// A key-only table has nothing to overwrite, so let
+							// its duplicates update the key to itself.
+							update := updateNames
+							if len(update) == 0 {
+								update = pkNames
+							}
+							return inserter.UpsertContext(ctx, "insert into`"+destTable+"`", pkNames, update, "", rows)
+						case *upsertInto:
+							return inserter.UpsertContext(ctx, "insert into`"+destTable+"`", pkNames, columnNames, "", rows)
+						}
+						return inserter.InsertContext(ctx, insertPrefix, rows)
 					}
 
-					// Spawned only after every synchronous setup step succeeds — a
-					// pre-insert failure would otherwise return without g.Wait(),
-					// leaking this producer blocked on a buffer with no consumer
-					// and holding a source connection across the retry.
-					srcChRef := reflect.MakeChan(reflect.ChanOf(reflect.BothDir, structType), *rowBufferSize)
+					// Each key range gets its own select stream and inserters, all
+					// writing into the same temp table. Spawned only after every
+					// synchronous setup step succeeds — a pre-insert failure would
+					// otherwise return without g.Wait(), leaking these producers
+					// blocked on buffers with no consumer and holding source
+					// connections across the retry.
+					for ri, r := range ranges {
+						var tracker *keyTracker
+						if trackers != nil {
+							tracker = trackers[ri]
+						}
 
-					g.Go(func() error {
-						defer srcChRef.Close()
+						srcChRef := reflect.MakeChan(reflect.ChanOf(reflect.BothDir, structType), *rowBufferSize)
 
-						q := "select /*+ MAX_EXECUTION_TIME(2147483647) */ " + columnsQuoted + "from`" + tableName + "`"
-						if *whereClause != "" {
-							q += " where " + *whereClause + " "
-						}
-						if err := srcTable.SelectContext(ctx, srcChRef.Interface(), q, 0); err != nil {
-							return errors.Wrapf(err, "select rows for %q", tableName)
+						// With a checkpoint or masks the select streams into its own
+						// channel and a relay logs each row's key and masks it on the
+						// way through, before any inserter can see it.
+						relay := tracker != nil || masker != nil
+						selectChRef := srcChRef
+						if relay {
+							selectChRef = reflect.MakeChan(reflect.ChanOf(reflect.BothDir, structType), *rowBufferSize)
 						}
-						return nil
-					})
 
-					if len(dsts) == 1 {
-						// Single destination: consume source channel directly.
 						g.Go(func() error {
-							inserter := tableDsts[0].I()
-							if state != nil {
-								inserter = inserter.SetAfterRowExec(func(_ time.Time) {
-									state.Increment()
-								})
+							defer selectChRef.Close()
+
+							q := "select /*+ MAX_EXECUTION_TIME(2147483647) */ " + columnsQuoted + "from`" + tableName + "`"
+							conds := slices.Concat(filter, r.remaining().conds(pkName))
+							if len(conds) != 0 {
+								q += " where " + strings.Join(conds, " and ") + " "
+							}
+							if tracker != nil {
+								// Keys must arrive ascending for "everything up to
+								// the last committed key" to mean anything.
+								q += " order by`" + pkName + "`"
+							} else if spec.OrderBy != "" {
+								q += " order by " + spec.OrderBy
+							}
+							if spec.Limit > 0 {
+								q += " limit " + strconv.FormatInt(spec.Limit, 10)
 							}
-							if err := inserter.InsertContext(ctx, insertPrefix, srcChRef.Interface()); err != nil {
-								return errors.Wrapf(err, "insert into %q", tableName)
+							if err := srcTable.SelectContext(ctx, selectChRef.Interface(), q, 0, filterParams); err != nil {
+								return errors.Wrapf(err, "select rows for %q", tableName)
 							}
 							return nil
 						})
-					} else {
+
+						if relay {
+							g.Go(func() error {
+								defer srcChRef.Close()
+								doneRef := reflect.ValueOf(ctx.Done())
+								recvCases := []reflect.SelectCase{
+									{Dir: reflect.SelectRecv, Chan: selectChRef},
+									{Dir: reflect.SelectRecv, Chan: doneRef},
+								}
+								sendCases := []reflect.SelectCase{
+									{Dir: reflect.SelectSend, Chan: srcChRef},
+									{Dir: reflect.SelectRecv, Chan: doneRef},
+								}
+								for {
+									chosen, val, ok := reflect.Select(recvCases)
+									if chosen == 1 {
+										return ctx.Err()
+									}
+									if !ok {
+										return nil
+									}
+									if tracker != nil {
+										key, _ := rowKey(val, pkField)
+										tracker.push(key)
+									}
+									if masker != nil {
+										var err error
+										if val, err = masker.mask(val); err != nil {
+											return errors.Wrapf(err, "mask row for %q", tableName)
+										}
+									}
+									sendCases[0].Send = val
+									if chosen, _, _ := reflect.Select(sendCases); chosen == 1 {
+										return ctx.Err()
+									}
+								}
+							})
+						}
+
+						// Progress comes from the first destination only, summed
+						// across ranges, and only the TUI shows it. The tracker
+						// counts what's committed as each insert returns instead.
+						afterRow := func(j int) func(time.Time) {
+							if j != 0 || u == nil {
+								return nil
+							}
+							return func(_ time.Time) {
+								state.Increment()
+							}
+						}
+
+						// Database destinations come first, then row destinations,
+						// which write each row themselves.
+						consumers := len(dsts) + len(tableWriters)
+						consume := func(j int, rows reflect.Value) error {
+							if j >= len(dsts) {
+								k := j - len(dsts)
+								if err := writeRows(ctx, tableWriters[k], rows, afterRow(j)); err != nil {
+									return errors.Wrapf(err, "write %q to %s", tableName, rowDsts[k].name)
+								}
+								return nil
+							}
+							insert := func(rows reflect.Value) error {
+								inserter := tableDsts[j].I()
+								if fn := afterRow(j); fn != nil {
+									inserter = inserter.SetAfterRowExec(fn)
+								}
+								return insertRows(inserter, rows.Interface())
+							}
+							var err error
+							if tracker != nil {
+								err = insertSegments(ctx, rows, checkpointSegmentRows, insert, func(n int64) {
+									tracker.commit(j, n)
+								})
+							} else {
+								err = insert(rows)
+							}
+							if err != nil {
+								if consumers == 1 {
+									return errors.Wrapf(err, "insert into %q", tableName)
+								}
+								return errors.Wrapf(err, "insert into %q (dest %d)", tableName, j)
+							}
+							return nil
+						}
+
+						if consumers == 1 {
+							// Single destination: consume source channel directly.
+							g.Go(func() error {
+								return consume(0, srcChRef)
+							})
+							continue
+						}
+
 						// Multiple destinations: fan out each row from the single source
 						// channel to per-dest channels so the source is read only once.
-						dstChRefs := make([]reflect.Value, len(dsts))
-						for j := range dsts {
+						dstChRefs := make([]reflect.Value, consumers)
+						for j := range consumers {
 							dstChRefs[j] = reflect.MakeChan(reflect.ChanOf(reflect.BothDir, structType), *rowBufferSize)
 						}
 
@@ -1054,26 +2099,68 @@ func main() {
 							}
 						})
 
-						for j := range dsts {
+						for j := range consumers {
 							g.Go(func() error {
-								inserter := tableDsts[j].I()
-								// Track progress from the first destination only.
-								if j == 0 && state != nil {
-									inserter = inserter.SetAfterRowExec(func(_ time.Time) {
-										state.Increment()
-									})
-								}
-								if err := inserter.InsertContext(ctx, insertPrefix, dstChRefs[j].Interface()); err != nil {
-									return errors.Wrapf(err, "insert into %q (dest %d)", tableName, j)
-								}
-								return nil
+								return consume(j, dstChRefs[j])
 							})
 						}
 					}
 				}
 
-				if err := g.Wait(); err != nil {
-					return struct{}{}, err
+				var stopFlush func()
+				if trackers != nil {
+					saveCheckpoint := func() {
+						for ri, tracker := range trackers {
+							tracker.snapshot(&ckpt.Ranges[ri], destKeys)
+						}
+						if err := ckpt.save(ckptPath); err != nil {
+							slog.Warn("failed to save checkpoint", "error", err, "tableName", tableName)
+						}
+					}
+					stop := make(chan struct{})
+					flushed := make(chan struct{})
+					go func() {
+						defer close(flushed)
+						ticker := time.NewTicker(checkpointInterval)
+						defer ticker.Stop()
+						for {
+							select {
+							case <-stop:
+								return
+							case <-ticker.C:
+								saveCheckpoint()
+							}
+						}
+					}()
+					stopFlush = func() {
+						close(stop)
+						<-flushed
+						saveCheckpoint()
+					}
+				}
+
+				waitErr := g.Wait()
+				if stopFlush != nil {
+					// Saved on failure too: that's what the retry and a later
+					// -resume continue from.
+					stopFlush()
+				}
+				if waitErr != nil {
+					return struct{}{}, waitErr
+				}
+
+				for i, w := range tableWriters {
+					if err := w.commit(); err != nil {
+						return struct{}{}, errors.Wrapf(err, "write %q to %s", tableName, rowDsts[i].name)
+					}
+				}
+				tableWriters = nil
+
+				if incrementalRun {
+					// Nothing is swapped in later, so the watermark can move as
+					// soon as the upserts land.
+					upserted = true
+					recordWatermark()
 				}
 
 				// All streams and inserts succeeded — queue the finalization closure.
@@ -1084,6 +2171,93 @@ func main() {
 				return struct{}{}, nil
 			}
 
+			if bk != nil {
+				// Backup replay: the table's own statements already create the
+				// temp table and carry the swap, so run the load half now and
+				// queue the rest exactly like a live table's finalization.
+				runOnce = func(attempt int) (struct{}, error) {
+					if attempt > 1 {
+						slog.Warn("retrying table import",
+							"tableName", tableName,
+							"attempt", attempt)
+						state.Reset()
+					}
+					state.Begin(attempt)
+
+					plan, err := bk.planTable(tableName)
+					if err != nil {
+						return struct{}{}, backoff.Permanent(err)
+					}
+
+					if count, ok := plan.countRows(); ok && !*skipData && !*skipCount {
+						state.SetTotal(count)
+					}
+
+					if attempt == 1 {
+						slog.Info("starting table", "tableName", tableName, "statements", len(plan.load)+len(plan.finalize))
+					}
+
+					for _, st := range plan.load {
+						stmt, err := st.read()
+						if err != nil {
+							return struct{}{}, backoff.Permanent(err)
+						}
+						insert := isInsertStatement(stmt)
+						if insert && *skipData {
+							continue
+						}
+						if !*dryRun {
+							g := new(errgroup.Group)
+							for _, dst := range tableDsts {
+								g.Go(func() error {
+									return dst.ExecContext(ctx, stmt)
+								})
+							}
+							if err := g.Wait(); err != nil {
+								err = errors.Wrapf(err, "replay %q", st.name)
+								if !plan.retryable {
+									err = backoff.Permanent(err)
+								}
+								return struct{}{}, err
+							}
+						}
+						if insert {
+							state.Add(countInsertRows(stmt))
+						}
+					}
+
+					delayedFuncs <- func() error {
+						finalizeStart := time.Now()
+						for _, st := range plan.finalize {
+							stmt, err := st.read()
+							if err != nil {
+								return err
+							}
+							if *dryRun {
+								continue
+							}
+							for i, dst := range tableDsts {
+								if err := execDst(dsts[i], dst, tableName, stmt); err != nil {
+									// Same leniency as a live import's constraint pass.
+									if addConstraintRegexp.MatchString(stmt) {
+										slog.Warn("failed to add constraints to table", "error", err, "tableName", tableName)
+										continue
+									}
+									return errors.Wrapf(err, "replay %q", st.name)
+								}
+							}
+						}
+						state.Finalize()
+						slog.Info("finalized table",
+							"tableName", tableName,
+							"duration", time.Since(finalizeStart).Round(time.Millisecond))
+						return nil
+					}
+
+					return struct{}{}, nil
+				}
+			}
+
 			bop := backoff.NewExponentialBackOff()
 			bop.InitialInterval = 1 * time.Second
 			bop.MaxInterval = 30 * time.Second
@@ -1095,14 +2269,18 @@ func main() {
 				if err == nil {
 					return v, nil
 				}
+				// Stopped, not failed, so there's nothing to retry.
+				if ctx.Err() != nil {
+					return v, backoff.Permanent(err)
+				}
 				var perm *backoff.PermanentError
 				if stderrors.As(err, &perm) {
 					return v, err
 				}
-				// -insert-ignore writes directly to the real table (no temp swap),
+				// The direct-write modes write to the real table (no temp swap),
 				// so retry after a partial first attempt would double-insert rows
 				// on tables without a unique key.
-				if *insertIgnoreInto {
+				if directWrite != "" && !retrySafe {
 					return v, backoff.Permanent(err)
 				}
 				if !isTransientError(err) {
@@ -1120,7 +2298,7 @@ func main() {
 				return v, err
 			}
 
-			if _, err := backoff.Retry(context.Background(), wrappedOp,
+			if _, err := backoff.Retry(ctx, wrappedOp,
 				backoff.WithBackOff(bop),
 				backoff.WithMaxTries(5),
 				// Disable backoff's default 15-minute total-time budget — a
@@ -1133,6 +2311,11 @@ func main() {
 				if stderrors.As(err, &perm) {
 					inner = perm.Err
 				}
+				if ctx.Err() != nil {
+					slog.Warn("table import stopped", "tableName", tableName, "cause", context.Cause(ctx))
+					state.Fail("interrupted")
+					return
+				}
 				slog.Error("table import failed after retries",
 					"error", inner,
 					"chain", formatErrorChain(inner),
@@ -1140,11 +2323,13 @@ func main() {
 					"tableName", tableName,
 					"attempts", attempts)
 				state.Fail(rootErrorMsg(inner))
+				// Stops every other table too, then the run cleans up.
+				err := fmt.Errorf("table %q import failed after %d attempts: %w", tableName, attempts, inner)
+				cancel(err)
 				if u != nil {
-					u.Fatal(fmt.Errorf("table %q import failed after %d attempts: %w", tableName, attempts, inner))
-					return
+					u.Fatal(err)
 				}
-				os.Exit(1)
+				return
 			}
 
 			elapsed := time.Since(tableStart).Round(time.Second)
@@ -1160,8 +2345,9 @@ func main() {
 				"duration", elapsed)
 
 			state.Complete()
-			// -insert-ignore has no delayed swap, so finalize TUI state now.
-			if *insertIgnoreInto {
+			// Direct writes and incremental upserts have no delayed swap, so
+			// finalize TUI state now.
+			if directWrite != "" || upserted {
 				state.Finalize()
 			}
 		}()
@@ -1176,51 +2362,98 @@ func main() {
 	if u != nil {
 		// If the TUI exits before workers finish, either the user interrupted
 		// (Ctrl+C / q -> errInterrupted) or a worker hit a permanent failure
-		// and called u.Fatal. We can't gracefully cancel the in-flight workers
-		// (no shared ctx), so force-exit either way; differentiate the message
-		// and exit code based on the recorded firstErr.
+		// and called u.Fatal; either way ctx is cancelled, so log what's left
+		// to the terminal while the workers unwind.
 		select {
 		case <-workersDone:
 		case <-u.Done():
 			log.SetOutput(os.Stderr)
-			fatalErr := u.FirstError()
-			path := u.LogPath()
-			if stderrors.Is(fatalErr, errInterrupted) {
-				fmt.Fprintln(os.Stderr, "\nswoof: interrupted")
-				if path != "" {
-					fmt.Fprintf(os.Stderr, "log: %s\n", path)
-				}
-				os.Exit(130)
+			fmt.Fprintln(os.Stderr, "\nswoof: stopping, waiting for tables to unwind...")
+			<-workersDone
+		}
+	} else {
+		<-workersDone
+	}
+
+	finalizing.Store(true)
+
+	// A stopped run drops the temp tables of every table it didn't swap in,
+	// except those checkpointed for -resume, and the file: directories it
+	// didn't finish, then says how far it got.
+	if ctx.Err() != nil {
+		cause := context.Cause(ctx)
+		if u != nil {
+			u.Stop()
+			<-u.Done()
+			log.SetOutput(os.Stderr)
+		}
+
+		var dbs []*mysql.Database
+		for _, d := range dsts {
+			if !d.isPath && !d.isClipboard && d.stream == nil {
+				dbs = append(dbs, d.db)
 			}
-			if fatalErr != nil {
-				fmt.Fprintf(os.Stderr, "\nswoof: %v\n", fatalErr)
+			if d.stream != nil {
+				d.stream.discard()
 			}
-			if path != "" {
-				fmt.Fprintf(os.Stderr, "full log: %s\n", path)
+		}
+		var tempTables, kept []string
+		if directWrite == "" && !*dryRun && len(dbs) != 0 {
+			for _, st := range states {
+				if tableStatus(st.Status.Load()) == statusFinalized {
+					continue
+				}
+				if checkpointing {
+					if _, err := os.Stat(checkpointPath(sourceKey, st.Name)); err == nil {
+						kept = append(kept, st.Name)
+						continue
+					}
+				}
+				tempTables = append(tempTables, *tempTablePrefix+destTables[st.Name])
+			}
+			slog.Info("dropping temp tables", "tables", len(tempTables), "destinations", len(dbs))
+			dropTempTables(dbs, tempTables)
+		}
+		for _, dir := range incompleteDirs {
+			slog.Info("removing incomplete directory", "directory", dir)
+			if err := os.RemoveAll(dir); err != nil {
+				slog.Warn("failed to remove incomplete directory", "error", err, "directory", dir)
 			}
-			os.Exit(1)
 		}
 
-		if fatalErr := u.FirstError(); fatalErr != nil {
-			u.Stop()
-			log.SetOutput(os.Stderr)
-			fmt.Fprintf(os.Stderr, "\nswoof: %v\n", fatalErr)
+		snaps := make([]tableSnapshot, len(states))
+		for i, st := range states {
+			snaps[i] = st.snapshot()
+		}
+		fmt.Fprintln(os.Stderr)
+		printPartialSummary(snaps, kept)
+		code := 1
+		if stderrors.Is(cause, errInterrupted) {
+			fmt.Fprintln(os.Stderr, "\nswoof: interrupted")
+			code = 130
+		} else {
+			fmt.Fprintf(os.Stderr, "\nswoof: %v\n", cause)
+		}
+		if u != nil {
 			if path := u.LogPath(); path != "" {
 				fmt.Fprintf(os.Stderr, "full log: %s\n", path)
 			}
-			os.Exit(1)
 		}
+		os.Exit(code)
+	}
 
+	if u != nil {
 		slog.Info("table imports complete",
 			"tables", tableCount,
 			"duration", time.Since(start).Round(time.Second))
-	} else {
-		<-workersDone
 	}
 
+	var mismatches []verifyMismatch
+	var verified bool
+
 	// Finalize keeps the TUI alive so swap progress shows in the log pane.
 	finalizeErr := func() error {
-		if !*insertIgnoreInto {
+		if directWrite == "" {
 			close(delayedFuncs)
 
 			slog.Info("finalizing table imports...")
@@ -1231,9 +2464,77 @@ func main() {
 				}
 			}
 		}
+		for _, d := range rowDsts {
+			if f, ok := d.dest.(rowDestFinisher); ok {
+				f.finish()
+			}
+		}
+
+		if retention > 0 && !*dryRun {
+			for _, d := range dsts {
+				if d.dsn == "" {
+					continue
+				}
+				if err := purgePrevious(d.db, d.key, *tempTablePrefix, retention); err != nil {
+					slog.Warn("failed to drop expired previous tables", "error", err, "destination", d.name)
+				}
+			}
+		}
+
+		// Every table is complete, so the stdout script gets them, in order,
+		// ahead of the routines.
+		for _, d := range dsts {
+			if d.stream != nil {
+				if err := d.stream.flush(orderedTables); err != nil {
+					return err
+				}
+			}
+		}
+
+		// A backup carries its routines as already-written drop+create pairs,
+		// so replay them in the same funcs, views, procs order.
+		if bk != nil {
+			for _, kind := range []struct {
+				enabled bool
+				dir     string
+			}{{*funcs, "funcs"}, {*views, "views"}, {*procs, "procs"}} {
+				if !kind.enabled {
+					continue
+				}
+				files, err := bk.routineFiles(kind.dir)
+				if err != nil {
+					return err
+				}
+				if files == nil {
+					slog.Warn("source has no "+kind.dir+" to import", "source", sourceFriendly)
+					continue
+				}
+
+				slog.Info("importing " + kind.dir + "...")
+
+				for _, f := range files {
+					stmt, err := readBackupStatement(f)
+					if err != nil {
+						return err
+					}
+					if *dryRun {
+						continue
+					}
+					for _, d := range dsts {
+						dst := d.db
+						if d.isPath {
+							dst = d.db.WriterWithSubdir(kind.dir)
+						}
+						if err := execDst(d, dst, "", stmt); err != nil {
+							return errors.Wrapf(err, "replay %q", f)
+						}
+					}
+				}
+			}
+		}
 
 		// funcs, views, and procs are read from source once and applied to all dests
-		if *funcs {
+		if *funcs && bk == nil {
 			slog.Info("importing functions...")
 
 			funcDsts := make([]*mysql.Database, len(dsts))
@@ -1265,11 +2566,11 @@ func main() {
 				funcInfo.CreateMySQL = definerRegexp.ReplaceAllString(funcInfo.CreateMySQL, "")
 
 				if !*dryRun {
-					for _, dst := range funcDsts {
+					for i, dst := range funcDsts {
 						if err := dst.Exec("drop function if exists`" + f.FuncName + "`"); err != nil {
 							return errors.Wrapf(err, "drop function %q", f.FuncName)
 						}
-						if err := dst.Exec(funcInfo.CreateMySQL); err != nil {
+						if err := execDst(dsts[i], dst, "", funcInfo.CreateMySQL); err != nil {
 							return errors.Wrapf(err, "create function %q", f.FuncName)
 						}
 					}
@@ -1277,7 +2578,7 @@ func main() {
 			}
 		}
 
-		if *views {
+		if *views && bk == nil {
 			slog.Info("importing views...")
 
 			viewDsts := make([]*mysql.Database, len(dsts))
@@ -1321,7 +2622,7 @@ func main() {
 			}
 		}
 
-		if *procs {
+		if *procs && bk == nil {
 			slog.Info("importing stored procedures...")
 
 			procDsts := make([]*mysql.Database, len(dsts))
@@ -1353,11 +2654,11 @@ func main() {
 				procInfo.CreateMySQL = definerRegexp.ReplaceAllString(procInfo.CreateMySQL, "")
 
 				if !*dryRun {
-					for _, dst := range procDsts {
+					for i, dst := range procDsts {
 						if err := dst.Exec("drop procedure if exists`" + p.ProcName + "`"); err != nil {
 							return errors.Wrapf(err, "drop stored procedure %q", p.ProcName)
 						}
-						if err := dst.Exec(procInfo.CreateMySQL); err != nil {
+						if err := execDst(dsts[i], dst, "", procInfo.CreateMySQL); err != nil {
 							return errors.Wrapf(err, "create stored procedure %q", p.ProcName)
 						}
 					}
@@ -1377,6 +2678,60 @@ func main() {
 
 				slog.Info("copied to clipboard", "size", len(d.clipboard.Bytes()))
 			}
+			if d.stream != nil {
+				if err := d.stream.close(); err != nil {
+					return err
+				}
+			}
+		}
+
+		// Runs last so it compares the real, swapped-in tables. Differences
+		// are reported after the summary; only failed queries abort here.
+		if *verify {
+			switch {
+			case bk != nil:
+				slog.Warn("-verify needs a live source, skipping verification")
+			case *dryRun || *skipData:
+				slog.Warn("no rows were copied, skipping verification")
+			default:
+				// Under -consistent the source side is the snapshot that was
+				// copied, so later writes to the source don't show as mismatches.
+				verifySrc := src
+				if snapDB != nil {
+					verifySrc = snapDB
+				}
+				var targets []verifyTarget
+				for _, d := range dsts {
+					if d.isPath || d.isClipboard || d.stream != nil {
+						slog.Info("skipping verification", "destination", d.name)
+						continue
+					}
+					targets = append(targets, verifyTarget{d.name, d.db})
+				}
+				// Compared the way they were copied: with their own filters,
+				// under their destination names, and without the columns that
+				// differ by design. A limited table's source side isn't.
+				var tables []verifySpec
+				for _, t := range orderedTables {
+					spec := specs.lookup(t)
+					if spec.Limit > 0 {
+						slog.Info("skipping verification of table with a limit", "tableName", t)
+						continue
+					}
+					tables = append(tables, verifySpec{t, destTables[t], tableWheres[t], func(column string) bool {
+						_, masked := masks.rule(t, column)
+						return masked || spec.excludes(column)
+					}})
+				}
+				if len(targets) != 0 {
+					slog.Info("verifying tables...")
+					var err error
+					if mismatches, err = verifyTables(ctx, verifySrc, targets, tables, *threads); err != nil {
+						return errors.Wrap(err, "verify tables")
+					}
+					verified = true
+				}
+			}
 		}
 
 		return nil
@@ -1399,20 +2754,61 @@ func main() {
 
 	// Ctrl+C / q during finalize: skip the success banner. Can't abort
 	// finalize itself — partial swap would leave dest in a worse state.
-	if u != nil && stderrors.Is(u.FirstError(), errInterrupted) {
+	if ctx.Err() != nil {
 		log.SetOutput(os.Stderr)
-		fmt.Fprintln(os.Stderr, "\nswoof: interrupted")
-		if path := u.LogPath(); path != "" {
-			fmt.Fprintf(os.Stderr, "log: %s\n", path)
-		}
+		printInterrupted(os.Stderr, u)
 		os.Exit(130)
 	}
 
-	slog.Info("finished importing tables", "count", tableCount, "destinations", len(dsts), "duration", time.Since(start))
+	slog.Info("finished importing tables", "count", tableCount, "destinations", len(dsts)+len(rowDsts), "duration", time.Since(start))
+	if len(mismatches) != 0 {
+		slog.Error("verification failed", "mismatches", len(mismatches))
+	}
 
 	notifyDesktop("swoof", fmt.Sprintf("Swoofed %d tables in %s",
 		tableCount, time.Since(start).Round(time.Second)))
 
+	// -follow runs until Ctrl+C (q in the TUI) or SIGTERM, which is how it
+	// finishes cleanly.
+	var followed *follower
+	if *follow {
+		// The snapshot's transactions would hold back the source's purge
+		// for as long as this runs.
+		snap.Close()
+
+		var followDests []followDest
+		for _, d := range dsts {
+			var fd followDest
+			if fd, err = openFollowDest(d.name, d.dsn); err != nil {
+				break
+			}
+			defer fd.db.Close()
+			followDests = append(followDests, fd)
+		}
+		if err == nil {
+			followed, err = newFollower(sourceDSN, rand.Uint32()|1<<31, snap.pos, followTables, followDests, u)
+		}
+		if err == nil {
+			slog.Info("following binlog", "file", snap.pos.File, "pos", snap.pos.Pos)
+			err = followed.run(ctx)
+		}
+		if err != nil {
+			if u != nil {
+				u.Fatal(err)
+				<-u.Done()
+				log.SetOutput(os.Stderr)
+				fmt.Fprintf(os.Stderr, "\nswoof: %v\n", err)
+				if path := u.LogPath(); path != "" {
+					fmt.Fprintf(os.Stderr, "full log: %s\n", path)
+				}
+			} else {
+				slog.Error("following binlog failed", "error", err)
+			}
+			os.Exit(1)
+		}
+		slog.Info("stopped following binlog", "file", followed.file, "pos", followed.pos, "applied", followed.applied)
+	}
+
 	if u != nil {
 		u.MarkCompleted()
 		<-u.Done()
@@ -1429,9 +2825,19 @@ func main() {
 			fmt.Fprintln(os.Stderr)
 		}
 		printRunSummaryLabels(sourceFriendly, destFriendlyNames, orderedTables)
+		if verified {
+			printVerifySummary(mismatches)
+		}
+		if followed != nil {
+			fmt.Fprintf(os.Stderr, "followed binlog to %s:%d, applied %d changes\n", followed.file, followed.pos, followed.applied)
+		}
 		fmt.Fprintln(os.Stderr)
 		if path := u.LogPath(); path != "" {
 			fmt.Fprintf(os.Stderr, "log: %s\n", path)
 		}
 	}
+
+	if len(mismatches) != 0 {
+		os.Exit(1)
+	}
 }
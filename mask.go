@@ -0,0 +1,463 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	mysql "github.com/StirlingMarketingGroup/cool-mysql"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// maskRule rewrites one column's values as rows stream from the source to
+// every destination, so production data can be copied somewhere less
+// trusted. In the masks file a rule is either just its type or a map:
+//
+//	users:
+//	  Email: email
+//	  Phone: {type: random, seed: s3cret}
+//	  Notes: {type: truncate, length: 20}
+type maskRule struct {
+	Type string `yaml:"type"`
+
+	// The replacement for "fixed", as it would be written in SQL.
+	Value string `yaml:"value"`
+
+	// Keys "random" so its output can't be reversed by hashing guesses.
+	Seed string `yaml:"seed"`
+
+	// The most characters (or bytes, for binary columns) "truncate" keeps.
+	Length int `yaml:"length"`
+}
+
+const (
+	maskFixed    = "fixed"
+	maskNull     = "null"
+	maskHash     = "hash"
+	maskEmail    = "email"
+	maskRandom   = "random"
+	maskTruncate = "truncate"
+)
+
+func (r *maskRule) UnmarshalYAML(unmarshal func(any) error) error {
+	var short string
+	if err := unmarshal(&short); err == nil {
+		*r = maskRule{Type: short}
+		return nil
+	}
+	type plain maskRule
+	return unmarshal((*plain)(r))
+}
+
+// maskRules maps table names to their columns' rules.
+type maskRules map[string]map[string]maskRule
+
+// getMasks reads the masks file. Like the aliases file, a missing one just
+// means there's nothing to mask.
+func getMasks(file string) (maskRules, error) {
+	y, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "read masks file %q", file)
+	}
+	// Pointers so a bare `Column: null`, which YAML reads as no value at
+	// all, can still mean the null rule.
+	var parsed map[string]map[string]*maskRule
+	if err := yaml.Unmarshal(y, &parsed); err != nil {
+		return nil, errors.Wrapf(err, "parse masks file %q", file)
+	}
+	rules := make(maskRules, len(parsed))
+	for table, columns := range parsed {
+		rules[table] = make(map[string]maskRule, len(columns))
+		for column, rule := range columns {
+			if rule == nil {
+				rule = &maskRule{Type: maskNull}
+			}
+			if err := rule.validate(); err != nil {
+				return nil, errors.Wrapf(err, "mask for %s.%s", table, column)
+			}
+			rules[table][column] = *rule
+		}
+	}
+	return rules, nil
+}
+
+func (r maskRule) validate() error {
+	switch r.Type {
+	case maskFixed, maskNull, maskHash, maskEmail, maskRandom:
+		return nil
+	case maskTruncate:
+		if r.Length <= 0 {
+			return errors.New("truncate needs a positive length")
+		}
+		return nil
+	}
+	return errors.Errorf("unknown mask type %q", r.Type)
+}
+
+// rule returns the rule for a table's column. MySQL column names aren't case
+// sensitive, so neither is the lookup.
+func (m maskRules) rule(table, column string) (maskRule, bool) {
+	for c, r := range m[table] {
+		if strings.EqualFold(c, column) {
+			return r, true
+		}
+	}
+	return maskRule{}, false
+}
+
+// maskedColumn is a rule bound to a field of the table's dynamic row struct.
+type maskedColumn struct {
+	rule     maskRule
+	field    int
+	name     string
+	dataType string
+
+	// Character (or byte) limit of the column, 0 when it has none that
+	// matters, so generated values still fit.
+	maxLen int
+
+	// Integer width in bits, for hashing into the column's range.
+	bits int
+
+	// In a primary or unique key, so "email" keeps its whole digest.
+	unique bool
+}
+
+type rowMasker struct {
+	columns []maskedColumn
+}
+
+// maskColumn describes a column for newMaskedColumn.
+type maskColumn struct {
+	field     int
+	name      string
+	dataType  string
+	maxLength *int64
+	nullable  bool
+
+	// Whether the column is in a primary or unique key, including one
+	// over several columns, whose masked values have to stay distinct.
+	unique bool
+}
+
+func intBits(dataType string) int {
+	switch dataType {
+	case "tinyint":
+		return 8
+	case "smallint":
+		return 16
+	case "mediumint":
+		return 24
+	case "int":
+		return 32
+	case "bigint":
+		return 64
+	}
+	return 0
+}
+
+func isTextType(dataType string) bool {
+	switch dataType {
+	case "char", "varchar", "text", "tinytext", "mediumtext", "longtext":
+		return true
+	}
+	return false
+}
+
+func isBinaryType(dataType string) bool {
+	switch dataType {
+	case "binary", "varbinary", "blob", "tinyblob", "mediumblob", "longblob":
+		return true
+	}
+	return false
+}
+
+// newMaskedColumn checks a rule against the column it's for, so a rule that
+// can't apply fails before any rows are copied instead of mid-stream.
+func newMaskedColumn(rule maskRule, c maskColumn) (maskedColumn, error) {
+	m := maskedColumn{
+		rule:     rule,
+		field:    c.field,
+		name:     c.name,
+		dataType: c.dataType,
+		bits:     intBits(c.dataType),
+		unique:   c.unique,
+	}
+	if c.maxLength != nil && *c.maxLength < 1<<24 {
+		m.maxLen = int(*c.maxLength)
+	}
+
+	text, bin, integer := isTextType(c.dataType), isBinaryType(c.dataType), m.bits != 0
+	var ok bool
+	switch rule.Type {
+	case maskFixed:
+		ok = true
+	case maskNull:
+		if !c.nullable {
+			return m, errors.Errorf("column %q is not nullable", c.name)
+		}
+		ok = true
+	case maskHash, maskRandom:
+		ok = text || bin || integer
+	case maskEmail:
+		ok = text
+	case maskTruncate:
+		ok = text || bin
+	}
+	if !ok {
+		return m, errors.Errorf("mask %q can't apply to %s column %q", rule.Type, c.dataType, c.name)
+	}
+	if c.unique && !m.distinct() {
+		return m, errors.Errorf("mask %q on key column %q could give two rows the same value", rule.Type, c.name)
+	}
+	return m, nil
+}
+
+// distinct reports whether the column's masked values stay as distinct as
+// the originals, so it can be masked even though it's in a unique key. Only
+// a hash that keeps its whole digest does, and an email whose local part is
+// the whole address's digest; one folded into an integer or cut to fit, and
+// every other rule but null, can collide.
+func (m maskedColumn) distinct() bool {
+	switch m.rule.Type {
+	case maskNull:
+		return true
+	case maskEmail:
+		return m.maxLen == 0 || m.maxLen >= 2*sha256.Size
+	case maskHash:
+		if isBinaryType(m.dataType) {
+			return m.maxLen == 0 || m.maxLen >= sha256.Size
+		}
+		return isTextType(m.dataType) && (m.maxLen == 0 || m.maxLen >= 2*sha256.Size)
+	}
+	return false
+}
+
+// mask rewrites the masked fields of row, a dynamic row struct. NULLs stay
+// NULL except under "fixed". Returns a copy, since rows received from a
+// channel aren't addressable.
+func (m *rowMasker) mask(row reflect.Value) (reflect.Value, error) {
+	out := reflect.New(row.Type()).Elem()
+	out.Set(row)
+	for _, c := range m.columns {
+		if err := c.apply(out.Field(c.field)); err != nil {
+			return row, errors.Wrapf(err, "mask column %q", c.name)
+		}
+	}
+	return out, nil
+}
+
+func (c maskedColumn) apply(f reflect.Value) error {
+	switch c.rule.Type {
+	case maskNull:
+		f.Set(reflect.Zero(f.Type()))
+		return nil
+	case maskFixed:
+		v := reflect.New(f.Type().Elem())
+		if err := setFromString(v.Elem(), c.rule.Value); err != nil {
+			return err
+		}
+		f.Set(v)
+		return nil
+	}
+
+	if f.IsNil() {
+		return nil
+	}
+	e := f.Elem()
+
+	// Replace the pointer rather than writing through it, since the source
+	// row may share it with other destinations' copies.
+	v := reflect.New(e.Type())
+	switch e.Kind() {
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.Elem().SetInt(c.maskInt(strconv.FormatInt(e.Int(), 10)))
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v.Elem().SetUint(c.maskUint(strconv.FormatUint(e.Uint(), 10)))
+	case reflect.String:
+		v.Elem().SetString(c.maskString(e.String()))
+	case reflect.Slice:
+		v.Elem().SetBytes([]byte(c.maskString(string(e.Bytes()))))
+	default:
+		return errors.Errorf("unsupported field type %s", e.Type())
+	}
+	f.Set(v)
+	return nil
+}
+
+func setFromString(v reflect.Value, s string) error {
+	switch v.Kind() {
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return errors.Wrapf(err, "fixed value %q", s)
+		}
+		v.SetInt(i)
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return errors.Wrapf(err, "fixed value %q", s)
+		}
+		v.SetUint(u)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return errors.Wrapf(err, "fixed value %q", s)
+		}
+		v.SetFloat(f)
+	case reflect.String:
+		if v.Type() == reflect.TypeFor[mysql.Raw]() {
+			// Raw goes into the query as is, so only allow a plain number.
+			if _, err := strconv.ParseFloat(s, 64); err != nil {
+				return errors.Errorf("fixed value %q is not a number", s)
+			}
+		}
+		v.SetString(s)
+	case reflect.Slice:
+		if v.Type() == reflect.TypeFor[json.RawMessage]() && !json.Valid([]byte(s)) {
+			return errors.Errorf("fixed value %q is not valid JSON", s)
+		}
+		v.SetBytes([]byte(s))
+	case reflect.Interface:
+		v.Set(reflect.ValueOf(s))
+	default:
+		return errors.Errorf("unsupported field type %s", v.Type())
+	}
+	return nil
+}
+
+// digest is the deterministic part of every generated value. "hash" ignores
+// the seed so equal values hash equally across tables and runs; "random"
+// keys it so its output is only stable for whoever holds the seed.
+func (c maskedColumn) digest(s string) []byte {
+	if c.rule.Type == maskRandom {
+		h := hmac.New(sha256.New, []byte(c.rule.Seed))
+		h.Write([]byte(s))
+		return h.Sum(nil)
+	}
+	sum := sha256.Sum256([]byte(s))
+	return sum[:]
+}
+
+func (c maskedColumn) maskInt(s string) int64 {
+	u := binary.BigEndian.Uint64(c.digest(s))
+	// Non-negative and within the column's signed range.
+	return int64(u >> (65 - c.bits))
+}
+
+func (c maskedColumn) maskUint(s string) uint64 {
+	u := binary.BigEndian.Uint64(c.digest(s))
+	return u >> (64 - c.bits)
+}
+
+func (c maskedColumn) maskString(s string) string {
+	switch c.rule.Type {
+	case maskTruncate:
+		if isBinaryType(c.dataType) {
+			if len(s) > c.rule.Length {
+				return s[:c.rule.Length]
+			}
+			return s
+		}
+		return truncateRunes(s, c.rule.Length)
+	case maskEmail:
+		if c.unique {
+			// The digest of the whole address, so addresses that differ only
+			// by domain stay apart; a domain too long for the column gives
+			// way before any of it does.
+			local := hex.EncodeToString(c.digest(s))
+			if _, domain, ok := strings.Cut(s, "@"); ok {
+				local += "@" + domain
+			}
+			return c.fit(local)
+		}
+		local, domain, ok := strings.Cut(s, "@")
+		if !ok {
+			return c.fit(hex.EncodeToString(c.digest(s))[:16])
+		}
+		domain = "@" + domain
+		local = hex.EncodeToString(c.digest(local))[:12]
+		if c.maxLen > 0 && utf8.RuneCountInString(local+domain) > c.maxLen {
+			// Keep the domain if anything has to give; it's the point.
+			local = truncateRunes(local, max(1, c.maxLen-utf8.RuneCountInString(domain)))
+		}
+		return c.fit(local + domain)
+	case maskRandom:
+		return c.fit(shapeLike(s, c.digest(s)))
+	}
+	if isBinaryType(c.dataType) {
+		return c.fit(string(c.digest(s)))
+	}
+	return c.fit(hex.EncodeToString(c.digest(s)))
+}
+
+func (c maskedColumn) fit(s string) string {
+	if c.maxLen <= 0 {
+		return s
+	}
+	if isBinaryType(c.dataType) {
+		if len(s) > c.maxLen {
+			return s[:c.maxLen]
+		}
+		return s
+	}
+	return truncateRunes(s, c.maxLen)
+}
+
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	i := 0
+	for j := range s {
+		if i == n {
+			return s[:j]
+		}
+		i++
+	}
+	return s
+}
+
+// shapeLike replaces every letter and digit of s with a pseudo-random one of
+// the same kind and case drawn from seed, keeping punctuation and length, so
+// masked phone numbers and codes still look like phone numbers and codes.
+func shapeLike(s string, seed []byte) string {
+	stream := seed
+	next := func(i int) byte {
+		if i >= len(stream) {
+			sum := sha256.Sum256(stream)
+			stream = append(stream, sum[:]...)
+		}
+		return stream[i]
+	}
+
+	var b strings.Builder
+	b.Grow(len(s))
+	i := 0
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			b.WriteByte('0' + next(i)%10)
+		case r >= 'a' && r <= 'z':
+			b.WriteByte('a' + next(i)%26)
+		case r >= 'A' && r <= 'Z':
+			b.WriteByte('A' + next(i)%26)
+		default:
+			b.WriteRune(r)
+			continue
+		}
+		i++
+	}
+	return b.String()
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	mysql "github.com/StirlingMarketingGroup/cool-mysql"
+)
+
+func TestGetMasks(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "masks.yaml")
+	if err := os.WriteFile(file, []byte(`users:
+  Email: email
+  Phone: {type: random, seed: s3cret}
+  Notes: {type: truncate, length: 20}
+  SSN: null
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	rules, err := getMasks(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, ok := rules.rule("users", "email"); !ok || r.Type != maskEmail {
+		t.Errorf("rule(users, email) = %+v, %v, want the case-insensitive email rule", r, ok)
+	}
+	if r, _ := rules.rule("users", "Phone"); r != (maskRule{Type: maskRandom, Seed: "s3cret"}) {
+		t.Errorf("rule(users, Phone) = %+v", r)
+	}
+	if r, _ := rules.rule("users", "Notes"); r.Length != 20 {
+		t.Errorf("rule(users, Notes) = %+v", r)
+	}
+	if r, _ := rules.rule("users", "SSN"); r.Type != maskNull {
+		t.Errorf("rule(users, SSN) = %+v, want a bare null to mean the null rule", r)
+	}
+	if _, ok := rules.rule("orders", "Email"); ok {
+		t.Error("rules shouldn't leak across tables")
+	}
+
+	if rules, err := getMasks(filepath.Join(dir, "missing.yaml")); err != nil || rules != nil {
+		t.Errorf("getMasks(missing) = %v, %v, want no rules", rules, err)
+	}
+
+	if err := os.WriteFile(file, []byte("users:\n  Email: scramble\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := getMasks(file); err == nil {
+		t.Error("an unknown mask type should fail")
+	}
+}
+
+func TestNewMaskedColumn(t *testing.T) {
+	length := int64(255)
+	tests := []struct {
+		rule     string
+		dataType string
+		nullable bool
+		ok       bool
+	}{
+		{maskHash, "varchar", false, true},
+		{maskHash, "bigint", false, true},
+		{maskHash, "datetime", false, false},
+		{maskEmail, "varchar", false, true},
+		{maskEmail, "blob", false, false},
+		{maskTruncate, "varbinary", false, true},
+		{maskTruncate, "int", false, false},
+		{maskRandom, "enum", false, false},
+		{maskNull, "varchar", true, true},
+		{maskNull, "varchar", false, false},
+		{maskFixed, "datetime", false, true},
+	}
+	for _, tt := range tests {
+		_, err := newMaskedColumn(maskRule{Type: tt.rule}, maskColumn{0, "C", tt.dataType, &length, tt.nullable, false})
+		if (err == nil) != tt.ok {
+			t.Errorf("%s on %s (nullable %v): err = %v, want ok %v", tt.rule, tt.dataType, tt.nullable, err, tt.ok)
+		}
+	}
+
+	// Key columns only take rules that can't make two rows collide.
+	keys := []struct {
+		rule      string
+		dataType  string
+		maxLength int64
+		ok        bool
+	}{
+		{maskHash, "varchar", 255, true},
+		{maskHash, "char", 64, true},
+		{maskHash, "varchar", 20, false},
+		{maskHash, "varbinary", 32, true},
+		{maskHash, "binary", 16, false},
+		{maskHash, "int", 0, false},
+		{maskHash, "bigint", 0, false},
+		{maskRandom, "varchar", 255, false},
+		{maskEmail, "varchar", 255, true},
+		{maskEmail, "varchar", 40, false},
+		{maskTruncate, "varchar", 255, false},
+		{maskFixed, "varchar", 255, false},
+		{maskNull, "varchar", 255, true},
+	}
+	for _, tt := range keys {
+		_, err := newMaskedColumn(maskRule{Type: tt.rule, Length: 10}, maskColumn{0, "C", tt.dataType, &tt.maxLength, true, true})
+		if (err == nil) != tt.ok {
+			t.Errorf("%s on key %s(%d): err = %v, want ok %v", tt.rule, tt.dataType, tt.maxLength, err, tt.ok)
+		}
+	}
+}
+
+func TestMaskString(t *testing.T) {
+	length := int64(20)
+	column := func(rule maskRule, dataType string) maskedColumn {
+		c, err := newMaskedColumn(rule, maskColumn{0, "C", dataType, &length, true, false})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	hash := column(maskRule{Type: maskHash}, "varchar")
+	if a, b := hash.maskString("alice"), hash.maskString("alice"); a != b || a == "alice" || len(a) != 20 {
+		t.Errorf("hash = %q, %q, want a stable 20 character digest", a, b)
+	}
+	if hash.maskString("alice") == hash.maskString("bob") {
+		t.Error("hash should tell values apart")
+	}
+
+	email := column(maskRule{Type: maskEmail}, "varchar")
+	got := email.maskString("alice.smith@example.com")
+	if !strings.HasSuffix(got, "@example.com") || strings.Contains(got, "alice") || len(got) > 20 {
+		t.Errorf("email = %q, want a hashed local part at example.com within 20 characters", got)
+	}
+
+	length = 100
+	key, err := newMaskedColumn(maskRule{Type: maskEmail}, maskColumn{0, "C", "varchar", &length, true, true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b := key.maskString("alice@example.com"), key.maskString("alice@example.org")
+	if a == b || !strings.HasSuffix(a, "@example.com") || strings.Index(a, "@") != 64 {
+		t.Errorf("email on a key = %q, %q, want the whole address's digest at each domain", a, b)
+	}
+	length = 20
+
+	random := column(maskRule{Type: maskRandom, Seed: "a"}, "varchar")
+	got = random.maskString("(555) 123-Abc")
+	if got == "(555) 123-Abc" || len(got) != len("(555) 123-Abc") || got[0] != '(' || got[5] != ' ' || got[9] != '-' {
+		t.Errorf("random = %q, want the same shape", got)
+	}
+	if got != random.maskString("(555) 123-Abc") {
+		t.Error("random should be stable for a seed")
+	}
+	if other := column(maskRule{Type: maskRandom, Seed: "b"}, "varchar"); other.maskString("(555) 123-Abc") == got {
+		t.Error("random should depend on the seed")
+	}
+
+	truncate := column(maskRule{Type: maskTruncate, Length: 3}, "varchar")
+	if got := truncate.maskString("héllo"); got != "hél" {
+		t.Errorf("truncate = %q, want characters rather than bytes kept", got)
+	}
+}
+
+func TestRowMasker(t *testing.T) {
+	type row struct {
+		ID    *int32
+		Email *string
+		Notes *string
+		Score *mysql.Raw
+		Flags *uint8
+	}
+	id, email, notes, score, flags := int32(7), "bob@example.com", "secret", mysql.Raw("1.5"), uint8(3)
+	in := row{&id, &email, &notes, &score, &flags}
+
+	length := int64(255)
+	var columns []maskedColumn
+	for _, c := range []struct {
+		rule     maskRule
+		field    int
+		dataType string
+	}{
+		{maskRule{Type: maskHash}, 0, "int"},
+		{maskRule{Type: maskEmail}, 1, "varchar"},
+		{maskRule{Type: maskNull}, 2, "text"},
+		{maskRule{Type: maskFixed, Value: "0"}, 3, "decimal"},
+		{maskRule{Type: maskHash}, 4, "tinyint"},
+	} {
+		mc, err := newMaskedColumn(c.rule, maskColumn{c.field, "C", c.dataType, &length, true, false})
+		if err != nil {
+			t.Fatal(err)
+		}
+		columns = append(columns, mc)
+	}
+	m := &rowMasker{columns}
+
+	v, err := m.mask(reflect.ValueOf(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := v.Interface().(row)
+	if *out.ID < 0 || *out.ID == id {
+		t.Errorf("ID = %d, want a different non-negative int", *out.ID)
+	}
+	if !strings.HasSuffix(*out.Email, "@example.com") || *out.Email == email {
+		t.Errorf("Email = %q", *out.Email)
+	}
+	if out.Notes != nil {
+		t.Errorf("Notes = %q, want NULL", *out.Notes)
+	}
+	if *out.Score != "0" {
+		t.Errorf("Score = %q, want 0", *out.Score)
+	}
+	if id != 7 || email != "bob@example.com" || notes != "secret" || score != "1.5" || flags != 3 {
+		t.Error("masking should leave the source row's values alone")
+	}
+
+	// NULLs stay NULL except under fixed.
+	v, err = m.mask(reflect.ValueOf(row{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out = v.Interface().(row)
+	if out.ID != nil || out.Email != nil || out.Score == nil {
+		t.Errorf("masked NULL row = %+v", out)
+	}
+
+	bad := &rowMasker{[]maskedColumn{{rule: maskRule{Type: maskFixed, Value: "1; drop table users"}, field: 3}}}
+	if _, err := bad.mask(reflect.ValueOf(row{})); err == nil {
+		t.Error("a fixed decimal that isn't a number should fail")
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// stdout is where destinations that write to stdout send their output,
+// kept from before main points os.Stdout at stderr for everything else.
+var stdout io.Writer = os.Stdout
+
+// Tables written to stdout go out one at a time, each in full.
+var stdoutMu sync.Mutex
+
+// ndjsonDest writes each table to <dir>/<table>.ndjson, one JSON object per
+// row keyed by column name, or with a dir of "-", to stdout. json columns
+// are embedded as JSON, binary columns are base64, and decimals are strings
+// so no precision is lost to a float.
+type ndjsonDest struct {
+	dir  string
+	opts rowDestOptions
+}
+
+func newNDJSONDest(dir string, opts rowDestOptions) (*ndjsonDest, error) {
+	if dir == "" {
+		return nil, errors.New("ndjson: destination needs a directory, or - for stdout")
+	}
+	if dir != "-" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, errors.Wrapf(err, "create ndjson directory %q", dir)
+		}
+	}
+	return &ndjsonDest{dir: dir, opts: opts}, nil
+}
+
+func (d *ndjsonDest) toStdout() bool {
+	return d.dir == "-"
+}
+
+func (d *ndjsonDest) key() string {
+	if d.toStdout() {
+		return "stdout"
+	}
+	if abs, err := filepath.Abs(d.dir); err == nil {
+		return "ndjson:" + abs
+	}
+	return "ndjson:" + d.dir
+}
+
+func (d *ndjsonDest) openTable(rt rowTable) (tableWriter, error) {
+	// A table for stdout is spooled to a temp file first, so a retried
+	// attempt doesn't repeat rows and concurrent tables don't interleave.
+	files := &tableFiles{dir: d.dir, table: rt.name, ext: "ndjson", splitSize: d.opts.splitSize}
+	if d.toStdout() {
+		files.dir, files.splitSize = os.TempDir(), 0
+	}
+	t := &ndjsonTable{
+		dest:    d,
+		files:   files,
+		columns: rt.columns,
+		keys:    make([][]byte, len(rt.columns)),
+	}
+	t.enc = json.NewEncoder(&t.value)
+	t.enc.SetEscapeHTML(false)
+	for i, c := range rt.columns {
+		if err := t.enc.Encode(c.name); err != nil {
+			return nil, errors.Wrapf(err, "encode column name %q", c.name)
+		}
+		t.keys[i] = append(bytes.Clone(bytes.TrimSuffix(t.value.Bytes(), []byte("\n"))), ':')
+		t.value.Reset()
+	}
+	return t, nil
+}
+
+type ndjsonTable struct {
+	dest    *ndjsonDest
+	files   *tableFiles
+	columns []rowColumn
+
+	// Each column's name encoded as an object key, colon included.
+	keys [][]byte
+
+	w     *bufio.Writer
+	line  []byte
+	value bytes.Buffer
+	enc   *json.Encoder
+}
+
+func (t *ndjsonTable) write(row reflect.Value) error {
+	if !t.files.open() {
+		f, err := t.files.startPart()
+		if err != nil {
+			return err
+		}
+		t.w = bufio.NewWriter(f)
+	}
+
+	t.line = append(t.line[:0], '{')
+	for i, c := range t.columns {
+		if i > 0 {
+			t.line = append(t.line, ',')
+		}
+		t.line = append(t.line, t.keys[i]...)
+		s, ok := fieldText(c, row.Field(i), "base64")
+		switch {
+		case !ok:
+			t.line = append(t.line, "null"...)
+		case c.dataType == "json" || jsonNumber(c.dataType):
+			t.line = append(t.line, s...)
+		default:
+			t.value.Reset()
+			if err := t.enc.Encode(s); err != nil {
+				return errors.Wrapf(err, "encode %q for %q", c.name, t.files.table)
+			}
+			t.line = append(t.line, bytes.TrimSuffix(t.value.Bytes(), []byte("\n"))...)
+		}
+	}
+	t.line = append(t.line, '}', '\n')
+
+	if _, err := t.w.Write(t.line); err != nil {
+		return errors.Wrapf(err, "write ndjson row for %q", t.files.table)
+	}
+	if t.files.full() {
+		return t.finishPart()
+	}
+	return nil
+}
+
+// jsonNumber reports whether a column's text is written as a JSON number.
+// Decimals aren't, since most readers would parse them into a float.
+func jsonNumber(dataType string) bool {
+	switch dataType {
+	case "tinyint", "smallint", "mediumint", "int", "bigint", "year", "float", "double", "bit":
+		return true
+	}
+	return false
+}
+
+func (t *ndjsonTable) finishPart() error {
+	err := t.w.Flush()
+	if cerr := t.files.finishPart(); err == nil {
+		err = cerr
+	}
+	return errors.Wrapf(err, "write ndjson file for %q", t.files.table)
+}
+
+func (t *ndjsonTable) commit() error {
+	if t.files.open() {
+		if err := t.finishPart(); err != nil {
+			return err
+		}
+	}
+	if !t.dest.toStdout() {
+		if len(t.files.parts) == 0 {
+			// Nothing was written, but the table should still be there,
+			// empty, in place of a previous run's.
+			if _, err := t.files.startPart(); err != nil {
+				return err
+			}
+			if err := t.files.finishPart(); err != nil {
+				return errors.Wrapf(err, "write ndjson file for %q", t.files.table)
+			}
+		}
+		return t.files.commit()
+	}
+
+	stdoutMu.Lock()
+	defer stdoutMu.Unlock()
+	for _, part := range t.files.parts {
+		f, err := os.Open(part)
+		if err != nil {
+			return errors.Wrapf(err, "open %q", part)
+		}
+		_, err = io.Copy(stdout, f)
+		f.Close()
+		if err != nil {
+			return errors.Wrapf(err, "write %q to stdout", t.files.table)
+		}
+	}
+	// The spooled parts have been copied, and are removed like an
+	// aborted attempt's.
+	return t.files.abort()
+}
+
+func (t *ndjsonTable) abort() error {
+	return t.files.abort()
+}
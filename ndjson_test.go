@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	mysql "github.com/StirlingMarketingGroup/cool-mysql"
+)
+
+var ndjsonColumns = []rowColumn{
+	{"ID", "bigint", "bigint", false},
+	{"Name", "varchar", "varchar(50)", true},
+	{"Price", "decimal", "decimal(30,10)", true},
+	{"Attrs", "json", "json", true},
+	{"Photo", "varbinary", "varbinary(10)", true},
+	{"Ratio", "double", "double", true},
+	{"Flags", "bit", "bit(3)", true},
+	{"Created", "datetime", "datetime(6)", true},
+}
+
+func TestNDJSONDest(t *testing.T) {
+	dir := t.TempDir()
+	d, ok, err := openRowDest("ndjson:"+dir, rowDestOptions{binaryEncoding: "hex"})
+	if !ok || err != nil {
+		t.Fatalf("openRowDest = %v, %v", ok, err)
+	}
+	writeTable(t, d, "items", ndjsonColumns, testRows(t, ndjsonColumns,
+		[]any{int64(-9007199254740993), "<a & \"b\">\tñ", mysql.Raw("12345678901234567890.0123456789"),
+			json.RawMessage(`{"size": [1, 2]}`), []byte{0xff, 0x00}, 1e21, []byte{0x05}, "2026-10-17 01:02:03.000004"},
+		[]any{int64(2), nil, nil, nil, nil, nil, nil, nil},
+	))
+	writeTable(t, d, "empty", ndjsonColumns, nil)
+
+	got, err := os.ReadFile(filepath.Join(dir, "items.ndjson"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"ID":-9007199254740993,"Name":"<a & \"b\">\tñ","Price":"12345678901234567890.0123456789",` +
+		`"Attrs":{"size": [1, 2]},"Photo":"/wA=","Ratio":1e+21,"Flags":5,"Created":"2026-10-17 01:02:03.000004"}` + "\n" +
+		`{"ID":2,"Name":null,"Price":null,"Attrs":null,"Photo":null,"Ratio":null,"Flags":null,"Created":null}` + "\n"
+	if string(got) != want {
+		t.Errorf("items.ndjson =\n%s\nwant\n%s", got, want)
+	}
+	for line := range bytes.Lines(got) {
+		if !json.Valid(line) {
+			t.Errorf("invalid JSON line %s", line)
+		}
+	}
+
+	if b, err := os.ReadFile(filepath.Join(dir, "empty.ndjson")); err != nil || len(b) != 0 {
+		t.Errorf("empty.ndjson = %q, %v, want an empty file", b, err)
+	}
+}
+
+func TestNDJSONDestStdout(t *testing.T) {
+	var out bytes.Buffer
+	stdout = &out
+	defer func() { stdout = os.Stdout }()
+
+	d, _, err := openRowDest("ndjson:-", rowDestOptions{binaryEncoding: "hex", splitSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	columns := ndjsonColumns[:2]
+	a, err := d.openTable(rowTable{name: "a", columns: columns})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := d.openTable(rowTable{name: "b", columns: columns})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := testRows(t, columns, []any{int64(1), "x"}, []any{int64(2), "y"})
+	for _, row := range rows {
+		if err := a.write(row); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.write(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if out.Len() != 0 {
+		t.Errorf("rows reached stdout before their table committed: %q", out.String())
+	}
+	if err := b.abort(); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.commit(); err != nil {
+		t.Fatal(err)
+	}
+	if want := "{\"ID\":1,\"Name\":\"x\"}\n{\"ID\":2,\"Name\":\"y\"}\n"; out.String() != want {
+		t.Errorf("stdout = %q, want %q", out.String(), want)
+	}
+	if d.key() != "stdout" {
+		t.Errorf("key = %q, want stdout", d.key())
+	}
+
+	if !writesToStdout("localhost, ndjson:-") || writesToStdout("localhost,ndjson:out") {
+		t.Error("writesToStdout should spot ndjson:- and only it")
+	}
+}
+
+func TestNDJSONDestSplit(t *testing.T) {
+	dir := t.TempDir()
+	d, _, err := openRowDest("ndjson:"+dir, rowDestOptions{binaryEncoding: "hex", splitSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	columns := ndjsonColumns[:2]
+	var rows [][]any
+	for i := range 3 {
+		rows = append(rows, []any{int64(i), string(make([]byte, 5000))})
+	}
+	writeTable(t, d, "big", columns, testRows(t, columns, rows...))
+	if files := dirFiles(t, dir); !slices.Equal(files, []string{"big-000001.ndjson", "big-000002.ndjson", "big-000003.ndjson"}) {
+		t.Errorf("files = %v, want three parts", files)
+	}
+}
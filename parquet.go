@@ -0,0 +1,475 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"log/slog"
+	"math"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	mysql "github.com/StirlingMarketingGroup/cool-mysql"
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/compress"
+	"github.com/parquet-go/parquet-go/encoding"
+	"github.com/pkg/errors"
+)
+
+// Uncompressed bytes of values buffered per row group, and so per file,
+// when -split-size doesn't say.
+const parquetRowGroupSize = 128 << 20
+
+// parquetDest writes each table to <dir>/<table>-000001.parquet and on, one
+// gzipped row group per file, and keeps <dir>/manifest.json listing each
+// table's files and row counts.
+type parquetDest struct {
+	dir  string
+	opts rowDestOptions
+
+	// Held while the manifest is rewritten.
+	manifestMu sync.Mutex
+}
+
+func newParquetDest(dir string, opts rowDestOptions) (*parquetDest, error) {
+	if dir == "" {
+		return nil, errors.New("parquet: destination needs a directory")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, errors.Wrapf(err, "create parquet directory %q", dir)
+	}
+	if opts.splitSize == 0 {
+		opts.splitSize = parquetRowGroupSize
+	}
+	return &parquetDest{dir: dir, opts: opts}, nil
+}
+
+func (d *parquetDest) key() string {
+	if abs, err := filepath.Abs(d.dir); err == nil {
+		return "parquet:" + abs
+	}
+	return "parquet:" + d.dir
+}
+
+func (d *parquetDest) openTable(rt rowTable) (tableWriter, error) {
+	t := &parquetTable{
+		dest: d,
+		// Every file is a split, numbered even when there's only one.
+		files:   &tableFiles{dir: d.dir, table: rt.name, ext: "parquet", splitSize: d.opts.splitSize},
+		columns: make([]*parquetColumn, len(rt.columns)),
+		row:     make(parquet.Row, len(rt.columns)),
+	}
+	root := make(parquetGroup, len(rt.columns))
+	for i, c := range rt.columns {
+		t.columns[i] = newParquetColumn(c)
+		root[i] = parquetField{t.columns[i].node, c.name, i}
+	}
+	t.schema = parquet.NewSchema("schema", root)
+	return t, nil
+}
+
+type parquetTable struct {
+	dest    *parquetDest
+	files   *tableFiles
+	columns []*parquetColumn
+	schema  *parquet.Schema
+
+	// The file being written, started by the first row after the last.
+	w   *parquet.Writer
+	buf *bufio.Writer
+
+	// Reused for each row's values.
+	row parquet.Row
+
+	// Rows in the row group being buffered, and in each file written.
+	rows     int64
+	fileRows []int64
+
+	// Set once a temporal value that can't be represented, like a zero
+	// date, has been written as null.
+	warned bool
+}
+
+func (t *parquetTable) write(row reflect.Value) error {
+	if t.w == nil {
+		if err := t.startFile(); err != nil {
+			return err
+		}
+	}
+	for i, c := range t.columns {
+		v, ok := c.value(row.Field(i))
+		if !ok && !t.warned {
+			t.warned = true
+			slog.Warn("writing zero or invalid dates as null in parquet", "tableName", t.files.table, "column", c.name)
+		}
+		var def int
+		if c.optional && !v.IsNull() {
+			def = 1
+		}
+		t.row[i] = v.Level(0, def, i)
+	}
+	if _, err := t.w.WriteRows([]parquet.Row{t.row}); err != nil {
+		return errors.Wrapf(err, "write parquet row for %q", t.files.table)
+	}
+	t.rows++
+	// Size counts the row group's values before they're compressed.
+	if t.w.Size() >= t.dest.opts.splitSize {
+		return t.finishFile()
+	}
+	return nil
+}
+
+func (t *parquetTable) startFile() error {
+	f, err := t.files.startPart()
+	if err != nil {
+		return err
+	}
+	t.buf = bufio.NewWriter(f)
+	t.w = parquet.NewWriter(t.buf, t.schema, parquet.Compression(&parquet.Gzip))
+	return nil
+}
+
+// finishFile ends the file being written, its rows one row group.
+func (t *parquetTable) finishFile() error {
+	err := t.w.Close()
+	if err == nil {
+		err = t.buf.Flush()
+	}
+	if cerr := t.files.finishPart(); err == nil {
+		err = cerr
+	}
+	t.w, t.buf = nil, nil
+	if err != nil {
+		return errors.Wrapf(err, "write parquet file for %q", t.files.table)
+	}
+	t.fileRows = append(t.fileRows, t.rows)
+	t.rows = 0
+	return nil
+}
+
+func (t *parquetTable) commit() error {
+	if t.w == nil && len(t.fileRows) == 0 {
+		// An empty table still gets a file, so readers see its schema.
+		if err := t.startFile(); err != nil {
+			return err
+		}
+	}
+	if t.w != nil {
+		if err := t.finishFile(); err != nil {
+			return err
+		}
+	}
+	if err := t.files.commit(); err != nil {
+		return err
+	}
+	return t.dest.record(t.files, t.fileRows)
+}
+
+func (t *parquetTable) abort() error {
+	return t.files.abort()
+}
+
+// parquetManifest is manifest.json, what each table's latest run wrote.
+type parquetManifest struct {
+	Tables map[string]parquetManifestTable `json:"tables"`
+}
+
+type parquetManifestTable struct {
+	Rows  int64                 `json:"rows"`
+	Files []parquetManifestFile `json:"files"`
+}
+
+type parquetManifestFile struct {
+	File string `json:"file"`
+	Rows int64  `json:"rows"`
+}
+
+// record updates the manifest with a table's files.
+func (d *parquetDest) record(files *tableFiles, fileRows []int64) error {
+	d.manifestMu.Lock()
+	defer d.manifestMu.Unlock()
+
+	path := filepath.Join(d.dir, "manifest.json")
+	var m parquetManifest
+	b, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(b, &m); err != nil {
+			return errors.Wrapf(err, "read parquet manifest %q", path)
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		return errors.Wrapf(err, "read parquet manifest %q", path)
+	}
+	if m.Tables == nil {
+		m.Tables = make(map[string]parquetManifestTable)
+	}
+
+	var entry parquetManifestTable
+	for i, rows := range fileRows {
+		entry.Rows += rows
+		entry.Files = append(entry.Files, parquetManifestFile{File: filepath.Base(files.partName(i)), Rows: rows})
+	}
+	m.Tables[files.table] = entry
+
+	b, err = json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "encode parquet manifest")
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(b, '\n'), 0o644); err != nil {
+		return errors.Wrapf(err, "write parquet manifest %q", path)
+	}
+	return errors.Wrapf(os.Rename(tmp, path), "write parquet manifest %q", path)
+}
+
+// parquetColumn maps a table column to its node in the file's schema and
+// its values to Parquet's.
+type parquetColumn struct {
+	rowColumn
+
+	node     parquet.Node
+	optional bool
+
+	// The physical type of a decimal's unscaled values, and the length of a
+	// fixed one.
+	kind             parquet.Kind
+	typeLength       int
+	precision, scale int
+}
+
+var parquetDecimalRegexp = regexp.MustCompile(`\(([0-9]+)(?:,([0-9]+))?\)`)
+
+// newParquetColumn maps a column to the Parquet type that holds its values
+// exactly: integers by width and sign, decimals scaled into integers or
+// fixed bytes, dates as days and datetimes and timestamps as microseconds
+// since the epoch, and everything else as byte arrays, annotated as strings
+// or JSON where they're text. time columns, which can be negative or over
+// 24 hours, stay strings.
+func newParquetColumn(c rowColumn) *parquetColumn {
+	p := &parquetColumn{rowColumn: c, optional: c.nullable}
+	unsigned := strings.HasSuffix(c.columnType, " unsigned")
+	intType := func(bits int) parquet.Node {
+		if unsigned {
+			return parquet.Uint(bits)
+		}
+		return parquet.Int(bits)
+	}
+
+	switch c.dataType {
+	case "tinyint":
+		p.node = intType(8)
+	case "smallint":
+		p.node = intType(16)
+	case "mediumint", "int":
+		p.node = intType(32)
+	case "bigint":
+		p.node = intType(64)
+	case "year":
+		p.node = parquet.Uint(16)
+	case "bit":
+		p.node = parquet.Uint(64)
+	case "float":
+		p.node = parquet.Leaf(parquet.FloatType)
+	case "double":
+		p.node = parquet.Leaf(parquet.DoubleType)
+	case "decimal":
+		p.precision, p.scale = 10, 0
+		if m := parquetDecimalRegexp.FindStringSubmatch(c.columnType); m != nil {
+			p.precision, _ = strconv.Atoi(m[1])
+			p.scale, _ = strconv.Atoi(m[2])
+		}
+		var typ parquet.Type
+		switch {
+		case p.precision <= 9:
+			typ = parquet.Int32Type
+		case p.precision <= 18:
+			typ = parquet.Int64Type
+		default:
+			p.typeLength = decimalBytes(p.precision)
+			typ = parquet.FixedLenByteArrayType(p.typeLength)
+		}
+		p.kind = typ.Kind()
+		p.node = parquet.Decimal(p.scale, p.precision, typ)
+	case "date":
+		// Zero dates have no day to count, and are written as null.
+		p.node, p.optional = parquet.Date(), true
+	case "datetime", "timestamp":
+		// timestamp values are read in UTC, datetime values are whatever
+		// the application meant them as.
+		p.node = parquet.TimestampAdjusted(parquet.Microsecond, c.dataType == "timestamp")
+		p.optional = true
+	case "set":
+		// Can be read as nothing at all, written as null.
+		p.node, p.optional = parquet.String(), true
+	case "json":
+		p.node = parquet.JSON()
+	default:
+		if c.binary() {
+			p.node = parquet.Leaf(parquet.ByteArrayType)
+		} else {
+			p.node = parquet.String()
+		}
+	}
+	if p.optional {
+		p.node = parquet.Optional(p.node)
+	} else {
+		p.node = parquet.Required(p.node)
+	}
+	return p
+}
+
+// decimalBytes is the fewest bytes whose two's complement holds every
+// unscaled value of a decimal's precision.
+func decimalBytes(precision int) int {
+	n := 1
+	for float64(8*n-1) < float64(precision)*math.Log2(10) {
+		n++
+	}
+	return n
+}
+
+// value converts a row's field, reporting false if it had to be written as
+// null because Parquet can't represent it.
+func (p *parquetColumn) value(v reflect.Value) (parquet.Value, bool) {
+	if v.IsNil() {
+		return parquet.NullValue(), true
+	}
+
+	switch p.dataType {
+	case "date", "datetime", "timestamp":
+		s := *(v.Interface().(*string))
+		layout := "2006-01-02 15:04:05.999999999"
+		if p.dataType == "date" {
+			layout = time.DateOnly
+		}
+		t, err := time.ParseInLocation(layout, s, time.UTC)
+		switch {
+		case err != nil:
+			return parquet.NullValue(), false
+		case p.dataType == "date":
+			return parquet.Int32Value(int32(t.Unix() / 86400)), true
+		}
+		return parquet.Int64Value(t.UnixMicro()), true
+
+	case "decimal":
+		return p.decimal(string(*(v.Interface().(*mysql.Raw)))), true
+
+	case "float", "double":
+		var f float64
+		switch x := v.Elem().Interface().(type) {
+		case float64:
+			f = x
+		case mysql.Raw:
+			f, _ = strconv.ParseFloat(string(x), 64)
+		}
+		if p.dataType == "float" {
+			return parquet.FloatValue(float32(f)), true
+		}
+		return parquet.DoubleValue(f), true
+
+	case "bit":
+		var n uint64
+		for _, b := range v.Elem().Bytes() {
+			n = n<<8 | uint64(b)
+		}
+		return parquet.Int64Value(int64(n)), true
+	}
+
+	e := v.Elem()
+	switch p.node.Type().Kind() {
+	case parquet.Int32:
+		if e.CanInt() {
+			return parquet.Int32Value(int32(e.Int())), true
+		}
+		return parquet.Int32Value(int32(uint32(e.Uint()))), true
+	case parquet.Int64:
+		if e.CanInt() {
+			return parquet.Int64Value(e.Int()), true
+		}
+		return parquet.Int64Value(int64(e.Uint())), true
+	}
+	if p.binary() {
+		return parquet.ByteArrayValue(e.Bytes()), true
+	}
+	s, isSet := fieldText(p.rowColumn, v, "")
+	if !isSet {
+		// A set column's any, holding nothing.
+		return parquet.NullValue(), true
+	}
+	return parquet.ByteArrayValue([]byte(s)), true
+}
+
+// decimal converts a decimal's text to its unscaled integer.
+func (p *parquetColumn) decimal(s string) parquet.Value {
+	whole, frac, _ := strings.Cut(s, ".")
+	frac = (frac + strings.Repeat("0", p.scale))[:p.scale]
+	n, _ := new(big.Int).SetString(whole+frac, 10)
+	if n == nil {
+		n = new(big.Int)
+	}
+	switch p.kind {
+	case parquet.Int32:
+		return parquet.Int32Value(int32(n.Int64()))
+	case parquet.Int64:
+		return parquet.Int64Value(n.Int64())
+	}
+	// Big-endian two's complement, sign extended to the fixed length.
+	if n.Sign() < 0 {
+		n.Add(n, new(big.Int).Lsh(big.NewInt(1), uint(8*p.typeLength)))
+	}
+	return parquet.FixedLenByteArrayValue(n.FillBytes(make([]byte, p.typeLength)))
+}
+
+// parquetGroup is a file's schema, its columns in the table's order, where
+// parquet.Group would sort them by name.
+type parquetGroup []parquet.Field
+
+func (g parquetGroup) ID() int                     { return 0 }
+func (g parquetGroup) Type() parquet.Type          { return parquet.Group{}.Type() }
+func (g parquetGroup) Optional() bool              { return false }
+func (g parquetGroup) Repeated() bool              { return false }
+func (g parquetGroup) Required() bool              { return true }
+func (g parquetGroup) Leaf() bool                  { return false }
+func (g parquetGroup) Fields() []parquet.Field     { return g }
+func (g parquetGroup) Encoding() encoding.Encoding { return nil }
+func (g parquetGroup) Compression() compress.Codec { return nil }
+
+func (g parquetGroup) String() string {
+	m := make(parquet.Group, len(g))
+	for _, f := range g {
+		m[f.Name()] = f
+	}
+	return m.String()
+}
+
+// GoType is a struct of the columns' types, in order.
+func (g parquetGroup) GoType() reflect.Type {
+	fields := make([]reflect.StructField, len(g))
+	for i, f := range g {
+		fields[i] = reflect.StructField{
+			Name: "F" + strconv.Itoa(i),
+			Type: f.GoType(),
+			Tag:  reflect.StructTag(`parquet:` + strconv.Quote(f.Name())),
+		}
+	}
+	return reflect.StructOf(fields)
+}
+
+// parquetField is a column of a parquetGroup.
+type parquetField struct {
+	parquet.Node
+	name  string
+	index int
+}
+
+func (f parquetField) Name() string { return f.name }
+
+func (f parquetField) Value(base reflect.Value) reflect.Value {
+	return reflect.Indirect(base).Field(f.index)
+}
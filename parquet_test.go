@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	mysql "github.com/StirlingMarketingGroup/cool-mysql"
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/format"
+)
+
+var parquetColumns = []rowColumn{
+	{"ID", "bigint", "bigint unsigned", false},
+	{"Name", "varchar", "varchar(50)", true},
+	{"Price", "decimal", "decimal(10,2)", true},
+	{"Big", "decimal", "decimal(30,4)", true},
+	{"Day", "date", "date", false},
+	{"Created", "datetime", "datetime(6)", true},
+	{"Attrs", "json", "json", true},
+	{"Photo", "blob", "blob", true},
+	{"Small", "tinyint", "tinyint", true},
+	{"Ratio", "float", "float", true},
+}
+
+// readParquetFile reads a file back with parquet-go's reader.
+func readParquetFile(t *testing.T, path string) (*parquet.File, []parquet.Row) {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := parquet.OpenFile(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatalf("open %s: %v", path, err)
+	}
+	rows := make([]parquet.Row, f.NumRows())
+	r := parquet.NewReader(f)
+	defer r.Close()
+	if n, err := r.ReadRows(rows); n != len(rows) || err != nil && err != io.EOF {
+		t.Fatalf("read %s: %d rows, %v", path, n, err)
+	}
+	return f, rows
+}
+
+func TestParquetDest(t *testing.T) {
+	dir := t.TempDir()
+	d, ok, err := openRowDest("parquet:"+dir, rowDestOptions{binaryEncoding: "hex"})
+	if !ok || err != nil {
+		t.Fatalf("openRowDest = %v, %v", ok, err)
+	}
+	writeTable(t, d, "items", parquetColumns, testRows(t, parquetColumns,
+		[]any{uint64(math.MaxUint64), "ñ", mysql.Raw("-12.34"), mysql.Raw("-12345678901234567890.5"),
+			"1969-12-31", "2026-10-17 01:02:03.000004", json.RawMessage(`{"a":1}`), []byte{0xff}, int8(-5), 1.5},
+		[]any{uint64(2), nil, nil, nil, "0000-00-00", nil, nil, nil, nil, nil},
+	))
+	writeTable(t, d, "empty", parquetColumns, nil)
+
+	if files := dirFiles(t, dir); !slices.Equal(files, []string{"empty-000001.parquet", "items-000001.parquet", "manifest.json"}) {
+		t.Errorf("files = %v", files)
+	}
+	f, rows := readParquetFile(t, filepath.Join(dir, "items-000001.parquet"))
+	if len(rows) != 2 {
+		t.Fatalf("%d rows, want 2", len(rows))
+	}
+
+	// Types, in the table's column order.
+	wantSchema := `message schema {
+	required int64 ID (INT(64,false));
+	optional binary Name (STRING);
+	optional int64 Price (DECIMAL(10,2));
+	optional fixed_len_byte_array(13) Big (DECIMAL(30,4));
+	optional int32 Day (DATE);
+	optional int64 Created (TIMESTAMP(isAdjustedToUTC=false,unit=MICROS));
+	optional binary Attrs (JSON);
+	optional binary Photo;
+	optional int32 Small (INT(8,true));
+	optional float Ratio;
+}`
+	if got := f.Schema().String(); got != wantSchema {
+		t.Errorf("schema =\n%s\nwant\n%s", got, wantSchema)
+	}
+	if cc := f.Metadata().RowGroups[0].Columns[0].MetaData; cc.Codec != format.Gzip {
+		t.Errorf("codec = %v, want gzip", cc.Codec)
+	}
+
+	first, second := rows[0], rows[1]
+	if uint64(first[0].Int64()) != math.MaxUint64 || second[0].Int64() != 2 {
+		t.Errorf("ID = %v, %v", first[0], second[0])
+	}
+	if string(first[1].ByteArray()) != "ñ" || !second[1].IsNull() {
+		t.Errorf("Name = %v, %v", first[1], second[1])
+	}
+	if first[2].Int64() != -1234 {
+		t.Errorf("Price = %v, want -1234", first[2])
+	}
+	// -123456789012345678905000, in 13 bytes of two's complement.
+	if !bytes.Equal(first[3].ByteArray(), []byte{0xff, 0xff, 0xff, 0xe5, 0xdb, 0x64, 0xe0, 0xef, 0x5f, 0x93, 0x69, 0x41, 0x58}) {
+		t.Errorf("Big = %x", first[3].ByteArray())
+	}
+	if first[4].Int32() != -1 || !second[4].IsNull() {
+		t.Errorf("Day = %v, %v, want day -1 then the zero date as null", first[4], second[4])
+	}
+	if created := time.Date(2026, 10, 17, 1, 2, 3, 4000, time.UTC).UnixMicro(); first[5].Int64() != created {
+		t.Errorf("Created = %v, want %d", first[5], created)
+	}
+	if string(first[6].ByteArray()) != `{"a":1}` || !bytes.Equal(first[7].ByteArray(), []byte{0xff}) {
+		t.Errorf("Attrs, Photo = %v, %v", first[6], first[7])
+	}
+	if first[8].Int32() != -5 || first[9].Float() != 1.5 {
+		t.Errorf("Small, Ratio = %v, %v", first[8], first[9])
+	}
+
+	if empty, rows := readParquetFile(t, filepath.Join(dir, "empty-000001.parquet")); len(rows) != 0 || empty.Schema().String() != wantSchema {
+		t.Errorf("empty file has %d rows, schema\n%s", len(rows), empty.Schema())
+	}
+
+	var m parquetManifest
+	b, err := os.ReadFile(filepath.Join(dir, "manifest.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(b, &m); err != nil {
+		t.Fatal(err)
+	}
+	if items := m.Tables["items"]; items.Rows != 2 || len(items.Files) != 1 || items.Files[0] != (parquetManifestFile{"items-000001.parquet", 2}) {
+		t.Errorf("manifest items = %+v", items)
+	}
+	if empty, ok := m.Tables["empty"]; !ok || empty.Rows != 0 {
+		t.Errorf("manifest empty = %+v, %v", empty, ok)
+	}
+}
+
+func TestParquetDestSplit(t *testing.T) {
+	dir := t.TempDir()
+	d, _, err := openRowDest("parquet:"+dir, rowDestOptions{binaryEncoding: "hex", splitSize: 10000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	columns := parquetColumns[:2]
+	var rows [][]any
+	for i := range 5 {
+		rows = append(rows, []any{uint64(i), string(make([]byte, 4000))})
+	}
+	// A previous run with more files, which this one replaces.
+	if err := os.WriteFile(filepath.Join(dir, "big-000009.parquet"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	writeTable(t, d, "big", columns, testRows(t, columns, rows...))
+	if files := dirFiles(t, dir); !slices.Equal(files, []string{"big-000001.parquet", "big-000002.parquet", "manifest.json"}) {
+		t.Errorf("files = %v, want two", files)
+	}
+
+	var m parquetManifest
+	b, _ := os.ReadFile(filepath.Join(dir, "manifest.json"))
+	if err := json.Unmarshal(b, &m); err != nil {
+		t.Fatal(err)
+	}
+	want := []parquetManifestFile{{"big-000001.parquet", 3}, {"big-000002.parquet", 2}}
+	if big := m.Tables["big"]; big.Rows != 5 || !slices.Equal(big.Files, want) {
+		t.Errorf("manifest big = %+v", big)
+	}
+	for _, file := range want {
+		if _, rows := readParquetFile(t, filepath.Join(dir, file.File)); int64(len(rows)) != file.Rows {
+			t.Errorf("%s has %d rows, want %d", file.File, len(rows), file.Rows)
+		}
+	}
+}
+
+func TestDecimalBytes(t *testing.T) {
+	for _, tt := range []struct{ precision, bytes int }{
+		{1, 1}, {2, 1}, {3, 2}, {9, 4}, {18, 8}, {19, 9}, {30, 13}, {38, 16}, {65, 28},
+	} {
+		if got := decimalBytes(tt.precision); got != tt.bytes {
+			t.Errorf("decimalBytes(%d) = %d, want %d", tt.precision, got, tt.bytes)
+		}
+	}
+}
@@ -0,0 +1,724 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/pkg/errors"
+)
+
+// postgresDest loads tables into a PostgreSQL database with COPY, each into
+// a temp table that's swapped in for the real one, with its keys, indexes
+// and checks added after the rename, in one transaction. Foreign keys are
+// added once every table is in, since they can name tables swapped in
+// later.
+type postgresDest struct {
+	pool *pgxpool.Pool
+	opts rowDestOptions
+
+	// The constraints swapped in tables are waiting on, for finish.
+	mu      sync.Mutex
+	pending []string
+}
+
+func newPostgresDest(dsn string, opts rowDestOptions) (*postgresDest, error) {
+	config, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse postgres DSN")
+	}
+	// Like database destinations, sessions are anchored to UTC, the zone
+	// the source's timestamp values are read in.
+	config.ConnConfig.RuntimeParams["timezone"] = "UTC"
+
+	ctx := context.Background()
+	pool, err := pgxpool.NewWithConfig(ctx, config)
+	if err != nil {
+		return nil, errors.Wrap(err, "open postgres database")
+	}
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, errors.Wrap(err, "open postgres database")
+	}
+	return &postgresDest{pool: pool, opts: opts}, nil
+}
+
+func (d *postgresDest) key() string {
+	c := d.pool.Config().ConnConfig
+	return fmt.Sprintf("postgres://%s@%s:%d/%s", c.User, c.Host, c.Port, c.Database)
+}
+
+func (d *postgresDest) openTable(rt rowTable) (tableWriter, error) {
+	schema := postgresSchema(rt)
+	for _, w := range schema.warnings {
+		slog.Warn("dropped from postgres schema: "+w, "tableName", rt.name)
+	}
+
+	// Each table holds a connection from open to commit, for its COPY and
+	// then the swap.
+	ctx := context.Background()
+	conn, err := d.pool.Acquire(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "connect to postgres")
+	}
+	t := &postgresTable{
+		dest:        d,
+		rt:          rt,
+		tempTable:   d.opts.tempPrefix + rt.name,
+		after:       schema.after,
+		constraints: schema.constraints,
+		conn:        conn,
+	}
+	temp := pgIdent(t.tempTable)
+	for _, stmt := range []string{"drop table if exists " + temp, "create table " + temp + schema.columns} {
+		if _, err := conn.Exec(ctx, stmt); err != nil {
+			conn.Release()
+			return nil, errors.Wrapf(err, "create postgres temp table %q", t.tempTable)
+		}
+	}
+
+	names := make([]string, len(rt.columns))
+	for i, c := range rt.columns {
+		names[i] = pgIdent(c.name)
+	}
+	pr, pw := io.Pipe()
+	t.pw, t.w, t.done = pw, bufio.NewWriterSize(pw, 1<<16), make(chan error, 1)
+	go func() {
+		_, err := conn.Conn().PgConn().CopyFrom(ctx, pr, "copy "+temp+"("+strings.Join(names, ",")+")from stdin")
+		// Rows written after the server gave up fail rather than block.
+		pr.CloseWithError(err)
+		t.done <- err
+	}()
+	return t, nil
+}
+
+type postgresTable struct {
+	dest        *postgresDest
+	rt          rowTable
+	tempTable   string
+	after       []string
+	constraints []string
+
+	// Released once the table is swapped in or dropped.
+	conn *pgxpool.Conn
+
+	// The COPY the rows stream into, until it's ended.
+	pw   *io.PipeWriter
+	w    *bufio.Writer
+	done chan error
+
+	line []byte
+
+	// Set once a zero date has been written as NULL.
+	warned bool
+}
+
+func (t *postgresTable) write(row reflect.Value) error {
+	t.line = t.line[:0]
+	for i, c := range t.rt.columns {
+		if i > 0 {
+			t.line = append(t.line, '\t')
+		}
+		var zero bool
+		t.line, zero = appendCopyValue(t.line, c, row.Field(i))
+		if zero && !t.warned {
+			t.warned = true
+			slog.Warn("writing zero dates as NULL in postgres", "tableName", t.rt.name, "column", c.name)
+		}
+	}
+	t.line = append(t.line, '\n')
+	if _, err := t.w.Write(t.line); err != nil {
+		return errors.Wrapf(t.endCopy(err), "copy into postgres table %q", t.tempTable)
+	}
+	return nil
+}
+
+// endCopy ends the COPY, cancelling it with err if there is one, and
+// returns the COPY's own error.
+func (t *postgresTable) endCopy(err error) error {
+	if t.done == nil {
+		return nil
+	}
+	if err == nil {
+		err = t.w.Flush()
+	}
+	if err != nil {
+		t.pw.CloseWithError(err)
+	} else {
+		t.pw.Close()
+	}
+	copyErr := <-t.done
+	t.done = nil
+	return copyErr
+}
+
+// appendCopyValue appends a field of the row struct in COPY's text format,
+// reporting whether it was a zero date, which Postgres has no value for and
+// is written as NULL.
+func appendCopyValue(b []byte, c rowColumn, v reflect.Value) ([]byte, bool) {
+	if v.IsNil() {
+		return append(b, `\N`...), false
+	}
+	switch {
+	case c.binary():
+		b = append(b, `\\x`...)
+		return hex.AppendEncode(b, v.Elem().Bytes()), false
+	case c.dataType == "bit":
+		bits := ""
+		for _, x := range v.Elem().Bytes() {
+			bits += fmt.Sprintf("%08b", x)
+		}
+		n := len(bits)
+		if m := postgresLengthRegexp.FindString(c.columnType); m != "" {
+			n, _ = strconv.Atoi(m[1 : len(m)-1])
+		}
+		if len(bits) < n {
+			bits = strings.Repeat("0", n-len(bits)) + bits
+		}
+		return append(b, bits[len(bits)-n:]...), false
+	}
+
+	s, ok := fieldText(c, v, "")
+	switch {
+	case !ok:
+		return append(b, `\N`...), false
+	case isTemporalDate(c.dataType) && strings.HasPrefix(s, "0000-00-00"):
+		return append(b, `\N`...), true
+	}
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			b = append(b, `\\`...)
+		case '\n':
+			b = append(b, `\n`...)
+		case '\r':
+			b = append(b, `\r`...)
+		case '\t':
+			b = append(b, `\t`...)
+		default:
+			b = append(b, s[i])
+		}
+	}
+	return b, false
+}
+
+// isTemporalDate reports whether values of dataType have a date part.
+func isTemporalDate(dataType string) bool {
+	return dataType == "date" || dataType == "datetime" || dataType == "timestamp"
+}
+
+// commit swaps the temp table in for the real one and adds its keys,
+// indexes and checks, all in one transaction. Other tables' foreign keys on
+// the real one would keep it from being dropped, so they're dropped with
+// it and added back on the new one, unchecked until finish validates them.
+func (t *postgresTable) commit() error {
+	if err := t.endCopy(nil); err != nil {
+		return errors.Wrapf(err, "copy into postgres table %q", t.tempTable)
+	}
+	ctx := context.Background()
+	tx, err := t.conn.Begin(ctx)
+	if err != nil {
+		return errors.Wrapf(err, "begin postgres transaction for %q", t.rt.name)
+	}
+	defer tx.Rollback(ctx)
+
+	table := pgIdent(t.rt.name)
+	refs, err := postgresReferences(ctx, tx, table)
+	if err != nil {
+		return errors.Wrapf(err, "select foreign keys on postgres table %q", t.rt.name)
+	}
+	var stmts, validate []string
+	for _, r := range refs {
+		stmts = append(stmts, "alter table "+r.table+" drop constraint "+pgIdent(r.name))
+	}
+	stmts = append(stmts,
+		"drop table if exists "+table,
+		"alter table "+pgIdent(t.tempTable)+" rename to "+table,
+	)
+	stmts = append(stmts, t.after...)
+	for _, r := range refs {
+		stmts = append(stmts, "alter table "+r.table+" add constraint "+pgIdent(r.name)+" "+strings.TrimSuffix(r.def, " NOT VALID")+" not valid")
+		validate = append(validate, "alter table "+r.table+" validate constraint "+pgIdent(r.name))
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(ctx, stmt); err != nil {
+			return errors.Wrapf(err, "swap in postgres table %q", t.rt.name)
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return errors.Wrapf(err, "swap in postgres table %q", t.rt.name)
+	}
+	t.conn.Release()
+	t.conn = nil
+
+	t.dest.mu.Lock()
+	t.dest.pending = append(t.dest.pending, t.constraints...)
+	t.dest.pending = append(t.dest.pending, validate...)
+	t.dest.mu.Unlock()
+	return nil
+}
+
+// postgresReference is another table's foreign key on a table.
+type postgresReference struct {
+	// Quoted, and qualified when it's outside the search path.
+	table string
+	name  string
+	def   string
+}
+
+func postgresReferences(ctx context.Context, tx pgx.Tx, table string) ([]postgresReference, error) {
+	rows, err := tx.Query(ctx, "select conrelid::regclass::text,conname,pg_get_constraintdef(oid)"+
+		"from pg_constraint "+
+		"where contype='f'and confrelid=to_regclass($1)and conrelid<>confrelid", table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var refs []postgresReference
+	for rows.Next() {
+		var r postgresReference
+		if err := rows.Scan(&r.table, &r.name, &r.def); err != nil {
+			return nil, err
+		}
+		refs = append(refs, r)
+	}
+	return refs, rows.Err()
+}
+
+// finish adds the foreign keys and checks of the tables swapped in, and
+// validates the keys other tables had on them. Like a database
+// destination's constraints, one that doesn't hold is skipped with a
+// warning.
+func (d *postgresDest) finish() {
+	d.mu.Lock()
+	stmts := d.pending
+	d.pending = nil
+	d.mu.Unlock()
+
+	ctx := context.Background()
+	for _, stmt := range stmts {
+		if _, err := d.pool.Exec(ctx, stmt); err != nil {
+			slog.Warn("failed to add postgres constraint", "error", err, "statement", stmt)
+		}
+	}
+}
+
+func (t *postgresTable) abort() error {
+	t.endCopy(errors.New("table aborted"))
+	if t.conn == nil {
+		return nil
+	}
+	defer func() {
+		t.conn.Release()
+		t.conn = nil
+	}()
+	_, err := t.conn.Exec(context.Background(), "drop table if exists "+pgIdent(t.tempTable))
+	return errors.Wrapf(err, "drop postgres temp table %q", t.tempTable)
+}
+
+// pgIdent quotes a Postgres identifier.
+func pgIdent(name string) string {
+	return pgx.Identifier{name}.Sanitize()
+}
+
+// pgLiteral quotes a Postgres string.
+func pgLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// postgresTableSchema is a MySQL table translated for Postgres.
+type postgresTableSchema struct {
+	// The column definitions, in parentheses.
+	columns string
+
+	// The statements that add the table's keys, identity, indexes and
+	// checks, once it has its name.
+	after []string
+
+	// The statements that add its foreign keys and CHECK constraints, once
+	// every table is in.
+	constraints []string
+
+	// What couldn't be carried over.
+	warnings []string
+}
+
+var (
+	postgresLengthRegexp     = regexp.MustCompile(`\([0-9]+(,[0-9]+)?\)`)
+	postgresForeignKeyRegexp = regexp.MustCompile("^CONSTRAINT (`(?:[^`]|``)+`) FOREIGN KEY \\((.+?)\\) REFERENCES (`(?:[^`]|``)+`) \\((.+?)\\)((?: ON (?:DELETE|UPDATE) (?:CASCADE|SET NULL|SET DEFAULT|RESTRICT|NO ACTION))*)$")
+	postgresCheckRegexp      = regexp.MustCompile("^CONSTRAINT (`(?:[^`]|``)+`) CHECK (\\(.*\\))$")
+)
+
+// postgresSchema translates the definitions of a SHOW CREATE TABLE into
+// Postgres': unsigned integers widen to the next type that holds them,
+// AUTO_INCREMENT becomes an identity continuing from the loaded rows, enum
+// and set become text checked against their values, json becomes jsonb,
+// and keys become the primary key and indexes. Foreign keys and checks are
+// carried over as constraints. Keys on other schemas, checks Postgres can't
+// read, full text and spatial keys, key prefixes and expressions, generated
+// columns, and defaults Postgres can't read are dropped with a warning.
+func postgresSchema(rt rowTable) postgresTableSchema {
+	var s postgresTableSchema
+	table := pgIdent(rt.name)
+	columns := make(map[string]rowColumn, len(rt.columns))
+	for _, c := range rt.columns {
+		columns[c.name] = c
+	}
+
+	defs := make(map[string]string, len(rt.columns))
+	var primaryKey, identity, indexes []string
+	for _, line := range strings.Split(rt.create, "\n") {
+		def, ok := strings.CutPrefix(line, "  ")
+		if !ok {
+			continue
+		}
+		def = strings.TrimSuffix(def, ",")
+
+		switch {
+		case strings.HasPrefix(def, "`"):
+			name, n, ok := parseIdentifier(def)
+			if !ok {
+				continue
+			}
+			c, ok := columns[name]
+			if !ok {
+				if strings.Contains(def, " GENERATED ALWAYS ") {
+					s.warnings = append(s.warnings, "generated column "+name)
+				}
+				continue
+			}
+			autoIncrement := strings.Contains(def[n:], " AUTO_INCREMENT")
+			if autoIncrement {
+				identity = append(identity, name)
+			}
+			defs[name] = postgresColumn(c, def[n:], autoIncrement, &s.warnings)
+
+		case strings.HasPrefix(def, "PRIMARY KEY "):
+			m := createPrimaryKeyRegexp.FindStringSubmatch(def)
+			parts, ok := parseKeyParts(m, 1, columns, false)
+			if !ok {
+				s.warnings = append(s.warnings, "primary key "+def[len("PRIMARY KEY "):])
+				continue
+			}
+			for _, p := range parts {
+				// Postgres keys have no order.
+				primaryKey = append(primaryKey, pgIdent(p.name))
+			}
+
+		case strings.HasPrefix(def, "KEY "), strings.HasPrefix(def, "UNIQUE KEY "):
+			m := createIndexRegexp.FindStringSubmatch(def)
+			if m == nil {
+				s.warnings = append(s.warnings, def)
+				continue
+			}
+			unique := m[1] != ""
+			parts, ok := parseKeyParts(m, 3, columns, true)
+			if !ok {
+				s.warnings = append(s.warnings, "index "+m[2])
+				continue
+			}
+			if unique && strings.Contains(m[3], "`(") {
+				// Unique on a prefix is stricter on the whole column.
+				s.warnings = append(s.warnings, "uniqueness of index "+m[2]+", which is on column prefixes")
+				unique = false
+			}
+			name, _, _ := parseIdentifier(m[2])
+			list := make([]string, len(parts))
+			for i, p := range parts {
+				list[i] = pgIdent(p.name)
+				if p.desc {
+					list[i] += " desc"
+				}
+			}
+			stmt := "create index " + pgIdent(rt.name+"_"+name) + " on " + table + "(" + strings.Join(list, ",") + ")"
+			if unique {
+				stmt = "create unique" + stmt[len("create"):]
+			}
+			indexes = append(indexes, stmt)
+
+		case strings.HasPrefix(def, "CONSTRAINT "):
+			stmt, ok := postgresConstraint(table, def, columns)
+			if !ok {
+				s.warnings = append(s.warnings, def)
+				continue
+			}
+			s.constraints = append(s.constraints, stmt)
+
+		default:
+			// FULLTEXT KEY and SPATIAL KEY.
+			s.warnings = append(s.warnings, def)
+		}
+	}
+
+	var checks []string
+	var b strings.Builder
+	b.WriteByte('(')
+	for i, c := range rt.columns {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		def, ok := defs[c.name]
+		if !ok {
+			def = postgresColumn(c, "", false, &s.warnings)
+		}
+		b.WriteString(pgIdent(c.name) + " " + def)
+
+		if c.dataType != "enum" && c.dataType != "set" {
+			continue
+		}
+		values := c.columnType[len(c.dataType)+1 : len(c.columnType)-1]
+		if strings.Contains(values, `\`) {
+			s.warnings = append(s.warnings, "check of column "+c.name+", whose values have backslashes")
+			continue
+		}
+		if c.dataType == "enum" {
+			// MySQL writes '' for a value that isn't in the list.
+			checks = append(checks, "alter table "+table+" add check("+pgIdent(c.name)+" in('',"+values+"))")
+		} else {
+			checks = append(checks, "alter table "+table+" add check(string_to_array("+pgIdent(c.name)+",',')<@array["+values+"])")
+		}
+	}
+	b.WriteByte(')')
+	s.columns = b.String()
+
+	if len(primaryKey) != 0 {
+		s.after = append(s.after, "alter table "+table+" add primary key("+strings.Join(primaryKey, ",")+")")
+	}
+	for _, name := range identity {
+		// Continuing from the highest id loaded.
+		s.after = append(s.after,
+			"alter table "+table+" alter column "+pgIdent(name)+" add generated by default as identity",
+			"select setval(pg_get_serial_sequence("+pgLiteral(table)+","+pgLiteral(name)+"),coalesce(max("+pgIdent(name)+"),0)+1,false)from "+table,
+		)
+	}
+	s.after = append(s.after, indexes...)
+	s.after = append(s.after, checks...)
+	return s
+}
+
+// postgresConstraint translates a foreign key or check, reporting false for
+// one it can't.
+func postgresConstraint(table, def string, columns map[string]rowColumn) (string, bool) {
+	if m := postgresForeignKeyRegexp.FindStringSubmatch(def); m != nil {
+		name, _, _ := parseIdentifier(m[1])
+		refTable, _, _ := parseIdentifier(m[3])
+		cols, ok := identifierList(m[2])
+		if !ok {
+			return "", false
+		}
+		for _, c := range cols {
+			if _, ok := columns[c]; !ok {
+				return "", false
+			}
+		}
+		refCols, ok := identifierList(m[4])
+		if !ok || len(refCols) != len(cols) {
+			return "", false
+		}
+		for i := range cols {
+			cols[i] = pgIdent(cols[i])
+			refCols[i] = pgIdent(refCols[i])
+		}
+		return "alter table " + table + " add constraint " + pgIdent(name) +
+			" foreign key(" + strings.Join(cols, ",") + ")references " + pgIdent(refTable) +
+			"(" + strings.Join(refCols, ",") + ")" + strings.ToLower(m[5]), true
+	}
+	if m := postgresCheckRegexp.FindStringSubmatch(def); m != nil {
+		name, _, _ := parseIdentifier(m[1])
+		expr, ok := postgresExpression(m[2])
+		if !ok {
+			return "", false
+		}
+		return "alter table " + table + " add constraint " + pgIdent(name) + " check" + expr, true
+	}
+	return "", false
+}
+
+// identifierList reads a comma-separated list of quoted identifiers.
+func identifierList(s string) ([]string, bool) {
+	var names []string
+	for s != "" {
+		name, n, ok := parseIdentifier(s)
+		if !ok || !strings.HasPrefix(s, "`") {
+			return nil, false
+		}
+		names = append(names, name)
+		s = s[n:]
+		if s != "" {
+			r, ok := strings.CutPrefix(s, ",")
+			if !ok {
+				return nil, false
+			}
+			s = r
+		}
+	}
+	return names, len(names) != 0
+}
+
+// postgresExpression rewrites a MySQL expression's quoted identifiers and
+// strings for Postgres, dropping charset introducers like _utf8mb4. It
+// reports false for strings with backslash escapes or in double quotes,
+// which read differently there.
+func postgresExpression(expr string) (string, bool) {
+	var b strings.Builder
+	for i := 0; i < len(expr); i++ {
+		switch c := expr[i]; {
+		case c == '`':
+			name, n, ok := parseIdentifier(expr[i:])
+			if !ok {
+				return "", false
+			}
+			b.WriteString(pgIdent(name))
+			i += n - 1
+		case c == '\'':
+			j := i + 1
+			for ; j < len(expr); j++ {
+				if expr[j] == '\\' {
+					return "", false
+				}
+				if expr[j] == '\'' {
+					if j+1 < len(expr) && expr[j+1] == '\'' {
+						j++
+						continue
+					}
+					break
+				}
+			}
+			if j == len(expr) {
+				return "", false
+			}
+			b.WriteString(expr[i : j+1])
+			i = j
+		case c == '"':
+			return "", false
+		case c == '_' && (i == 0 || !isIdentByte(expr[i-1])):
+			j := i + 1
+			for j < len(expr) && isIdentByte(expr[j]) {
+				j++
+			}
+			if j < len(expr) && expr[j] == '\'' {
+				// A charset introducer.
+				i = j - 1
+				continue
+			}
+			b.WriteString(expr[i:j])
+			i = j - 1
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String(), true
+}
+
+// postgresColumn translates the part of a column's definition after its
+// name.
+func postgresColumn(c rowColumn, def string, autoIncrement bool, warnings *[]string) string {
+	out := postgresType(c, autoIncrement)
+	notNull := !c.nullable
+
+	if m := createDefaultRegexp.FindStringSubmatch(def); m != nil {
+		v := m[1]
+		switch {
+		case v == "NULL":
+		case strings.HasPrefix(v, "'0000-00-00"):
+			// Zero dates load as NULL, which the column has to take.
+			notNull = false
+		case strings.HasPrefix(v, "CURRENT_TIMESTAMP"):
+			if c.dataType == "datetime" {
+				out += " default localtimestamp"
+			} else {
+				out += " default current_timestamp"
+			}
+		case strings.HasPrefix(v, "'") && !strings.Contains(v, `\`),
+			createNumberRegexp.MatchString(v):
+			out += " default " + v
+		case strings.HasPrefix(v, "0x") && c.binary():
+			out += ` default '\x` + v[2:] + "'"
+		case strings.HasPrefix(v, "b'") && c.dataType == "bit":
+			bits := strings.Trim(v[1:], "'")
+			if m := postgresLengthRegexp.FindString(c.columnType); m != "" {
+				if n, _ := strconv.Atoi(m[1 : len(m)-1]); len(bits) < n {
+					bits = strings.Repeat("0", n-len(bits)) + bits
+				}
+			}
+			out += " default B'" + bits + "'"
+		default:
+			*warnings = append(*warnings, "default "+v+" of column "+c.name)
+		}
+	}
+	if strings.Contains(def, " ON UPDATE ") {
+		*warnings = append(*warnings, "on update of column "+c.name)
+	}
+	if notNull {
+		out += " not null"
+	}
+	return out
+}
+
+// postgresType is the Postgres type that holds a column's values. Unsigned
+// integers widen, except an AUTO_INCREMENT bigint, which stays a bigint to
+// be an identity.
+func postgresType(c rowColumn, autoIncrement bool) string {
+	unsigned := strings.HasSuffix(c.columnType, " unsigned")
+	length := postgresLengthRegexp.FindString(c.columnType)
+	switch c.dataType {
+	case "tinyint", "year":
+		return "smallint"
+	case "smallint":
+		if unsigned {
+			return "integer"
+		}
+		return "smallint"
+	case "mediumint":
+		return "integer"
+	case "int":
+		if unsigned {
+			return "bigint"
+		}
+		return "integer"
+	case "bigint":
+		if unsigned && !autoIncrement {
+			return "numeric(20)"
+		}
+		return "bigint"
+	case "decimal":
+		return "numeric" + length
+	case "float":
+		return "real"
+	case "double":
+		return "double precision"
+	case "bit":
+		return "bit" + length
+	case "date":
+		return "date"
+	case "datetime":
+		return "timestamp" + length
+	case "timestamp":
+		return "timestamptz" + length
+	case "time":
+		// Negative and over 24 hour values don't fit a time.
+		return "interval"
+	case "char", "varchar":
+		return c.dataType + length
+	case "json":
+		return "jsonb"
+	case "uuid":
+		return "uuid"
+	case "inet4", "inet6":
+		return "inet"
+	}
+	if c.binary() {
+		return "bytea"
+	}
+	return "text"
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+
+	mysql "github.com/StirlingMarketingGroup/cool-mysql"
+)
+
+func TestPostgresSchema(t *testing.T) {
+	s := postgresSchema(rowTable{name: "items", columns: testSQLiteColumns, create: testSQLiteCreate})
+
+	want := `("ID" bigint not null,` +
+		`"Name" varchar(50) default 'it''s' not null,` +
+		`"Price" numeric(10,2) default '0.00',` +
+		`"Photo" bytea,` +
+		`"Flags" bit(3) default B'101',` +
+		`"Updated" timestamptz default current_timestamp,` +
+		`"Code" varchar(10))`
+	if s.columns != want {
+		t.Errorf("columns =\n%s\nwant\n%s", s.columns, want)
+	}
+
+	wantAfter := []string{
+		`alter table "items" add primary key("ID")`,
+		`alter table "items" alter column "ID" add generated by default as identity`,
+		`select setval(pg_get_serial_sequence('"items"','ID'),coalesce(max("ID"),0)+1,false)from "items"`,
+		`create unique index "items_Name" on "items"("Name")`,
+		`create index "items_Code" on "items"("Code")`,
+		`create index "items_PriceName" on "items"("Price" desc,"Name")`,
+	}
+	if !slices.Equal(s.after, wantAfter) {
+		t.Errorf("after =\n%q\nwant\n%q", s.after, wantAfter)
+	}
+
+	wantWarnings := []string{
+		"on update of column Updated",
+		"default (uuid()) of column Code",
+		"generated column Upper",
+		"uniqueness of index `Code`, which is on column prefixes",
+		"index `Expr`",
+		"FULLTEXT KEY `NameText` (`Name`)",
+	}
+	if !slices.Equal(s.warnings, wantWarnings) {
+		t.Errorf("warnings =\n%q\nwant\n%q", s.warnings, wantWarnings)
+	}
+	wantConstraints := []string{`alter table "items" add constraint "items_ibfk_1" foreign key("ID")references "other"("ID")`}
+	if !slices.Equal(s.constraints, wantConstraints) {
+		t.Errorf("constraints =\n%q\nwant\n%q", s.constraints, wantConstraints)
+	}
+
+	s = postgresSchema(rowTable{
+		name: "kinds",
+		columns: []rowColumn{
+			{"ID", "bigint", "bigint unsigned", false},
+			{"Size", "enum", "enum('s','m','it''s')", false},
+			{"Tags", "set", "set('a','b')", true},
+			{"Total", "bigint", "bigint unsigned", false},
+			{"Made", "datetime", "datetime(6)", false},
+			{"Attrs", "json", "json", true},
+			{"Took", "time", "time", true},
+			{"Hash", "binary", "binary(4)", false},
+		},
+		create: "CREATE TABLE `kinds` (\n" +
+			"  `ID` bigint unsigned NOT NULL AUTO_INCREMENT,\n" +
+			"  `Size` enum('s','m','it''s') NOT NULL DEFAULT 's',\n" +
+			"  `Tags` set('a','b') DEFAULT NULL,\n" +
+			"  `Total` bigint unsigned NOT NULL,\n" +
+			"  `Made` datetime(6) NOT NULL DEFAULT '0000-00-00 00:00:00.000000',\n" +
+			"  `Attrs` json DEFAULT NULL,\n" +
+			"  `Took` time DEFAULT NULL,\n" +
+			"  `Hash` binary(4) NOT NULL DEFAULT 0x00000000,\n" +
+			"  UNIQUE KEY `ID` (`ID`)\n" +
+			")",
+	})
+	want = `("ID" bigint not null,"Size" text default 's' not null,"Tags" text,"Total" numeric(20) not null,` +
+		`"Made" timestamp(6),"Attrs" jsonb,"Took" interval,"Hash" bytea default '\x00000000' not null)`
+	if s.columns != want {
+		t.Errorf("columns =\n%s\nwant\n%s", s.columns, want)
+	}
+	wantAfter = []string{
+		`alter table "kinds" alter column "ID" add generated by default as identity`,
+		`select setval(pg_get_serial_sequence('"kinds"','ID'),coalesce(max("ID"),0)+1,false)from "kinds"`,
+		`create unique index "kinds_ID" on "kinds"("ID")`,
+		`alter table "kinds" add check("Size" in('','s','m','it''s'))`,
+		`alter table "kinds" add check(string_to_array("Tags",',')<@array['a','b'])`,
+	}
+	if !slices.Equal(s.after, wantAfter) {
+		t.Errorf("after =\n%q\nwant\n%q", s.after, wantAfter)
+	}
+	if len(s.warnings) != 0 {
+		t.Errorf("warnings = %q, want none", s.warnings)
+	}
+}
+
+func TestPostgresConstraint(t *testing.T) {
+	columns := map[string]rowColumn{"ID": {}, "ShopID": {}, "UserID": {}, "Qty": {}, "Kind": {}}
+	tests := []struct {
+		def  string
+		want string
+	}{
+		{
+			"CONSTRAINT `orders_shop` FOREIGN KEY (`ShopID`,`UserID`) REFERENCES `shop_users` (`ShopID`,`UserID`) ON DELETE CASCADE ON UPDATE SET NULL",
+			`alter table "orders" add constraint "orders_shop" foreign key("ShopID","UserID")references "shop_users"("ShopID","UserID") on delete cascade on update set null`,
+		},
+		{
+			"CONSTRAINT `orders_chk_1` CHECK (((`Qty` > 0) and (`Kind` in (_utf8mb4'a',_utf8mb4'it''s'))))",
+			`alter table "orders" add constraint "orders_chk_1" check((("Qty" > 0) and ("Kind" in ('a','it''s'))))`,
+		},
+		// Another schema's table, a column that isn't copied, a string
+		// with an escape, and a check MySQL doesn't enforce.
+		{"CONSTRAINT `fk_other` FOREIGN KEY (`UserID`) REFERENCES `accounts`.`users` (`ID`)", ""},
+		{"CONSTRAINT `fk_gone` FOREIGN KEY (`GoneID`) REFERENCES `gone` (`ID`)", ""},
+		{"CONSTRAINT `chk_esc` CHECK ((`Kind` <> _utf8mb4'a\\'b'))", ""},
+		{"CONSTRAINT `chk_off` CHECK ((`Qty` > 0)) /*!80016 NOT ENFORCED */", ""},
+	}
+	for _, tt := range tests {
+		got, ok := postgresConstraint(`"orders"`, tt.def, columns)
+		if ok != (tt.want != "") || got != tt.want {
+			t.Errorf("postgresConstraint(%q) =\n%s, %v\nwant\n%s", tt.def, got, ok, tt.want)
+		}
+	}
+}
+
+func TestAppendCopyValue(t *testing.T) {
+	for _, tt := range []struct {
+		column rowColumn
+		value  any
+		want   string
+		zero   bool
+	}{
+		{rowColumn{"a", "int", "int", true}, nil, `\N`, false},
+		{rowColumn{"a", "bigint", "bigint unsigned", false}, uint64(18446744073709551615), "18446744073709551615", false},
+		{rowColumn{"a", "varchar", "varchar(10)", false}, "a\tb\nc\\d\re", `a\tb\nc\\d\re`, false},
+		{rowColumn{"a", "blob", "blob", false}, []byte{0xff, 0x00}, `\\xff00`, false},
+		{rowColumn{"a", "blob", "blob", false}, []byte{}, `\\x`, false},
+		{rowColumn{"a", "bit", "bit(3)", false}, []byte{0x05}, "101", false},
+		{rowColumn{"a", "bit", "bit(10)", false}, []byte{0x01, 0x02}, "0100000010", false},
+		{rowColumn{"a", "decimal", "decimal(30,10)", false}, mysql.Raw("-1.5000000000"), "-1.5000000000", false},
+		{rowColumn{"a", "json", "json", false}, json.RawMessage(`{"a":"\t"}`), `{"a":"\\t"}`, false},
+		{rowColumn{"a", "date", "date", false}, "0000-00-00", `\N`, true},
+		{rowColumn{"a", "datetime", "datetime(6)", false}, "2026-10-17 01:02:03.000004", "2026-10-17 01:02:03.000004", false},
+		{rowColumn{"a", "time", "time", false}, "-838:59:59", "-838:59:59", false},
+	} {
+		row := testRows(t, []rowColumn{tt.column}, []any{tt.value})[0]
+		got, zero := appendCopyValue(nil, tt.column, row.Field(0))
+		if string(got) != tt.want || zero != tt.zero {
+			t.Errorf("appendCopyValue(%s %v) = %s, %v, want %s, %v", tt.column.columnType, tt.value, got, zero, tt.want, tt.zero)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	mysql "github.com/StirlingMarketingGroup/cool-mysql"
+	"github.com/pkg/errors"
+)
+
+// previousTable names the copy -keep-previous keeps of a table a swap
+// replaced.
+func previousTable(prefix, table string) string {
+	return prefix + "prev_" + table
+}
+
+// previousCopies records when each table's previous copy was kept on a
+// destination, for -keep-previous-for to purge them by.
+type previousCopies struct {
+	Destination string               `json:"destination"`
+	Tables      map[string]time.Time `json:"tables"`
+}
+
+func previousDir() string {
+	return filepath.Join(confDir, "swoof", "previous")
+}
+
+func previousPath(dest string) string {
+	return stateFilePath(previousDir(), "previous", dest)
+}
+
+// loadPreviousCopies returns an empty record for a destination nothing was
+// kept on yet.
+func loadPreviousCopies(path, dest string) (*previousCopies, error) {
+	p := &previousCopies{Destination: dest, Tables: make(map[string]time.Time)}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return p, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "read previous copies %q", path)
+	}
+	if err := json.Unmarshal(b, p); err != nil {
+		return nil, errors.Wrapf(err, "parse previous copies %q", path)
+	}
+	if p.Tables == nil {
+		p.Tables = make(map[string]time.Time)
+	}
+	return p, nil
+}
+
+func (p *previousCopies) save(path string) error {
+	return saveStateFile(path, p)
+}
+
+// expired returns the tables whose previous copy was kept longer than
+// retention ago.
+func (p *previousCopies) expired(retention time.Duration, now time.Time) []string {
+	var tables []string
+	for t, kept := range p.Tables {
+		if now.Sub(kept) > retention {
+			tables = append(tables, t)
+		}
+	}
+	slices.Sort(tables)
+	return tables
+}
+
+// recordPrevious notes that table's previous copy on dest was kept now, or
+// that it has none.
+func recordPrevious(dest, table string, kept bool) error {
+	path := previousPath(dest)
+	p, err := loadPreviousCopies(path, dest)
+	if err != nil {
+		return err
+	}
+	if kept {
+		p.Tables[table] = time.Now()
+	} else {
+		delete(p.Tables, table)
+	}
+	return p.save(path)
+}
+
+// purgePrevious drops the previous copies on a destination that are older
+// than retention.
+func purgePrevious(db *mysql.Database, dest, prefix string, retention time.Duration) error {
+	path := previousPath(dest)
+	p, err := loadPreviousCopies(path, dest)
+	if err != nil {
+		return err
+	}
+	expired := p.expired(retention, time.Now())
+	for _, t := range expired {
+		prev := previousTable(prefix, t)
+		slog.Info("dropping expired previous table", "table", prev, "kept", p.Tables[t])
+		if err := db.Exec("drop table if exists`" + prev + "`"); err != nil {
+			return errors.Wrapf(err, "drop previous table %q", prev)
+		}
+		delete(p.Tables, t)
+	}
+	if len(expired) == 0 {
+		return nil
+	}
+	return p.save(path)
+}
+
+// parseRetention reads -keep-previous-for: a duration like 72h, or a whole
+// number of days like 7d.
+func parseRetention(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, errors.Errorf("invalid retention %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, errors.Errorf("invalid retention %q", s)
+	}
+	return d, nil
+}
+
+func tableExists(db *mysql.Database, table string) (bool, error) {
+	return db.Exists("select 1 "+
+		"from`INFORMATION_SCHEMA`.`TABLES`"+
+		"where`TABLE_SCHEMA`=database()"+
+		"and`TABLE_NAME`=@@Table", 0, mysql.Params{"Table": table})
+}
+
+// keepPrevious moves table aside as prev, replacing an older previous copy,
+// so a temp table can be renamed in its place. Trigger and constraint
+// names are unique across a schema, so the kept copy gives up its own for
+// the new table to take. It reports false when there's no table to keep.
+func keepPrevious(db *mysql.Database, table, prev string) (bool, error) {
+	if err := db.Exec("drop table if exists`" + prev + "`"); err != nil {
+		return false, errors.Wrapf(err, "drop previous table %q", prev)
+	}
+	exists, err := tableExists(db, table)
+	if err != nil {
+		return false, errors.Wrapf(err, "check table %q", table)
+	}
+	if !exists {
+		return false, nil
+	}
+	if _, err := dropTriggers(db, table); err != nil {
+		return false, err
+	}
+	if err := dropForeignKeys(db, table); err != nil {
+		return false, err
+	}
+	if err := db.Exec("alter table`" + table + "`rename`" + prev + "`"); err != nil {
+		return false, errors.Wrapf(err, "rename table %q to %q", table, prev)
+	}
+	return true, nil
+}
+
+// dropTriggers drops a table's triggers, returning the statements that
+// create them again.
+func dropTriggers(db *mysql.Database, table string) ([]string, error) {
+	var triggers []struct {
+		Trigger string
+	}
+	if err := db.Select(&triggers, "show triggers where`table`=@@Table", 0, mysql.Params{"Table": table}); err != nil {
+		return nil, errors.Wrapf(err, "select triggers for table %q", table)
+	}
+	var creates []string
+	for _, r := range triggers {
+		var trigger struct {
+			CreateMySQL string `mysql:"SQL Original Statement"`
+		}
+		if err := db.Select(&trigger, "show create trigger`"+r.Trigger+"`", 0); err != nil {
+			return nil, errors.Wrapf(err, "select trigger creation syntax for %q on table %q", r.Trigger, table)
+		}
+		creates = append(creates, definerRegexp.ReplaceAllString(trigger.CreateMySQL, ""))
+		if err := db.Exec("drop trigger`" + r.Trigger + "`"); err != nil {
+			return nil, errors.Wrapf(err, "drop trigger %q on table %q", r.Trigger, table)
+		}
+	}
+	return creates, nil
+}
+
+// dropForeignKeys drops the foreign keys a table has on others.
+func dropForeignKeys(db *mysql.Database, table string) error {
+	var keys []struct {
+		Name string `mysql:"CONSTRAINT_NAME"`
+	}
+	if err := db.Select(&keys, "select`CONSTRAINT_NAME`"+
+		"from`INFORMATION_SCHEMA`.`TABLE_CONSTRAINTS`"+
+		"where`TABLE_SCHEMA`=database()"+
+		"and`TABLE_NAME`=@@Table"+
+		"and`CONSTRAINT_TYPE`='FOREIGN KEY'", 0, mysql.Params{"Table": table}); err != nil {
+		return errors.Wrapf(err, "select foreign keys of %q", table)
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	drops := make([]string, len(keys))
+	for i, k := range keys {
+		drops[i] = "drop foreign key`" + k.Name + "`"
+	}
+	if err := db.Exec("alter table`" + table + "`" + strings.Join(drops, ",")); err != nil {
+		return errors.Wrapf(err, "drop foreign keys of %q", table)
+	}
+	return nil
+}
+
+var constraintLineRegexp = regexp.MustCompile("^  CONSTRAINT (`(?:[^`]|``)+`) FOREIGN KEY .* REFERENCES (`(?:[^`]|``)+`) ")
+
+// repointForeignKeys moves other tables' foreign keys on from over to to.
+// Renaming a table takes the keys that reference it along, so after a
+// table is swapped for another, they'd point at the wrong one.
+func repointForeignKeys(db *mysql.Database, from, to string) error {
+	var children []struct {
+		Table string `mysql:"TABLE_NAME"`
+	}
+	if err := db.Select(&children, "select distinct`TABLE_NAME`"+
+		"from`INFORMATION_SCHEMA`.`KEY_COLUMN_USAGE`"+
+		"where`TABLE_SCHEMA`=database()"+
+		"and`REFERENCED_TABLE_SCHEMA`=database()"+
+		"and`REFERENCED_TABLE_NAME`=@@Table", 0, mysql.Params{"Table": from}); err != nil {
+		return errors.Wrapf(err, "select foreign keys on %q", from)
+	}
+	for _, c := range children {
+		var create struct {
+			CreateMySQL string `mysql:"Create Table"`
+		}
+		if err := db.Select(&create, "show create table`"+c.Table+"`", 0); err != nil {
+			return errors.Wrapf(err, "show create table %q", c.Table)
+		}
+		for _, stmt := range repointedConstraints(c.Table, create.CreateMySQL, from, to) {
+			if err := db.Exec(stmt); err != nil {
+				return errors.Wrapf(err, "move foreign keys of %q from %q to %q", c.Table, from, to)
+			}
+		}
+	}
+	return nil
+}
+
+// repointedConstraints returns the statements that re-create a table's
+// foreign keys on from as keys on to.
+func repointedConstraints(table, create, from, to string) []string {
+	var stmts []string
+	for _, line := range strings.Split(create, "\n") {
+		m := constraintLineRegexp.FindStringSubmatch(line)
+		if m == nil || m[2] != "`"+strings.ReplaceAll(from, "`", "``")+"`" {
+			continue
+		}
+		def := strings.TrimSuffix(strings.TrimSpace(line), ",")
+		def = strings.Replace(def, " REFERENCES "+m[2]+" ", " REFERENCES `"+strings.ReplaceAll(to, "`", "``")+"` ", 1)
+		stmts = append(stmts,
+			"alter table`"+table+"`drop foreign key"+m[1],
+			"alter table`"+table+"`add "+def)
+	}
+	return stmts
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParseRetention(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"7d", 7 * 24 * time.Hour, false},
+		{"72h", 72 * time.Hour, false},
+		{"90m", 90 * time.Minute, false},
+		{"0d", 0, true},
+		{"-1h", 0, true},
+		{"1.5d", 0, true},
+		{"week", 0, true},
+		{"", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseRetention(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseRetention(%q) = %v, %v, want %v, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestPreviousCopiesExpired(t *testing.T) {
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	p := &previousCopies{Tables: map[string]time.Time{
+		"users":  now.Add(-8 * 24 * time.Hour),
+		"orders": now.Add(-time.Hour),
+		"carts":  now.Add(-30 * 24 * time.Hour),
+	}}
+	if got := p.expired(7*24*time.Hour, now); !slices.Equal(got, []string{"carts", "users"}) {
+		t.Errorf("expired = %v, want [carts users]", got)
+	}
+	if got := p.expired(365*24*time.Hour, now); len(got) != 0 {
+		t.Errorf("expired = %v, want none", got)
+	}
+}
+
+func TestPreviousCopiesSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "previous.json")
+	p, err := loadPreviousCopies(path, "root@prod:3306/app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Tables) != 0 {
+		t.Fatalf("a missing file loaded %v", p.Tables)
+	}
+
+	kept := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	p.Tables["users"] = kept
+	if err := p.save(path); err != nil {
+		t.Fatal(err)
+	}
+	got, err := loadPreviousCopies(path, "root@prod:3306/app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Tables["users"].Equal(kept) {
+		t.Errorf("loaded %v, want users kept at %v", got.Tables, kept)
+	}
+}
+
+func TestRepointedConstraints(t *testing.T) {
+	create := "CREATE TABLE `orders` (\n" +
+		"  `ID` int NOT NULL,\n" +
+		"  `UserID` int NOT NULL,\n" +
+		"  `ShopID` int NOT NULL,\n" +
+		"  PRIMARY KEY (`ID`),\n" +
+		"  CONSTRAINT `orders_user` FOREIGN KEY (`UserID`) REFERENCES `_swoof_prev_users` (`ID`) ON DELETE CASCADE,\n" +
+		"  CONSTRAINT `orders_shop` FOREIGN KEY (`ShopID`) REFERENCES `shops` (`ID`)\n" +
+		") ENGINE=InnoDB"
+	want := []string{
+		"alter table`orders`drop foreign key`orders_user`",
+		"alter table`orders`add CONSTRAINT `orders_user` FOREIGN KEY (`UserID`) REFERENCES `users` (`ID`) ON DELETE CASCADE",
+	}
+	if got := repointedConstraints("orders", create, "_swoof_prev_users", "users"); !slices.Equal(got, want) {
+		t.Errorf("repointedConstraints = %q, want %q", got, want)
+	}
+	if got := repointedConstraints("orders", create, "carts", "users"); len(got) != 0 {
+		t.Errorf("repointedConstraints = %q, want none for a table nothing references", got)
+	}
+}
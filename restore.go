@@ -0,0 +1,381 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// backup is a directory previously written by a `file:` destination. Every
+// statement the run executed lands in its own numbered `*.sql.gz`, grouped
+// under tables/<name>/ and funcs/, views/, procs/, so replaying a directory
+// in numeric order reproduces exactly what a live import would have done.
+type backup struct {
+	dir string
+}
+
+func openBackup(dir string) (*backup, error) {
+	info, err := os.Stat(filepath.Join(dir, "tables"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errors.Errorf("%q is not a swoof backup: no tables directory", dir)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "stat backup %q", dir)
+	}
+	if !info.IsDir() {
+		return nil, errors.Errorf("%q is not a swoof backup: tables is not a directory", dir)
+	}
+	return &backup{dir: dir}, nil
+}
+
+func (b *backup) tableDir(name string) string {
+	return filepath.Join(b.dir, "tables", name)
+}
+
+func (b *backup) tables() ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(b.dir, "tables"))
+	if err != nil {
+		return nil, errors.Wrap(err, "list backup tables")
+	}
+	var names []string
+	for _, e := range entries {
+		if e.IsDir() {
+			names = append(names, e.Name())
+		}
+	}
+	return names, nil
+}
+
+func (b *backup) tableExists(name string) (bool, error) {
+	info, err := os.Stat(b.tableDir(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return info.IsDir(), nil
+}
+
+func (b *backup) matchTables(pattern string) ([]string, error) {
+	names, err := b.tables()
+	if err != nil {
+		return nil, err
+	}
+	var matched []string
+	for _, n := range names {
+		ok, err := path.Match(pattern, n)
+		if err != nil {
+			return nil, errors.Wrapf(err, "match pattern %q", pattern)
+		}
+		if ok {
+			matched = append(matched, n)
+		}
+	}
+	return matched, nil
+}
+
+func (b *backup) tablesExcept(exclude []string) ([]string, error) {
+	names, err := b.tables()
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(names, func(n string) bool {
+		return slices.Contains(exclude, n)
+	}), nil
+}
+
+// Compressed bytes on disk stand in for data_length+index_length.
+func (b *backup) tablesBySize(names []string) ([]string, error) {
+	sizes := make(map[string]int64, len(names))
+	var ordered []string
+	for _, n := range names {
+		if _, ok := sizes[n]; ok {
+			continue
+		}
+		files, err := backupFiles(b.tableDir(n))
+		if err != nil {
+			return nil, err
+		}
+		var size int64
+		for _, f := range files {
+			info, err := os.Stat(f)
+			if err != nil {
+				return nil, errors.Wrapf(err, "stat %q", f)
+			}
+			size += info.Size()
+		}
+		sizes[n] = size
+		ordered = append(ordered, n)
+	}
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return sizes[ordered[i]] > sizes[ordered[j]]
+	})
+	return ordered, nil
+}
+
+// backupFiles returns the statement files in dir in execution order. The
+// writer zero-pads its counter, but sort numerically anyway so a backup that
+// outgrew the padding still replays in the right order.
+func backupFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "list %q", dir)
+	}
+	type numbered struct {
+		n    int64
+		name string
+	}
+	var files []numbered
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".sql.gz") {
+			continue
+		}
+		n, err := strconv.ParseInt(strings.TrimSuffix(e.Name(), ".sql.gz"), 10, 64)
+		if err != nil {
+			n = -1
+		}
+		files = append(files, numbered{n, e.Name()})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].n != files[j].n {
+			return files[i].n < files[j].n
+		}
+		return files[i].name < files[j].name
+	})
+	paths := make([]string, len(files))
+	for i, f := range files {
+		paths[i] = filepath.Join(dir, f.name)
+	}
+	return paths, nil
+}
+
+func readBackupStatement(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", errors.Wrapf(err, "open %q", file)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return "", errors.Wrapf(err, "decompress %q", file)
+	}
+	b, err := io.ReadAll(zr)
+	if err != nil {
+		return "", errors.Wrapf(err, "read %q", file)
+	}
+	return trimStatement(string(b)), nil
+}
+
+// Enough to classify a statement without inflating a multi-megabyte insert.
+const statementHeadLen = 512
+
+func readBackupStatementHead(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", errors.Wrapf(err, "open %q", file)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return "", errors.Wrapf(err, "decompress %q", file)
+	}
+	b, err := io.ReadAll(io.LimitReader(bufio.NewReader(zr), statementHeadLen))
+	if err != nil {
+		return "", errors.Wrapf(err, "read %q", file)
+	}
+	return trimStatement(string(b)), nil
+}
+
+func trimStatement(s string) string {
+	return strings.TrimSuffix(strings.TrimSpace(s), ";")
+}
+
+func isInsertStatement(s string) bool {
+	return len(s) >= 6 && strings.EqualFold(s[:6], "insert")
+}
+
+// replaySource is a source whose tables are loaded by replaying SQL
+// statements rather than by streaming rows: a `file:` backup, a `dump:`
+// file, or a `csv:` directory.
+type replaySource interface {
+	tableCatalog
+
+	planTable(table string) (tableReplay, error)
+
+	// routineFiles returns the statement files for funcs, views, or procs,
+	// or nil when the source has none.
+	routineFiles(kind string) ([]string, error)
+}
+
+// isReplaySource reports whether a source argument names a replaySource
+// rather than a database.
+func isReplaySource(dsn string) bool {
+	for _, prefix := range []string{"file:", "dump:", "csv:", "tsv:"} {
+		if strings.HasPrefix(dsn, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// replayStatement is one statement of a table's replay, read only when it
+// runs, since an extended insert can be megabytes.
+type replayStatement struct {
+	// Where the statement comes from, for errors.
+	name string
+
+	insert bool
+
+	// Tuples in an insert, or -1 when they're only known once it's read.
+	rows int64
+
+	read func() (string, error)
+}
+
+// tableReplay splits a table's statements at the drop of the real table:
+// everything before it builds the temp table, everything from it on is the
+// swap, constraints, and triggers that main defers to finalization.
+type tableReplay struct {
+	load     []replayStatement
+	finalize []replayStatement
+	inserts  int
+
+	// Set when the load phase opens by dropping the table it writes to, so a
+	// retry starts from a clean slate instead of double-inserting.
+	retryable bool
+}
+
+func backupStatement(file string, insert bool) replayStatement {
+	st := replayStatement{name: file, insert: insert, read: func() (string, error) {
+		return readBackupStatement(file)
+	}}
+	if insert {
+		st.rows = -1
+	}
+	return st
+}
+
+func (b *backup) planTable(table string) (tableReplay, error) {
+	files, err := backupFiles(b.tableDir(table))
+	if err != nil {
+		return tableReplay{}, err
+	}
+	dropReal := regexp.MustCompile("(?is)^drop\\s+table\\s+if\\s+exists\\s*`" + regexp.QuoteMeta(table) + "`$")
+
+	var plan tableReplay
+	for i, f := range files {
+		head, err := readBackupStatementHead(f)
+		if err != nil {
+			return tableReplay{}, err
+		}
+		if i == 0 {
+			plan.retryable = strings.HasPrefix(strings.ToLower(head), "drop table")
+		}
+		if dropReal.MatchString(head) {
+			for _, f := range files[i:] {
+				plan.finalize = append(plan.finalize, backupStatement(f, false))
+			}
+			break
+		}
+		insert := isInsertStatement(head)
+		if insert {
+			plan.inserts++
+		}
+		plan.load = append(plan.load, backupStatement(f, insert))
+	}
+	return plan, nil
+}
+
+// countRows sums the tuples of every insert, the replay's equivalent of
+// the count(*) a live source runs for the progress bar. A dump's or CSV
+// file's inserts are counted as it's read up front, but a backup's are only
+// counted as they load, rather than decompressing each one twice, so ok is
+// false when any insert's count isn't known yet.
+func (p tableReplay) countRows() (n int64, ok bool) {
+	for _, st := range p.load {
+		if !st.insert {
+			continue
+		}
+		if st.rows < 0 {
+			return 0, false
+		}
+		n += st.rows
+	}
+	return n, true
+}
+
+// routineFiles returns the statements for funcs, views, or procs, or nil
+// when the backup was taken without that flag.
+func (b *backup) routineFiles(kind string) ([]string, error) {
+	dir := filepath.Join(b.dir, kind)
+	if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return backupFiles(dir)
+}
+
+// countInsertRows counts the top-level value tuples of an extended insert.
+// Quoted strings and identifiers are skipped so parens or commas inside data
+// don't count; statements without a VALUES list count as zero.
+func countInsertRows(stmt string) int64 {
+	var rows int64
+	var depth int
+	var quote byte
+	inValues := false
+	for i := 0; i < len(stmt); i++ {
+		c := stmt[i]
+		if quote != 0 {
+			switch {
+			case c == '\\' && quote != '`':
+				i++
+			case c == quote:
+				// Doubled quotes are an escaped quote, not a close.
+				if i+1 < len(stmt) && stmt[i+1] == quote {
+					i++
+				} else {
+					quote = 0
+				}
+			}
+			continue
+		}
+		switch c {
+		case '\'', '"', '`':
+			quote = c
+		case '(':
+			if depth == 0 && inValues {
+				rows++
+			}
+			depth++
+		case ')':
+			depth--
+		case 'v', 'V':
+			if depth == 0 && !inValues && i+5 <= len(stmt) && strings.EqualFold(stmt[i:i+5], "value") &&
+				(i == 0 || !isIdentByte(stmt[i-1])) {
+				end := i + 5
+				if end < len(stmt) && (stmt[end] == 's' || stmt[end] == 'S') {
+					end++
+				}
+				if end == len(stmt) || !isIdentByte(stmt[end]) {
+					inValues = true
+					i = end - 1
+				}
+			}
+		}
+	}
+	return rows
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c == '$' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
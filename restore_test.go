@@ -0,0 +1,189 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func writeBackupFile(t *testing.T, dir, name, stmt string) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(filepath.Join(dir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := gzip.NewWriter(f)
+	if _, err := zw.Write([]byte(stmt + ";\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCountInsertRows(t *testing.T) {
+	tests := []struct {
+		name string
+		stmt string
+		want int64
+	}{
+		{"single row", "insert into`t`(`a`,`b`)values(1,2)", 1},
+		{"extended", "insert into`t`(`a`,`b`)values(1,2),(3,4),(5,6)", 3},
+		{"mysqldump style", "INSERT INTO `t` VALUES (1,'a'),(2,'b')", 2},
+		{"singular value keyword", "insert into t value (1)", 1},
+		{"parens in strings", "insert into t values ('(,)'),(')(')", 2},
+		{"escaped quotes", `insert into t values ('it\'s (one)'),('it''s (two)')`, 2},
+		{"nested function calls", "insert into t values (conv('ff',16,10)),(now())", 2},
+		{"column named values", "insert into t(`values`)values(1),(2)", 2},
+		{"not an insert", "drop table if exists`t`", 0},
+		{"insert select", "insert into t select * from u", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := countInsertRows(tt.stmt); got != tt.want {
+				t.Errorf("countInsertRows(%q) = %d, want %d", tt.stmt, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBackupFilesNumericOrder(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"0000000010.sql.gz", "0000000002.sql.gz", "10000000000.sql.gz", "0000000001.sql.gz"} {
+		writeBackupFile(t, dir, name, "select 1")
+	}
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := backupFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, f := range files {
+		got = append(got, filepath.Base(f))
+	}
+	want := []string{"0000000001.sql.gz", "0000000002.sql.gz", "0000000010.sql.gz", "10000000000.sql.gz"}
+	if !slices.Equal(got, want) {
+		t.Errorf("backupFiles order = %v, want %v", got, want)
+	}
+}
+
+func TestPlanTable(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "tables", "users")
+	stmts := []string{
+		"drop table if exists`_swoof_users`",
+		"CREATE TABLE `_swoof_users` (\n  `id` int NOT NULL\n)",
+		"insert into`_swoof_users`(`id`)values(1),(2)",
+		"insert into`_swoof_users`(`id`)values(3)",
+		"drop table if exists`users`",
+		"alter table`_swoof_users`rename`users`",
+	}
+	for i, s := range stmts {
+		writeBackupFile(t, dir, fmt.Sprintf("%010d.sql.gz", i+1), s)
+	}
+
+	b, err := openBackup(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := b.planTable("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.load) != 4 || len(plan.finalize) != 2 {
+		t.Fatalf("split = %d load / %d finalize, want 4 / 2", len(plan.load), len(plan.finalize))
+	}
+	if !plan.retryable {
+		t.Error("plan starting with a temp-table drop should be retryable")
+	}
+	if plan.inserts != 2 {
+		t.Errorf("inserts = %d, want 2", plan.inserts)
+	}
+	// Counting up front would mean decompressing every insert twice, so
+	// they're counted as they load.
+	if rows, ok := plan.countRows(); ok {
+		t.Errorf("countRows = %d before anything loaded, want it unknown", rows)
+	}
+	var rows int64
+	for _, st := range plan.load {
+		if !st.insert {
+			continue
+		}
+		stmt, err := st.read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows += countInsertRows(stmt)
+	}
+	if rows != 3 {
+		t.Errorf("loaded %d rows, want 3", rows)
+	}
+	stmt, err := plan.finalize[1].read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stmt != stmts[5] {
+		t.Errorf("finalize statement = %q, want %q", stmt, stmts[5])
+	}
+}
+
+func TestBackupCatalog(t *testing.T) {
+	root := t.TempDir()
+	writeBackupFile(t, filepath.Join(root, "tables", "orders"), "0000000001.sql.gz", "insert into`orders`values(1),(2),(3),(4),(5),(6),(7),(8)")
+	writeBackupFile(t, filepath.Join(root, "tables", "order_items"), "0000000001.sql.gz", "select 1")
+	writeBackupFile(t, filepath.Join(root, "tables", "users"), "0000000001.sql.gz", "select 1")
+
+	b, err := openBackup(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ok, err := b.tableExists("users")
+	if err != nil || !ok {
+		t.Errorf("tableExists(users) = %v, %v, want true", ok, err)
+	}
+	ok, err = b.tableExists("missing")
+	if err != nil || ok {
+		t.Errorf("tableExists(missing) = %v, %v, want false", ok, err)
+	}
+
+	matched, err := b.matchTables("order*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"order_items", "orders"}; !slices.Equal(matched, want) {
+		t.Errorf("matchTables = %v, want %v", matched, want)
+	}
+
+	rest, err := b.tablesExcept([]string{"users"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"order_items", "orders"}; !slices.Equal(rest, want) {
+		t.Errorf("tablesExcept = %v, want %v", rest, want)
+	}
+
+	ordered, err := b.tablesBySize([]string{"users", "orders", "users"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ordered) != 2 || ordered[0] != "orders" {
+		t.Errorf("tablesBySize = %v, want orders first and no duplicates", ordered)
+	}
+
+	if _, err := openBackup(t.TempDir()); err == nil {
+		t.Error("openBackup on a directory without tables/ should fail")
+	}
+}
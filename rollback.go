@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+
+	mysql "github.com/StirlingMarketingGroup/cool-mysql"
+	"github.com/fatih/color"
+	"github.com/pkg/errors"
+	"github.com/posener/cmd"
+)
+
+// runRollback implements `swoof rollback`, which swaps tables on a
+// destination back with the previous copies -keep-previous kept of them.
+// The copies they replace become the previous ones, so rolling back again
+// undoes it.
+func runRollback(argv []string) {
+	c := cmd.New(cmd.OptName("swoof rollback"))
+	connectionsFile := c.String("c", confDir+"/swoof/connections.yaml", "your connections file")
+	prefix := c.String("p", "_swoof_", "prefix of the temp and previous tables")
+	all := c.Bool("all", false, "rolls back every table with a previous copy, specified tables are ignored")
+	args := c.Args("dest, tables", "dest, tables, ex:\n"+
+		"swoof rollback [flags] localhost table1 table2")
+	c.ParseArgs(append([]string{"swoof rollback"}, argv...)...)
+
+	if len(*args) < 1 || len(*args) < 2 && !*all {
+		c.Usage()
+		os.Exit(2)
+	}
+
+	fatal := func(msg string, args ...any) {
+		slog.Error(msg, args...)
+		os.Exit(2)
+	}
+
+	ctx := context.Background()
+	connections, _ := getConnections(*connectionsFile)
+	dest := (*args)[0]
+	if c, ok := connections[dest]; ok && c.SourceOnly {
+		fatal("destination use is not allowed by config", "destination", dest)
+	}
+	dsn, err := ensureUTCSession(resolveDSN(connections, dest))
+	if err != nil {
+		fatal("failed to apply UTC session tz", "error", err, "destination", dest)
+	}
+	db, err := mysql.NewFromDSN(dsn, dsn)
+	if err != nil {
+		fatal("failed to connect", "error", err, "destination", dest)
+	}
+	db.DisableUnusedColumnWarnings = true
+
+	tables := (*args)[1:]
+	if *all {
+		var prevs []struct {
+			Name string `mysql:"TABLE_NAME"`
+		}
+		like := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(previousTable(*prefix, "")) + "%"
+		if err := db.Select(&prevs, "select`TABLE_NAME`"+
+			"from`INFORMATION_SCHEMA`.`TABLES`"+
+			"where`TABLE_SCHEMA`=database()"+
+			"and`TABLE_NAME`like @@Like "+
+			"order by`TABLE_NAME`", 0, mysql.Params{"Like": like}); err != nil {
+			fatal("failed to select previous tables", "error", err)
+		}
+		tables = tables[:0]
+		for _, p := range prevs {
+			tables = append(tables, strings.TrimPrefix(p.Name, previousTable(*prefix, "")))
+		}
+		if len(tables) == 0 {
+			fmt.Println("no previous tables to roll back to")
+			return
+		}
+	}
+
+	// Holding the temp tables' leases keeps a run from swapping a table in
+	// while it's being rolled back, and the swap goes through its name.
+	swaps := make([]string, len(tables))
+	for i, t := range tables {
+		swaps[i] = *prefix + t
+	}
+	lease, held, err := leaseTables(ctx, dsn, swaps, func(err error) {
+		slog.Warn("lost the temp table leases, a run could start swapping meanwhile", "error", err, "destination", dest)
+	})
+	if err != nil {
+		fatal("failed to lease temp tables", "error", err, "destination", dest)
+	}
+	defer lease.Close()
+
+	bold := color.New(color.FgHiWhite).SprintFunc()
+	green := color.New(color.FgHiGreen).SprintFunc()
+	red := color.New(color.FgHiRed).SprintFunc()
+	destKey := dsnTarget(dsn)
+	failed := false
+	for i, t := range tables {
+		if slices.Contains(held, swaps[i]) {
+			fmt.Printf("%s %s\n", bold(t), red("skipped: a running swoof is copying it"))
+			failed = true
+			continue
+		}
+		kept, err := rollbackTable(db, t, previousTable(*prefix, t), swaps[i])
+		if err != nil {
+			fmt.Printf("%s %s\n", bold(t), red(err.Error()))
+			failed = true
+			continue
+		}
+		if err := recordPrevious(destKey, t, kept); err != nil {
+			slog.Warn("failed to record previous table", "error", err, "tableName", t)
+		}
+		fmt.Printf("%s %s\n", bold(t), green("rolled back"))
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// rollbackTable swaps table with its previous copy, through swap. The
+// triggers and foreign keys on the table move to the copy taking its
+// place, and keys other tables have on it are pointed back at it. It
+// reports whether there was a table to become the previous copy.
+func rollbackTable(db *mysql.Database, table, prev, swap string) (bool, error) {
+	exists, err := tableExists(db, prev)
+	if err != nil {
+		return false, errors.Wrapf(err, "check table %q", prev)
+	}
+	if !exists {
+		return false, errors.Errorf("no previous copy of %q to roll back to", table)
+	}
+	if exists, err = tableExists(db, swap); err != nil {
+		return false, errors.Wrapf(err, "check table %q", swap)
+	}
+	if exists {
+		return false, errors.Errorf("temp table %q is in the way, run swoof cleanup first", swap)
+	}
+	if exists, err = tableExists(db, table); err != nil {
+		return false, errors.Wrapf(err, "check table %q", table)
+	}
+
+	var triggers []string
+	var constraints string
+	if exists {
+		var create struct {
+			CreateMySQL string `mysql:"Create Table"`
+		}
+		if err := db.Select(&create, "show create table`"+table+"`", 0); err != nil {
+			return false, errors.Wrapf(err, "show create table %q", table)
+		}
+		_, constraints = splitConstraints(create.CreateMySQL)
+		if triggers, err = dropTriggers(db, table); err != nil {
+			return false, err
+		}
+		if err := dropForeignKeys(db, table); err != nil {
+			return false, err
+		}
+		if err := db.Exec("rename table`" + table + "`to`" + swap + "`," +
+			"`" + prev + "`to`" + table + "`," +
+			"`" + swap + "`to`" + prev + "`"); err != nil {
+			return false, errors.Wrapf(err, "swap %q with %q", table, prev)
+		}
+	} else if err := db.Exec("alter table`" + prev + "`rename`" + table + "`"); err != nil {
+		return false, errors.Wrapf(err, "rename table %q to %q", prev, table)
+	}
+
+	for _, from := range []string{prev, swap} {
+		if err := repointForeignKeys(db, from, table); err != nil {
+			return false, err
+		}
+	}
+	if constraints != "" {
+		if err := db.Exec(addConstraints(table, constraints)); err != nil {
+			slog.Warn("failed to add constraints to table", "error", err, "tableName", table)
+		}
+	}
+	for _, trigger := range triggers {
+		if err := db.Exec(trigger); err != nil {
+			return false, errors.Wrapf(err, "create trigger on table %q", table)
+		}
+	}
+	return exists, nil
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	mysql "github.com/StirlingMarketingGroup/cool-mysql"
+	"github.com/pkg/errors"
+)
+
+// rowDest is a destination that takes a table's rows rather than the SQL
+// that would insert them, like a csv: directory. Rows come from the same
+// dynamic struct a database destination's inserter reads, after masking.
+type rowDest interface {
+	// openTable starts writing a table's rows.
+	openTable(t rowTable) (tableWriter, error)
+
+	// key identifies the physical target, to spot duplicate destinations.
+	key() string
+}
+
+// rowDestFinisher is a row destination with work left once every table is
+// in, like foreign keys between them.
+type rowDestFinisher interface {
+	finish()
+}
+
+// tableWriter is one attempt at writing a table. Nothing it writes is
+// visible until commit, and abort discards it, so a retried table doesn't
+// leave a partial copy behind.
+type tableWriter interface {
+	write(row reflect.Value) error
+	commit() error
+	abort() error
+}
+
+// rowTable is what a row destination is told about a table it's about to
+// write.
+type rowTable struct {
+	name string
+
+	// Each field of the row struct, described by the column at its index.
+	columns []rowColumn
+
+	// The source's SHOW CREATE TABLE, for destinations that build their own
+	// schema from it.
+	create string
+}
+
+// Parts of the definitions in a SHOW CREATE TABLE, for destinations that
+// translate it.
+var (
+	createDefaultRegexp    = regexp.MustCompile(` DEFAULT ('(?:[^']|'')*'|\(.*\)|[^ ]+)`)
+	createNumberRegexp     = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?(e[-+]?[0-9]+)?$`)
+	createIndexRegexp      = regexp.MustCompile("^(UNIQUE )?KEY (`(?:[^`]|``)+`) \\((.*)\\)")
+	createPrimaryKeyRegexp = regexp.MustCompile("^PRIMARY KEY \\((.*)\\)")
+)
+
+// keyPart is a column of a key in a SHOW CREATE TABLE.
+type keyPart struct {
+	name string
+	desc bool
+}
+
+// parseKeyParts reads the column list of a key, m[i]. Keys over
+// expressions or missing columns aren't carried over, nor are prefixes,
+// which only indexes may drop.
+func parseKeyParts(m []string, i int, columns map[string]rowColumn, dropPrefixes bool) ([]keyPart, bool) {
+	if m == nil {
+		return nil, false
+	}
+	var parts []keyPart
+	rest := m[i]
+	for rest != "" {
+		name, n, ok := parseIdentifier(rest)
+		if !ok {
+			return nil, false
+		}
+		if _, ok := columns[name]; !ok {
+			return nil, false
+		}
+		part := keyPart{name: name}
+		rest = rest[n:]
+		if strings.HasPrefix(rest, "(") {
+			if !dropPrefixes {
+				return nil, false
+			}
+			rest = rest[strings.IndexByte(rest, ')')+1:]
+		}
+		if r, ok := strings.CutPrefix(rest, " DESC"); ok {
+			part.desc = true
+			rest = r
+		}
+		parts = append(parts, part)
+		rest = strings.TrimPrefix(rest, ",")
+	}
+	return parts, len(parts) != 0
+}
+
+// rowColumn describes a field of the row struct from INFORMATION_SCHEMA.
+type rowColumn struct {
+	name       string
+	dataType   string
+	columnType string
+	nullable   bool
+}
+
+// binary reports whether the column's values are bytes with no text form,
+// and so need encoding in a text format.
+func (c rowColumn) binary() bool {
+	return isBinaryType(c.dataType) || isSpatialType(c.dataType) || c.dataType == "vector"
+}
+
+// rowDestOptions are the flags the row destinations share.
+type rowDestOptions struct {
+	// How NULL is written in formats without one of their own.
+	null string
+
+	// hex or base64, for binary columns in text formats.
+	binaryEncoding string
+
+	// Bytes after which a table's output moves on to a new file, or 0 for
+	// one file per table.
+	splitSize int64
+
+	// Prefix of the temp tables destinations with tables load into.
+	tempPrefix string
+}
+
+// openRowDest opens a destination given on the command line if it's a row
+// destination, reporting false for anything else.
+func openRowDest(dsn string, opts rowDestOptions) (rowDest, bool, error) {
+	if dir, ok := strings.CutPrefix(dsn, "csv:"); ok {
+		d, err := newCSVDest(dir, ',', opts)
+		return d, true, err
+	}
+	if dir, ok := strings.CutPrefix(dsn, "tsv:"); ok {
+		d, err := newCSVDest(dir, '\t', opts)
+		return d, true, err
+	}
+	if dir, ok := strings.CutPrefix(dsn, "ndjson:"); ok {
+		d, err := newNDJSONDest(dir, opts)
+		return d, true, err
+	}
+	if dir, ok := strings.CutPrefix(dsn, "parquet:"); ok {
+		d, err := newParquetDest(dir, opts)
+		return d, true, err
+	}
+	if path, ok := strings.CutPrefix(dsn, "sqlite:"); ok {
+		d, err := newSQLiteDest(path, opts)
+		return d, true, err
+	}
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		d, err := newPostgresDest(dsn, opts)
+		return d, true, err
+	}
+	return nil, false, nil
+}
+
+// writesToStdout reports whether any of a comma-separated list of
+// destinations writes to stdout.
+func writesToStdout(dsts string) bool {
+	for _, dsn := range strings.Split(dsts, ",") {
+		dsn = strings.TrimSpace(dsn)
+		if dsn == "ndjson:-" || isStdoutDest(dsn) {
+			return true
+		}
+	}
+	return false
+}
+
+// isStdoutDest reports whether a destination is the SQL script on stdout.
+func isStdoutDest(dsn string) bool {
+	return dsn == "-" || strings.EqualFold(dsn, "stdout")
+}
+
+// writeRows feeds every row from rows, a channel of the row struct, to w,
+// calling afterRow, if set, after each.
+func writeRows(ctx context.Context, w tableWriter, rows reflect.Value, afterRow func(time.Time)) error {
+	recvCases := []reflect.SelectCase{
+		{Dir: reflect.SelectRecv, Chan: rows},
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())},
+	}
+	for {
+		chosen, row, ok := reflect.Select(recvCases)
+		if chosen == 1 {
+			return ctx.Err()
+		}
+		if !ok {
+			return nil
+		}
+		if err := w.write(row); err != nil {
+			return err
+		}
+		if afterRow != nil {
+			afterRow(time.Time{})
+		}
+	}
+}
+
+// fieldText renders one field of a row struct as text, the way the server
+// would print it, with binary columns encoded. NULLs report false.
+func fieldText(c rowColumn, v reflect.Value, encoding string) (string, bool) {
+	if v.IsNil() {
+		return "", false
+	}
+	switch x := v.Elem().Interface().(type) {
+	case string:
+		return x, true
+	case mysql.Raw:
+		return string(x), true
+	case json.RawMessage:
+		return string(x), true
+	case float64:
+		if c.dataType == "float" {
+			return strconv.FormatFloat(x, 'g', -1, 32), true
+		}
+		return strconv.FormatFloat(x, 'g', -1, 64), true
+	case []byte:
+		switch {
+		case c.dataType == "bit":
+			// The bit value as a number, the way it's usually read.
+			var n uint64
+			for _, b := range x {
+				n = n<<8 | uint64(b)
+			}
+			return strconv.FormatUint(n, 10), true
+		case !c.binary():
+			return string(x), true
+		case encoding == "base64":
+			return base64.StdEncoding.EncodeToString(x), true
+		}
+		return hex.EncodeToString(x), true
+	case nil:
+		// A set column's any, holding nothing.
+		return "", false
+	}
+
+	e := v.Elem()
+	switch e.Kind() {
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(e.Int(), 10), true
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(e.Uint(), 10), true
+	}
+	return fmt.Sprint(e.Interface()), true
+}
+
+func (o rowDestOptions) validate() error {
+	switch o.binaryEncoding {
+	case "hex", "base64":
+		return nil
+	}
+	return errors.Errorf("unknown binary encoding %q, want hex or base64", o.binaryEncoding)
+}
+
+// tableFiles writes a table to hidden temp files in a directory, renamed
+// into place on commit. With a split size, a table moves on to a new part
+// once the current one passes it, and the parts are named <table>-000001
+// and on.
+type tableFiles struct {
+	dir       string
+	table     string
+	ext       string
+	splitSize int64
+
+	parts []string
+	f     *os.File
+	size  *countingWriter
+}
+
+// countingWriter counts what's written through it. Writers that buffer lag
+// what they've been given by at most their buffer, so splits land close to
+// the size.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// startPart creates the next part, returning the writer to write it with.
+func (t *tableFiles) startPart() (io.Writer, error) {
+	f, err := os.CreateTemp(t.dir, "."+t.table+"-*."+t.ext+".tmp")
+	if err != nil {
+		return nil, errors.Wrapf(err, "create %s file for %q", t.ext, t.table)
+	}
+	t.parts = append(t.parts, f.Name())
+	t.f = f
+	t.size = &countingWriter{w: f}
+	return t.size, nil
+}
+
+func (t *tableFiles) finishPart() error {
+	err := t.f.Close()
+	t.f = nil
+	return err
+}
+
+// open reports whether a part is being written.
+func (t *tableFiles) open() bool {
+	return t.f != nil
+}
+
+// full reports whether the current part has passed the split size.
+func (t *tableFiles) full() bool {
+	return t.splitSize > 0 && t.size.n >= t.splitSize
+}
+
+// commit renames the finished parts into place, then removes any files a
+// previous run left for the table that this one didn't replace.
+func (t *tableFiles) commit() error {
+	var names []string
+	for i, part := range t.parts {
+		name := t.partName(i)
+		if err := os.Rename(part, name); err != nil {
+			return errors.Wrapf(err, "rename %q to %q", part, name)
+		}
+		names = append(names, name)
+	}
+	t.parts = nil
+
+	stale, err := filepath.Glob(filepath.Join(t.dir, t.table+"-[0-9][0-9][0-9][0-9][0-9][0-9]."+t.ext))
+	if err != nil {
+		return errors.Wrapf(err, "list old %s files for %q", t.ext, t.table)
+	}
+	stale = append(stale, filepath.Join(t.dir, t.table+"."+t.ext))
+	for _, name := range stale {
+		if slices.Contains(names, name) {
+			continue
+		}
+		if err := os.Remove(name); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return errors.Wrapf(err, "remove old %s file %q", t.ext, name)
+		}
+	}
+	return nil
+}
+
+// partName is where the i'th part goes on commit.
+func (t *tableFiles) partName(i int) string {
+	if t.splitSize > 0 {
+		return filepath.Join(t.dir, fmt.Sprintf("%s-%06d.%s", t.table, i+1, t.ext))
+	}
+	return filepath.Join(t.dir, t.table+"."+t.ext)
+}
+
+// abort removes the parts written so far.
+func (t *tableFiles) abort() error {
+	if t.f != nil {
+		t.f.Close()
+		t.f = nil
+	}
+	var err error
+	for _, part := range t.parts {
+		if rerr := os.Remove(part); rerr != nil && err == nil {
+			err = rerr
+		}
+	}
+	t.parts = nil
+	return err
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	stderrors "errors"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+
+	mysql "github.com/StirlingMarketingGroup/cool-mysql"
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/pkg/errors"
+)
+
+// How many times a snapshot taken without the read lock is retried when the
+// source commits something while its connections are being opened.
+const snapshotAttempts = 10
+
+// How long the global read lock waits on running statements before the
+// snapshot is taken without it, so a long query on the source doesn't
+// block its writers behind the lock.
+const snapshotLockWait = 10
+
+// errSnapshotLost is returned once every snapshot connection has been
+// dropped, since a fresh connection wouldn't see the same view.
+var errSnapshotLost = stderrors.New("every connection of the consistent snapshot was lost")
+
+// binlogPosition is where the source's binary log was when a snapshot was
+// taken, for starting replication or binlog reads from.
+type binlogPosition struct {
+	File string
+	Pos  uint64
+	GTID string
+}
+
+func (p binlogPosition) known() bool {
+	return p.File != "" || p.GTID != ""
+}
+
+// snapshot is a set of source connections that each started a transaction
+// WITH CONSISTENT SNAPSHOT at the same point, so every table read through
+// db sees the source as it was at pos, however many run at once.
+type snapshot struct {
+	db     *mysql.Database
+	sqlDB  *sql.DB
+	conns  *snapshotConnector
+	pos    binlogPosition
+	locked bool
+}
+
+// openSnapshot opens n connections to the source inside one consistent
+// view. The connections start their transactions under FLUSH TABLES WITH
+// READ LOCK, held only while they do; where the lock isn't allowed, they
+// start without it and are opened again until nothing was committed in
+// between.
+func openSnapshot(ctx context.Context, dsn string, n int) (*snapshot, error) {
+	cfg, err := mysqldriver.ParseDSN(dsn)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse source DSN")
+	}
+	base, err := mysqldriver.NewConnector(cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "create source connector")
+	}
+
+	ctlDB := sql.OpenDB(base)
+	defer ctlDB.Close()
+	ctl, err := ctlDB.Conn(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "connect to source")
+	}
+	defer ctl.Close()
+
+	locked := false
+	if _, err := ctl.ExecContext(ctx, "set session lock_wait_timeout="+strconv.Itoa(snapshotLockWait)); err != nil {
+		return nil, errors.Wrap(err, "set lock wait timeout")
+	}
+	if _, err := ctl.ExecContext(ctx, "flush tables with read lock"); err != nil {
+		var mysqlErr *mysqldriver.MySQLError
+		if !stderrors.As(err, &mysqlErr) {
+			return nil, errors.Wrap(err, "flush tables with read lock")
+		}
+		slog.Warn("can't take a global read lock on the source, opening the snapshot without one", "cause", mysqlErr.Message)
+	} else {
+		locked = true
+		defer func() {
+			if _, err := ctl.ExecContext(context.Background(), "unlock tables"); err != nil {
+				slog.Warn("failed to unlock source tables", "error", err)
+			}
+		}()
+	}
+
+	for attempt := 1; ; attempt++ {
+		before, err := readBinlogPosition(ctx, ctl)
+		if err != nil {
+			return nil, err
+		}
+		conns, err := startSnapshots(ctx, base, n)
+		if err != nil {
+			return nil, err
+		}
+		after := before
+		if !locked {
+			if after, err = readBinlogPosition(ctx, ctl); err != nil {
+				conns.close()
+				return nil, err
+			}
+		}
+
+		if !locked && !before.known() && n > 1 {
+			slog.Warn("the source's binlog position can't be read, so its snapshot connections may differ by commits made while they were opened")
+		}
+		if locked || before == after {
+			s := &snapshot{conns: conns, pos: before, locked: locked}
+			s.sqlDB = sql.OpenDB(conns)
+			// Every connection is opened up front and none may be closed
+			// while idle, or the connection that replaces it is outside the
+			// snapshot.
+			s.sqlDB.SetMaxOpenConns(n)
+			s.sqlDB.SetMaxIdleConns(n)
+			conns.limit = s.sqlDB.SetMaxOpenConns
+			if s.db, err = mysql.NewFromConn(s.sqlDB, s.sqlDB); err != nil {
+				s.Close()
+				return nil, errors.Wrap(err, "create snapshot connection")
+			}
+			s.db.SetMaxConnectionTime(0)
+			return s, nil
+		}
+
+		conns.close()
+		if attempt == snapshotAttempts {
+			return nil, errors.Errorf("the source committed while each of %d snapshots was being opened", snapshotAttempts)
+		}
+		slog.Debug("source committed while the snapshot was being opened, opening it again", "attempt", attempt)
+	}
+}
+
+// Close ends the snapshot's transactions.
+func (s *snapshot) Close() error {
+	err := s.sqlDB.Close()
+	s.conns.close()
+	return err
+}
+
+// startSnapshots opens n connections, each in a read only transaction with
+// a consistent snapshot.
+func startSnapshots(ctx context.Context, base driver.Connector, n int) (*snapshotConnector, error) {
+	c := &snapshotConnector{driver: base.Driver(), conns: make(chan driver.Conn, n), alive: n}
+	for range n {
+		conn, err := base.Connect(ctx)
+		if err != nil {
+			c.close()
+			return nil, errors.Wrap(err, "open snapshot connection")
+		}
+		c.conns <- conn
+		for _, q := range []string{
+			"set session transaction isolation level repeatable read",
+			"start transaction with consistent snapshot,read only",
+		} {
+			if _, err := conn.(driver.ExecerContext).ExecContext(ctx, q, nil); err != nil {
+				c.close()
+				return nil, errors.Wrap(err, "start snapshot transaction")
+			}
+		}
+	}
+	return c, nil
+}
+
+// snapshotConnector hands database/sql the snapshot's connections instead
+// of dialing new ones. Once they've all been handed out, database/sql only
+// asks for another when one was dropped, so each ask is one connection
+// fewer, and the pool is shrunk to what's left for its callers to wait on.
+type snapshotConnector struct {
+	driver driver.Driver
+	conns  chan driver.Conn
+
+	// Sets database/sql's limit on open connections.
+	limit func(n int)
+
+	mu    sync.Mutex
+	alive int
+}
+
+func (c *snapshotConnector) Connect(context.Context) (driver.Conn, error) {
+	select {
+	case conn := <-c.conns:
+		return conn, nil
+	default:
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.alive = max(c.alive-1, 0)
+	if c.alive == 0 {
+		return nil, errSnapshotLost
+	}
+	if c.limit != nil {
+		c.limit(c.alive)
+	}
+	// A bad connection has database/sql try again, and with the pool
+	// shrunk, it waits for one of the connections left.
+	return nil, errors.Wrapf(driver.ErrBadConn, "a snapshot connection was lost, %d left", c.alive)
+}
+
+func (c *snapshotConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// close closes the connections that were never handed out.
+func (c *snapshotConnector) close() {
+	for {
+		select {
+		case conn := <-c.conns:
+			conn.Close()
+		default:
+			return
+		}
+	}
+}
+
+// readBinlogPosition reads the source's binlog file and position, and its
+// executed GTID set where it keeps one. Without the privilege to see them,
+// or with binary logging off, the position is left empty.
+func readBinlogPosition(ctx context.Context, conn *sql.Conn) (binlogPosition, error) {
+	var pos binlogPosition
+	for _, q := range []string{"show binary log status", "show master status"} {
+		row, err := queryRow(ctx, conn, q)
+		if err != nil {
+			var mysqlErr *mysqldriver.MySQLError
+			if stderrors.As(err, &mysqlErr) {
+				continue
+			}
+			return pos, errors.Wrap(err, "read binlog position")
+		}
+		pos = parseBinlogStatus(row)
+		break
+	}
+	if pos.GTID == "" {
+		for _, q := range []string{"select@@global.gtid_executed", "select@@global.gtid_binlog_pos"} {
+			if row, err := queryRow(ctx, conn, q); err == nil {
+				for _, v := range row {
+					pos.GTID = v
+				}
+				break
+			}
+		}
+	}
+	return pos, nil
+}
+
+// queryRow reads the first row of a query as strings by column name, nil
+// if it has none.
+func queryRow(ctx context.Context, conn *sql.Conn, q string) (map[string]string, error) {
+	rows, err := conn.QueryContext(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	values := make([]sql.NullString, len(columns))
+	dest := make([]any, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return nil, err
+	}
+	row := make(map[string]string, len(columns))
+	for i, c := range columns {
+		row[c] = values[i].String
+	}
+	return row, rows.Err()
+}
+
+// parseBinlogStatus reads a row of SHOW MASTER STATUS, which only MySQL
+// gives the GTID set in.
+func parseBinlogStatus(row map[string]string) binlogPosition {
+	pos := binlogPosition{
+		File: row["File"],
+		GTID: strings.ReplaceAll(row["Executed_Gtid_Set"], "\n", ""),
+	}
+	pos.Pos, _ = strconv.ParseUint(row["Position"], 10, 64)
+	return pos
+}
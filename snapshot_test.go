@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	stderrors "errors"
+	"testing"
+	"time"
+)
+
+type fakeConn struct{ closed bool }
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) { return nil, stderrors.New("not supported") }
+func (c *fakeConn) Begin() (driver.Tx, error)           { return nil, stderrors.New("not supported") }
+func (c *fakeConn) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestSnapshotConnector(t *testing.T) {
+	a, b, spare := new(fakeConn), new(fakeConn), new(fakeConn)
+	c := &snapshotConnector{conns: make(chan driver.Conn, 3), alive: 3}
+	c.conns <- a
+	c.conns <- b
+	c.conns <- spare
+
+	for _, want := range []*fakeConn{a, b} {
+		conn, err := c.Connect(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if conn != want {
+			t.Errorf("Connect = %p, want %p", conn, want)
+		}
+	}
+
+	// What database/sql never asked for is closed with the snapshot.
+	c.close()
+	if !spare.closed || a.closed || b.closed {
+		t.Errorf("closed = %v, %v, %v, want only the spare", a.closed, b.closed, spare.closed)
+	}
+
+	// A dropped connection can't be replaced by one outside the snapshot,
+	// but while others are left, the ask is retried against them.
+	var limit int
+	c.limit = func(n int) { limit = n }
+	if _, err := c.Connect(context.Background()); !stderrors.Is(err, driver.ErrBadConn) || limit != 2 {
+		t.Errorf("Connect with 2 left = %v, limit %d, want a bad connection and limit 2", err, limit)
+	}
+	c.Connect(context.Background())
+	if _, err := c.Connect(context.Background()); !stderrors.Is(err, errSnapshotLost) {
+		t.Errorf("Connect once they're gone = %v, want errSnapshotLost", err)
+	}
+	if isTransientError(errSnapshotLost) {
+		t.Error("a lost snapshot shouldn't be retried")
+	}
+}
+
+// A query on a dropped snapshot connection waits for one of the others
+// instead of failing while they're busy.
+func TestSnapshotConnectorLost(t *testing.T) {
+	c := &snapshotConnector{conns: make(chan driver.Conn, 3), alive: 3}
+	for range 3 {
+		c.conns <- new(fakeConn)
+	}
+	db := sql.OpenDB(c)
+	defer db.Close()
+	db.SetMaxOpenConns(3)
+	db.SetMaxIdleConns(3)
+	c.limit = db.SetMaxOpenConns
+
+	ctx := context.Background()
+	var conns []*sql.Conn
+	for range 3 {
+		conn, err := db.Conn(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conns = append(conns, conn)
+	}
+	conns[0].Raw(func(any) error { return driver.ErrBadConn })
+	conns[0].Close()
+
+	got := make(chan error, 1)
+	go func() {
+		conn, err := db.Conn(ctx)
+		if err == nil {
+			conn.Close()
+		}
+		got <- err
+	}()
+	select {
+	case err := <-got:
+		t.Fatalf("Conn while the others are busy = %v, want it to wait", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	conns[1].Close()
+	if err := <-got; err != nil {
+		t.Errorf("Conn once one is free = %v", err)
+	}
+	if n := db.Stats().MaxOpenConnections; n != 2 {
+		t.Errorf("max open connections = %d, want the 2 left", n)
+	}
+	conns[2].Close()
+}
+
+func TestParseBinlogStatus(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		row  map[string]string
+		want binlogPosition
+	}{
+		{
+			name: "mysql",
+			row: map[string]string{
+				"File":              "binlog.000042",
+				"Position":          "1337",
+				"Binlog_Do_DB":      "",
+				"Executed_Gtid_Set": "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5,\n9e33c80a-71ca-11e1-9e33-c80aa9429562:1-3",
+			},
+			want: binlogPosition{"binlog.000042", 1337, "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5,9e33c80a-71ca-11e1-9e33-c80aa9429562:1-3"},
+		},
+		{
+			name: "mariadb",
+			row:  map[string]string{"File": "mysql-bin.000003", "Position": "4", "Binlog_Do_DB": ""},
+			want: binlogPosition{"mysql-bin.000003", 4, ""},
+		},
+		{
+			name: "binary logging off",
+			want: binlogPosition{},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseBinlogStatus(tt.row)
+			if got != tt.want {
+				t.Errorf("parseBinlogStatus = %+v, want %+v", got, tt.want)
+			}
+			if got.known() != (tt.want != binlogPosition{}) {
+				t.Errorf("known = %v", got.known())
+			}
+		})
+	}
+}
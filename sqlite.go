@@ -0,0 +1,363 @@
+package main
+
+import (
+	"database/sql"
+	"log/slog"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	_ "modernc.org/sqlite"
+)
+
+// Rows per transaction while loading a table.
+const sqliteBatchRows = 50000
+
+// sqliteDest writes tables into a SQLite database file, each loaded into a
+// temp table and swapped in with its indexes in one transaction, so a run
+// against an existing file replaces tables whole or not at all.
+type sqliteDest struct {
+	path string
+	db   *sql.DB
+	opts rowDestOptions
+}
+
+func newSQLiteDest(path string, opts rowDestOptions) (*sqliteDest, error) {
+	if path == "" {
+		return nil, errors.New("sqlite: destination needs a file")
+	}
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "open sqlite database %q", path)
+	}
+	// SQLite takes one writer at a time, so tables take turns on a single
+	// connection rather than failing with SQLITE_BUSY.
+	db.SetMaxOpenConns(1)
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, errors.Wrapf(err, "open sqlite database %q", path)
+	}
+	return &sqliteDest{path: path, db: db, opts: opts}, nil
+}
+
+func (d *sqliteDest) key() string {
+	if abs, err := filepath.Abs(d.path); err == nil {
+		return "sqlite:" + abs
+	}
+	return "sqlite:" + d.path
+}
+
+func (d *sqliteDest) openTable(rt rowTable) (tableWriter, error) {
+	schema := sqliteSchema(rt)
+	for _, w := range schema.warnings {
+		slog.Warn("dropped from sqlite schema: "+w, "tableName", rt.name)
+	}
+
+	t := &sqliteTable{
+		dest:      d,
+		rt:        rt,
+		tempTable: d.opts.tempPrefix + rt.name,
+		indexes:   schema.indexes,
+		values:    make([]any, len(rt.columns)),
+	}
+	if _, err := d.db.Exec("drop table if exists`" + t.tempTable + "`"); err != nil {
+		return nil, errors.Wrapf(err, "drop sqlite temp table %q", t.tempTable)
+	}
+	if _, err := d.db.Exec("create table`" + t.tempTable + "`" + schema.columns); err != nil {
+		return nil, errors.Wrapf(err, "create sqlite temp table %q", t.tempTable)
+	}
+
+	names := make([]string, len(rt.columns))
+	marks := make([]string, len(rt.columns))
+	for i, c := range rt.columns {
+		names[i] = "`" + c.name + "`"
+		marks[i] = "?"
+	}
+	t.insert = "insert into`" + t.tempTable + "`(" + strings.Join(names, ",") + ")values(" + strings.Join(marks, ",") + ")"
+	return t, nil
+}
+
+type sqliteTable struct {
+	dest      *sqliteDest
+	rt        rowTable
+	tempTable string
+	indexes   []string
+	insert    string
+	values    []any
+
+	// The open batch, if any.
+	tx   *sql.Tx
+	stmt *sql.Stmt
+	rows int
+}
+
+func (t *sqliteTable) write(row reflect.Value) error {
+	if t.tx == nil {
+		tx, err := t.dest.db.Begin()
+		if err != nil {
+			return errors.Wrapf(err, "begin sqlite transaction for %q", t.rt.name)
+		}
+		stmt, err := tx.Prepare(t.insert)
+		if err != nil {
+			tx.Rollback()
+			return errors.Wrapf(err, "prepare sqlite insert for %q", t.rt.name)
+		}
+		t.tx, t.stmt, t.rows = tx, stmt, 0
+	}
+
+	for i, c := range t.rt.columns {
+		t.values[i] = sqliteValue(c, row.Field(i))
+	}
+	if _, err := t.stmt.Exec(t.values...); err != nil {
+		return errors.Wrapf(err, "insert into sqlite table %q", t.tempTable)
+	}
+	t.rows++
+	if t.rows >= sqliteBatchRows {
+		return t.commitBatch()
+	}
+	return nil
+}
+
+func (t *sqliteTable) commitBatch() error {
+	t.stmt.Close()
+	err := t.tx.Commit()
+	t.tx, t.stmt = nil, nil
+	return errors.Wrapf(err, "commit sqlite rows for %q", t.rt.name)
+}
+
+// sqliteValue is a field of the row struct as SQLite takes it: the bytes of
+// a binary column, and otherwise the value's text, which the column's
+// affinity turns back into a number where it is one.
+func sqliteValue(c rowColumn, v reflect.Value) any {
+	if c.binary() && !v.IsNil() {
+		if b := v.Elem().Bytes(); b != nil {
+			return b
+		}
+		// A nil slice would be bound as NULL.
+		return []byte{}
+	}
+	s, ok := fieldText(c, v, "")
+	if !ok {
+		return nil
+	}
+	return s
+}
+
+// commit swaps the temp table in for the real one and builds its indexes,
+// all in one transaction.
+func (t *sqliteTable) commit() error {
+	if t.tx != nil {
+		if err := t.commitBatch(); err != nil {
+			return err
+		}
+	}
+	tx, err := t.dest.db.Begin()
+	if err != nil {
+		return errors.Wrapf(err, "begin sqlite transaction for %q", t.rt.name)
+	}
+	defer tx.Rollback()
+
+	stmts := []string{
+		"drop table if exists`" + t.rt.name + "`",
+		"alter table`" + t.tempTable + "`rename to`" + t.rt.name + "`",
+	}
+	stmts = append(stmts, t.indexes...)
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return errors.Wrapf(err, "swap in sqlite table %q", t.rt.name)
+		}
+	}
+	return errors.Wrapf(tx.Commit(), "swap in sqlite table %q", t.rt.name)
+}
+
+func (t *sqliteTable) abort() error {
+	if t.tx != nil {
+		t.stmt.Close()
+		t.tx.Rollback()
+		t.tx, t.stmt = nil, nil
+	}
+	_, err := t.dest.db.Exec("drop table if exists`" + t.tempTable + "`")
+	return errors.Wrapf(err, "drop sqlite temp table %q", t.tempTable)
+}
+
+// sqliteTableSchema is a MySQL table translated for SQLite.
+type sqliteTableSchema struct {
+	// The column and primary key definitions, in parentheses.
+	columns string
+
+	// The statements that create the table's indexes, once it has its name.
+	indexes []string
+
+	// What couldn't be carried over.
+	warnings []string
+}
+
+// sqliteSchema translates the definitions of a SHOW CREATE TABLE into
+// SQLite's: columns get the type whose affinity holds their values, the
+// primary key stays, and other keys become indexes. Foreign keys, checks,
+// full text and spatial keys, key prefixes and expressions, generated
+// columns, and defaults SQLite can't read are dropped with a warning.
+func sqliteSchema(rt rowTable) sqliteTableSchema {
+	var s sqliteTableSchema
+	columns := make(map[string]rowColumn, len(rt.columns))
+	for _, c := range rt.columns {
+		columns[c.name] = c
+	}
+
+	defs := make(map[string]string, len(rt.columns))
+	var primaryKey []keyPart
+	for _, line := range strings.Split(rt.create, "\n") {
+		def, ok := strings.CutPrefix(line, "  ")
+		if !ok {
+			continue
+		}
+		def = strings.TrimSuffix(def, ",")
+
+		switch {
+		case strings.HasPrefix(def, "`"):
+			name, n, ok := parseIdentifier(def)
+			if !ok {
+				continue
+			}
+			c, ok := columns[name]
+			if !ok {
+				if strings.Contains(def, " GENERATED ALWAYS ") {
+					s.warnings = append(s.warnings, "generated column "+name)
+				}
+				continue
+			}
+			defs[name] = sqliteColumn(c, def[n:], &s.warnings)
+
+		case strings.HasPrefix(def, "PRIMARY KEY "):
+			m := createPrimaryKeyRegexp.FindStringSubmatch(def)
+			parts, ok := parseKeyParts(m, 1, columns, false)
+			if !ok {
+				s.warnings = append(s.warnings, "primary key "+def[len("PRIMARY KEY "):])
+				continue
+			}
+			primaryKey = parts
+
+		case strings.HasPrefix(def, "KEY "), strings.HasPrefix(def, "UNIQUE KEY "):
+			m := createIndexRegexp.FindStringSubmatch(def)
+			if m == nil {
+				s.warnings = append(s.warnings, def)
+				continue
+			}
+			unique := m[1] != ""
+			parts, ok := parseKeyParts(m, 3, columns, true)
+			if !ok {
+				s.warnings = append(s.warnings, "index "+m[2])
+				continue
+			}
+			if unique && strings.Contains(m[3], "`(") {
+				// Unique on a prefix is stricter on the whole column.
+				s.warnings = append(s.warnings, "uniqueness of index "+m[2]+", which is on column prefixes")
+				unique = false
+			}
+			name, _, _ := parseIdentifier(m[2])
+			stmt := "create index`" + rt.name + "_" + name + "`on`" + rt.name + "`(" + sqliteKeyList(parts) + ")"
+			if unique {
+				stmt = "create unique" + stmt[len("create"):]
+			}
+			s.indexes = append(s.indexes, stmt)
+
+		default:
+			// FULLTEXT KEY, SPATIAL KEY, and CONSTRAINTs.
+			s.warnings = append(s.warnings, def)
+		}
+	}
+
+	var b strings.Builder
+	b.WriteByte('(')
+	for i, c := range rt.columns {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		def, ok := defs[c.name]
+		if !ok {
+			def = sqliteColumn(c, "", &s.warnings)
+		}
+		if len(primaryKey) == 1 && primaryKey[0].name == c.name && sqliteType(c) == "integer" {
+			// An alias of the rowid, which is how SQLite auto increments.
+			def = strings.Replace(def, "integer", "integer primary key", 1)
+			primaryKey = nil
+		}
+		b.WriteString("`" + c.name + "`" + def)
+	}
+	if len(primaryKey) != 0 {
+		b.WriteString(",primary key(" + sqliteKeyList(primaryKey) + ")")
+	}
+	b.WriteByte(')')
+	s.columns = b.String()
+	return s
+}
+
+// sqliteColumn translates the part of a column's definition after its name.
+func sqliteColumn(c rowColumn, def string, warnings *[]string) string {
+	out := sqliteType(c)
+	if !c.nullable {
+		out += " not null"
+	}
+	if m := createDefaultRegexp.FindStringSubmatch(def); m != nil {
+		v := m[1]
+		switch {
+		case v == "NULL":
+		case strings.HasPrefix(v, "CURRENT_TIMESTAMP"):
+			out += " default current_timestamp"
+		case strings.HasPrefix(v, "'") && !strings.Contains(v, `\`),
+			createNumberRegexp.MatchString(v):
+			out += " default " + v
+		case strings.HasPrefix(v, "0x"):
+			out += " default x'" + v[2:] + "'"
+		case strings.HasPrefix(v, "b'"):
+			n, err := strconv.ParseUint(strings.Trim(v[1:], "'"), 2, 64)
+			if err == nil {
+				out += " default " + strconv.FormatUint(n, 10)
+				break
+			}
+			fallthrough
+		default:
+			*warnings = append(*warnings, "default "+v+" of column "+c.name)
+		}
+	}
+	if strings.Contains(def, " ON UPDATE ") {
+		*warnings = append(*warnings, "on update of column "+c.name)
+	}
+	return out
+}
+
+// sqliteType is the type whose affinity keeps a column's values as they
+// are. Decimals stay text so no precision is lost to a float, and so does
+// bigint unsigned, whose values past SQLite's signed 64 bits would become
+// floats too.
+func sqliteType(c rowColumn) string {
+	switch c.dataType {
+	case "bigint":
+		if strings.Contains(c.columnType, " unsigned") {
+			return "text"
+		}
+		return "integer"
+	case "tinyint", "smallint", "mediumint", "int", "year", "bit":
+		return "integer"
+	case "float", "double":
+		return "real"
+	}
+	if c.binary() {
+		return "blob"
+	}
+	return "text"
+}
+
+// sqliteKeyList writes key parts as a SQLite column list.
+func sqliteKeyList(parts []keyPart) string {
+	list := make([]string, len(parts))
+	for i, p := range parts {
+		list[i] = "`" + p.name + "`"
+		if p.desc {
+			list[i] += " desc"
+		}
+	}
+	return strings.Join(list, ",")
+}
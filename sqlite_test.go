@@ -0,0 +1,181 @@
+package main
+
+import (
+	"database/sql"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	mysql "github.com/StirlingMarketingGroup/cool-mysql"
+)
+
+const testSQLiteCreate = "CREATE TABLE `items` (\n" +
+	"  `ID` int unsigned NOT NULL AUTO_INCREMENT,\n" +
+	"  `Name` varchar(50) COLLATE utf8mb4_bin NOT NULL DEFAULT 'it''s',\n" +
+	"  `Price` decimal(10,2) DEFAULT '0.00',\n" +
+	"  `Photo` blob,\n" +
+	"  `Flags` bit(3) DEFAULT b'101',\n" +
+	"  `Updated` timestamp NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,\n" +
+	"  `Code` varchar(10) DEFAULT (uuid()),\n" +
+	"  `Upper` varchar(50) GENERATED ALWAYS AS (upper(`Name`)) VIRTUAL,\n" +
+	"  PRIMARY KEY (`ID`),\n" +
+	"  UNIQUE KEY `Name` (`Name`),\n" +
+	"  UNIQUE KEY `Code` (`Code`(4)),\n" +
+	"  KEY `PriceName` (`Price` DESC,`Name`(10)),\n" +
+	"  KEY `Expr` ((lower(`Name`))),\n" +
+	"  FULLTEXT KEY `NameText` (`Name`),\n" +
+	"  CONSTRAINT `items_ibfk_1` FOREIGN KEY (`ID`) REFERENCES `other` (`ID`)\n" +
+	") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4"
+
+var testSQLiteColumns = []rowColumn{
+	{"ID", "int", "int unsigned", false},
+	{"Name", "varchar", "varchar(50)", false},
+	{"Price", "decimal", "decimal(10,2)", true},
+	{"Photo", "blob", "blob", true},
+	{"Flags", "bit", "bit(3)", true},
+	{"Updated", "timestamp", "timestamp", true},
+	{"Code", "varchar", "varchar(10)", true},
+}
+
+func TestSQLiteSchema(t *testing.T) {
+	s := sqliteSchema(rowTable{name: "items", columns: testSQLiteColumns, create: testSQLiteCreate})
+
+	want := "(`ID`integer primary key not null," +
+		"`Name`text not null default 'it''s'," +
+		"`Price`text default '0.00'," +
+		"`Photo`blob," +
+		"`Flags`integer default 5," +
+		"`Updated`text default current_timestamp," +
+		"`Code`text)"
+	if s.columns != want {
+		t.Errorf("columns =\n%s\nwant\n%s", s.columns, want)
+	}
+
+	wantIndexes := []string{
+		"create unique index`items_Name`on`items`(`Name`)",
+		"create index`items_Code`on`items`(`Code`)",
+		"create index`items_PriceName`on`items`(`Price` desc,`Name`)",
+	}
+	if !slices.Equal(s.indexes, wantIndexes) {
+		t.Errorf("indexes =\n%q\nwant\n%q", s.indexes, wantIndexes)
+	}
+
+	wantWarnings := []string{
+		"on update of column Updated",
+		"default (uuid()) of column Code",
+		"generated column Upper",
+		"uniqueness of index `Code`, which is on column prefixes",
+		"index `Expr`",
+		"FULLTEXT KEY `NameText` (`Name`)",
+		"CONSTRAINT `items_ibfk_1` FOREIGN KEY (`ID`) REFERENCES `other` (`ID`)",
+	}
+	if !slices.Equal(s.warnings, wantWarnings) {
+		t.Errorf("warnings =\n%q\nwant\n%q", s.warnings, wantWarnings)
+	}
+
+	// A composite key stays a table constraint.
+	s = sqliteSchema(rowTable{name: "pairs", columns: testSQLiteColumns[:2], create: "CREATE TABLE `pairs` (\n" +
+		"  `ID` int unsigned NOT NULL,\n" +
+		"  `Name` varchar(50) NOT NULL,\n" +
+		"  PRIMARY KEY (`ID`,`Name`)\n" +
+		")"})
+	if want := "(`ID`integer not null,`Name`text not null,primary key(`ID`,`Name`))"; s.columns != want {
+		t.Errorf("composite key columns = %s, want %s", s.columns, want)
+	}
+}
+
+func TestSQLiteType(t *testing.T) {
+	for _, tt := range []struct {
+		dataType, columnType, want string
+	}{
+		{"int", "int unsigned", "integer"},
+		{"bigint", "bigint", "integer"},
+		{"bigint", "bigint unsigned", "text"},
+		{"bigint", "bigint(20) unsigned zerofill", "text"},
+		{"decimal", "decimal(10,2)", "text"},
+		{"double", "double", "real"},
+		{"varbinary", "varbinary(16)", "blob"},
+	} {
+		if got := sqliteType(rowColumn{"C", tt.dataType, tt.columnType, true}); got != tt.want {
+			t.Errorf("sqliteType(%s) = %s, want %s", tt.columnType, got, tt.want)
+		}
+	}
+}
+
+func TestSQLiteDest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.db")
+	d, ok, err := openRowDest("sqlite:"+path, rowDestOptions{tempPrefix: "_swoof_"})
+	if !ok || err != nil {
+		t.Fatalf("openRowDest = %v, %v", ok, err)
+	}
+	rt := rowTable{name: "items", columns: testSQLiteColumns, create: testSQLiteCreate}
+	load := func(rows ...[]any) {
+		t.Helper()
+		w, err := d.openTable(rt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, row := range testRows(t, testSQLiteColumns, rows...) {
+			if err := w.write(row); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := w.commit(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	load(
+		[]any{uint32(1), "old", mysql.Raw("1.00"), nil, nil, nil, nil},
+	)
+	// Running again replaces the table, indexes and all.
+	load(
+		[]any{uint32(1), "a", mysql.Raw("12345678.99"), []byte{}, []byte{0x05}, "2026-10-17 01:02:03", nil},
+		[]any{uint32(2), "b", nil, []byte{0xff}, nil, nil, "X"},
+	)
+
+	// An aborted attempt leaves the table as it was.
+	w, err := d.openTable(rt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.write(testRows(t, testSQLiteColumns, []any{uint32(3), "c", nil, nil, nil, nil, nil})[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.abort(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var tables []string
+	rows, err := db.Query("select name from sqlite_master where type in('table','index')and name not like'sqlite_%' order by name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+		var name string
+		rows.Scan(&name)
+		tables = append(tables, name)
+	}
+	if want := []string{"items", "items_Code", "items_Name", "items_PriceName"}; !slices.Equal(tables, want) {
+		t.Errorf("schema objects = %v, want %v", tables, want)
+	}
+
+	var price, photo, updated, flags string
+	var photoLen int
+	err = db.QueryRow("select price,typeof(photo),length(photo),updated,typeof(flags)||flags from items where id=1").Scan(&price, &photo, &photoLen, &updated, &flags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if price != "12345678.99" || photo != "blob" || photoLen != 0 || updated != "2026-10-17 01:02:03" || flags != "integer5" {
+		t.Errorf("row 1 = %s %s(%d) %s %s", price, photo, photoLen, updated, flags)
+	}
+	var count int
+	if err := db.QueryRow("select count(*) from items where price is null and hex(photo)='FF'").Scan(&count); err != nil || count != 1 {
+		t.Errorf("row 2 not found as written: %d, %v", count, err)
+	}
+}
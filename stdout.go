@@ -0,0 +1,149 @@
+package main
+
+import (
+	"io"
+	"os"
+	"regexp"
+
+	mysql "github.com/StirlingMarketingGroup/cool-mysql"
+	"github.com/pkg/errors"
+)
+
+// sqlStream is the - (or stdout) destination: one SQL script on stdout for
+// everything a run copies, ready to pipe into mysql. Tables load
+// concurrently, so each table's statements are spooled to a temp file and
+// written out whole, in table order, once every table is finalized; a run
+// that fails writes nothing past the header.
+type sqlStream struct {
+	w      io.Writer
+	spools map[string]*sqlSpool
+}
+
+// newSQLStream starts the script with the session settings a restore
+// needs.
+func newSQLStream(w io.Writer, sqlMode *string) (*sqlStream, error) {
+	s := &sqlStream{w: w, spools: make(map[string]*sqlSpool)}
+	header := "set foreign_key_checks=0;\nset unique_checks=0;\n"
+	if sqlMode != nil {
+		header += "set sql_mode='" + *sqlMode + "';\n"
+	}
+	if _, err := s.Write([]byte(header + "\n")); err != nil {
+		return nil, errors.Wrap(err, "write to stdout")
+	}
+	return s, nil
+}
+
+// Write writes straight to the script, for what's written after the tables.
+func (s *sqlStream) Write(p []byte) (int, error) {
+	stdoutMu.Lock()
+	defer stdoutMu.Unlock()
+	return s.w.Write(p)
+}
+
+// addTable sets up a table's spool, returning the writer its statements go
+// through, set up like base.
+func (s *sqlStream) addTable(name string, base *mysql.Database) (*mysql.Database, error) {
+	sp := new(sqlSpool)
+	db, err := mysql.NewWriter(sp)
+	if err != nil {
+		return nil, errors.Wrapf(err, "create stdout writer for %q", name)
+	}
+	db.DisableUnusedColumnWarnings = base.DisableUnusedColumnWarnings
+	db.Log = base.Log
+	s.spools[name] = sp
+	sp.db = db
+	return db, nil
+}
+
+// compoundStatementRegexp matches the CREATE statements whose bodies can
+// hold statements of their own.
+var compoundStatementRegexp = regexp.MustCompile(`(?is)^\s*create\s+(?:definer\s*=\s*\S+\s+)?(?:trigger|function|procedure|event)\b`)
+
+// exec runs stmt through db, the script's writer or one added with
+// addTable for table. The mysql client would end a trigger's or routine's
+// body at its first semicolon, so those are written between DELIMITER
+// lines instead, the way mysqldump writes them.
+func (s *sqlStream) exec(table string, db *mysql.Database, stmt string) error {
+	if !compoundStatementRegexp.MatchString(stmt) {
+		return db.Exec(stmt)
+	}
+	var w io.Writer = s
+	if table != "" {
+		w = s.spools[table]
+	}
+	_, err := io.WriteString(w, "DELIMITER ;;\n"+stmt+";;\nDELIMITER ;\n")
+	return errors.Wrap(err, "write to stdout")
+}
+
+// table returns the writer for a table added with addTable.
+func (s *sqlStream) table(name string) *mysql.Database {
+	return s.spools[name].db
+}
+
+// flush writes the spooled tables out in order.
+func (s *sqlStream) flush(tables []string) error {
+	for _, name := range tables {
+		sp, ok := s.spools[name]
+		if !ok || sp.f == nil {
+			continue
+		}
+		if _, err := sp.f.Seek(0, io.SeekStart); err != nil {
+			return errors.Wrapf(err, "read stdout spool for %q", name)
+		}
+		stdoutMu.Lock()
+		_, err := io.Copy(s.w, sp.f)
+		stdoutMu.Unlock()
+		if err != nil {
+			return errors.Wrap(err, "write to stdout")
+		}
+		sp.remove()
+		delete(s.spools, name)
+	}
+	return nil
+}
+
+// close ends the script, putting back the session settings, and removes
+// any spools left unwritten.
+func (s *sqlStream) close() error {
+	for _, sp := range s.spools {
+		sp.remove()
+	}
+	_, err := s.Write([]byte("set foreign_key_checks=1;\nset unique_checks=1;\n"))
+	return errors.Wrap(err, "write to stdout")
+}
+
+// discard removes the spools of a run that stopped, leaving the script
+// without the tables it didn't get to.
+func (s *sqlStream) discard() {
+	for name, sp := range s.spools {
+		sp.remove()
+		delete(s.spools, name)
+	}
+}
+
+// sqlSpool holds a table's statements until the script gets to it. The
+// file is created on the first write, so tables that write nothing don't
+// leave one.
+type sqlSpool struct {
+	db *mysql.Database
+	f  *os.File
+}
+
+func (sp *sqlSpool) Write(p []byte) (int, error) {
+	if sp.f == nil {
+		f, err := os.CreateTemp("", "swoof-*.sql")
+		if err != nil {
+			return 0, errors.Wrap(err, "create stdout spool file")
+		}
+		sp.f = f
+	}
+	return sp.f.Write(p)
+}
+
+func (sp *sqlSpool) remove() {
+	if sp.f != nil {
+		sp.f.Close()
+		os.Remove(sp.f.Name())
+		sp.f = nil
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	mysql "github.com/StirlingMarketingGroup/cool-mysql"
+)
+
+func TestSQLStream(t *testing.T) {
+	var out bytes.Buffer
+	mode := "NO_ENGINE_SUBSTITUTION"
+	s, err := newSQLStream(&out, &mode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base, err := mysql.NewWriter(&bytes.Buffer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a", "b", "empty", "failed"} {
+		if _, err := s.addTable(name, base); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Tables finish out of order, but the script keeps the order asked for.
+	spool := func(name, stmt string) *os.File {
+		t.Helper()
+		sp := s.spools[name]
+		if _, err := sp.Write([]byte(stmt)); err != nil {
+			t.Fatal(err)
+		}
+		return sp.f
+	}
+	b := spool("b", "insert into`b`values(2);\n")
+	a := spool("a", "insert into`a`values(1);\n")
+	failed := spool("failed", "insert into`failed`values(3);\n")
+	if s.spools["empty"].f != nil {
+		t.Error("a table that writes nothing shouldn't get a spool file")
+	}
+
+	if err := s.flush([]string{"a", "b", "empty"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Write([]byte("create view`v`as select 1;\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "set foreign_key_checks=0;\nset unique_checks=0;\nset sql_mode='NO_ENGINE_SUBSTITUTION';\n\n" +
+		"insert into`a`values(1);\n" +
+		"insert into`b`values(2);\n" +
+		"create view`v`as select 1;\n" +
+		"set foreign_key_checks=1;\nset unique_checks=1;\n"
+	if out.String() != want {
+		t.Errorf("script =\n%s\nwant\n%s", out.String(), want)
+	}
+	for _, f := range []*os.File{a, b, failed} {
+		if _, err := os.Stat(f.Name()); !os.IsNotExist(err) {
+			t.Errorf("spool %s wasn't removed", f.Name())
+		}
+	}
+}
+
+func TestSQLStreamDelimiter(t *testing.T) {
+	var out bytes.Buffer
+	s, err := newSQLStream(&out, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base, err := mysql.NewWriter(&bytes.Buffer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := s.addTable("t", base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	script, err := mysql.NewWriter(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	trigger := "CREATE TRIGGER `t_bi` BEFORE INSERT ON `t` FOR EACH ROW BEGIN set new.a = 1; set new.b = 2; END"
+	if err := s.exec("t", db, trigger); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.flush([]string{"t"}); err != nil {
+		t.Fatal(err)
+	}
+	proc := "CREATE DEFINER=`root`@`%` PROCEDURE `p`()\nBEGIN\n  select 1;\n  select 2;\nEND"
+	if err := s.exec("", script, proc); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "set foreign_key_checks=0;\nset unique_checks=0;\n\n" +
+		"DELIMITER ;;\n" + trigger + ";;\nDELIMITER ;\n" +
+		"DELIMITER ;;\n" + proc + ";;\nDELIMITER ;\n"
+	if out.String() != want {
+		t.Errorf("script =\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+func TestIsStdoutDest(t *testing.T) {
+	for _, tt := range []struct {
+		dsts string
+		sql  bool
+		any  bool
+	}{
+		{"-", true, true},
+		{"stdout", true, true},
+		{"STDOUT", true, true},
+		{"ndjson:-", false, true},
+		{"localhost, -", false, true},
+		{"file:-", false, false},
+		{"localhost", false, false},
+	} {
+		if got := isStdoutDest(tt.dsts); got != tt.sql {
+			t.Errorf("isStdoutDest(%q) = %v, want %v", tt.dsts, got, tt.sql)
+		}
+		if got := writesToStdout(tt.dsts); got != tt.any {
+			t.Errorf("writesToStdout(%q) = %v, want %v", tt.dsts, got, tt.any)
+		}
+	}
+}
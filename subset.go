@@ -0,0 +1,302 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	mysql "github.com/StirlingMarketingGroup/cool-mysql"
+	"github.com/pkg/errors"
+)
+
+// foreignKey is one foreign key constraint between two tables of the same
+// schema: table's columns reference refTable's refColumns.
+type foreignKey struct {
+	name       string
+	table      string
+	columns    []string
+	refTable   string
+	refColumns []string
+}
+
+// loadForeignKeys reads every foreign key within the source's schema.
+// References into other schemas aren't followed.
+func loadForeignKeys(ctx context.Context, db *mysql.Database) ([]*foreignKey, error) {
+	var rows []struct {
+		ConstraintName       string `mysql:"CONSTRAINT_NAME"`
+		TableName            string `mysql:"TABLE_NAME"`
+		ColumnName           string `mysql:"COLUMN_NAME"`
+		ReferencedTableName  string `mysql:"REFERENCED_TABLE_NAME"`
+		ReferencedColumnName string `mysql:"REFERENCED_COLUMN_NAME"`
+	}
+	if err := db.SelectContext(ctx, &rows, "select`CONSTRAINT_NAME`,`TABLE_NAME`,`COLUMN_NAME`,"+
+		"`REFERENCED_TABLE_NAME`,`REFERENCED_COLUMN_NAME`"+
+		"from`INFORMATION_SCHEMA`.`KEY_COLUMN_USAGE`"+
+		"where`TABLE_SCHEMA`=database()"+
+		"and`REFERENCED_TABLE_SCHEMA`=database()"+
+		"order by`TABLE_NAME`,`CONSTRAINT_NAME`,`ORDINAL_POSITION`", 0); err != nil {
+		return nil, errors.Wrap(err, "select foreign keys")
+	}
+
+	var fks []*foreignKey
+	for _, r := range rows {
+		if n := len(fks); n == 0 || fks[n-1].table != r.TableName || fks[n-1].name != r.ConstraintName {
+			fks = append(fks, &foreignKey{
+				name:     r.ConstraintName,
+				table:    r.TableName,
+				refTable: r.ReferencedTableName,
+			})
+		}
+		fk := fks[len(fks)-1]
+		fk.columns = append(fk.columns, r.ColumnName)
+		fk.refColumns = append(fk.refColumns, r.ReferencedColumnName)
+	}
+	return fks, nil
+}
+
+type subsetReasonKind int
+
+const (
+	subsetRoot subsetReasonKind = iota
+
+	// The table's rows are referenced by an included table's rows.
+	subsetParent
+
+	// The table's rows reference an included table's rows.
+	subsetChild
+)
+
+// subsetReason is why a table is part of a subset. Each one selects some of
+// its rows, and the table copies the rows any of them select.
+type subsetReason struct {
+	kind subsetReasonKind
+	fk   *foreignKey
+}
+
+// subsetPlan is the set of tables, and the rows of each, that -subset copies
+// so every included row's foreign keys resolve on the destination.
+type subsetPlan struct {
+	// In the order they were reached: roots, then children, then parents.
+	tables  []string
+	reasons map[string][]subsetReason
+
+	// Foreign keys from a table to itself, followed to every ancestor row.
+	selfRefs map[string][]*foreignKey
+
+	// Each table's WHERE condition, "" when it's copied in full.
+	wheres map[string]string
+
+	// Foreign keys that close a loop between tables, and so were only
+	// followed as far as the loop.
+	cycles []*foreignKey
+
+	// Each root's own filter, "" for all of its rows.
+	rootWheres map[string]string
+}
+
+// planSubset works out which rows of which tables to copy, starting from the
+// roots filtered by their wheres. Parent rows are followed from every included
+// table, since those are what keeps foreign keys from dangling. With
+// children, rows that reference the roots are followed too, and their
+// children in turn, but never the children of a parent, which would pull in
+// every sibling of every referenced row.
+func planSubset(fks []*foreignKey, roots []string, wheres map[string]string, children bool) *subsetPlan {
+	p := &subsetPlan{
+		reasons:    map[string][]subsetReason{},
+		selfRefs:   map[string][]*foreignKey{},
+		wheres:     map[string]string{},
+		rootWheres: wheres,
+	}
+	add := func(table string, r subsetReason) bool {
+		_, seen := p.reasons[table]
+		if !seen {
+			p.tables = append(p.tables, table)
+		}
+		p.reasons[table] = append(p.reasons[table], r)
+		return !seen
+	}
+
+	for _, t := range roots {
+		if _, seen := p.reasons[t]; !seen {
+			add(t, subsetReason{kind: subsetRoot})
+		}
+	}
+
+	if children {
+		queue := append([]string(nil), p.tables...)
+		for len(queue) != 0 {
+			t := queue[0]
+			queue = queue[1:]
+			for _, fk := range fks {
+				if fk.refTable == t && fk.table != t && add(fk.table, subsetReason{subsetChild, fk}) {
+					queue = append(queue, fk.table)
+				}
+			}
+		}
+	}
+
+	// p.tables grows as parents are found, so they're walked in turn.
+	for i := 0; i < len(p.tables); i++ {
+		t := p.tables[i]
+		for _, fk := range fks {
+			if fk.table != t {
+				continue
+			}
+			if fk.refTable == t {
+				p.selfRefs[t] = append(p.selfRefs[t], fk)
+				continue
+			}
+			// A child's rows were picked by what they reference, so that
+			// parent already has them.
+			if slices.Contains(p.reasons[t], subsetReason{subsetChild, fk}) {
+				continue
+			}
+			add(fk.refTable, subsetReason{subsetParent, fk})
+		}
+	}
+
+	for _, t := range p.tables {
+		w, all := p.filter(t, map[string]bool{}, nil)
+		if !all {
+			p.wheres[t] = w
+		}
+	}
+	return p
+}
+
+func quoteNames(columns []string) []string {
+	quoted := make([]string, len(columns))
+	for i, c := range columns {
+		quoted[i] = "`" + c + "`"
+	}
+	return quoted
+}
+
+// quoteTuple quotes columns as the left side of an in(), which needs a row
+// constructor for more than one.
+func quoteTuple(columns []string) string {
+	if len(columns) == 1 {
+		return "`" + columns[0] + "`"
+	}
+	return "(" + strings.Join(quoteNames(columns), ",") + ")"
+}
+
+// filter builds the condition selecting table's rows, or reports that it
+// copies them all. Each reason nests the condition of the table it came
+// from, so visiting guards against loops, and from is the foreign key the
+// caller came through: following it back out would only select the rows
+// the caller started from, or their siblings.
+func (p *subsetPlan) filter(table string, visiting map[string]bool, from *foreignKey) (string, bool) {
+	visiting[table] = true
+	defer delete(visiting, table)
+
+	var conds []string
+	for _, r := range p.reasons[table] {
+		if r.fk != nil && r.fk == from {
+			continue
+		}
+		switch r.kind {
+		case subsetRoot:
+			w := p.rootWheres[table]
+			if w == "" {
+				return "", true
+			}
+			conds = append(conds, "("+w+")")
+		case subsetParent, subsetChild:
+			other, cols, otherCols := r.fk.table, r.fk.refColumns, r.fk.columns
+			if r.kind == subsetChild {
+				other, cols, otherCols = r.fk.refTable, r.fk.columns, r.fk.refColumns
+			}
+			if visiting[other] {
+				p.addCycle(r.fk)
+				continue
+			}
+			sub := "select " + strings.Join(quoteNames(otherCols), ",") + " from`" + other + "`"
+			if w, all := p.filter(other, visiting, r.fk); w == "false" {
+				continue
+			} else if !all {
+				sub += " where " + w
+			}
+			conds = append(conds, quoteTuple(cols)+" in("+sub+")")
+		}
+	}
+
+	w := "false"
+	if len(conds) != 0 {
+		w = strings.Join(conds, " or ")
+	}
+	if fks := p.selfRefs[table]; len(fks) != 0 && len(conds) != 0 {
+		w = ancestorsFilter(table, fks, w)
+	}
+	return w, false
+}
+
+// ancestorsFilter extends a table's condition to every row its selected rows
+// reference through its own foreign keys, like a comment's parent comments,
+// with a recursive CTE, so it needs MySQL 8. Union drops rows already found,
+// so loops in the data end.
+func ancestorsFilter(table string, fks []*foreignKey, where string) string {
+	var columns []string
+	for _, fk := range fks {
+		for _, c := range slices.Concat(fk.refColumns, fk.columns) {
+			if !slices.ContainsFunc(columns, func(v string) bool { return strings.EqualFold(v, c) }) {
+				columns = append(columns, c)
+			}
+		}
+	}
+
+	q := "(with recursive`_swoof_ancestors`as(select " + strings.Join(quoteNames(columns), ",") +
+		" from`" + table + "`where " + where
+	for _, fk := range fks {
+		on := make([]string, len(fk.columns))
+		for i := range fk.columns {
+			on[i] = "`" + table + "`.`" + fk.refColumns[i] + "`=`_swoof_ancestors`.`" + fk.columns[i] + "`"
+		}
+		q += " union select " + strings.Join(qualify(table, columns), ",") +
+			" from`" + table + "`join`_swoof_ancestors`on " + strings.Join(on, " and ")
+	}
+	key := fks[0].refColumns
+	return quoteTuple(key) + " in" + q + ")select " + strings.Join(quoteNames(key), ",") + " from`_swoof_ancestors`)"
+}
+
+func qualify(table string, columns []string) []string {
+	quoted := make([]string, len(columns))
+	for i, c := range columns {
+		quoted[i] = "`" + table + "`.`" + c + "`"
+	}
+	return quoted
+}
+
+func (p *subsetPlan) addCycle(fk *foreignKey) {
+	if !slices.Contains(p.cycles, fk) {
+		p.cycles = append(p.cycles, fk)
+	}
+}
+
+// describe lists the plan a line per table, for printing before the run.
+func (p *subsetPlan) describe() []string {
+	var lines []string
+	for _, t := range p.tables {
+		var why []string
+		for _, r := range p.reasons[t] {
+			switch r.kind {
+			case subsetRoot:
+				if w := p.rootWheres[t]; w == "" {
+					why = append(why, "root, all rows")
+				} else {
+					why = append(why, "root where "+w)
+				}
+			case subsetParent:
+				why = append(why, fmt.Sprintf("referenced by %s through %s", r.fk.table, r.fk.name))
+			case subsetChild:
+				why = append(why, fmt.Sprintf("references %s through %s", r.fk.refTable, r.fk.name))
+			}
+		}
+		for _, fk := range p.selfRefs[t] {
+			why = append(why, "with ancestors through "+fk.name)
+		}
+		lines = append(lines, t+": "+strings.Join(why, "; "))
+	}
+	return lines
+}
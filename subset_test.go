@@ -0,0 +1,118 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func testForeignKeys() []*foreignKey {
+	return []*foreignKey{
+		{"fk_orders_customers", "orders", []string{"CustomerID"}, "customers", []string{"ID"}},
+		{"fk_items_orders", "order_items", []string{"OrderID"}, "orders", []string{"ID"}},
+		{"fk_items_products", "order_items", []string{"ProductID"}, "products", []string{"ID"}},
+		{"fk_products_categories", "products", []string{"CategoryID"}, "categories", []string{"ID"}},
+		{"fk_categories_parent", "categories", []string{"ParentID"}, "categories", []string{"ID"}},
+		{"fk_customers_regions", "customers", []string{"RegionCode", "CountryCode"}, "regions", []string{"Code", "Country"}},
+	}
+}
+
+func TestPlanSubsetParents(t *testing.T) {
+	p := planSubset(testForeignKeys(), []string{"orders"}, map[string]string{"orders": "Created>'2025-01-01'"}, false)
+
+	if want := []string{"orders", "customers", "regions"}; !slices.Equal(p.tables, want) {
+		t.Fatalf("tables = %v, want %v", p.tables, want)
+	}
+	tests := map[string]string{
+		"orders":    "(Created>'2025-01-01')",
+		"customers": "`ID` in(select `CustomerID` from`orders` where (Created>'2025-01-01'))",
+		"regions": "(`Code`,`Country`) in(select `RegionCode`,`CountryCode` from`customers` where " +
+			"`ID` in(select `CustomerID` from`orders` where (Created>'2025-01-01')))",
+	}
+	for table, want := range tests {
+		if got := p.wheres[table]; got != want {
+			t.Errorf("wheres[%s] = %s\nwant %s", table, got, want)
+		}
+	}
+	if len(p.cycles) != 0 {
+		t.Errorf("cycles = %v, want none", p.cycles)
+	}
+}
+
+func TestPlanSubsetChildren(t *testing.T) {
+	p := planSubset(testForeignKeys(), []string{"orders"}, map[string]string{"orders": "ID=1"}, true)
+
+	if want := []string{"orders", "order_items", "customers", "products", "regions", "categories"}; !slices.Equal(p.tables, want) {
+		t.Fatalf("tables = %v, want %v", p.tables, want)
+	}
+
+	// The items of the root rows, not of every order sharing their products.
+	if got, want := p.wheres["order_items"], "`OrderID` in(select `ID` from`orders` where (ID=1))"; got != want {
+		t.Errorf("wheres[order_items] = %s\nwant %s", got, want)
+	}
+
+	// Orders are only referenced back by their own items, which adds nothing.
+	if got, want := p.wheres["orders"], "(ID=1)"; got != want {
+		t.Errorf("wheres[orders] = %s, want %s", got, want)
+	}
+	if got := p.wheres["products"]; !strings.HasPrefix(got, "`ID` in(select `ProductID` from`order_items` where `OrderID` in(") {
+		t.Errorf("wheres[products] = %s, want the products of the root's items", got)
+	}
+	if len(p.cycles) != 0 {
+		t.Errorf("cycles = %v, want none", p.cycles)
+	}
+}
+
+func TestPlanSubsetSelfReference(t *testing.T) {
+	p := planSubset(testForeignKeys(), []string{"categories"}, map[string]string{"categories": "ID=5"}, false)
+
+	want := "`ID` in(with recursive`_swoof_ancestors`as(select `ID`,`ParentID` from`categories`where (ID=5)" +
+		" union select `categories`.`ID`,`categories`.`ParentID` from`categories`join`_swoof_ancestors`on `categories`.`ID`=`_swoof_ancestors`.`ParentID`" +
+		")select `ID` from`_swoof_ancestors`)"
+	if got := p.wheres["categories"]; got != want {
+		t.Errorf("wheres[categories] = %s\nwant %s", got, want)
+	}
+	if got := p.describe(); !slices.Equal(got, []string{"categories: root where ID=5; with ancestors through fk_categories_parent"}) {
+		t.Errorf("describe = %q", got)
+	}
+}
+
+func TestPlanSubsetAllRows(t *testing.T) {
+	p := planSubset(testForeignKeys(), []string{"orders", "customers"}, map[string]string{"orders": "ID<10"}, false)
+
+	if got, want := p.wheres["orders"], "(ID<10)"; got != want {
+		t.Errorf("wheres[orders] = %s, want %s", got, want)
+	}
+	// Customers is a root without a filter, so it's copied in full despite
+	// also being a parent of orders.
+	if _, ok := p.wheres["customers"]; ok {
+		t.Error("a root without a where should copy every row")
+	}
+	if got, want := p.wheres["regions"], "(`Code`,`Country`) in(select `RegionCode`,`CountryCode` from`customers`)"; got != want {
+		t.Errorf("wheres[regions] = %s, want %s", got, want)
+	}
+}
+
+func TestPlanSubsetCycle(t *testing.T) {
+	fks := []*foreignKey{
+		{"fk_a_b", "a", []string{"BID"}, "b", []string{"ID"}},
+		{"fk_b_a", "b", []string{"AID"}, "a", []string{"ID"}},
+	}
+	p := planSubset(fks, []string{"a"}, map[string]string{"a": "ID=1"}, false)
+
+	if got, want := p.wheres["b"], "`ID` in(select `BID` from`a` where (ID=1))"; got != want {
+		t.Errorf("wheres[b] = %s, want %s", got, want)
+	}
+	// Each side of the loop is cut off once.
+	var names []string
+	for _, fk := range p.cycles {
+		names = append(names, fk.name)
+	}
+	slices.Sort(names)
+	if want := []string{"fk_a_b", "fk_b_a"}; !slices.Equal(names, want) {
+		t.Errorf("cycles = %v, want %v", names, want)
+	}
+	if got, want := p.wheres["a"], "(ID=1)"; got != want {
+		t.Errorf("wheres[a] = %s, want %s", got, want)
+	}
+}
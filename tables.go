@@ -0,0 +1,115 @@
+package main
+
+import (
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// tableSpec is one table's options from the -tables-file, for copying each
+// table its own way in a single run:
+//
+//	orders:
+//	  where: Created > now() - interval 90 day
+//	products: {}
+//	sessions:
+//	  exclude_columns: [Payload]
+//	  order_by: ID desc
+//	  limit: 100000
+//	  as: recent_sessions
+type tableSpec struct {
+	// Replaces -w for this table.
+	Where string `yaml:"where"`
+
+	// Columns that aren't copied, left to their defaults on the destination.
+	ExcludeColumns []string `yaml:"exclude_columns"`
+
+	OrderBy string `yaml:"order_by"`
+	Limit   int64  `yaml:"limit"`
+
+	// The table's name on every destination.
+	As string `yaml:"as"`
+}
+
+// tableSpecs maps table names, or globs of them, to their options.
+type tableSpecs map[string]tableSpec
+
+func getTableSpecs(file string) (tableSpecs, error) {
+	y, err := os.ReadFile(file)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read tables file %q", file)
+	}
+	// Pointers so a bare `products:` lists the table with no options.
+	var parsed map[string]*tableSpec
+	if err := yaml.Unmarshal(y, &parsed); err != nil {
+		return nil, errors.Wrapf(err, "parse tables file %q", file)
+	}
+	specs := make(tableSpecs, len(parsed))
+	for name, s := range parsed {
+		if s == nil {
+			s = &tableSpec{}
+		}
+		if s.As != "" && isTablePattern(name) {
+			return nil, errors.Errorf("%q: as can't rename every table a pattern matches", name)
+		}
+		if s.Limit < 0 {
+			return nil, errors.Errorf("%q: limit %d is negative", name, s.Limit)
+		}
+		specs[name] = *s
+	}
+	return specs, nil
+}
+
+func isTablePattern(name string) bool {
+	return strings.ContainsAny(name, "*?")
+}
+
+// names returns the file's tables and patterns, to resolve like table
+// arguments.
+func (s tableSpecs) names() []string {
+	names := make([]string, 0, len(s))
+	for name := range s {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// lookup returns a table's options: its own entry, or else the first
+// pattern, by name, that matches it.
+func (s tableSpecs) lookup(table string) tableSpec {
+	if spec, ok := s[table]; ok {
+		return spec
+	}
+	for _, name := range s.names() {
+		if ok, _ := path.Match(name, table); ok && isTablePattern(name) {
+			return s[name]
+		}
+	}
+	return tableSpec{}
+}
+
+// excludes reports whether column is left out of the copy.
+func (s tableSpec) excludes(column string) bool {
+	return slices.ContainsFunc(s.ExcludeColumns, func(c string) bool {
+		return strings.EqualFold(c, column)
+	})
+}
+
+// ordered reports whether rows have to be read in one stream in the spec's
+// own order, rather than split or resumed by primary key.
+func (s tableSpec) ordered() bool {
+	return s.OrderBy != "" || s.Limit > 0
+}
+
+// destName is the table's name on the destinations.
+func (s tableSpec) destName(table string) string {
+	if s.As != "" {
+		return s.As
+	}
+	return table
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestGetTableSpecs(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "tables.yaml")
+	if err := os.WriteFile(file, []byte(`orders:
+  where: Created > now() - interval 90 day
+products:
+sessions:
+  exclude_columns: [Payload]
+  order_by: ID desc
+  limit: 1000
+  as: recent_sessions
+audit_*:
+  where: ID > 100
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	specs, err := getTableSpecs(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"audit_*", "orders", "products", "sessions"}; !slices.Equal(specs.names(), want) {
+		t.Errorf("names = %v, want %v", specs.names(), want)
+	}
+
+	if got := specs.lookup("orders").Where; got != "Created > now() - interval 90 day" {
+		t.Errorf("orders where = %q", got)
+	}
+	if got := specs.lookup("products"); got.Where != "" || got.ordered() || got.destName("products") != "products" {
+		t.Errorf("products = %+v, want no options", got)
+	}
+
+	sessions := specs.lookup("sessions")
+	if !sessions.excludes("payload") || sessions.excludes("ID") {
+		t.Errorf("sessions excludes = %v, want only Payload, case-insensitively", sessions.ExcludeColumns)
+	}
+	if !sessions.ordered() || sessions.Limit != 1000 || sessions.OrderBy != "ID desc" {
+		t.Errorf("sessions = %+v", sessions)
+	}
+	if got := sessions.destName("sessions"); got != "recent_sessions" {
+		t.Errorf("sessions destName = %q", got)
+	}
+
+	if got := specs.lookup("audit_logins").Where; got != "ID > 100" {
+		t.Errorf("audit_logins where = %q, want the pattern's", got)
+	}
+	if got := specs.lookup("customers"); got.Where != "" {
+		t.Errorf("customers = %+v, want no options", got)
+	}
+}
+
+func TestGetTableSpecsInvalid(t *testing.T) {
+	tests := map[string]string{
+		"pattern rename": "audit_*:\n  as: audit\n",
+		"negative limit": "orders:\n  limit: -1\n",
+		"not a map":      "- orders\n",
+	}
+	for name, y := range tests {
+		file := filepath.Join(t.TempDir(), "tables.yaml")
+		if err := os.WriteFile(file, []byte(y), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := getTableSpecs(file); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
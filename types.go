@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+
+	mysql "github.com/StirlingMarketingGroup/cool-mysql"
+)
+
+// rowField returns a new field for the dynamic row struct that a column of
+// the given INFORMATION_SCHEMA DATA_TYPE scans into and is written back
+// from unchanged, or false for a type we don't know. All field types are
+// pointers so mysql scanning handles NULL gracefully.
+//
+// With lossless, floats are carried as the text the server printed rather
+// than parsed into a float64 and formatted again.
+func rowField(dataType string, unsigned, lossless bool) (any, bool) {
+	switch dataType {
+	case "tinyint":
+		if unsigned {
+			return new(uint8), true
+		}
+		return new(int8), true
+	case "smallint":
+		if unsigned {
+			return new(uint16), true
+		}
+		return new(int16), true
+	case "int", "mediumint":
+		if unsigned {
+			return new(uint32), true
+		}
+		return new(int32), true
+	case "bigint":
+		if unsigned {
+			return new(uint64), true
+		}
+		return new(int64), true
+	case "year":
+		// A number, since 0 writes back as 0000 where the string '0'
+		// would be read as 2000.
+		return new(uint16), true
+	case "float", "double":
+		if lossless {
+			// The server prints the shortest text that reads back as the
+			// same float, which a float64 round trip can lengthen.
+			return new(mysql.Raw), true
+		}
+		return new(float64), true
+	case "decimal":
+		// mysql.Raw is passed directly into the query with no escaping;
+		// safe here because a decimal from mysql can't contain breaking characters.
+		return new(mysql.Raw), true
+	case "timestamp", "date", "datetime":
+		// As text, so zero dates and fractional seconds are written back
+		// exactly as they were read.
+		return new(string), true
+	case "time":
+		// As text, which keeps negative and over 24 hour values and
+		// fractional seconds, and is read back the same way.
+		return new(string), true
+	case "binary", "varbinary", "blob", "tinyblob", "mediumblob", "longblob":
+		return new([]byte), true
+	case "bit":
+		// The value's big-endian bytes, which a bit column takes back as a
+		// hex literal.
+		return new([]byte), true
+	case "geometry", "point", "linestring", "polygon", "multipoint", "multilinestring",
+		"multipolygon", "geometrycollection", "geomcollection":
+		// MySQL's internal format, a little-endian SRID followed by WKB,
+		// which a spatial column takes back as is, SRID included.
+		return new([]byte), true
+	case "vector":
+		// Packed little-endian float32s, which a vector column takes back
+		// as a binary string.
+		return new([]byte), true
+	case "char", "varchar", "text", "tinytext", "mediumtext", "longtext", "enum":
+		return new(string), true
+	case "uuid", "inet4", "inet6":
+		// MariaDB's, read and written in their text form.
+		return new(string), true
+	case "json":
+		// json.RawMessage lets cool mysql surround the value with charset info,
+		// since mysql needs utf8 charset info for json columns.
+		return new(json.RawMessage), true
+	case "set":
+		return new(any), true
+	}
+	return nil, false
+}
+
+// isSpatialType reports whether values of dataType are geometries, carried
+// as MySQL's internal binary format.
+func isSpatialType(dataType string) bool {
+	switch dataType {
+	case "geometry", "point", "linestring", "polygon", "multipoint", "multilinestring",
+		"multipolygon", "geometrycollection", "geomcollection":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	dynamicstruct "github.com/Ompluscator/dynamic-struct"
+	mysql "github.com/StirlingMarketingGroup/cool-mysql"
+)
+
+// Every DATA_TYPE MySQL 9 and MariaDB 11 report for a base table column.
+var allDataTypes = []string{
+	"tinyint", "smallint", "mediumint", "int", "bigint", "decimal", "float", "double", "bit",
+	"date", "datetime", "timestamp", "time", "year",
+	"char", "varchar", "binary", "varbinary",
+	"tinyblob", "blob", "mediumblob", "longblob", "tinytext", "text", "mediumtext", "longtext",
+	"enum", "set", "json", "vector",
+	"geometry", "point", "linestring", "polygon", "multipoint", "multilinestring",
+	"multipolygon", "geometrycollection", "geomcollection",
+	"uuid", "inet4", "inet6",
+}
+
+func TestRowFieldCoversEveryType(t *testing.T) {
+	for _, dataType := range allDataTypes {
+		for _, unsigned := range []bool{false, true} {
+			for _, lossless := range []bool{false, true} {
+				v, ok := rowField(dataType, unsigned, lossless)
+				if !ok {
+					t.Errorf("rowField(%q, %v, %v) is unknown", dataType, unsigned, lossless)
+					continue
+				}
+				if reflect.TypeOf(v).Kind() != reflect.Pointer {
+					t.Errorf("rowField(%q, %v, %v) = %T, want a pointer so NULLs scan", dataType, unsigned, lossless, v)
+				}
+			}
+		}
+	}
+	if _, ok := rowField("hologram", false, false); ok {
+		t.Error("an unknown type should be reported")
+	}
+}
+
+type literalKind int
+
+const (
+	literalNull literalKind = iota
+	literalNumber
+	literalText
+	literalBinary
+)
+
+// insertedLiteral writes a one-column row of the field rowField gives
+// dataType, holding value as the driver would scan it, through a
+// mysql.NewWriter and returns the value literal it wrote, decoded.
+func insertedLiteral(t *testing.T, dataType string, unsigned, lossless bool, value any) (literalKind, []byte) {
+	t.Helper()
+
+	field, ok := rowField(dataType, unsigned, lossless)
+	if !ok {
+		t.Fatalf("rowField(%q) is unknown", dataType)
+	}
+	s := dynamicstruct.NewStruct()
+	s.AddField("F1", field, `mysql:"c"`)
+	structType := reflect.TypeOf(s.Build().New()).Elem()
+
+	row := reflect.New(structType).Elem()
+	if value != nil {
+		p := reflect.New(structType.Field(0).Type.Elem())
+		p.Elem().Set(reflect.ValueOf(value).Convert(p.Elem().Type()))
+		row.Field(0).Set(p)
+	}
+	rows := reflect.MakeSlice(reflect.SliceOf(structType), 0, 1)
+	rows = reflect.Append(rows, row)
+
+	var buf bytes.Buffer
+	db, err := mysql.NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.I().InsertContext(t.Context(), "insert into`t`(`c`)", rows.Interface()); err != nil {
+		t.Fatal(err)
+	}
+
+	q := buf.String()
+	i := strings.Index(strings.ToLower(q), "values")
+	if i == -1 {
+		t.Fatalf("no values in %q", q)
+	}
+	lit, ok := firstTupleValue(q[i+len("values"):])
+	if !ok {
+		t.Fatalf("no value tuple in %q", q)
+	}
+	kind, b, err := decodeLiteral(lit)
+	if err != nil {
+		t.Fatalf("decode %q: %v", lit, err)
+	}
+	return kind, b
+}
+
+// firstTupleValue returns the contents of the first parenthesized tuple in
+// s, which for one column is its value literal.
+func firstTupleValue(s string) (string, bool) {
+	start := strings.IndexByte(s, '(')
+	if start == -1 {
+		return "", false
+	}
+	depth := 0
+	var quote byte
+	for i := start; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+			if depth == 0 {
+				return strings.TrimSpace(s[start+1 : i]), true
+			}
+		}
+	}
+	return "", false
+}
+
+// decodeLiteral reads a MySQL value literal in any of the forms a writer
+// might choose: NULL, numbers, hex and bit literals, quoted strings, charset
+// introducers, trailing collations, and convert(... using ...).
+func decodeLiteral(lit string) (literalKind, []byte, error) {
+	lit = strings.TrimSpace(lit)
+	lower := strings.ToLower(lit)
+
+	if lower == "null" {
+		return literalNull, nil, nil
+	}
+	if strings.HasPrefix(lower, "convert(") && strings.HasSuffix(lit, ")") {
+		using := strings.LastIndex(lower, " using ")
+		if using == -1 {
+			return 0, nil, strconv.ErrSyntax
+		}
+		_, b, err := decodeLiteral(lit[len("convert("):using])
+		charset := strings.TrimSpace(lower[using+len(" using ") : len(lit)-1])
+		if charset == "binary" {
+			return literalBinary, b, err
+		}
+		return literalText, b, err
+	}
+	if i := strings.LastIndex(lower, " collate "); i != -1 && !strings.ContainsAny(lower[i:], "'\"") {
+		return decodeLiteral(lit[:i])
+	}
+	if strings.HasPrefix(lit, "_") {
+		end := strings.IndexAny(lit, " '\"")
+		if end == -1 {
+			end = strings.Index(lower, "0x")
+		}
+		if end == -1 {
+			return 0, nil, strconv.ErrSyntax
+		}
+		_, b, err := decodeLiteral(lit[end:])
+		if lower[1:end] == "binary" {
+			return literalBinary, b, err
+		}
+		return literalText, b, err
+	}
+
+	switch {
+	case strings.HasPrefix(lower, "0x"):
+		b, err := hex.DecodeString(lit[2:])
+		return literalBinary, b, err
+	case strings.HasPrefix(lower, "x'") && strings.HasSuffix(lit, "'"):
+		b, err := hex.DecodeString(lit[2 : len(lit)-1])
+		return literalBinary, b, err
+	case strings.HasPrefix(lower, "b'") && strings.HasSuffix(lit, "'"):
+		bits := lit[2 : len(lit)-1]
+		n, err := strconv.ParseUint(bits, 2, 64)
+		b := binary.BigEndian.AppendUint64(nil, n)
+		return literalBinary, b[8-(len(bits)+7)/8:], err
+	case len(lit) >= 2 && (lit[0] == '\'' || lit[0] == '"') && lit[len(lit)-1] == lit[0]:
+		return literalText, unescapeQuoted(lit[1:len(lit)-1], lit[0]), nil
+	}
+	if _, err := strconv.ParseFloat(lit, 64); err != nil {
+		return 0, nil, err
+	}
+	return literalNumber, []byte(lit), nil
+}
+
+func unescapeQuoted(s string, quote byte) []byte {
+	var b []byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s):
+			i++
+			switch s[i] {
+			case '0':
+				b = append(b, 0)
+			case 'n':
+				b = append(b, '\n')
+			case 'r':
+				b = append(b, '\r')
+			case 'Z':
+				b = append(b, 26)
+			default:
+				b = append(b, s[i])
+			}
+		case c == quote && i+1 < len(s) && s[i+1] == quote:
+			b = append(b, quote)
+			i++
+		default:
+			b = append(b, c)
+		}
+	}
+	return b
+}
+
+func TestDecodeLiteral(t *testing.T) {
+	tests := []struct {
+		lit  string
+		kind literalKind
+		want string
+	}{
+		{"NULL", literalNull, ""},
+		{"-12.5", literalNumber, "-12.5"},
+		{"0x0102", literalBinary, "\x01\x02"},
+		{"X'ff'", literalBinary, "\xff"},
+		{"b'100000001'", literalBinary, "\x01\x01"},
+		{"_binary 0x00", literalBinary, "\x00"},
+		{"_utf8mb4 0x6869", literalText, "hi"},
+		{"_utf8mb4'it''s' collate utf8mb4_bin", literalText, "it's"},
+		{"'a\\\\b\\n'", literalText, "a\\b\n"},
+		{"convert(0x6869 using utf8mb4)", literalText, "hi"},
+	}
+	for _, tt := range tests {
+		kind, b, err := decodeLiteral(tt.lit)
+		if err != nil || kind != tt.kind || string(b) != tt.want {
+			t.Errorf("decodeLiteral(%q) = %v, %q, %v, want %v, %q", tt.lit, kind, b, err, tt.kind, tt.want)
+		}
+	}
+}
+
+// littleEndianFloats packs a vector the way MySQL stores one.
+func littleEndianFloats(fs ...float32) []byte {
+	var b []byte
+	for _, f := range fs {
+		b = binary.LittleEndian.AppendUint32(b, math.Float32bits(f))
+	}
+	return b
+}
+
+// A POINT(1 2) with SRID 4326 in MySQL's internal format.
+var point4326 = append([]byte{0xe6, 0x10, 0, 0, 1, 1, 0, 0, 0},
+	append(binary.LittleEndian.AppendUint64(nil, math.Float64bits(1)),
+		binary.LittleEndian.AppendUint64(nil, math.Float64bits(2))...)...)
+
+func TestRowFieldRoundTrip(t *testing.T) {
+	tests := []struct {
+		name     string
+		dataType string
+		unsigned bool
+
+		// As scanned from the text protocol.
+		value any
+
+		kinds []literalKind
+		want  []byte
+	}{
+		{"bit", "bit", false, []byte{0x01, 0xff}, []literalKind{literalBinary}, []byte{0x01, 0xff}},
+		{"bit zero byte", "bit", false, []byte{0x00}, []literalKind{literalBinary}, []byte{0x00}},
+		{"year", "year", false, uint16(2155), []literalKind{literalNumber}, []byte("2155")},
+		{"year zero", "year", false, uint16(0), []literalKind{literalNumber}, []byte("0")},
+		{"time negative", "time", false, "-838:59:59.000000", []literalKind{literalText}, []byte("-838:59:59.000000")},
+		{"time over a day", "time", false, "100:00:00.5", []literalKind{literalText}, []byte("100:00:00.5")},
+		{"point with srid", "point", false, point4326, []literalKind{literalBinary}, point4326},
+		{"geometry", "geometry", false, point4326, []literalKind{literalBinary}, point4326},
+		{"geomcollection", "geomcollection", false, point4326, []literalKind{literalBinary}, point4326},
+		{"vector", "vector", false, littleEndianFloats(1.5, -2, 0), []literalKind{literalBinary}, littleEndianFloats(1.5, -2, 0)},
+		{"uuid", "uuid", false, "123e4567-e89b-12d3-a456-426614174000", []literalKind{literalText}, []byte("123e4567-e89b-12d3-a456-426614174000")},
+		{"inet6", "inet6", false, "2001:db8::1", []literalKind{literalText}, []byte("2001:db8::1")},
+		{"mediumint unsigned", "mediumint", true, uint32(16777215), []literalKind{literalNumber}, []byte("16777215")},
+		{"bigint unsigned", "bigint", true, uint64(math.MaxUint64), []literalKind{literalNumber}, []byte("18446744073709551615")},
+		{"decimal", "decimal", false, mysql.Raw("-0.0100"), []literalKind{literalNumber}, []byte("-0.0100")},
+		{"varbinary", "varbinary", false, []byte{0, 0xfe}, []literalKind{literalBinary}, []byte{0, 0xfe}},
+		{"json", "json", false, []byte(`{"a":[1]}`), []literalKind{literalText}, []byte(`{"a":[1]}`)},
+		{"null", "point", false, nil, []literalKind{literalNull}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kind, got := insertedLiteral(t, tt.dataType, tt.unsigned, false, tt.value)
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("wrote %x, want %x", got, tt.want)
+			}
+			ok := false
+			for _, k := range tt.kinds {
+				ok = ok || k == kind
+			}
+			if !ok {
+				t.Errorf("wrote a literal of kind %v, want one of %v", kind, tt.kinds)
+			}
+		})
+	}
+}
+
+func TestRowFieldLossless(t *testing.T) {
+	tests := []struct {
+		dataType string
+
+		// As the server prints it.
+		text string
+	}{
+		{"float", "0.1"},
+		{"float", "3.40282e38"},
+		{"float", "-1.17549e-38"},
+		{"double", "0.30000000000000004"},
+		{"double", "1.7976931348623157e308"},
+	}
+	for _, tt := range tests {
+		kind, got := insertedLiteral(t, tt.dataType, false, true, mysql.Raw(tt.text))
+		if kind != literalNumber || string(got) != tt.text {
+			t.Errorf("%s %s wrote %v %q, want the number as printed", tt.dataType, tt.text, kind, got)
+		}
+	}
+
+	// Without it, the value goes through a float64 and comes out as
+	// whatever strconv makes of it.
+	field, _ := rowField("float", false, false)
+	if _, ok := field.(*float64); !ok {
+		t.Errorf("float field = %T, want *float64 outside lossless", field)
+	}
+}
@@ -31,7 +31,8 @@ const (
 	statusRunning
 	statusRetrying
 	statusDone      // imported into temp table, awaiting swap. Blue.
-	statusFinalized // swap + triggers complete. Green. -insert-ignore lands here directly.
+	statusFinalized // swap + triggers complete. Green. Direct writes land here directly.
+	statusFollowing // -follow applying binlog changes. Current counts applied changes.
 	statusFailed
 )
 
@@ -45,6 +46,9 @@ type tableState struct {
 	StartedAt  atomic.Int64
 	FinishedAt atomic.Int64
 	LastCause  atomic.Pointer[string]
+
+	// -follow: how far behind the source the last applied change was.
+	Lag atomic.Int64
 }
 
 func newTableState(name string) *tableState {
@@ -97,6 +101,13 @@ func (s *tableState) Increment() {
 	s.Current.Add(1)
 }
 
+func (s *tableState) Add(n int64) {
+	if s == nil {
+		return
+	}
+	s.Current.Add(n)
+}
+
 func (s *tableState) Reset() {
 	if s == nil {
 		return
@@ -120,7 +131,7 @@ func (s *tableState) Complete() {
 	s.setStatus(statusDone)
 }
 
-// Called once the temp-table swap completes (or directly in -insert-ignore).
+// Called once the temp-table swap completes (or directly for direct writes).
 func (s *tableState) Finalize() {
 	if s == nil {
 		return
@@ -128,6 +139,27 @@ func (s *tableState) Finalize() {
 	s.setStatus(statusFinalized)
 }
 
+// Follow restarts the counts for the changes -follow applies.
+func (s *tableState) Follow() {
+	if s == nil {
+		return
+	}
+	s.Current.Store(0)
+	s.Total.Store(0)
+	s.StartedAt.Store(time.Now().UnixNano())
+	s.FinishedAt.Store(0)
+	s.setCause("")
+	s.setStatus(statusFollowing)
+}
+
+func (s *tableState) Applied(n int64, lag time.Duration) {
+	if s == nil {
+		return
+	}
+	s.Current.Add(n)
+	s.Lag.Store(int64(lag))
+}
+
 func (s *tableState) Fail(cause string) {
 	if s == nil {
 		return
@@ -146,6 +178,7 @@ type tableSnapshot struct {
 	startedAt  int64
 	finishedAt int64
 	cause      string
+	lag        time.Duration
 }
 
 func (s *tableState) snapshot() tableSnapshot {
@@ -162,6 +195,7 @@ func (s *tableState) snapshot() tableSnapshot {
 		startedAt:  s.StartedAt.Load(),
 		finishedAt: s.FinishedAt.Load(),
 		cause:      cause,
+		lag:        time.Duration(s.Lag.Load()),
 	}
 }
 
@@ -289,6 +323,10 @@ type ui struct {
 	completed   atomic.Bool
 	completedAt atomic.Int64
 
+	// -follow, once the copy is done: the stream's lag behind the source.
+	following atomic.Bool
+	lag       atomic.Int64
+
 	// SetTables vs render-tick. Workers only read after SetTables completes.
 	statesMu sync.RWMutex
 }
@@ -435,6 +473,20 @@ func (u *ui) MarkCompleted() {
 	u.completed.Store(true)
 }
 
+func (u *ui) SetFollowing() {
+	if u == nil {
+		return
+	}
+	u.following.Store(true)
+}
+
+func (u *ui) SetLag(d time.Duration) {
+	if u == nil {
+		return
+	}
+	u.lag.Store(int64(d))
+}
+
 func (u *ui) Stop() {
 	u.stopOnce.Do(func() {
 		u.app.Stop()
@@ -549,13 +601,15 @@ func (u *ui) renderHeader(snaps []tableSnapshot) {
 		current = "dev"
 	}
 
-	var done, finalized, retrying, running, pending, failed int
+	var done, finalized, following, retrying, running, pending, failed int
 	for _, s := range snaps {
 		switch s.status {
 		case statusDone:
 			done++
 		case statusFinalized:
 			finalized++
+		case statusFollowing:
+			following++
 		case statusRetrying:
 			retrying++
 		case statusRunning:
@@ -585,6 +639,9 @@ func (u *ui) renderHeader(snaps []tableSnapshot) {
 	case u.completed.Load():
 		line1 = centeredLine(termW, "green::b",
 			"Swoofed", len(snaps), "tables from", u.source, "to", destStr, "in", elapsed)
+	case u.following.Load():
+		line1 = centeredLine(termW, "gray",
+			"Following", len(snaps), "tables from", u.source, "to", destStr, "- lag:", renderLag(time.Duration(u.lag.Load())))
 	case len(snaps) == 0:
 		line1 = centeredLine(termW, "gray",
 			"Connecting to", u.source, "and resolving tables - Elapsed time:", elapsed)
@@ -606,6 +663,9 @@ func (u *ui) renderHeader(snaps []tableSnapshot) {
 		{done, "imported", "blue"},
 		{finalized, "done", "green"},
 	}
+	if following > 0 {
+		stats = append(stats, statItem{following, "following", "teal"})
+	}
 	if failed > 0 {
 		stats = append(stats, statItem{failed, "failed", "red"})
 	}
@@ -764,7 +824,7 @@ func statusAttrs(st tableStatus) string {
 }
 
 func renderPct(s tableSnapshot) string {
-	if s.status == statusDone || s.status == statusFinalized {
+	if s.status == statusDone || s.status == statusFinalized || s.status == statusFollowing {
 		return "100%"
 	}
 	if s.total <= 0 {
@@ -846,6 +906,7 @@ var logMessageColors = map[string]string{
 	"finalizing table imports...": "blue",
 	"table imports complete":      "green",
 	"finished importing tables":   "green",
+	"following binlog":            "teal",
 }
 
 // All raw text is tview.Escape'd so brackets in SQL errors don't trip the
@@ -899,6 +960,8 @@ func statusColor(s tableStatus) string {
 		return "blue"
 	case statusFinalized:
 		return "green"
+	case statusFollowing:
+		return "teal"
 	case statusFailed:
 		return "red"
 	}
@@ -917,10 +980,12 @@ func statusRank(s tableStatus) int {
 		return 3
 	case statusFinalized:
 		return 4
-	case statusFailed:
+	case statusFollowing:
 		return 5
+	case statusFailed:
+		return 6
 	}
-	return 6
+	return 7
 }
 
 func statusRune(s tableStatus) string {
@@ -932,6 +997,8 @@ func statusRune(s tableStatus) string {
 		return "↻"
 	case statusDone, statusFinalized:
 		return "✓"
+	case statusFollowing:
+		return "↓"
 	case statusFailed:
 		return "✗"
 	}
@@ -945,6 +1012,8 @@ func renderBar(s tableSnapshot, width int) string {
 	inner := width - 2
 	var filled int
 	switch {
+	case s.status == statusFollowing:
+		filled = inner
 	case s.total <= 0:
 		filled = 0
 	case s.status == statusDone, s.status == statusFinalized:
@@ -979,6 +1048,9 @@ func renderBar(s tableSnapshot, width int) string {
 }
 
 func renderCounts(s tableSnapshot) string {
+	if s.status == statusFollowing {
+		return formatShort(s.current) + " chg"
+	}
 	if s.total <= 0 && s.current <= 0 {
 		return "--"
 	}
@@ -1020,6 +1092,11 @@ func renderState(s tableSnapshot, now time.Time) string {
 			return "done " + time.Duration(s.finishedAt-s.startedAt).Round(time.Second).String()
 		}
 		return "done"
+	case statusFollowing:
+		if s.current == 0 {
+			return "following"
+		}
+		return "lag " + renderLag(s.lag)
 	case statusFailed:
 		if s.cause != "" {
 			return "failed: " + s.cause
@@ -1045,3 +1122,8 @@ func renderState(s tableSnapshot, now time.Time) string {
 	}
 	return ""
 }
+
+// Binlog timestamps are whole seconds, so lag is too.
+func renderLag(d time.Duration) string {
+	return d.Truncate(time.Second).String()
+}
@@ -10,7 +10,6 @@ import (
 	"strconv"
 	"strings"
 
-	mysql "github.com/StirlingMarketingGroup/cool-mysql"
 	mysqldriver "github.com/go-sql-driver/mysql"
 	"github.com/pkg/errors"
 )
@@ -72,6 +71,81 @@ func ensureLongSourceStream(dsn string) (string, error) {
 	return cfg.FormatDSN(), nil
 }
 
+// ensureSQLMode injects the source's sql_mode into a destination DSN's
+// params if the user hasn't set one, so values the source accepted, like
+// 0000-00-00 dates under a mode without NO_ZERO_DATE, are accepted the same
+// way on insert instead of rejected or rounded by the destination's own
+// default mode.
+func ensureSQLMode(dsn, mode string) (string, error) {
+	cfg, err := mysqldriver.ParseDSN(dsn)
+	if err != nil {
+		return "", fmt.Errorf("parse DSN: %w", err)
+	}
+	if _, ok := cfg.Params["sql_mode"]; ok {
+		return dsn, nil
+	}
+	if cfg.Params == nil {
+		cfg.Params = make(map[string]string)
+	}
+	cfg.Params["sql_mode"] = "'" + mode + "'"
+	return cfg.FormatDSN(), nil
+}
+
+// textTemporals turns off parseTime on a source DSN. With it on, the driver
+// hands dates back as time.Time, which can't hold zero dates and formats
+// the rest its own way; off, they come back exactly as the server prints
+// them, fractional seconds included.
+func textTemporals(dsn string) (string, error) {
+	cfg, err := mysqldriver.ParseDSN(dsn)
+	if err != nil {
+		return "", fmt.Errorf("parse DSN: %w", err)
+	}
+	if !cfg.ParseTime {
+		return dsn, nil
+	}
+	cfg.ParseTime = false
+	return cfg.FormatDSN(), nil
+}
+
+// splitConstraints cuts the foreign key constraints out of a SHOW CREATE
+// TABLE statement, returning the statement without them and the cut block
+// for addConstraints.
+func splitConstraints(create string) (string, string) {
+	constraintsStart := strings.Index(create, ",\n  CONSTRAINT ")
+	if constraintsStart == -1 {
+		return create, ""
+	}
+	// MySQL always gives constraints as a contiguous block, so locate
+	// the last one and treat everything between as the constraint block.
+	constraintsEnd := strings.LastIndex(create, ",\n  CONSTRAINT ")
+	constraintsEnd = constraintsEnd + strings.IndexByte(create[constraintsEnd+2:], '\n') + 2
+	return create[:constraintsStart] + create[constraintsEnd:], create[constraintsStart:constraintsEnd]
+}
+
+// addConstraints returns the statement that adds a block cut by
+// splitConstraints back onto table.
+func addConstraints(table, constraints string) string {
+	return "alter table`" + table + "`" + strings.ReplaceAll(strings.TrimLeft(constraints, ","), "\n", "\nadd")
+}
+
+// parseSize reads a size like 512MB, 1.5G or 4096, in powers of 1024.
+func parseSize(s string) (int64, error) {
+	num := strings.TrimSpace(s)
+	unit := strings.TrimLeft(num, "0123456789.")
+	num = num[:len(num)-len(unit)]
+	unit = strings.TrimSuffix(strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(unit)), "B"), "I")
+
+	shift, ok := map[string]uint{"": 0, "K": 10, "M": 20, "G": 30, "T": 40}[unit]
+	if !ok {
+		return 0, errors.Errorf("unknown unit in size %q", s)
+	}
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil || n < 0 {
+		return 0, errors.Errorf("invalid size %q", s)
+	}
+	return int64(n * float64(int64(1)<<shift)), nil
+}
+
 // formatShort renders counts the way dashboards do: under 1000 unchanged,
 // otherwise one decimal plus K / M / B / T. Hand-rolled instead of fmt.Sprintf
 // because the progress-bar decorators call this on every repaint for every
@@ -259,7 +333,7 @@ func isTransientError(err error) bool {
 }
 
 // appendTable appends to the table array, expanding glob-style wildcards when present.
-func appendTable(src *mysql.Database, t string, tables *[]string) {
+func appendTable(src tableCatalog, t string, tables *[]string) {
 	if strings.ContainsAny(t, "*?") {
 		appendPatternTables(src, t, tables)
 		return
@@ -269,18 +343,8 @@ func appendTable(src *mysql.Database, t string, tables *[]string) {
 	*tables = append(*tables, t)
 }
 
-func appendPatternTables(src *mysql.Database, pattern string, tables *[]string) {
-	likePattern := globToLike(pattern)
-
-	var matched []string
-	err := src.Select(&matched, "select`table_name`"+
-		"from`information_schema`.`TABLES`"+
-		"where`table_schema`=database()"+
-		"and`table_type`='BASE TABLE'"+
-		"and`table_name`like @@Pattern"+
-		" order by`table_name`", 0, mysql.Params{
-		"Pattern": likePattern,
-	})
+func appendPatternTables(src tableCatalog, pattern string, tables *[]string) {
+	matched, err := src.matchTables(pattern)
 	if err != nil {
 		panic(err)
 	}
@@ -311,3 +375,28 @@ func globToLike(pattern string) string {
 
 	return b.String()
 }
+
+// directWriteFlag names the flag that makes swoof write straight into the
+// real table instead of building a temp table and swapping it in, or returns
+// "" for a normal import.
+func directWriteFlag() string {
+	switch {
+	case *insertIgnoreInto:
+		return "-insert-ignore"
+	case *upsertInto:
+		return "-upsert"
+	case *replaceInto:
+		return "-replace"
+	}
+	return ""
+}
+
+func countTrue(bs ...bool) int {
+	n := 0
+	for _, b := range bs {
+		if b {
+			n++
+		}
+	}
+	return n
+}
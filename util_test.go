@@ -111,6 +111,97 @@ func TestEnsureLongSourceStream(t *testing.T) {
 	})
 }
 
+func TestEnsureSQLMode(t *testing.T) {
+	cases := []struct {
+		name          string
+		dsn           string
+		mode          string
+		wantMode      string
+		wantUnchanged bool
+	}{
+		{
+			name:     "injects on DSN with no params",
+			dsn:      "user:pass@tcp(host:3306)/db",
+			mode:     "NO_ENGINE_SUBSTITUTION,ALLOW_INVALID_DATES",
+			wantMode: "'NO_ENGINE_SUBSTITUTION,ALLOW_INVALID_DATES'",
+		},
+		{
+			name:     "injects an empty mode",
+			dsn:      "user:pass@tcp(host:3306)/db?parseTime=true",
+			wantMode: "''",
+		},
+		{
+			name:          "respects user-supplied sql_mode",
+			dsn:           "user:pass@tcp(host:3306)/db?sql_mode=%27TRADITIONAL%27",
+			mode:          "STRICT_TRANS_TABLES",
+			wantMode:      "'TRADITIONAL'",
+			wantUnchanged: true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := ensureSQLMode(c.dsn, c.mode)
+			if err != nil {
+				t.Fatalf("ensureSQLMode error: %v", err)
+			}
+			if c.wantUnchanged && got != c.dsn {
+				t.Errorf("DSN changed despite existing sql_mode: got %q, original %q", got, c.dsn)
+			}
+			cfg, err := mysqldriver.ParseDSN(got)
+			if err != nil {
+				t.Fatalf("result DSN did not parse: %v", err)
+			}
+			if cfg.Params["sql_mode"] != c.wantMode {
+				t.Errorf("sql_mode = %q, want %q", cfg.Params["sql_mode"], c.wantMode)
+			}
+		})
+	}
+}
+
+func TestTextTemporals(t *testing.T) {
+	got, err := textTemporals("user:pass@tcp(host:3306)/db?parseTime=true&loc=Local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := mysqldriver.ParseDSN(got)
+	if err != nil {
+		t.Fatalf("result DSN did not parse: %v", err)
+	}
+	if cfg.ParseTime {
+		t.Errorf("parseTime still on in %q", got)
+	}
+
+	const plain = "user:pass@tcp(host:3306)/db"
+	if got, _ := textTemporals(plain); got != plain {
+		t.Errorf("DSN without parseTime changed: got %q", got)
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+	}{
+		{"4096", 4096},
+		{"512MB", 512 << 20},
+		{"1.5G", 3 << 29},
+		{"2 GiB", 2 << 30},
+		{"64k", 64 << 10},
+		{"1TB", 1 << 40},
+	}
+	for _, tt := range tests {
+		got, err := parseSize(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("parseSize(%q) = %d, %v, want %d", tt.in, got, err, tt.want)
+		}
+	}
+	for _, in := range []string{"", "MB", "12 parsecs", "-1G"} {
+		if _, err := parseSize(in); err == nil {
+			t.Errorf("parseSize(%q) should fail", in)
+		}
+	}
+}
+
 func TestExtractErrorStack(t *testing.T) {
 	t.Run("empty on plain errors", func(t *testing.T) {
 		if got := extractErrorStack(stderrors.New("no stack here")); got != "" {
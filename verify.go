@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	mysql "github.com/StirlingMarketingGroup/cool-mysql"
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+)
+
+// Rows per checksummed range. Small enough that a mismatch points somewhere
+// useful, large enough that a big table isn't thousands of round trips.
+const verifyRangeRows = 100_000
+
+// Upper bound on ranges per table, so a sparse key space doesn't turn into
+// millions of mostly empty range queries.
+const verifyMaxRanges = 1_000
+
+type verifyTarget struct {
+	name string
+	db   *mysql.Database
+}
+
+// verifyMismatch is a key range whose row count or checksum differs between
+// the source and one destination.
+type verifyMismatch struct {
+	table   string
+	dest    string
+	rng     keyRange
+	srcRows int64
+	dstRows int64
+	srcSum  uint64
+	dstSum  uint64
+}
+
+func (m verifyMismatch) rangeString() string {
+	switch {
+	case m.rng.Low == "" && m.rng.High == "":
+		return "all rows"
+	case m.rng.Low == "":
+		return "<= " + m.rng.High
+	case m.rng.High == "":
+		return "> " + m.rng.Low
+	}
+	return "(" + m.rng.Low + ", " + m.rng.High + "]"
+}
+
+// verifySpec is how one table was copied, so it's compared the same way.
+type verifySpec struct {
+	table     string
+	destTable string
+	where     string
+
+	// Reports columns that differ by design, masked or left out of the
+	// copy, which are left out of the checksums.
+	skip func(column string) bool
+}
+
+type rangeChecksum struct {
+	Rows     int64  `mysql:"Rows"`
+	Checksum uint64 `mysql:"Checksum"`
+}
+
+// checksumExpr folds every row into an order-independent checksum. concat_ws
+// skips NULLs, so a trailing run of isnull flags keeps NULL and empty strings
+// apart, and keeps a NULL from shifting its neighbors into each other.
+func checksumExpr(columns []string) string {
+	quoted := make([]string, len(columns))
+	nulls := make([]string, len(columns))
+	for i, c := range columns {
+		quoted[i] = "`" + c + "`"
+		nulls[i] = "isnull(`" + c + "`)"
+	}
+	return "coalesce(bit_xor(crc32(concat_ws('#'," + strings.Join(quoted, ",") +
+		",concat(" + strings.Join(nulls, ",") + ")))),0)"
+}
+
+// verifyRangeCount sizes ranges by the source's row count rather than its key
+// span, since keys can be arbitrarily sparse.
+func verifyRangeCount(rows int64) int {
+	n := (rows + verifyRangeRows - 1) / verifyRangeRows
+	return int(max(1, min(n, verifyMaxRanges)))
+}
+
+// verifyTables compares every table between the source and each target,
+// running up to threads tables at once. Query failures are returned as
+// errors; differences in data are returned as mismatches.
+func verifyTables(ctx context.Context, src *mysql.Database, targets []verifyTarget, tables []verifySpec, threads int) ([]verifyMismatch, error) {
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(threads)
+
+	results := make([][]verifyMismatch, len(tables))
+	for i, table := range tables {
+		g.Go(func() error {
+			m, err := verifyTable(ctx, src, targets, table)
+			if err != nil {
+				return errors.Wrapf(err, "verify %q", table.table)
+			}
+			results[i] = m
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	var mismatches []verifyMismatch
+	for _, m := range results {
+		mismatches = append(mismatches, m...)
+	}
+	return mismatches, nil
+}
+
+func verifyTable(ctx context.Context, src *mysql.Database, targets []verifyTarget, spec verifySpec) ([]verifyMismatch, error) {
+	table, where := spec.table, spec.where
+	var columns []struct {
+		ColumnName           string `mysql:"COLUMN_NAME"`
+		DataType             string `mysql:"DATA_TYPE"`
+		ColumnType           string `mysql:"COLUMN_TYPE"`
+		ColumnKey            string `mysql:"COLUMN_KEY"`
+		GenerationExpression string `mysql:"GENERATION_EXPRESSION"`
+	}
+	if err := src.SelectContext(ctx, &columns, "select*"+
+		"from`INFORMATION_SCHEMA`.`columns`"+
+		"where`TABLE_SCHEMA`=database()"+
+		"and`table_name`='"+table+"'"+
+		"order by`ORDINAL_POSITION`", 0); err != nil {
+		return nil, errors.Wrap(err, "select columns")
+	}
+
+	var names []string
+	var skippedColumns int
+	var pkName string
+	var pkUnsigned, pkSkipped bool
+	pkColumns := 0
+	for _, c := range columns {
+		// Generated columns aren't copied, the destination computes its own.
+		if len(c.GenerationExpression) != 0 {
+			continue
+		}
+		skipped := spec.skip != nil && spec.skip(c.ColumnName)
+		if skipped {
+			skippedColumns++
+		} else {
+			names = append(names, c.ColumnName)
+		}
+		if c.ColumnKey == "PRI" {
+			pkColumns++
+			if skipped {
+				// The destination's keys don't line up with the source's,
+				// so the table is compared in one range.
+				pkSkipped = true
+			}
+			switch c.DataType {
+			case "tinyint", "smallint", "mediumint", "int", "bigint":
+				pkName, pkUnsigned = c.ColumnName, strings.HasSuffix(c.ColumnType, "unsigned")
+			}
+		}
+	}
+	if len(names) == 0 && skippedColumns == 0 {
+		return nil, errors.New("no columns to compare")
+	}
+	if pkColumns != 1 || pkSkipped {
+		pkName = ""
+	}
+
+	var filter []string
+	if where != "" {
+		filter = append(filter, "("+where+")")
+	}
+	whereOf := func(conds []string) string {
+		if len(conds) == 0 {
+			return ""
+		}
+		return " where " + strings.Join(conds, " and ")
+	}
+
+	ranges := []keyRange{{}}
+	if pkName != "" {
+		var bounds struct {
+			Rows int64   `mysql:"Rows"`
+			Min  *string `mysql:"Min"`
+			Max  *string `mysql:"Max"`
+		}
+		if err := src.SelectContext(ctx, &bounds, "select count(*)`Rows`,"+
+			"min(`"+pkName+"`)`Min`,max(`"+pkName+"`)`Max`"+
+			"from`"+table+"`"+whereOf(filter), 0); err != nil {
+			return nil, errors.Wrap(err, "select key bounds")
+		}
+		lo, hi, ok, err := parseKeyBounds(bounds.Min, bounds.Max, pkUnsigned)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			ranges = splitKeyRange(lo, hi, verifyRangeCount(bounds.Rows))
+		}
+	}
+
+	// With every column skipped there's nothing to checksum but the counts.
+	expr := "0"
+	if len(names) != 0 {
+		expr = checksumExpr(names)
+	}
+	var mismatches []verifyMismatch
+	for _, r := range ranges {
+		q := func(table string) string {
+			return "select count(*)`Rows`," + expr + "`Checksum`from`" + table + "`" +
+				whereOf(append(r.conds(pkName), filter...))
+		}
+
+		// The source and every destination read the range at once, so a
+		// table being written to between them shows up as little as possible.
+		sums := make([]rangeChecksum, len(targets)+1)
+		g, gctx := errgroup.WithContext(ctx)
+		g.Go(func() error {
+			return errors.Wrap(src.SelectContext(gctx, &sums[0], q(table), 0), "checksum source")
+		})
+		for i, t := range targets {
+			g.Go(func() error {
+				return errors.Wrapf(t.db.SelectContext(gctx, &sums[i+1], q(spec.destTable), 0), "checksum %s", t.name)
+			})
+		}
+		if err := g.Wait(); err != nil {
+			return nil, err
+		}
+
+		for i, t := range targets {
+			d := sums[i+1]
+			if d == sums[0] {
+				continue
+			}
+			m := verifyMismatch{
+				table:   table,
+				dest:    t.name,
+				rng:     r,
+				srcRows: sums[0].Rows,
+				dstRows: d.Rows,
+				srcSum:  sums[0].Checksum,
+				dstSum:  d.Checksum,
+			}
+			slog.Error("verification mismatch",
+				"tableName", table,
+				"destination", t.name,
+				"range", m.rangeString(),
+				"sourceRows", m.srcRows,
+				"destinationRows", m.dstRows,
+				"sourceChecksum", fmt.Sprintf("%08x", m.srcSum),
+				"destinationChecksum", fmt.Sprintf("%08x", m.dstSum))
+			mismatches = append(mismatches, m)
+		}
+	}
+
+	if len(mismatches) == 0 {
+		slog.Info("verified table", "tableName", table, "ranges", len(ranges))
+	}
+	return mismatches, nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import "testing"
+
+func TestChecksumExpr(t *testing.T) {
+	got := checksumExpr([]string{"id", "name"})
+	want := "coalesce(bit_xor(crc32(concat_ws('#',`id`,`name`,concat(isnull(`id`),isnull(`name`))))),0)"
+	if got != want {
+		t.Errorf("checksumExpr = %s, want %s", got, want)
+	}
+}
+
+func TestVerifyRangeCount(t *testing.T) {
+	tests := []struct {
+		rows int64
+		want int
+	}{
+		{0, 1},
+		{1, 1},
+		{verifyRangeRows, 1},
+		{verifyRangeRows + 1, 2},
+		{verifyRangeRows * verifyMaxRanges * 10, verifyMaxRanges},
+	}
+	for _, tt := range tests {
+		if got := verifyRangeCount(tt.rows); got != tt.want {
+			t.Errorf("verifyRangeCount(%d) = %d, want %d", tt.rows, got, tt.want)
+		}
+	}
+}
+
+func TestVerifyMismatchRangeString(t *testing.T) {
+	tests := []struct {
+		r    keyRange
+		want string
+	}{
+		{keyRange{}, "all rows"},
+		{keyRange{High: "10"}, "<= 10"},
+		{keyRange{Low: "10"}, "> 10"},
+		{keyRange{Low: "10", High: "20"}, "(10, 20]"},
+	}
+	for _, tt := range tests {
+		if got := (verifyMismatch{rng: tt.r}).rangeString(); got != tt.want {
+			t.Errorf("rangeString(%+v) = %q, want %q", tt.r, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// watermarks records, per destination, the highest value of an -incremental
+// column that has been copied. The next run upserts rows at or above it
+// straight into the real table instead of rebuilding through a temp table.
+type watermarks struct {
+	Source string `json:"source"`
+	Table  string `json:"table"`
+	Column string `json:"column"`
+
+	// The filter the rows were selected with. Rows a different -w excluded
+	// were never copied, no matter how old they are.
+	Where string `json:"where,omitempty"`
+
+	Destinations map[string]string `json:"destinations"`
+	UpdatedAt    time.Time         `json:"updated_at"`
+}
+
+func watermarkDir() string {
+	return filepath.Join(confDir, "swoof", "watermarks")
+}
+
+func watermarkPath(source, table, column string) string {
+	return stateFilePath(watermarkDir(), table, source+"\x00"+table+"\x00"+column)
+}
+
+// loadWatermarks returns nil without an error when the table has never been
+// copied with this column.
+func loadWatermarks(path string) (*watermarks, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "read watermarks %q", path)
+	}
+	var w watermarks
+	if err := json.Unmarshal(b, &w); err != nil {
+		return nil, errors.Wrapf(err, "parse watermarks %q", path)
+	}
+	return &w, nil
+}
+
+func (w *watermarks) save(path string) error {
+	w.UpdatedAt = time.Now()
+	return saveStateFile(path, w)
+}
+
+// since returns the lowest watermark across destKeys, the point an upsert
+// has to start from to bring every destination up to date. ok is false when
+// any destination has never been fully copied, or was copied under a
+// different filter, so the table has to be rebuilt.
+func (w *watermarks) since(destKeys []string, where string) (string, bool) {
+	if w == nil || w.Where != where || len(destKeys) == 0 {
+		return "", false
+	}
+	var lowest string
+	for i, k := range destKeys {
+		v, ok := w.Destinations[k]
+		if !ok {
+			return "", false
+		}
+		if i == 0 || watermarkLess(v, lowest) {
+			lowest = v
+		}
+	}
+	return lowest, true
+}
+
+// set records v for every destination, keeping entries for destinations
+// that weren't part of this run.
+func (w *watermarks) set(destKeys []string, v string) {
+	if w.Destinations == nil {
+		w.Destinations = make(map[string]string, len(destKeys))
+	}
+	for _, k := range destKeys {
+		w.Destinations[k] = v
+	}
+}
+
+// watermarkLess compares two values mysql rendered as text. Numbers compare
+// numerically; dates and datetimes come back in a fixed-width format that
+// already sorts correctly as a string.
+func watermarkLess(a, b string) bool {
+	ai, aErr := strconv.ParseInt(a, 10, 64)
+	bi, bErr := strconv.ParseInt(b, 10, 64)
+	if aErr == nil && bErr == nil {
+		return ai < bi
+	}
+	au, aErr := strconv.ParseUint(a, 10, 64)
+	bu, bErr := strconv.ParseUint(b, 10, 64)
+	if aErr == nil && bErr == nil {
+		return au < bu
+	}
+	af, aErr := strconv.ParseFloat(a, 64)
+	bf, bErr := strconv.ParseFloat(b, 64)
+	if aErr == nil && bErr == nil {
+		return af < bf
+	}
+	return a < b
+}
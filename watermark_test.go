@@ -0,0 +1,82 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestWatermarkLess(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"9", "10", true},
+		{"-10", "9", true},
+		{"18446744073709551615", "9", false},
+		{"9.5", "10.25", true},
+		{"2025-01-02 00:00:00", "2025-01-10 00:00:00", true},
+		{"2025-01-02 00:00:00", "2025-01-02 00:00:00.5", true},
+		{"2025-01-10", "2025-01-02", false},
+	}
+	for _, tt := range tests {
+		if got := watermarkLess(tt.a, tt.b); got != tt.want {
+			t.Errorf("watermarkLess(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestWatermarksSince(t *testing.T) {
+	w := &watermarks{
+		Where: "Active",
+		Destinations: map[string]string{
+			"a": "120",
+			"b": "99",
+		},
+	}
+	if got, ok := w.since([]string{"a", "b"}, "Active"); !ok || got != "99" {
+		t.Errorf("since = %q, %v, want the lowest, 99", got, ok)
+	}
+	if _, ok := w.since([]string{"a", "c"}, "Active"); ok {
+		t.Error("a destination without a watermark should force a rebuild")
+	}
+	if _, ok := w.since([]string{"a"}, ""); ok {
+		t.Error("a different -w should force a rebuild")
+	}
+	var missing *watermarks
+	if _, ok := missing.since([]string{"a"}, ""); ok {
+		t.Error("no watermarks should force a rebuild")
+	}
+
+	w.set([]string{"b", "c"}, "150")
+	if w.Destinations["a"] != "120" || w.Destinations["b"] != "150" || w.Destinations["c"] != "150" {
+		t.Errorf("set = %v, want b and c moved and a kept", w.Destinations)
+	}
+}
+
+func TestWatermarksSaveLoad(t *testing.T) {
+	path := watermarkPath("root@prod:3306/app", "orders", "UpdatedAt")
+	if filepath.Dir(path) != watermarkDir() {
+		t.Errorf("watermarkPath = %q, want it under %q", path, watermarkDir())
+	}
+	if other := watermarkPath("root@prod:3306/app", "orders", "OrderID"); other == path {
+		t.Error("different columns should get different watermark files")
+	}
+
+	path = filepath.Join(t.TempDir(), "orders.json")
+	got, err := loadWatermarks(path)
+	if err != nil || got != nil {
+		t.Fatalf("loadWatermarks on a missing file = %v, %v, want nil, nil", got, err)
+	}
+	w := &watermarks{Source: "root@prod:3306/app", Table: "orders", Column: "UpdatedAt"}
+	w.set([]string{"root@localhost:3306/app"}, "2025-06-01 12:00:00")
+	if err := w.save(path); err != nil {
+		t.Fatal(err)
+	}
+	got, err = loadWatermarks(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Column != "UpdatedAt" || got.Destinations["root@localhost:3306/app"] != "2025-06-01 12:00:00" {
+		t.Errorf("round trip = %+v", got)
+	}
+}